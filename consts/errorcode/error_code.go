@@ -1,10 +1,11 @@
 package errorcode
 
 const (
-	OK              = "OK"
-	OperationFailed = "OperationFailed"
-	DataNotFound    = "DataNotFound"
-	DataExists      = "DataExists"
-	BadArgument     = "BadArgument"
-	TaskNotFound    = "TaskNotFound"
+	OK                 = "OK"
+	OperationFailed    = "OperationFailed"
+	DataNotFound       = "DataNotFound"
+	DataExists         = "DataExists"
+	BadArgument        = "BadArgument"
+	TaskNotFound       = "TaskNotFound"
+	PreconditionFailed = "PreconditionFailed"
 )
@@ -0,0 +1,200 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Worker因为负载过高而拒绝执行计划。PlanRejectedError可以通过errors.Is与它匹配，
+// 实现WorkerClient时，如果错误经过RPC传输后丢失了类型，需要自行转换回这个错误。
+var ErrPlanRejected = errors.New("plan rejected by worker")
+
+// Worker因为负载过高而拒绝执行计划时返回的错误。调用者可以稍后重试。
+type PlanRejectedError struct {
+	Reason string
+}
+
+func (e *PlanRejectedError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrPlanRejected, e.Reason)
+}
+
+func (e *PlanRejectedError) Unwrap() error {
+	return ErrPlanRejected
+}
+
+// 判断错误是否是因为Worker负载过高而拒绝执行计划，等同于errors.Is(err, ErrPlanRejected)
+func IsPlanRejected(err error) bool {
+	return errors.Is(err, ErrPlanRejected)
+}
+
+// 指令可以实现此接口来报告自己执行时大概会占用的缓冲区内存，用于Worker的准入控制。
+// 只有自己持有缓冲区的指令（比如FanOut、加解密、压缩）需要实现，其他指令只是传递流，不会占用额外的内存。
+type MemoryEstimator interface {
+	EstimateMemory() int64
+}
+
+// 估计计划执行时占用的缓冲区内存，只会统计实现了MemoryEstimator接口的指令，其他指令视为0。
+// 因此只包含普通指令的计划估计值为0，此时MaxMemory不会限制它们，只能通过MaxPlans限制。
+func EstimatePlanMemory(plan Plan) int64 {
+	var total int64
+	for _, op := range plan.Ops {
+		if est, ok := op.(MemoryEstimator); ok {
+			total += est.EstimateMemory()
+		}
+	}
+	return total
+}
+
+type AdmissionConfig struct {
+	MaxPlans     int           `json:"maxPlans"`     // 最多同时执行的计划数，为0则不限制
+	MaxMemory    int64         `json:"maxMemory"`    // 同时执行的计划估计占用的内存之和的上限，为0则不限制。估计方式见EstimatePlanMemory
+	MaxQueueLen  int           `json:"maxQueueLen"`  // 最多有多少个计划排队等待，为0则不限制
+	QueueTimeout time.Duration `json:"queueTimeout"` // 计划排队等待的最长时间，超时后拒绝执行。为0则不排队，无法立刻执行时直接拒绝
+}
+
+type admissionWaiter struct {
+	memory   int64
+	admitted chan any
+}
+
+// 对Worker上执行的计划进行准入控制。等待的计划按先后顺序执行，避免占用内存大的计划一直无法执行。
+type admission struct {
+	lock    sync.Mutex
+	cfg     AdmissionConfig
+	running int
+	memory  int64
+	waiters []*admissionWaiter
+}
+
+func (a *admission) SetConfig(cfg AdmissionConfig) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.cfg = cfg
+	a.dispatch()
+}
+
+func (a *admission) Stats() (running int, memory int64, queued int) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.running, a.memory, len(a.waiters)
+}
+
+// 申请执行一个估计占用memory字节内存的计划，成功时返回一个用于释放资源的函数，该函数只能调用一次。
+func (a *admission) Admit(ctx context.Context, memory int64) (func(), error) {
+	a.lock.Lock()
+
+	if len(a.waiters) == 0 && a.canRun(memory) {
+		a.run(memory)
+		a.lock.Unlock()
+		return a.releaseFunc(memory), nil
+	}
+
+	if a.cfg.QueueTimeout <= 0 {
+		a.lock.Unlock()
+		return nil, &PlanRejectedError{Reason: "worker is busy"}
+	}
+
+	if a.cfg.MaxQueueLen > 0 && len(a.waiters) >= a.cfg.MaxQueueLen {
+		a.lock.Unlock()
+		return nil, &PlanRejectedError{Reason: "queue is full"}
+	}
+
+	w := &admissionWaiter{
+		memory:   memory,
+		admitted: make(chan any),
+	}
+	a.waiters = append(a.waiters, w)
+	timeout := a.cfg.QueueTimeout
+	a.lock.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-w.admitted:
+		return a.releaseFunc(memory), nil
+	case <-timer.C:
+		err = &PlanRejectedError{Reason: fmt.Sprintf("waited in queue for %v", timeout)}
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	// 可能在超时的同时被允许执行了，此时需要释放资源
+	select {
+	case <-w.admitted:
+		a.release(memory)
+	default:
+		for i, ww := range a.waiters {
+			if ww == w {
+				a.waiters = append(a.waiters[:i], a.waiters[i+1:]...)
+				break
+			}
+		}
+		// 队头的计划被移除后，后面的计划可能可以执行了
+		a.dispatch()
+	}
+
+	return nil, err
+}
+
+func (a *admission) canRun(memory int64) bool {
+	// 没有正在执行的计划时总是可以执行，否则超过内存限制的计划永远不能执行
+	if a.running == 0 {
+		return true
+	}
+
+	if a.cfg.MaxPlans > 0 && a.running >= a.cfg.MaxPlans {
+		return false
+	}
+
+	if a.cfg.MaxMemory > 0 && a.memory+memory > a.cfg.MaxMemory {
+		return false
+	}
+
+	return true
+}
+
+func (a *admission) run(memory int64) {
+	a.running++
+	a.memory += memory
+}
+
+func (a *admission) releaseFunc(memory int64) func() {
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			a.lock.Lock()
+			defer a.lock.Unlock()
+
+			a.release(memory)
+		})
+	}
+}
+
+func (a *admission) release(memory int64) {
+	a.running--
+	a.memory -= memory
+	a.dispatch()
+}
+
+func (a *admission) dispatch() {
+	for len(a.waiters) > 0 {
+		w := a.waiters[0]
+		if !a.canRun(w.memory) {
+			return
+		}
+
+		a.run(w.memory)
+		close(w.admitted)
+		a.waiters = a.waiters[1:]
+	}
+}
@@ -0,0 +1,210 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testMemoryOp struct {
+	memory int64
+}
+
+func (o *testMemoryOp) Execute(ctx *ExecContext, e *Executor) error {
+	return nil
+}
+
+func (o *testMemoryOp) EstimateMemory() int64 {
+	return o.memory
+}
+
+func (o *testMemoryOp) String() string {
+	return "TestMemoryOp"
+}
+
+type testPlainOp struct{}
+
+func (o *testPlainOp) Execute(ctx *ExecContext, e *Executor) error {
+	return nil
+}
+
+func (o *testPlainOp) String() string {
+	return "TestPlainOp"
+}
+
+func Test_Admission(t *testing.T) {
+	ctx := context.Background()
+
+	type admitRet struct {
+		release func()
+		err     error
+	}
+
+	// 在后台申请执行，并等待它进入队列
+	admitAsync := func(a *admission, memory int64) chan admitRet {
+		_, _, queued := a.Stats()
+
+		ch := make(chan admitRet, 1)
+		go func() {
+			release, err := a.Admit(ctx, memory)
+			ch <- admitRet{release, err}
+		}()
+
+		for {
+			_, _, q := a.Stats()
+			if q > queued {
+				return ch
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	isWaiting := func(ch chan admitRet) bool {
+		select {
+		case <-ch:
+			return false
+		case <-time.After(20 * time.Millisecond):
+			return true
+		}
+	}
+
+	Convey("不排队时，超过限制直接拒绝", t, func() {
+		a := &admission{}
+		a.SetConfig(AdmissionConfig{MaxPlans: 1})
+
+		release, err := a.Admit(ctx, 0)
+		So(err, ShouldBeNil)
+
+		_, err = a.Admit(ctx, 0)
+		So(errors.Is(err, ErrPlanRejected), ShouldBeTrue)
+		So(IsPlanRejected(fmt.Errorf("worker 1: %w", err)), ShouldBeTrue)
+
+		var rejected *PlanRejectedError
+		So(errors.As(err, &rejected), ShouldBeTrue)
+		So(rejected.Reason, ShouldEqual, "worker is busy")
+
+		release()
+		// 重复调用不会重复释放
+		release()
+		running, _, _ := a.Stats()
+		So(running, ShouldEqual, 0)
+
+		release, err = a.Admit(ctx, 0)
+		So(err, ShouldBeNil)
+		release()
+	})
+
+	Convey("只有错误信息相同的错误不会被视为拒绝", t, func() {
+		So(IsPlanRejected(errors.New(ErrPlanRejected.Error())), ShouldBeFalse)
+		So(IsPlanRejected(nil), ShouldBeFalse)
+	})
+
+	Convey("按先后顺序执行排队的计划", t, func() {
+		a := &admission{}
+		a.SetConfig(AdmissionConfig{MaxMemory: 100, QueueTimeout: time.Minute})
+
+		release1, err := a.Admit(ctx, 60)
+		So(err, ShouldBeNil)
+
+		// 内存不足，需要排队
+		ch2 := admitAsync(a, 50)
+		// 内存足够，但前面有计划在排队，也需要排队
+		ch3 := admitAsync(a, 10)
+		So(isWaiting(ch2), ShouldBeTrue)
+		So(isWaiting(ch3), ShouldBeTrue)
+
+		release1()
+		ret2 := <-ch2
+		So(ret2.err, ShouldBeNil)
+		ret3 := <-ch3
+		So(ret3.err, ShouldBeNil)
+
+		running, memory, queued := a.Stats()
+		So(running, ShouldEqual, 2)
+		So(memory, ShouldEqual, 60)
+		So(queued, ShouldEqual, 0)
+
+		ret2.release()
+		ret3.release()
+		running, memory, _ = a.Stats()
+		So(running, ShouldEqual, 0)
+		So(memory, ShouldEqual, 0)
+	})
+
+	Convey("超过内存限制的计划在没有其他计划执行时也可以执行", t, func() {
+		a := &admission{}
+		a.SetConfig(AdmissionConfig{MaxMemory: 100})
+
+		release, err := a.Admit(ctx, 1000)
+		So(err, ShouldBeNil)
+		release()
+	})
+
+	Convey("队列已满、排队超时与取消", t, func() {
+		a := &admission{}
+		a.SetConfig(AdmissionConfig{MaxPlans: 1, MaxQueueLen: 1, QueueTimeout: 50 * time.Millisecond})
+
+		release, err := a.Admit(ctx, 0)
+		So(err, ShouldBeNil)
+		defer release()
+
+		ch := admitAsync(a, 0)
+		_, err = a.Admit(ctx, 0)
+		So(IsPlanRejected(err), ShouldBeTrue)
+		So(err.Error(), ShouldContainSubstring, "queue is full")
+
+		ret := <-ch
+		So(IsPlanRejected(ret.err), ShouldBeTrue)
+		So(ret.err.Error(), ShouldContainSubstring, "waited in queue")
+		_, _, queued := a.Stats()
+		So(queued, ShouldEqual, 0)
+
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err = a.Admit(cctx, 0)
+		So(errors.Is(err, context.Canceled), ShouldBeTrue)
+		So(IsPlanRejected(err), ShouldBeFalse)
+	})
+
+	Convey("放宽限制后执行排队的计划", t, func() {
+		a := &admission{}
+		a.SetConfig(AdmissionConfig{MaxPlans: 1, QueueTimeout: time.Minute})
+
+		release, err := a.Admit(ctx, 0)
+		So(err, ShouldBeNil)
+		defer release()
+
+		ch := admitAsync(a, 0)
+		a.SetConfig(AdmissionConfig{MaxPlans: 2, QueueTimeout: time.Minute})
+		ret := <-ch
+		So(ret.err, ShouldBeNil)
+		ret.release()
+	})
+
+	Convey("根据指令估计计划的内存", t, func() {
+		plan := Plan{Ops: []Op{&testMemoryOp{memory: 10}, &testPlainOp{}, &testMemoryOp{memory: 5}}}
+		So(EstimatePlanMemory(plan), ShouldEqual, 15)
+
+		w := NewWorker()
+		w.SetAdmission(AdmissionConfig{MaxMemory: 20})
+
+		release, err := w.Admit(ctx, plan)
+		So(err, ShouldBeNil)
+		defer release()
+
+		_, memory, _ := w.AdmissionStats()
+		So(memory, ShouldEqual, 15)
+
+		_, err = w.Admit(ctx, plan)
+		So(IsPlanRejected(err), ShouldBeTrue)
+
+		// 没有估计值的指令不占用内存
+		release2, err := w.Admit(ctx, Plan{Ops: []Op{&testPlainOp{}}})
+		So(err, ShouldBeNil)
+		release2()
+	})
+}
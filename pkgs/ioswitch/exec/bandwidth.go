@@ -0,0 +1,86 @@
+package exec
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"gitlink.org.cn/cloudream/common/utils/io2"
+	"gitlink.org.cn/cloudream/common/utils/sync2"
+)
+
+// 一个Worker上所有的带宽预算，每个预算有一个名称，对应一个令牌桶。
+// 同一个Worker上执行的所有Plan应该共享同一个BandwidthBudgets，通过SetValueByType放入ExecContext中即可被指令使用。
+// 使用同一个预算的多个Plan之间会公平地分配带宽。
+type BandwidthBudgets struct {
+	lock    sync.Mutex
+	buckets map[string]*sync2.TokenBucket
+}
+
+func NewBandwidthBudgets() *BandwidthBudgets {
+	return &BandwidthBudgets{
+		buckets: make(map[string]*sync2.TokenBucket),
+	}
+}
+
+// 设置一个预算的带宽限制，单位为字节每秒。如果bytesPerSec为0，则代表不限制。burst为0时等于bytesPerSec。
+func (b *BandwidthBudgets) Set(name string, bytesPerSec int64, burst int64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	bkt, ok := b.buckets[name]
+	if ok {
+		bkt.SetLimit(bytesPerSec, burst)
+		return
+	}
+
+	b.buckets[name] = sync2.NewTokenBucket(bytesPerSec, burst)
+}
+
+func (b *BandwidthBudgets) Remove(name string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	bkt, ok := b.buckets[name]
+	if !ok {
+		return
+	}
+
+	// 正在使用这个预算的流不再限速
+	bkt.SetLimit(0, 0)
+	delete(b.buckets, name)
+}
+
+// 如果不存在，则返回nil
+func (b *BandwidthBudgets) Get(name string) *sync2.TokenBucket {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.buckets[name]
+}
+
+// 让流的读取受指定预算的限制。如果预算不存在，则返回原始的流。
+func (b *BandwidthBudgets) Throttle(ctx context.Context, planID PlanID, name string, str io.ReadCloser) io.ReadCloser {
+	bkt := b.Get(name)
+	if bkt == nil {
+		return str
+	}
+
+	return io2.Throttle(str, func(n int) error {
+		return bkt.Acquire(ctx, planID, int64(n))
+	})
+}
+
+// 如果ExecContext中设置了BandwidthBudgets，且name不为空，则让流受到对应预算的限制，否则返回原始的流。
+func ThrottleByBudget(ctx *ExecContext, planID PlanID, name string, str io.ReadCloser) io.ReadCloser {
+	if name == "" {
+		return str
+	}
+
+	budgets, err := GetValueByType[*BandwidthBudgets](ctx)
+	if err != nil {
+		return str
+	}
+
+	return budgets.Throttle(ctx.Context, planID, name, str)
+}
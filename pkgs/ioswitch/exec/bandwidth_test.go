@@ -0,0 +1,73 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_BandwidthBudgets(t *testing.T) {
+	ctx := context.Background()
+
+	Convey("使用预算限制流的速度", t, func() {
+		budgets := NewBandwidthBudgets()
+		budgets.Set("net", 10*1024, 1024)
+
+		data := make([]byte, 4*1024)
+		str := budgets.Throttle(ctx, "plan", "net", io.NopCloser(bytes.NewReader(data)))
+
+		start := time.Now()
+		got, err := io.ReadAll(str)
+		So(err, ShouldBeNil)
+		So(got, ShouldResemble, data)
+		So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 250*time.Millisecond)
+	})
+
+	Convey("修改与删除预算", t, func() {
+		budgets := NewBandwidthBudgets()
+		budgets.Set("net", 1024, 0)
+		budgets.Set("net", 2048, 0)
+
+		rate, burst := budgets.Get("net").Limit()
+		So(rate, ShouldEqual, 2048)
+		So(burst, ShouldEqual, 2048)
+
+		str := budgets.Throttle(ctx, "plan", "net", io.NopCloser(bytes.NewReader(make([]byte, 1024*1024))))
+		budgets.Remove("net")
+		So(budgets.Get("net"), ShouldBeNil)
+
+		// 删除之后正在使用的流也不再限速
+		start := time.Now()
+		_, err := io.ReadAll(str)
+		So(err, ShouldBeNil)
+		So(time.Since(start), ShouldBeLessThan, time.Second)
+	})
+
+	Convey("预算不存在时不限速", t, func() {
+		budgets := NewBandwidthBudgets()
+		str := io.NopCloser(bytes.NewReader(nil))
+		So(budgets.Throttle(ctx, "plan", "none", str) == str, ShouldBeTrue)
+
+		ectx := NewExecContext()
+		So(ThrottleByBudget(ectx, "plan", "net", str) == str, ShouldBeTrue)
+
+		SetValueByType(ectx, budgets)
+		So(ThrottleByBudget(ectx, "plan", "", str) == str, ShouldBeTrue)
+	})
+
+	Convey("取消时返回错误", t, func() {
+		budgets := NewBandwidthBudgets()
+		budgets.Set("net", 1024, 1024)
+
+		cctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		str := budgets.Throttle(cctx, "plan", "net", io.NopCloser(bytes.NewReader(make([]byte, 10*1024))))
+		_, err := io.ReadAll(str)
+		So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+	})
+}
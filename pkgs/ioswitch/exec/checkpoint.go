@@ -0,0 +1,83 @@
+package exec
+
+import (
+	"io"
+)
+
+// 计划的执行进度，可以序列化后保存下来，在计划失败后用于恢复执行，跳过已经完成的部分。
+//
+// 检查点由名称区分，在重新生成计划时，同名的检查点应该代表同样的工作。
+type PlanState struct {
+	Completed map[string]bool     `json:"completed"` // 已经完成的检查点
+	Offsets   map[string]int64    `json:"offsets"`   // 流已经读取完成的字节数
+	Values    map[string]VarValue `json:"values"`    // 完成检查点时得到的值，恢复执行时会代替原本的计算结果
+}
+
+func NewPlanState() *PlanState {
+	return &PlanState{
+		Completed: make(map[string]bool),
+		Offsets:   make(map[string]int64),
+		Values:    make(map[string]VarValue),
+	}
+}
+
+func (s *PlanState) Clone() *PlanState {
+	n := NewPlanState()
+	for k, v := range s.Completed {
+		n.Completed[k] = v
+	}
+	for k, v := range s.Offsets {
+		n.Offsets[k] = v
+	}
+	for k, v := range s.Values {
+		n.Values[k] = v.Clone()
+	}
+	return n
+}
+
+func (s *PlanState) IsCompleted(key string) bool {
+	return s.Completed[key]
+}
+
+func (s *PlanState) Offset(key string) int64 {
+	return s.Offsets[key]
+}
+
+func (s *PlanState) Value(key string) (VarValue, bool) {
+	v, ok := s.Values[key]
+	return v, ok
+}
+
+// 记录检查点。Driver实现了这个接口，并且会在执行计划时将自己放入ExecContext中
+type CheckpointRecorder interface {
+	RecordCheckpoint(key string, value VarValue)
+}
+
+// 根据执行进度重新生成计划
+type PlanRebuilder func(state *PlanState) (*PlanBuilder, error)
+
+// 统计Driver读取的流的字节数，作为检查点的偏移量
+type checkpointReader struct {
+	inner  io.ReadCloser
+	key    string
+	offset int64
+	driver *Driver
+}
+
+func (r *checkpointReader) Read(p []byte) (int, error) {
+	n, err := r.inner.Read(p)
+	r.offset += int64(n)
+
+	r.driver.stateLock.Lock()
+	r.driver.state.Offsets[r.key] = r.offset
+	if err == io.EOF {
+		r.driver.state.Completed[r.key] = true
+	}
+	r.driver.stateLock.Unlock()
+
+	return n, err
+}
+
+func (r *checkpointReader) Close() error {
+	return r.inner.Close()
+}
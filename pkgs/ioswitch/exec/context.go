@@ -22,6 +22,15 @@ func NewWithContext(ctx context.Context) *ExecContext {
 	return &ExecContext{Context: ctx, Values: make(map[any]any)}
 }
 
+// 复制一个ExecContext，Values是浅复制
+func (c *ExecContext) clone() *ExecContext {
+	values := make(map[any]any, len(c.Values))
+	for k, v := range c.Values {
+		values[k] = v
+	}
+	return &ExecContext{Context: c.Context, Values: values}
+}
+
 // error只会是ErrValueNotFound
 func (c *ExecContext) Value(key any) (any, error) {
 	value, ok := c.Values[key]
@@ -19,25 +19,119 @@ type Driver struct {
 	ctx        *ExecContext
 	cancel     context.CancelFunc
 	driverExec *Executor
+	progress   progressHub
+	stateLock  sync.Mutex
+	state      *PlanState
 }
 
 // 开始写入一个流。此函数会将输入视为一个完整的流，因此会给流包装一个Range来获取只需要的部分。
 func (e *Driver) BeginWrite(str io.ReadCloser, handle *DriverWriteStream) {
-	e.driverExec.PutVar(handle.ID, &StreamValue{Stream: io2.NewRange(str, handle.RangeHint.Offset, handle.RangeHint.Length)})
+	// 恢复执行时，已经完成的部分不会生成对应的指令
+	if handle.ID == 0 {
+		str.Close()
+		return
+	}
+
+	str = io2.NewRange(str, handle.RangeHint.Offset, handle.RangeHint.Length)
+	e.driverExec.PutVar(handle.ID, &StreamValue{Stream: e.trackProgress(str, handle.ID, handle.RangeHint)})
 }
 
 // 开始写入一个流。此函数默认输入流已经是Handle的RangeHint锁描述的范围，因此不会做任何其他处理
 func (e *Driver) BeginWriteRanged(str io.ReadCloser, handle *DriverWriteStream) {
-	e.driverExec.PutVar(handle.ID, &StreamValue{Stream: str})
+	if handle.ID == 0 {
+		str.Close()
+		return
+	}
+
+	e.driverExec.PutVar(handle.ID, &StreamValue{Stream: e.trackProgress(str, handle.ID, handle.RangeHint)})
 }
 
+// 开始读取一个流。如果Handle设置了检查点，那么读取的字节数会记录到执行进度中，读取完毕时检查点完成。
+// 恢复执行时，如果这个流已经读取完毕，那么返回一个空的流。
 func (e *Driver) BeginRead(handle *DriverReadStream) (io.ReadCloser, error) {
+	if handle.ID == 0 {
+		return io2.ErrorReader(io.EOF), nil
+	}
+
 	str, err := BindVar[*StreamValue](e.driverExec, e.ctx.Context, handle.ID)
 	if err != nil {
 		return nil, fmt.Errorf("bind vars: %w", err)
 	}
 
-	return str.Stream, nil
+	ret := e.trackProgress(str.Stream, handle.ID, handle.RangeHint)
+	if handle.Checkpoint != "" {
+		e.stateLock.Lock()
+		offset := e.state.Offset(handle.Checkpoint)
+		e.stateLock.Unlock()
+
+		ret = &checkpointReader{
+			inner:  ret,
+			key:    handle.Checkpoint,
+			offset: offset,
+			driver: e,
+		}
+	}
+
+	return ret, nil
+}
+
+// 获取当前的执行进度，返回的是一份拷贝，可以在计划执行期间随时调用并保存
+func (e *Driver) State() *PlanState {
+	e.stateLock.Lock()
+	defer e.stateLock.Unlock()
+
+	return e.state.Clone()
+}
+
+// 记录一个检查点已经完成，以及完成时得到的值
+func (e *Driver) RecordCheckpoint(key string, value VarValue) {
+	e.stateLock.Lock()
+	defer e.stateLock.Unlock()
+
+	e.state.Completed[key] = true
+	if value != nil {
+		e.state.Values[key] = value.Clone()
+	}
+}
+
+// 根据执行进度重新生成计划并开始执行，返回新的Driver。state为nil时使用这个Driver当前的执行进度。
+// 只有设置了PlanBuilder.Rebuild的计划才能恢复执行。
+func (e *Driver) Resume(ctx *ExecContext, state *PlanState) (*Driver, error) {
+	if e.planBlder.Rebuild == nil {
+		return nil, fmt.Errorf("plan is not resumable")
+	}
+
+	if state == nil {
+		state = e.State()
+	}
+
+	blder, err := e.planBlder.Rebuild(state)
+	if err != nil {
+		return nil, fmt.Errorf("rebuilding plan: %w", err)
+	}
+
+	return blder.Execute(ctx), nil
+}
+
+// 订阅流的读取进度，包括BeginWrite、BeginRead的流，以及Worker通过进度跟踪指令报告的流。
+// 回调函数会在读取流的线程中被调用，因此不能执行耗时的操作。返回的函数用于取消订阅。
+func (e *Driver) SubscribeProgress(cb ProgressCallback) func() {
+	return e.progress.Subscribe(cb)
+}
+
+// 报告一个流的读取进度，会转发给所有订阅者
+func (e *Driver) ReportProgress(p StreamProgress) {
+	e.progress.ReportProgress(p)
+}
+
+func (e *Driver) trackProgress(str io.ReadCloser, id VarID, rng *math2.Range) io.ReadCloser {
+	base := StreamProgress{VarID: id}
+	if rng != nil && rng.Length != nil {
+		total := *rng.Length
+		base.Total = &total
+	}
+
+	return TrackProgress(str, base, e.progress.ReportProgress)
 }
 
 func (e *Driver) Signal(signal *DriverSignalVar) {
@@ -58,7 +152,34 @@ func (e *Driver) execute() {
 
 	errLock := sync.Mutex{}
 	var execErr error
+
+	optCtx, optCancel := context.WithCancel(e.ctx.Context)
+	defer optCancel()
+	optWg := sync.WaitGroup{}
+
 	for _, p := range e.planBlder.WorkerPlans {
+		if p.Optional {
+			optWg.Add(1)
+			go func(p *WorkerPlanBuilder) {
+				defer optWg.Done()
+
+				plan := Plan{
+					ID:  e.planID,
+					Ops: p.Ops,
+				}
+
+				cli, err := p.Worker.NewClient()
+				if err != nil {
+					return
+				}
+				defer cli.Close()
+
+				// 可选的计划失败时，需要的数据会由其他来源提供，所以忽略错误
+				cli.ExecutePlan(optCtx, plan)
+			}(p)
+			continue
+		}
+
 		wg.Add(1)
 
 		go func(p *WorkerPlanBuilder, ctx context.Context, cancel context.CancelFunc) {
@@ -100,6 +221,10 @@ func (e *Driver) execute() {
 
 	wg.Wait()
 
+	// 其他部分都执行完毕后，可选的计划就不再被需要了
+	optCancel()
+	optWg.Wait()
+
 	e.callback.SetComplete(stored, execErr)
 }
 
@@ -109,7 +234,9 @@ type DriverWriteStream struct {
 }
 
 type DriverReadStream struct {
-	ID VarID
+	ID         VarID
+	RangeHint  *math2.Range // 读取的流的范围，如果Length不为nil，则会作为进度的总长度
+	Checkpoint string       // 检查点名称，为空则不记录读取进度
 }
 
 type DriverSignalVar struct {
@@ -0,0 +1,58 @@
+package exec
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// 等待start关闭后，通过ExecContext中的CheckpointRecorder记录一个检查点
+type testCheckpointOp struct {
+	key   string
+	start chan any
+}
+
+func (o *testCheckpointOp) Execute(ctx *ExecContext, e *Executor) error {
+	<-o.start
+
+	recorder, err := GetValueByType[CheckpointRecorder](ctx)
+	if err != nil {
+		return err
+	}
+	recorder.RecordCheckpoint(o.key, nil)
+	return nil
+}
+
+func (o *testCheckpointOp) String() string {
+	return "TestCheckpoint(" + o.key + ")"
+}
+
+func Test_DriverContext(t *testing.T) {
+	Convey("同一个ExecContext执行多个计划，互不影响", t, func() {
+		ctx := NewExecContext()
+		ctx.SetValue("user", 1)
+		start := make(chan any)
+
+		b1 := NewPlanBuilder()
+		b1.AtDriver().AddOp(&testCheckpointOp{key: "a", start: start})
+		d1 := b1.Execute(ctx)
+
+		b2 := NewPlanBuilder()
+		b2.AtDriver().AddOp(&testCheckpointOp{key: "b", start: start})
+		d2 := b2.Execute(ctx)
+
+		close(start)
+		_, err := d1.Wait(context.Background())
+		So(err, ShouldBeNil)
+		_, err = d2.Wait(context.Background())
+		So(err, ShouldBeNil)
+
+		So(d1.State().Completed, ShouldResemble, map[string]bool{"a": true})
+		So(d2.State().Completed, ShouldResemble, map[string]bool{"b": true})
+
+		// 调用者的ExecContext没有被修改
+		So(ctx.Context == context.Background(), ShouldBeTrue)
+		So(ctx.Values, ShouldResemble, map[any]any{"user": 1})
+	})
+}
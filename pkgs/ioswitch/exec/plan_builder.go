@@ -12,6 +12,8 @@ type PlanBuilder struct {
 	NextVarID   VarID
 	WorkerPlans []*WorkerPlanBuilder
 	DriverPlan  DriverPlanBuilder
+	State       *PlanState    // 计划开始执行时的进度，为nil代表从头开始
+	Rebuild     PlanRebuilder // 用于Driver.Resume，为nil则计划不能恢复执行
 }
 
 func NewPlanBuilder() *PlanBuilder {
@@ -49,9 +51,11 @@ func (b *PlanBuilder) NewVar() VarID {
 	return id
 }
 
+// 执行计划。ctx中的Values会被复制到Driver自己的ExecContext中，因此同一个ctx可以用于多次执行，互不影响
 func (b *PlanBuilder) Execute(ctx *ExecContext) *Driver {
 	c, cancel := context.WithCancel(ctx.Context)
-	ctx.Context = c
+	driverCtx := ctx.clone()
+	driverCtx.Context = c
 
 	planID := genRandomPlanID()
 
@@ -60,14 +64,23 @@ func (b *PlanBuilder) Execute(ctx *ExecContext) *Driver {
 		Ops: b.DriverPlan.Ops,
 	}
 
+	state := NewPlanState()
+	if b.State != nil {
+		state = b.State.Clone()
+	}
+
 	exec := Driver{
+		state:      state,
 		planID:     planID,
 		planBlder:  b,
 		callback:   future.NewSetValue[map[string]VarValue](),
-		ctx:        ctx,
+		ctx:        driverCtx,
 		cancel:     cancel,
 		driverExec: NewExecutor(execPlan),
 	}
+	// 让在Driver上执行的指令能够报告进度
+	SetValueByType[ProgressReporter](driverCtx, &exec)
+	SetValueByType[CheckpointRecorder](driverCtx, &exec)
 	go exec.execute()
 
 	return &exec
@@ -99,6 +112,9 @@ func (b *PlanBuilder) String() string {
 type WorkerPlanBuilder struct {
 	Worker WorkerInfo
 	Ops    []Op
+	// 如果为true，则这个Worker上的计划执行失败时不会导致整个计划失败，
+	// 并且在其他部分都执行完毕后，这个Worker上的计划会被取消
+	Optional bool
 }
 
 func (b *WorkerPlanBuilder) AddOp(op Op) {
@@ -0,0 +1,153 @@
+package exec
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// 两次进度报告之间的最小间隔，流结束时的报告不受此限制
+const ProgressReportInterval = time.Millisecond * 200
+
+// 一个流的读取进度
+type StreamProgress struct {
+	VarID     VarID  `json:"varID"`
+	Name      string `json:"name"`   // 创建进度跟踪时指定的名称，可以用来区分不同的流
+	Worker    string `json:"worker"` // 流所在的Worker，为空代表在Driver上
+	BytesRead int64  `json:"bytesRead"`
+	Total     *int64 `json:"total,omitempty"` // 流的总长度，未知则为nil
+	IsDone    bool   `json:"isDone"`          // 流已经读取完毕，或者出现了错误
+	Error     string `json:"error,omitempty"`
+}
+
+type ProgressCallback func(p StreamProgress)
+
+// 接收进度报告。Driver实现了这个接口，并且会在执行计划时将自己放入ExecContext中，
+// 在Worker上执行的计划也可以自行在ExecContext中设置一个ProgressReporter来接收进度。
+type ProgressReporter interface {
+	ReportProgress(p StreamProgress)
+}
+
+type progressSubscriber struct {
+	callback ProgressCallback
+}
+
+type progressHub struct {
+	lock sync.Mutex
+	subs []*progressSubscriber
+}
+
+func (h *progressHub) Subscribe(cb ProgressCallback) func() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	sub := &progressSubscriber{callback: cb}
+	h.subs = append(h.subs, sub)
+
+	return func() {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+
+		for i, s := range h.subs {
+			if s == sub {
+				h.subs = append(h.subs[:i:i], h.subs[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (h *progressHub) ReportProgress(p StreamProgress) {
+	h.lock.Lock()
+	subs := h.subs
+	h.lock.Unlock()
+
+	for _, s := range subs {
+		s.callback(p)
+	}
+}
+
+// 流经常会在另外一个协程中被关闭来中止读取，因此Read和Close可能同时调用
+type progressTracker struct {
+	inner      io.ReadCloser
+	lock       sync.Mutex
+	progress   StreamProgress
+	report     ProgressCallback
+	lastReport time.Time
+}
+
+func (t *progressTracker) Read(p []byte) (int, error) {
+	n, err := t.inner.Read(p)
+
+	t.lock.Lock()
+	if t.progress.IsDone {
+		t.lock.Unlock()
+		return n, err
+	}
+
+	t.progress.BytesRead += int64(n)
+
+	report := true
+	if err == io.EOF {
+		t.progress.IsDone = true
+	} else if err != nil {
+		t.progress.IsDone = true
+		t.progress.Error = err.Error()
+	} else if time.Since(t.lastReport) >= ProgressReportInterval {
+		t.lastReport = time.Now()
+	} else {
+		report = false
+	}
+	snapshot := t.progress
+	t.lock.Unlock()
+
+	// 在锁外调用，避免回调中关闭流时死锁
+	if report {
+		t.report(snapshot)
+	}
+	return n, err
+}
+
+func (t *progressTracker) Close() error {
+	t.lock.Lock()
+	if !t.progress.IsDone {
+		t.progress.IsDone = true
+		// 只有已知总长度，且还未读取完毕时关闭才算错误
+		if t.progress.Total != nil && t.progress.BytesRead < *t.progress.Total {
+			t.progress.Error = "stream closed early"
+		}
+		snapshot := t.progress
+		t.lock.Unlock()
+
+		t.report(snapshot)
+	} else {
+		t.lock.Unlock()
+	}
+
+	return t.inner.Close()
+}
+
+// 统计流的读取进度。每隔ProgressReportInterval以及流结束时，都会调用一次report。
+// base中的VarID、Name、Worker、Total字段会原样出现在报告中。
+func TrackProgress(str io.ReadCloser, base StreamProgress, report ProgressCallback) io.ReadCloser {
+	base.BytesRead = 0
+	base.IsDone = false
+	base.Error = ""
+
+	return &progressTracker{
+		inner:      str,
+		progress:   base,
+		report:     report,
+		lastReport: time.Now(),
+	}
+}
+
+// 如果ExecContext中设置了ProgressReporter，则统计流的读取进度，否则返回原始的流。
+func TrackProgressByContext(ctx *ExecContext, str io.ReadCloser, base StreamProgress) io.ReadCloser {
+	reporter, err := GetValueByType[ProgressReporter](ctx)
+	if err != nil {
+		return str
+	}
+
+	return TrackProgress(str, base, reporter.ReportProgress)
+}
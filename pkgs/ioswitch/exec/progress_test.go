@@ -0,0 +1,126 @@
+package exec
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_TrackProgress(t *testing.T) {
+	type recorder struct {
+		lock    sync.Mutex
+		reports []StreamProgress
+	}
+	newRecorder := func() (*recorder, ProgressCallback) {
+		r := &recorder{}
+		return r, func(p StreamProgress) {
+			r.lock.Lock()
+			r.reports = append(r.reports, p)
+			r.lock.Unlock()
+		}
+	}
+	last := func(r *recorder) StreamProgress {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		return r.reports[len(r.reports)-1]
+	}
+
+	Convey("读取完毕时报告", t, func() {
+		rec, cb := newRecorder()
+		total := int64(10)
+		str := TrackProgress(io.NopCloser(bytes.NewReader(make([]byte, 10))), StreamProgress{VarID: 1, Name: "a", Total: &total}, cb)
+
+		_, err := io.ReadAll(str)
+		So(err, ShouldBeNil)
+		So(str.Close(), ShouldBeNil)
+
+		So(rec.reports, ShouldHaveLength, 1)
+		p := last(rec)
+		So(p.VarID, ShouldEqual, 1)
+		So(p.Name, ShouldEqual, "a")
+		So(p.BytesRead, ShouldEqual, 10)
+		So(p.IsDone, ShouldBeTrue)
+		So(p.Error, ShouldBeEmpty)
+	})
+
+	Convey("提前关闭", t, func() {
+		rec, cb := newRecorder()
+		total := int64(10)
+		str := TrackProgress(io.NopCloser(bytes.NewReader(make([]byte, 10))), StreamProgress{Total: &total}, cb)
+
+		buf := make([]byte, 4)
+		_, err := io.ReadFull(str, buf)
+		So(err, ShouldBeNil)
+		So(str.Close(), ShouldBeNil)
+
+		p := last(rec)
+		So(p.BytesRead, ShouldEqual, 4)
+		So(p.IsDone, ShouldBeTrue)
+		So(p.Error, ShouldEqual, "stream closed early")
+
+		// 未知总长度时关闭不算错误
+		rec, cb = newRecorder()
+		str = TrackProgress(io.NopCloser(bytes.NewReader(make([]byte, 10))), StreamProgress{}, cb)
+		So(str.Close(), ShouldBeNil)
+		So(last(rec).Error, ShouldBeEmpty)
+
+		// 读取完所有数据但没有读到EOF时关闭也不算错误
+		rec, cb = newRecorder()
+		str = TrackProgress(io.NopCloser(bytes.NewReader(make([]byte, 10))), StreamProgress{Total: &total}, cb)
+		_, err = io.ReadFull(str, make([]byte, 10))
+		So(err, ShouldBeNil)
+		So(str.Close(), ShouldBeNil)
+		So(last(rec).Error, ShouldBeEmpty)
+	})
+
+	Convey("读取出错", t, func() {
+		rec, cb := newRecorder()
+		pr, pw := io.Pipe()
+		pw.CloseWithError(errors.New("broken"))
+		str := TrackProgress(pr, StreamProgress{}, cb)
+
+		_, err := io.ReadAll(str)
+		So(err, ShouldNotBeNil)
+		So(str.Close(), ShouldBeNil)
+
+		So(rec.reports, ShouldHaveLength, 1)
+		So(last(rec).Error, ShouldEqual, "broken")
+	})
+
+	Convey("在另一个协程中关闭", t, func() {
+		rec, cb := newRecorder()
+		pr, pw := io.Pipe()
+		str := TrackProgress(pr, StreamProgress{}, cb)
+
+		go func() {
+			pw.Write(make([]byte, 100))
+			str.Close()
+		}()
+
+		_, err := io.ReadAll(str)
+		So(err, ShouldNotBeNil)
+
+		p := last(rec)
+		So(p.IsDone, ShouldBeTrue)
+		So(p.BytesRead, ShouldBeLessThanOrEqualTo, 100)
+	})
+
+	Convey("订阅与取消订阅", t, func() {
+		var hub progressHub
+		rec1, cb1 := newRecorder()
+		rec2, cb2 := newRecorder()
+		unsub1 := hub.Subscribe(cb1)
+		hub.Subscribe(cb2)
+
+		hub.ReportProgress(StreamProgress{VarID: 1})
+		unsub1()
+		hub.ReportProgress(StreamProgress{VarID: 2})
+
+		So(rec1.reports, ShouldHaveLength, 1)
+		So(rec2.reports, ShouldHaveLength, 2)
+	})
+}
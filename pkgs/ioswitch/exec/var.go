@@ -1,6 +1,9 @@
 package exec
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
 
 	"gitlink.org.cn/cloudream/common/pkgs/types"
@@ -24,6 +27,9 @@ var valueUnion = serder.UseTypeUnionExternallyTagged(types.Ref(types.NewTypeUnio
 	(*StreamValue)(nil),
 	(*SignalValue)(nil),
 	(*StringValue)(nil),
+	(*IntValue)(nil),
+	(*BytesValue)(nil),
+	(*JSONValue)(nil),
 )))
 
 func UseVarValue[T VarValue]() {
@@ -79,3 +85,79 @@ func NewStringVar(id VarID, value string) StringVar {
 		Value: &StringValue{Value: value},
 	}
 }
+
+type IntValue struct {
+	Value int64 `json:"value"`
+}
+
+func (o *IntValue) Clone() VarValue {
+	return &IntValue{Value: o.Value}
+}
+
+type IntVar = Var[*IntValue]
+
+func NewIntVar(id VarID, value int64) IntVar {
+	return IntVar{
+		ID:    id,
+		Value: &IntValue{Value: value},
+	}
+}
+
+type BytesValue struct {
+	Value []byte `json:"value"`
+}
+
+func (o *BytesValue) Clone() VarValue {
+	return &BytesValue{Value: bytes.Clone(o.Value)}
+}
+
+type BytesVar = Var[*BytesValue]
+
+func NewBytesVar(id VarID, value []byte) BytesVar {
+	return BytesVar{
+		ID:    id,
+		Value: &BytesValue{Value: value},
+	}
+}
+
+// 任意的JSON数据，保存的是编码后的JSON文本
+type JSONValue struct {
+	Value json.RawMessage `json:"value"`
+}
+
+// 将一个对象编码为JSONValue
+func NewJSONValue(v any) (*JSONValue, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return &JSONValue{Value: data}, nil
+}
+
+func (o *JSONValue) Clone() VarValue {
+	return &JSONValue{Value: bytes.Clone(o.Value)}
+}
+
+// 将JSON数据解码到v中
+func (o *JSONValue) Unmarshal(v any) error {
+	if len(o.Value) == 0 {
+		return fmt.Errorf("empty json value")
+	}
+
+	return json.Unmarshal(o.Value, v)
+}
+
+type JSONVar = Var[*JSONValue]
+
+func NewJSONVar(id VarID, value any) (JSONVar, error) {
+	v, err := NewJSONValue(value)
+	if err != nil {
+		return JSONVar{}, err
+	}
+
+	return JSONVar{
+		ID:    id,
+		Value: v,
+	}, nil
+}
@@ -0,0 +1,51 @@
+package exec
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlink.org.cn/cloudream/common/utils/serder"
+)
+
+func Test_VarValueJSON(t *testing.T) {
+	Convey("各种类型的变量值序列化后再反序列化", t, func() {
+		jsonVal, err := NewJSONValue(map[string]any{"a": 1, "b": []string{"x", "y"}})
+		So(err, ShouldBeNil)
+
+		vals := []VarValue{
+			&SignalValue{},
+			&StringValue{Value: "str"},
+			&IntValue{Value: -1234567890123},
+			&BytesValue{Value: []byte{0, 1, 2, 0xff}},
+			jsonVal,
+		}
+
+		for _, val := range vals {
+			data, err := serder.ObjectToJSONEx(val)
+			So(err, ShouldBeNil)
+
+			ret, err := serder.JSONToObjectEx[VarValue](data)
+			So(err, ShouldBeNil)
+			So(ret, ShouldResemble, val)
+		}
+	})
+
+	Convey("作为执行进度的一部分序列化", t, func() {
+		state := NewPlanState()
+		state.Completed["a"] = true
+		state.Values["int"] = &IntValue{Value: 10}
+		state.Values["bytes"] = &BytesValue{Value: []byte("data")}
+		state.Values["json"] = &JSONValue{Value: []byte(`[1,"2",{"3":null}]`)}
+
+		data, err := serder.ObjectToJSONEx(state)
+		So(err, ShouldBeNil)
+
+		ret, err := serder.JSONToObjectEx[*PlanState](data)
+		So(err, ShouldBeNil)
+		So(ret, ShouldResemble, state)
+
+		var arr []any
+		So(ret.Values["json"].(*JSONValue).Unmarshal(&arr), ShouldBeNil)
+		So(arr, ShouldResemble, []any{float64(1), "2", map[string]any{"3": nil}})
+	})
+}
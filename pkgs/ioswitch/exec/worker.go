@@ -19,6 +19,7 @@ type Worker struct {
 	lock      sync.Mutex
 	executors map[PlanID]*Executor
 	findings  []*finding
+	admission admission
 }
 
 func NewWorker() Worker {
@@ -27,6 +28,37 @@ func NewWorker() Worker {
 	}
 }
 
+// 设置准入控制的参数，只影响之后通过Admit或Execute申请执行的计划
+func (s *Worker) SetAdmission(cfg AdmissionConfig) {
+	s.admission.SetConfig(cfg)
+}
+
+// 当前正在执行的计划数、这些计划估计占用的内存以及正在排队的计划数
+func (s *Worker) AdmissionStats() (running int, memory int64, queued int) {
+	return s.admission.Stats()
+}
+
+// 申请执行一个计划，资源不足时会排队等待。如果排队超时或者队列已满，则返回PlanRejectedError。
+// 成功时返回的函数需要在计划执行结束后调用，以释放资源。
+func (s *Worker) Admit(ctx context.Context, plan Plan) (func(), error) {
+	return s.admission.Admit(ctx, EstimatePlanMemory(plan))
+}
+
+// 经过准入控制后执行一个计划，执行期间可以通过FindByID找到它
+func (s *Worker) Execute(ctx *ExecContext, plan Plan) (map[string]VarValue, error) {
+	release, err := s.Admit(ctx.Context, plan)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	exe := NewExecutor(plan)
+	s.Add(exe)
+	defer s.Remove(exe)
+
+	return exe.Run(ctx)
+}
+
 func (s *Worker) Add(exe *Executor) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
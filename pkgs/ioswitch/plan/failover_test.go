@@ -0,0 +1,204 @@
+package plan
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlink.org.cn/cloudream/common/pkgs/future"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/dag"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/plan/ops"
+	"gitlink.org.cn/cloudream/common/utils/io2"
+)
+
+// 在内存中执行计划的Worker。down为true时无法连接
+type testWorker struct {
+	name   string
+	down   bool
+	worker *exec.Worker
+}
+
+func newTestWorker(name string, down bool) *testWorker {
+	w := exec.NewWorker()
+	return &testWorker{name: name, down: down, worker: &w}
+}
+
+func (w *testWorker) NewClient() (exec.WorkerClient, error) {
+	if w.down {
+		return nil, fmt.Errorf("worker %v is unreachable", w.name)
+	}
+	return &testWorkerClient{worker: w.worker}, nil
+}
+
+func (w *testWorker) Equals(worker exec.WorkerInfo) bool {
+	other, ok := worker.(*testWorker)
+	return ok && other.name == w.name
+}
+
+func (w *testWorker) String() string {
+	return w.name
+}
+
+type testWorkerClient struct {
+	worker *exec.Worker
+}
+
+func (c *testWorkerClient) ExecutePlan(ctx context.Context, plan exec.Plan) error {
+	_, err := c.worker.Execute(exec.NewWithContext(ctx), plan)
+	return err
+}
+
+func (c *testWorkerClient) SendStream(ctx context.Context, planID exec.PlanID, id exec.VarID, stream io.ReadCloser) error {
+	exe := c.worker.FindByIDContexted(ctx, planID)
+	if exe == nil {
+		return fmt.Errorf("plan %v not found", planID)
+	}
+
+	fut := future.NewSetVoid()
+	exe.PutVar(id, &exec.StreamValue{Stream: io2.AfterReadClosedOnce(stream, func(closer io.ReadCloser) {
+		fut.SetVoid()
+	})})
+	return fut.Wait(ctx)
+}
+
+func (c *testWorkerClient) SendVar(ctx context.Context, planID exec.PlanID, id exec.VarID, value exec.VarValue) error {
+	exe := c.worker.FindByIDContexted(ctx, planID)
+	if exe == nil {
+		return fmt.Errorf("plan %v not found", planID)
+	}
+
+	exe.PutVar(id, value)
+	return nil
+}
+
+func (c *testWorkerClient) GetStream(ctx context.Context, planID exec.PlanID, streamID exec.VarID, signalID exec.VarID, signal exec.VarValue) (io.ReadCloser, error) {
+	exe := c.worker.FindByIDContexted(ctx, planID)
+	if exe == nil {
+		return nil, fmt.Errorf("plan %v not found", planID)
+	}
+
+	exe.PutVar(signalID, signal)
+	str, err := exec.BindVar[*exec.StreamValue](exe, ctx, streamID)
+	if err != nil {
+		return nil, err
+	}
+	return str.Stream, nil
+}
+
+func (c *testWorkerClient) GetVar(ctx context.Context, planID exec.PlanID, varID exec.VarID, signalID exec.VarID, signal exec.VarValue) (exec.VarValue, error) {
+	exe := c.worker.FindByIDContexted(ctx, planID)
+	if exe == nil {
+		return nil, fmt.Errorf("plan %v not found", planID)
+	}
+
+	exe.PutVar(signalID, signal)
+	return exec.BindVar[exec.VarValue](exe, ctx, varID)
+}
+
+func (c *testWorkerClient) Close() error {
+	return nil
+}
+
+// 输出固定数据的来源
+type testSource struct {
+	Output exec.VarID
+	Data   []byte
+}
+
+func (o *testSource) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
+	fut := future.NewSetVoid()
+	e.PutVar(o.Output, &exec.StreamValue{Stream: io2.AfterReadClosedOnce(io.NopCloser(bytes.NewReader(o.Data)), func(closer io.ReadCloser) {
+		fut.SetVoid()
+	})})
+	return fut.Wait(ctx.Context)
+}
+
+func (o *testSource) String() string {
+	return fmt.Sprintf("TestSource()->%v", o.Output)
+}
+
+type testSourceNode struct {
+	dag.NodeBase
+	data []byte
+}
+
+func newTestSourceNode(b *ops.GraphNodeBuilder, worker exec.WorkerInfo, data []byte) *testSourceNode {
+	node := &testSourceNode{data: data}
+	b.AddNode(node)
+
+	node.Env().ToEnvWorker(worker)
+	node.OutputStreams().Init(node, 1)
+	return node
+}
+
+func (t *testSourceNode) GenerateOp() (exec.Op, error) {
+	return &testSource{
+		Output: t.OutputStreams().Get(0).VarID,
+		Data:   t.data,
+	}, nil
+}
+
+func Test_FailoverAcrossWorkers(t *testing.T) {
+	data := make([]byte, 100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	// Failover在worker0上执行，按顺序使用srcWorkers上的来源，结果送到Driver
+	run := func(srcWorkers ...*testWorker) ([]byte, error) {
+		b := ops.NewGraphNodeBuilder()
+
+		w0 := newTestWorker("worker0", false)
+		failover := b.NewFailover(false, nil)
+		failover.Env().ToEnvWorker(w0)
+		for _, w := range srcWorkers {
+			failover.AddInput(newTestSourceNode(b, w, data).OutputStreams().Get(0))
+		}
+
+		handle := &exec.DriverReadStream{}
+		to := b.NewToDriver(handle)
+		to.Env().ToEnvDriver()
+		to.SetInput(failover.Output().Var())
+
+		blder := exec.NewPlanBuilder()
+		So(Generate(b.Graph, blder), ShouldBeNil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		d := blder.Execute(exec.NewWithContext(ctx))
+		str, err := d.BeginRead(handle)
+		So(err, ShouldBeNil)
+		got, readErr := io.ReadAll(str)
+		str.Close()
+
+		_, err = d.Wait(ctx)
+		So(ctx.Err(), ShouldBeNil)
+		if readErr != nil {
+			return got, readErr
+		}
+		return got, err
+	}
+
+	Convey("备用来源所在的Worker无法连接时，不影响使用主来源", t, func() {
+		got, err := run(newTestWorker("worker1", false), newTestWorker("worker2", true))
+		So(err, ShouldBeNil)
+		So(got, ShouldResemble, data)
+	})
+
+	Convey("主来源所在的Worker无法连接时，切换到备用来源", t, func() {
+		got, err := run(newTestWorker("worker1", true), newTestWorker("worker2", false))
+		So(err, ShouldBeNil)
+		So(got, ShouldResemble, data)
+	})
+
+	Convey("所有来源所在的Worker都无法连接时，计划失败", t, func() {
+		_, err := run(newTestWorker("worker1", true), newTestWorker("worker2", true))
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -1,19 +1,30 @@
 package plan
 
 import (
+	"github.com/samber/lo"
 	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/dag"
 	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
 	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/plan/ops"
 )
 
-func Generate(graph *dag.Graph, planBld *exec.PlanBuilder) error {
+type GenerateConfig struct {
+	// 生成的SendStream、GetStream指令所使用的带宽预算名称，为空则不限速
+	TransferBandwidth string
+}
+
+func Generate(graph *dag.Graph, planBld *exec.PlanBuilder, cfg ...GenerateConfig) error {
+	c := GenerateConfig{}
+	if len(cfg) > 0 {
+		c = cfg[0]
+	}
+
 	myGraph := &ops.GraphNodeBuilder{graph}
-	generateSend(myGraph)
-	return buildPlan(graph, planBld)
+	generateSend(myGraph, c)
+	return buildPlan(graph, planBld, findFallibleNodes(graph))
 }
 
 // 生成Send指令
-func generateSend(graph *ops.GraphNodeBuilder) {
+func generateSend(graph *ops.GraphNodeBuilder, cfg GenerateConfig) {
 	graph.Walk(func(node dag.Node) bool {
 		switch node.(type) {
 		case *ops.SendStreamNode:
@@ -43,6 +54,7 @@ func generateSend(graph *ops.GraphNodeBuilder) {
 
 				getNode := graph.NewGetStream(node.Env().Worker)
 				getNode.Env().ToEnvDriver()
+				getNode.Bandwidth = cfg.TransferBandwidth
 
 				// // 同时需要对此变量生成HoldUntil指令，避免Plan结束时Get指令还未到达
 				holdNode := graph.NewHoldUntil()
@@ -59,10 +71,28 @@ func generateSend(graph *ops.GraphNodeBuilder) {
 					To(to, dstNode.InputStreams().IndexOf(out))
 
 			case dag.EnvWorker:
-				// 如果是要送到Agent，则可以直接发送
 				dstNode := out.Dst.Get(0)
+
+				// Failover节点的来源可能会失败，如果由来源主动发送，那么来源失败时Failover节点会一直等待，
+				// 所以改为由Failover节点所在的Worker主动拉取
+				if _, ok := dstNode.(*ops.FailoverNode); ok {
+					getNode := graph.NewGetStream(node.Env().Worker)
+					*getNode.Env() = *to.Env()
+					getNode.Bandwidth = cfg.TransferBandwidth
+
+					holdNode := graph.NewHoldUntil()
+					*holdNode.Env() = *node.Env()
+					holdNode.SetSignal(getNode.SignalVar())
+
+					out.Dst.RemoveAt(0)
+					getNode.Get(holdNode.HoldStream(out)).To(to, dstNode.InputStreams().IndexOf(out))
+					continue
+				}
+
+				// 如果是要送到Agent，则可以直接发送
 				n := graph.NewSendStream(to.Env().Worker)
 				*n.Env() = *node.Env()
+				n.Bandwidth = cfg.TransferBandwidth
 
 				out.Dst.RemoveAt(0)
 				n.Send(out).To(to, dstNode.InputStreams().IndexOf(out))
@@ -118,9 +148,59 @@ func generateSend(graph *ops.GraphNodeBuilder) {
 	})
 }
 
+// 找到所有只为Failover节点提供数据的节点，这些节点失败时不应该导致整个计划失败。
+// 把Failover的打开请求传给其他Worker上的来源的节点也是如此，否则来源所在的Worker无法访问时，
+// 即使不需要这个来源，发送打开请求失败也会导致整个计划失败。
+func findFallibleNodes(graph *dag.Graph) map[dag.Node]bool {
+	fallibles := make(map[dag.Node]bool)
+	graph.Walk(func(node dag.Node) bool {
+		switch node.(type) {
+		case *ops.SendValueNode, *ops.GetValueNode, *ops.HoldUntilNode:
+			fallibles[node] = true
+		}
+
+		if node.OutputStreams().Len() > 0 {
+			fallibles[node] = true
+		}
+		return true
+	})
+
+	isFallibleDst := func(dst dag.Node) bool {
+		if _, ok := dst.(*ops.FailoverNode); ok {
+			return true
+		}
+		return fallibles[dst]
+	}
+
+	// 不断排除有输出送到其他节点的节点，直到没有变化
+	for changed := true; changed; {
+		changed = false
+
+		for node := range fallibles {
+			ok := true
+			for i := 0; i < node.OutputStreams().Len() && ok; i++ {
+				ok = lo.EveryBy(node.OutputStreams().Get(i).Dst.RawArray(), isFallibleDst)
+			}
+			for i := 0; i < node.OutputValues().Len() && ok; i++ {
+				ok = lo.EveryBy(node.OutputValues().Get(i).Dst.RawArray(), isFallibleDst)
+			}
+
+			if !ok {
+				delete(fallibles, node)
+				changed = true
+			}
+		}
+	}
+
+	return fallibles
+}
+
 // 生成Plan
-func buildPlan(graph *dag.Graph, blder *exec.PlanBuilder) error {
+func buildPlan(graph *dag.Graph, blder *exec.PlanBuilder, fallibles map[dag.Node]bool) error {
 	var retErr error
+	var nodes []dag.Node
+	nodeOps := make(map[dag.Node]exec.Op)
+	requiredWorkers := make(map[*exec.WorkerPlanBuilder]bool)
 	graph.Walk(func(node dag.Node) bool {
 		for i := 0; i < node.OutputStreams().Len(); i++ {
 			out := node.OutputStreams().Get(i)
@@ -185,15 +265,72 @@ func buildPlan(graph *dag.Graph, blder *exec.PlanBuilder) error {
 			return true
 		}
 
+		nodes = append(nodes, node)
+		nodeOps[node] = op
+		return true
+	})
+	if retErr != nil {
+		return retErr
+	}
+
+	setupFailoverSources(nodeOps, fallibles)
+
+	for _, node := range nodes {
+		op := nodeOps[node]
+		if fallibles[node] {
+			op = &ops.Fallible{
+				Op:      op,
+				Outputs: node.OutputStreams().GetVarIDs(),
+			}
+		}
+
 		switch node.Env().Type {
 		case dag.EnvDriver:
 			blder.AtDriver().AddOp(op)
 		case dag.EnvWorker:
-			blder.AtWorker(node.Env().Worker).AddOp(op)
+			p := blder.AtWorker(node.Env().Worker)
+			p.AddOp(op)
+			if !fallibles[node] {
+				requiredWorkers[p] = true
+			}
 		}
+	}
 
-		return true
-	})
+	for _, p := range blder.WorkerPlans {
+		p.Optional = !requiredWorkers[p]
+	}
+
+	return nil
+}
+
+// 让只为Failover节点提供数据的来源节点在收到Failover的打开请求后才执行，并告诉Failover指令哪些来源支持范围读取
+func setupFailoverSources(nodeOps map[dag.Node]exec.Op, fallibles map[dag.Node]bool) {
+	// 来源本身也可能是Failover节点，所以从未修改过的指令中查找
+	rawOps := make(map[dag.Node]exec.Op, len(nodeOps))
+	for node, op := range nodeOps {
+		rawOps[node] = op
+	}
+
+	for node, op := range rawOps {
+		failover, ok := node.(*ops.FailoverNode)
+		if !ok {
+			continue
+		}
+		failoverOp := op.(*ops.Failover)
 
-	return retErr
+		for i, src := range failover.Sources() {
+			srcOp, ok := rawOps[src.Node]
+			// 来源没有生成指令（比如FromDriver），或者它的输出还有其他用途时，只能在计划开始时就执行
+			if !ok || !fallibles[src.Node] || src.Node.OutputStreams().Len() != 1 {
+				continue
+			}
+
+			_, failoverOp.Sources[i].Ranged = srcOp.(ops.RangedSource)
+			nodeOps[src.Node] = &ops.LazySource{
+				Open:    src.Node.InputValues().Get(src.OpenIndex).VarID,
+				Op:      srcOp,
+				Outputs: src.Node.OutputStreams().GetVarIDs(),
+			}
+		}
+	}
 }
@@ -0,0 +1,142 @@
+package ops
+
+import (
+	"fmt"
+
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/dag"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
+	"gitlink.org.cn/cloudream/common/utils/math2"
+)
+
+func init() {
+	exec.UseOp[*Checkpoint]()
+}
+
+// 可以根据执行进度跳过已经完成的工作的节点
+type ResumableNode interface {
+	dag.Node
+	// 根据执行进度调整节点，需要时可以通过b修改图。如果返回true，代表这个节点的工作已经完成，
+	// 它的输入会被断开，只为它提供数据的节点也会被移除。如果节点没有输出，那么节点本身也会被移除。
+	ApplyPlanState(b *GraphNodeBuilder, state *exec.PlanState) bool
+}
+
+// 可以让输出流跳过开头一部分数据的节点。恢复执行时，已经被读取过的数据会尽量让上游节点直接跳过，而不是产生之后再丢弃。
+type SkippableNode interface {
+	dag.Node
+	// 让第idx个输出流跳过开头的skip个字节。不支持时返回false，并且不能修改节点。
+	SkipOutput(b *GraphNodeBuilder, idx int, skip int64) bool
+}
+
+// 让dst节点的第idx个输入流跳过开头的skip个字节。如果这个流只输入给了dst，并且产生流的节点实现了SkippableNode，
+// 那么由产生流的节点跳过，否则在流与dst之间插入一个RangeNode。
+func (b *GraphNodeBuilder) SkipInput(dst dag.Node, idx int, skip int64) {
+	if skip <= 0 {
+		return
+	}
+
+	v := dst.InputStreams().Get(idx)
+	if v.Dst.Len() == 1 {
+		if src, ok := v.Src.(SkippableNode); ok && src.SkipOutput(b, v.IndexAtSrc(), skip) {
+			return
+		}
+	}
+
+	// 在产生流的节点所在的环境中跳过，减少传输的数据量
+	rng := b.NewRange(math2.Range{Offset: skip})
+	*rng.Env() = *v.Src.Env()
+
+	v.Dst.Remove(dst)
+	rng.SetInput(v)
+	rng.Output().Var().To(dst, idx)
+}
+
+// 将输入的值原样输出，同时向ExecContext中的CheckpointRecorder报告检查点已经完成
+type Checkpoint struct {
+	Input  exec.VarID `json:"input"`
+	Output exec.VarID `json:"output"`
+	Key    string     `json:"key"`
+}
+
+func (o *Checkpoint) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
+	v, err := e.BindVar(ctx.Context, o.Input)
+	if err != nil {
+		return err
+	}
+
+	recorder, err := exec.GetValueByType[exec.CheckpointRecorder](ctx)
+	if err == nil {
+		recorder.RecordCheckpoint(o.Key, v)
+	}
+
+	e.PutVar(o.Output, v)
+	return nil
+}
+
+func (o *Checkpoint) String() string {
+	return fmt.Sprintf("Checkpoint(%v) %v->%v", o.Key, o.Input, o.Output)
+}
+
+// 检查点节点，一般连接到写入分片、计算哈希等工作的结果上。
+// 恢复执行时，如果检查点已经完成，那么会直接输出之前记录的值，产生这个值的节点也会被移除。
+//
+// 检查点只能在Driver上记录，因此这个节点固定在Driver上执行。
+type CheckpointNode struct {
+	dag.NodeBase
+	Key     string
+	resumed exec.VarValue
+}
+
+func (b *GraphNodeBuilder) NewCheckpoint(key string) *CheckpointNode {
+	node := &CheckpointNode{
+		Key: key,
+	}
+	b.AddNode(node)
+
+	node.Env().ToEnvDriver()
+	node.Env().Pinned = true
+
+	node.InputValues().Init(1)
+	node.OutputValues().Init(node, 1)
+	return node
+}
+
+func (t *CheckpointNode) SetInput(v *dag.ValueVar) {
+	v.To(t, 0)
+}
+
+func (t *CheckpointNode) Output() dag.ValueOutputSlot {
+	return dag.ValueOutputSlot{
+		Node:  t,
+		Index: 0,
+	}
+}
+
+func (t *CheckpointNode) ApplyPlanState(b *GraphNodeBuilder, state *exec.PlanState) bool {
+	if !state.IsCompleted(t.Key) {
+		return false
+	}
+
+	// 没有记录值的检查点只能重新执行
+	v, ok := state.Value(t.Key)
+	if !ok {
+		return false
+	}
+
+	t.resumed = v
+	return true
+}
+
+func (t *CheckpointNode) GenerateOp() (exec.Op, error) {
+	if t.resumed != nil {
+		return &ConstVar{
+			ID:    t.OutputValues().Get(0).VarID,
+			Value: t.resumed,
+		}, nil
+	}
+
+	return &Checkpoint{
+		Input:  t.InputValues().Get(0).VarID,
+		Output: t.OutputValues().Get(0).VarID,
+		Key:    t.Key,
+	}, nil
+}
@@ -0,0 +1,204 @@
+package ops
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"gitlink.org.cn/cloudream/common/pkgs/future"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/dag"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
+	"gitlink.org.cn/cloudream/common/utils/io2"
+)
+
+func init() {
+	exec.UseOp[*Compress]()
+	exec.UseOp[*Decompress]()
+}
+
+const (
+	CompressGzip  = "gzip"
+	CompressFlate = "flate"
+)
+
+type Compress struct {
+	Input     exec.VarID `json:"input"`
+	Output    exec.VarID `json:"output"`
+	Algorithm string     `json:"algorithm"`
+	Level     int        `json:"level"` // 与compress/flate中的定义相同，0为不压缩，-1为默认的压缩级别
+}
+
+func (o *Compress) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
+	input, err := exec.BindVar[*exec.StreamValue](e, ctx.Context, o.Input)
+	if err != nil {
+		return err
+	}
+	defer input.Stream.Close()
+
+	pr, pw := io.Pipe()
+	w, err := newCompressWriter(o.Algorithm, pw, o.Level)
+	if err != nil {
+		return err
+	}
+
+	e.PutVar(o.Output, &exec.StreamValue{Stream: pr})
+
+	_, err = io.Copy(w, input.Stream)
+	if err == nil {
+		err = w.Close()
+	}
+	pw.CloseWithError(err)
+	return err
+}
+
+// flate压缩器内部的窗口和哈希表大约占用1MiB内存
+func (o *Compress) EstimateMemory() int64 {
+	return 1024 * 1024
+}
+
+func (o *Compress) String() string {
+	return fmt.Sprintf("Compress(%v) %v->%v", o.Algorithm, o.Input, o.Output)
+}
+
+type Decompress struct {
+	Input     exec.VarID `json:"input"`
+	Output    exec.VarID `json:"output"`
+	Algorithm string     `json:"algorithm"`
+}
+
+func (o *Decompress) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
+	input, err := exec.BindVar[*exec.StreamValue](e, ctx.Context, o.Input)
+	if err != nil {
+		return err
+	}
+	defer input.Stream.Close()
+
+	if !isCompressAlgorithm(o.Algorithm) {
+		return fmt.Errorf("unsupported compress algorithm: %v", o.Algorithm)
+	}
+
+	// gzip在创建Reader时就会读取头部，因此延迟到第一次读取时再创建
+	rd := io2.Lazy(func() (io.ReadCloser, error) {
+		return newDecompressReader(o.Algorithm, input.Stream)
+	})
+
+	fut := future.NewSetVoid()
+	e.PutVar(o.Output, &exec.StreamValue{Stream: io2.AfterReadClosedOnce(rd, func(closer io.ReadCloser) {
+		fut.SetVoid()
+	})})
+
+	return fut.Wait(ctx.Context)
+}
+
+func (o *Decompress) EstimateMemory() int64 {
+	return 64 * 1024
+}
+
+func (o *Decompress) String() string {
+	return fmt.Sprintf("Decompress(%v) %v->%v", o.Algorithm, o.Input, o.Output)
+}
+
+func isCompressAlgorithm(alg string) bool {
+	return alg == CompressGzip || alg == CompressFlate
+}
+
+func newCompressWriter(alg string, w io.Writer, level int) (io.WriteCloser, error) {
+	switch alg {
+	case CompressGzip:
+		return gzip.NewWriterLevel(w, level)
+	case CompressFlate:
+		return flate.NewWriter(w, level)
+	default:
+		return nil, fmt.Errorf("unsupported compress algorithm: %v", alg)
+	}
+}
+
+func newDecompressReader(alg string, r io.Reader) (io.ReadCloser, error) {
+	switch alg {
+	case CompressGzip:
+		// 出错时gzip.NewReader返回的是nil的*gzip.Reader，不能直接作为io.ReadCloser返回
+		rd, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return rd, nil
+	case CompressFlate:
+		return flate.NewReader(r), nil
+	default:
+		return nil, fmt.Errorf("unsupported compress algorithm: %v", alg)
+	}
+}
+
+type CompressNode struct {
+	dag.NodeBase
+	Algorithm string
+	Level     int
+}
+
+func (b *GraphNodeBuilder) NewCompress(alg string, level int) *CompressNode {
+	node := &CompressNode{
+		Algorithm: alg,
+		Level:     level,
+	}
+	b.AddNode(node)
+
+	node.InputStreams().Init(1)
+	node.OutputStreams().Init(node, 1)
+	return node
+}
+
+func (t *CompressNode) SetInput(v *dag.StreamVar) {
+	v.To(t, 0)
+}
+
+func (t *CompressNode) Output() dag.StreamOutputSlot {
+	return dag.StreamOutputSlot{
+		Node:  t,
+		Index: 0,
+	}
+}
+
+func (t *CompressNode) GenerateOp() (exec.Op, error) {
+	return &Compress{
+		Input:     t.InputStreams().Get(0).VarID,
+		Output:    t.OutputStreams().Get(0).VarID,
+		Algorithm: t.Algorithm,
+		Level:     t.Level,
+	}, nil
+}
+
+type DecompressNode struct {
+	dag.NodeBase
+	Algorithm string
+}
+
+func (b *GraphNodeBuilder) NewDecompress(alg string) *DecompressNode {
+	node := &DecompressNode{
+		Algorithm: alg,
+	}
+	b.AddNode(node)
+
+	node.InputStreams().Init(1)
+	node.OutputStreams().Init(node, 1)
+	return node
+}
+
+func (t *DecompressNode) SetInput(v *dag.StreamVar) {
+	v.To(t, 0)
+}
+
+func (t *DecompressNode) Output() dag.StreamOutputSlot {
+	return dag.StreamOutputSlot{
+		Node:  t,
+		Index: 0,
+	}
+}
+
+func (t *DecompressNode) GenerateOp() (exec.Op, error) {
+	return &Decompress{
+		Input:     t.InputStreams().Get(0).VarID,
+		Output:    t.OutputStreams().Get(0).VarID,
+		Algorithm: t.Algorithm,
+	}, nil
+}
@@ -0,0 +1,63 @@
+package ops
+
+import (
+	"bytes"
+	"compress/flate"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
+)
+
+func Test_Compress(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1024)
+
+	Convey("压缩后解压", t, func() {
+		for _, alg := range []string{CompressGzip, CompressFlate} {
+			for _, level := range []int{flate.NoCompression, flate.DefaultCompression, flate.BestCompression} {
+				e, wait := runTestOps(map[exec.VarID]exec.VarValue{1: newTestStream(data)},
+					&Compress{Input: 1, Output: 2, Algorithm: alg, Level: level},
+					&Decompress{Input: 2, Output: 3, Algorithm: alg},
+				)
+
+				got, err := readTestStream(e, 3)
+				So(err, ShouldBeNil)
+				So(wait(), ShouldBeNil)
+				So(got, ShouldResemble, data)
+			}
+		}
+	})
+
+	Convey("级别为0时不压缩", t, func() {
+		compressedSize := func(level int) int {
+			e, wait := runTestOps(map[exec.VarID]exec.VarValue{1: newTestStream(data)},
+				&Compress{Input: 1, Output: 2, Algorithm: CompressFlate, Level: level},
+			)
+
+			got, err := readTestStream(e, 2)
+			So(err, ShouldBeNil)
+			So(wait(), ShouldBeNil)
+			return len(got)
+		}
+
+		So(compressedSize(flate.NoCompression), ShouldBeGreaterThan, len(data))
+		So(compressedSize(flate.DefaultCompression), ShouldBeLessThan, len(data)/10)
+	})
+
+	Convey("不支持的算法", t, func() {
+		_, wait := runTestOps(map[exec.VarID]exec.VarValue{1: newTestStream(data)},
+			&Decompress{Input: 1, Output: 2, Algorithm: "zip"},
+		)
+		So(wait(), ShouldNotBeNil)
+	})
+
+	Convey("解压损坏的数据", t, func() {
+		e, wait := runTestOps(map[exec.VarID]exec.VarValue{1: newTestStream([]byte("not gzip"))},
+			&Decompress{Input: 1, Output: 2, Algorithm: CompressGzip},
+		)
+
+		_, err := readTestStream(e, 2)
+		So(err, ShouldNotBeNil)
+		wait()
+	})
+}
@@ -0,0 +1,258 @@
+package ops
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"gitlink.org.cn/cloudream/common/pkgs/future"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/dag"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
+	"gitlink.org.cn/cloudream/common/utils/crypto2"
+	"gitlink.org.cn/cloudream/common/utils/io2"
+	"gitlink.org.cn/cloudream/common/utils/math2"
+)
+
+func init() {
+	exec.UseOp[*GCMEncrypt]()
+	exec.UseOp[*GCMDecrypt]()
+	exec.UseVarValue[*CipherKeyValue]()
+}
+
+// 加解密使用的密钥。注：不要在任何输出中包含密钥内容
+type CipherKeyValue struct {
+	Key []byte `json:"key"`
+}
+
+func (v *CipherKeyValue) Clone() exec.VarValue {
+	return &CipherKeyValue{Key: bytes.Clone(v.Key)}
+}
+
+func (v *CipherKeyValue) String() string {
+	return fmt.Sprintf("CipherKey(%d bytes)", len(v.Key))
+}
+
+func (v *CipherKeyValue) GoString() string {
+	return v.String()
+}
+
+type CipherKeyVar = exec.Var[*CipherKeyValue]
+
+func NewCipherKeyVar(id exec.VarID, key []byte) CipherKeyVar {
+	return CipherKeyVar{
+		ID:    id,
+		Value: &CipherKeyValue{Key: key},
+	}
+}
+
+// 将流加密为分块AES-GCM格式，格式定义见crypto2包
+type GCMEncrypt struct {
+	Key       exec.VarID `json:"key"`
+	Input     exec.VarID `json:"input"`
+	Output    exec.VarID `json:"output"`
+	ChunkSize int        `json:"chunkSize"`
+}
+
+func (o *GCMEncrypt) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
+	key, err := exec.BindVar[*CipherKeyValue](e, ctx.Context, o.Key)
+	if err != nil {
+		return err
+	}
+
+	input, err := exec.BindVar[*exec.StreamValue](e, ctx.Context, o.Input)
+	if err != nil {
+		return err
+	}
+	defer input.Stream.Close()
+
+	rd, err := crypto2.NewGCMEncryptReader(key.Key, input.Stream, o.ChunkSize)
+	if err != nil {
+		return fmt.Errorf("new encrypt reader: %w", err)
+	}
+
+	fut := future.NewSetVoid()
+	e.PutVar(o.Output, &exec.StreamValue{Stream: io2.AfterReadClosedOnce(io.NopCloser(rd), func(closer io.ReadCloser) {
+		fut.SetVoid()
+	})})
+
+	return fut.Wait(ctx.Context)
+}
+
+func (o *GCMEncrypt) EstimateMemory() int64 {
+	chunkSize := o.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = crypto2.GCMDefaultChunkSize
+	}
+
+	// 明文和密文各一个分块
+	return int64(chunkSize+crypto2.GCMTagSize) * 2
+}
+
+func (o *GCMEncrypt) String() string {
+	return fmt.Sprintf("GCMEncrypt(K:%v) %v->%v", o.Key, o.Input, o.Output)
+}
+
+// 解密分块AES-GCM格式的流。
+//
+// 如果Header为nil，则Input应该是包含头部的完整密文流，此时忽略Range。
+// 否则Header应该是密文头部的流，Input是crypto2.GCMCipherRange(Range)所对应的密文，输出Range范围内的明文。
+type GCMDecrypt struct {
+	Key    exec.VarID  `json:"key"`
+	Header *exec.VarID `json:"header"`
+	Input  exec.VarID  `json:"input"`
+	Output exec.VarID  `json:"output"`
+	Range  math2.Range `json:"range"`
+}
+
+func (o *GCMDecrypt) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
+	key, err := exec.BindVar[*CipherKeyValue](e, ctx.Context, o.Key)
+	if err != nil {
+		return err
+	}
+
+	input, err := exec.BindVar[*exec.StreamValue](e, ctx.Context, o.Input)
+	if err != nil {
+		return err
+	}
+	defer input.Stream.Close()
+
+	var rd io.Reader
+	if o.Header == nil {
+		rd, err = crypto2.NewGCMDecryptReader(key.Key, input.Stream)
+		if err != nil {
+			return fmt.Errorf("new decrypt reader: %w", err)
+		}
+	} else {
+		hdrStr, err := exec.BindVar[*exec.StreamValue](e, ctx.Context, *o.Header)
+		if err != nil {
+			return err
+		}
+
+		hdr, err := crypto2.ReadGCMHeader(hdrStr.Stream)
+		hdrStr.Stream.Close()
+		if err != nil {
+			return err
+		}
+
+		rd, err = crypto2.NewGCMRangeDecryptReader(key.Key, hdr, input.Stream, o.Range)
+		if err != nil {
+			return fmt.Errorf("new decrypt reader: %w", err)
+		}
+	}
+
+	fut := future.NewSetVoid()
+	e.PutVar(o.Output, &exec.StreamValue{Stream: io2.AfterReadClosedOnce(io.NopCloser(rd), func(closer io.ReadCloser) {
+		fut.SetVoid()
+	})})
+
+	return fut.Wait(ctx.Context)
+}
+
+// 分块大小记录在密文头部中，执行前无法知道，因此按照默认分块大小估计
+func (o *GCMDecrypt) EstimateMemory() int64 {
+	return int64(crypto2.GCMDefaultChunkSize+crypto2.GCMTagSize) * 2
+}
+
+func (o *GCMDecrypt) String() string {
+	if o.Header == nil {
+		return fmt.Sprintf("GCMDecrypt(K:%v) %v->%v", o.Key, o.Input, o.Output)
+	}
+
+	start, end := o.Range.ToStartEnd()
+	return fmt.Sprintf("GCMDecrypt(K:%v)[%v:%v] (H:%v)%v->%v", o.Key, start, end, *o.Header, o.Input, o.Output)
+}
+
+type GCMEncryptNode struct {
+	dag.NodeBase
+	ChunkSize int
+}
+
+func (b *GraphNodeBuilder) NewGCMEncrypt(chunkSize int) *GCMEncryptNode {
+	node := &GCMEncryptNode{
+		ChunkSize: chunkSize,
+	}
+	b.AddNode(node)
+
+	node.InputValues().Init(1)
+	node.InputStreams().Init(1)
+	node.OutputStreams().Init(node, 1)
+	return node
+}
+
+func (t *GCMEncryptNode) SetKey(v *dag.ValueVar) {
+	v.To(t, 0)
+}
+
+func (t *GCMEncryptNode) SetInput(v *dag.StreamVar) {
+	v.To(t, 0)
+}
+
+func (t *GCMEncryptNode) Output() dag.StreamOutputSlot {
+	return dag.StreamOutputSlot{
+		Node:  t,
+		Index: 0,
+	}
+}
+
+func (t *GCMEncryptNode) GenerateOp() (exec.Op, error) {
+	return &GCMEncrypt{
+		Key:       t.InputValues().Get(0).VarID,
+		Input:     t.InputStreams().Get(0).VarID,
+		Output:    t.OutputStreams().Get(0).VarID,
+		ChunkSize: t.ChunkSize,
+	}, nil
+}
+
+type GCMDecryptNode struct {
+	dag.NodeBase
+	Range math2.Range
+}
+
+// 输入流槽位0为密文，槽位1为密文头部（仅范围解密时使用）
+func (b *GraphNodeBuilder) NewGCMDecrypt() *GCMDecryptNode {
+	node := &GCMDecryptNode{}
+	b.AddNode(node)
+
+	node.InputValues().Init(1)
+	node.InputStreams().Init(2)
+	node.OutputStreams().Init(node, 1)
+	return node
+}
+
+func (t *GCMDecryptNode) SetKey(v *dag.ValueVar) {
+	v.To(t, 0)
+}
+
+// 输入包含头部的完整密文
+func (t *GCMDecryptNode) SetInput(v *dag.StreamVar) {
+	v.To(t, 0)
+}
+
+// 范围解密。header为密文头部，data为crypto2.GCMCipherRange(rng)所对应的密文
+func (t *GCMDecryptNode) SetRangedInput(header *dag.StreamVar, data *dag.StreamVar, rng math2.Range) {
+	data.To(t, 0)
+	header.To(t, 1)
+	t.Range = rng
+}
+
+func (t *GCMDecryptNode) Output() dag.StreamOutputSlot {
+	return dag.StreamOutputSlot{
+		Node:  t,
+		Index: 0,
+	}
+}
+
+func (t *GCMDecryptNode) GenerateOp() (exec.Op, error) {
+	op := &GCMDecrypt{
+		Key:    t.InputValues().Get(0).VarID,
+		Input:  t.InputStreams().Get(0).VarID,
+		Output: t.OutputStreams().Get(0).VarID,
+	}
+
+	if hdr := t.InputStreams().Get(1); hdr != nil {
+		op.Header = &hdr.VarID
+		op.Range = t.Range
+	}
+
+	return op, nil
+}
@@ -29,6 +29,23 @@ func (t *FromDriverNode) Output() dag.StreamOutputSlot {
 	}
 }
 
+// 恢复执行时，ToDriverNode已经读取过的数据会通过这个函数传递过来，调整Handle的RangeHint，
+// 之后通过BeginWrite写入的流就不会再包含这部分数据
+func (t *FromDriverNode) SkipOutput(b *GraphNodeBuilder, idx int, skip int64) bool {
+	var rng math2.Range
+	if t.Handle.RangeHint != nil {
+		rng = *t.Handle.RangeHint
+	}
+
+	rng.Offset += skip
+	if rng.Length != nil {
+		length := *rng.Length - skip
+		rng.Length = &length
+	}
+	t.Handle.RangeHint = &rng
+	return true
+}
+
 func (t *FromDriverNode) GenerateOp() (exec.Op, error) {
 	t.Handle.ID = t.OutputStreams().Get(0).VarID
 	return nil, nil
@@ -40,8 +57,9 @@ func (t *FromDriverNode) GenerateOp() (exec.Op, error) {
 
 type ToDriverNode struct {
 	dag.NodeBase
-	Handle *exec.DriverReadStream
-	Range  math2.Range
+	Handle     *exec.DriverReadStream
+	Range      math2.Range
+	Checkpoint string // 检查点名称，为空则不记录读取进度，也不能跳过已经读取的部分
 }
 
 func (b *GraphNodeBuilder) NewToDriver(handle *exec.DriverReadStream) *ToDriverNode {
@@ -65,8 +83,35 @@ func (t *ToDriverNode) Input() dag.StreamOutputSlot {
 	}
 }
 
+// 恢复执行时，如果检查点已经完成，则移除这个节点，否则让输入流跳过已经读取过的部分
+func (t *ToDriverNode) ApplyPlanState(b *GraphNodeBuilder, state *exec.PlanState) bool {
+	if t.Checkpoint == "" {
+		return false
+	}
+
+	if state.IsCompleted(t.Checkpoint) {
+		t.Handle.ID = 0
+		return true
+	}
+
+	skip := state.Offset(t.Checkpoint)
+	if skip > 0 && t.InputStreams().Get(0) != nil {
+		b.SkipInput(t, 0, skip)
+
+		t.Range.Offset += skip
+		if t.Range.Length != nil {
+			length := *t.Range.Length - skip
+			t.Range.Length = &length
+		}
+	}
+
+	return false
+}
+
 func (t *ToDriverNode) GenerateOp() (exec.Op, error) {
 	t.Handle.ID = t.InputStreams().Get(0).VarID
+	t.Handle.RangeHint = &t.Range
+	t.Handle.Checkpoint = t.Checkpoint
 	return nil, nil
 }
 
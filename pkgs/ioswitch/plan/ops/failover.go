@@ -0,0 +1,388 @@
+package ops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/hashicorp/go-multierror"
+	"gitlink.org.cn/cloudream/common/pkgs/future"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/dag"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/utils"
+	"gitlink.org.cn/cloudream/common/utils/io2"
+	"gitlink.org.cn/cloudream/common/utils/math2"
+)
+
+func init() {
+	exec.UseOp[*Failover]()
+	exec.UseOp[*Fallible]()
+	exec.UseOp[*LazySource]()
+	exec.UseVarValue[*FailoverOpenValue]()
+}
+
+// 来源没有被Failover指令使用时，它的输出流会返回这个错误
+var ErrSourceNotUsed = errors.New("source not used by failover")
+
+// 可以只读取部分数据的来源指令。作为Failover的来源时，切换到这个来源后会直接从已经输出的位置开始读取，
+// 而不需要从头读取再丢弃已经输出的部分。
+type RangedSource interface {
+	exec.Op
+	// 返回只读取rng范围内的数据的指令，rng是相对于这个指令原本输出的流的范围
+	WithRange(rng math2.Range) exec.Op
+}
+
+// Failover指令发给来源的打开请求
+type FailoverOpenValue struct {
+	Range math2.Range `json:"range"` // 需要读取的范围，只对RangedSource有效
+	Skip  bool        `json:"skip"`  // 为true代表不再需要这个来源
+}
+
+func (v *FailoverOpenValue) Clone() exec.VarValue {
+	rng := v.Range
+	if rng.Length != nil {
+		length := *rng.Length
+		rng.Length = &length
+	}
+	return &FailoverOpenValue{Range: rng, Skip: v.Skip}
+}
+
+type FailoverSource struct {
+	Input exec.VarID `json:"input"`
+	// 需要使用这个来源时，会在此变量上放入一个FailoverOpenValue，不再需要时则放入Skip为true的值。
+	// 为nil代表来源的流在计划开始时就已经准备好
+	Open *exec.VarID `json:"open"`
+	// 来源是否会按照打开请求中的范围输出数据。为false则从头读取，并丢弃已经输出过的部分
+	Ranged bool `json:"ranged"`
+}
+
+// 从多个内容相同的来源中选择第一个可用的来源作为输出。来源按照Sources中的顺序依次打开，
+// 只有在前一个来源失败时才会打开下一个来源。
+//
+// 如果来源在输出第一个字节之前失败，则切换到下一个来源。如果Resume为true，
+// 那么即使已经输出了一部分数据，也会切换到下一个来源，并从已经输出的位置继续读取。
+type Failover struct {
+	Sources []FailoverSource `json:"sources"`
+	Output  exec.VarID       `json:"output"`
+	Resume  bool             `json:"resume"`
+	Length  *int64           `json:"length"` // 流的预期长度。如果来源在达到这个长度之前就结束了，也视为来源失败。为nil则不检查
+}
+
+func (o *Failover) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
+	reader := &failoverReader{
+		ctx:     ctx.Context,
+		exe:     e,
+		sources: o.Sources,
+		resume:  o.Resume,
+		length:  o.Length,
+	}
+
+	fut := future.NewSetVoid()
+	e.PutVar(o.Output, &exec.StreamValue{Stream: io2.AfterReadClosedOnce(reader, func(closer io.ReadCloser) {
+		fut.SetVoid()
+	})})
+
+	err := fut.Wait(ctx.Context)
+
+	// 没有用到的来源也需要通知并关闭，否则产生这些流的指令会一直等待。
+	// 来源可能在无法访问或者没有响应的Worker上，所以不等待它们的流
+	for _, src := range o.Sources[reader.next:] {
+		if src.Open != nil {
+			e.PutVar(*src.Open, &FailoverOpenValue{Skip: true})
+		}
+
+		go func(input exec.VarID) {
+			str, err := exec.BindVar[*exec.StreamValue](e, ctx.Context, input)
+			if err == nil {
+				str.Stream.Close()
+			}
+		}(src.Input)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return reader.failed
+}
+
+func (o *Failover) String() string {
+	var inputs []exec.VarID
+	for _, src := range o.Sources {
+		inputs = append(inputs, src.Input)
+	}
+	return fmt.Sprintf("Failover(resume:%v) (%v)->%v", o.Resume, utils.FormatVarIDs(inputs), o.Output)
+}
+
+type failoverReader struct {
+	ctx     context.Context
+	exe     *exec.Executor
+	sources []FailoverSource
+	resume  bool
+	length  *int64
+	next    int
+	cur     io.ReadCloser
+	pos     int64
+	srcErrs error
+	failed  error
+}
+
+func (r *failoverReader) Read(p []byte) (int, error) {
+	for {
+		if r.failed != nil {
+			return 0, r.failed
+		}
+
+		if r.cur == nil {
+			if err := r.openNext(); err != nil {
+				r.failed = err
+				return 0, err
+			}
+		}
+
+		n, err := r.cur.Read(p)
+		r.pos += int64(n)
+
+		if err == nil {
+			return n, nil
+		}
+
+		if err == io.EOF {
+			if r.length == nil || r.pos >= *r.length {
+				return n, io.EOF
+			}
+
+			err = io.ErrUnexpectedEOF
+		}
+
+		r.sourceFailed(err)
+
+		if r.pos > 0 && !r.resume {
+			r.failed = fmt.Errorf("source %v failed after %v bytes read: %w", r.next-1, r.pos, err)
+			return n, r.failed
+		}
+
+		// 已经读到的数据先返回，下次读取时再切换来源
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (r *failoverReader) Close() error {
+	if r.cur != nil {
+		r.cur.Close()
+		r.cur = nil
+	}
+	return nil
+}
+
+func (r *failoverReader) sourceFailed(err error) {
+	r.srcErrs = multierror.Append(r.srcErrs, fmt.Errorf("source %v: %w", r.next-1, err))
+	r.cur.Close()
+	r.cur = nil
+}
+
+func (r *failoverReader) openNext() error {
+	for r.next < len(r.sources) {
+		src := r.sources[r.next]
+		r.next++
+
+		// 支持范围读取的来源直接从已经输出的位置开始读取
+		var offset int64
+		if src.Ranged {
+			offset = r.pos
+		}
+
+		if src.Open != nil {
+			rng := math2.Range{Offset: offset}
+			if r.length != nil {
+				length := *r.length - offset
+				rng.Length = &length
+			}
+			r.exe.PutVar(*src.Open, &FailoverOpenValue{Range: rng})
+		}
+
+		str, err := exec.BindVar[*exec.StreamValue](r.exe, r.ctx, src.Input)
+		if err != nil {
+			return err
+		}
+
+		r.cur = str.Stream
+		if r.pos == offset {
+			return nil
+		}
+
+		// 不支持范围读取的来源，需要跳过已经读取过的部分
+		_, err = io.CopyN(io.Discard, r.cur, r.pos-offset)
+		if err == nil {
+			return nil
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		r.sourceFailed(err)
+	}
+
+	if r.srcErrs == nil {
+		return errors.New("no source available")
+	}
+
+	return fmt.Errorf("all sources failed: %w", r.srcErrs)
+}
+
+// 收到Failover指令的打开请求之后才执行的来源指令，使得来源按照Failover的需要依次打开。
+//
+// 如果Op实现了RangedSource，则只读取打开请求中的范围，否则原样执行Op。
+// 如果Failover不再需要这个来源，则不会执行Op，而是让输出流在读取时返回ErrSourceNotUsed。
+type LazySource struct {
+	Open    exec.VarID   `json:"open"`
+	Op      exec.Op      `json:"op"`
+	Outputs []exec.VarID `json:"outputs"`
+}
+
+func (o *LazySource) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
+	open, err := exec.BindVar[*FailoverOpenValue](e, ctx.Context, o.Open)
+	if err != nil {
+		return err
+	}
+
+	if open.Skip {
+		for _, id := range o.Outputs {
+			e.PutVar(id, &exec.StreamValue{Stream: io2.ErrorReader(ErrSourceNotUsed)})
+		}
+		return nil
+	}
+
+	op := o.Op
+	if ranged, ok := op.(RangedSource); ok {
+		op = ranged.WithRange(open.Range)
+	}
+
+	return op.Execute(ctx, e)
+}
+
+func (o *LazySource) EstimateMemory() int64 {
+	if est, ok := o.Op.(exec.MemoryEstimator); ok {
+		return est.EstimateMemory()
+	}
+	return 0
+}
+
+func (o *LazySource) String() string {
+	return fmt.Sprintf("LazySource(O:%v)(%v)", o.Open, o.Op)
+}
+
+// 执行一个指令，但指令失败时不会导致整个计划失败，而是让它的输出流在读取时返回这个错误。
+// 一般用于包装只为Failover指令提供数据的指令。
+//
+// 被包装的指令需要保证在返回错误之前没有输出过流，否则输出流会被重复设置。
+type Fallible struct {
+	Op      exec.Op      `json:"op"`
+	Outputs []exec.VarID `json:"outputs"`
+}
+
+func (o *Fallible) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
+	err := o.Op.Execute(ctx, e)
+	if err == nil {
+		return nil
+	}
+
+	// 计划被取消时不需要再处理
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	for _, id := range o.Outputs {
+		e.PutVar(id, &exec.StreamValue{Stream: io2.ErrorReader(fmt.Errorf("%T: %w", o.Op, err))})
+	}
+
+	return nil
+}
+
+func (o *Fallible) EstimateMemory() int64 {
+	if est, ok := o.Op.(exec.MemoryEstimator); ok {
+		return est.EstimateMemory()
+	}
+	return 0
+}
+
+func (o *Fallible) String() string {
+	return fmt.Sprintf("Fallible(%v)", o.Op)
+}
+
+type FailoverNode struct {
+	dag.NodeBase
+	Resume  bool
+	Length  *int64
+	sources []FailoverNodeSource
+}
+
+type FailoverNodeSource struct {
+	Node dag.Node
+	// 打开请求在来源节点的输入值中的位置
+	OpenIndex int
+}
+
+func (b *GraphNodeBuilder) NewFailover(resume bool, length *int64) *FailoverNode {
+	node := &FailoverNode{
+		Resume: resume,
+		Length: length,
+	}
+	b.AddNode(node)
+
+	node.OutputStreams().Init(node, 1)
+	return node
+}
+
+// 添加一个来源。先添加的来源会被优先使用。
+//
+// 只为Failover节点提供数据的节点，以及把打开请求发送到来源所在Worker的节点，在失败时不会导致整个计划失败，
+// 如果一个Worker上的所有指令都是这种节点，那么这个Worker本身出现故障也不会影响计划。
+//
+// 来源节点会多出一个输入值，用于接收Failover节点的打开请求。生成计划时，只为Failover节点提供数据的来源节点
+// 会在收到打开请求之后才执行，如果它的指令实现了RangedSource，那么切换来源时会直接从已经输出的位置开始读取。
+func (t *FailoverNode) AddInput(str *dag.StreamVar) {
+	str.To(t, t.InputStreams().EnlargeOne())
+
+	src := str.Src
+	openIdx := src.InputValues().EnlargeOne()
+	t.OutputValues().AppendNew(t).Var().To(src, openIdx)
+
+	t.sources = append(t.sources, FailoverNodeSource{
+		Node:      src,
+		OpenIndex: openIdx,
+	})
+}
+
+// 按照添加的顺序返回所有来源节点
+func (t *FailoverNode) Sources() []FailoverNodeSource {
+	return t.sources
+}
+
+func (t *FailoverNode) Output() dag.StreamOutputSlot {
+	return dag.StreamOutputSlot{
+		Node:  t,
+		Index: 0,
+	}
+}
+
+func (t *FailoverNode) GenerateOp() (exec.Op, error) {
+	op := &Failover{
+		Output: t.OutputStreams().Get(0).VarID,
+		Resume: t.Resume,
+		Length: t.Length,
+	}
+
+	for i := 0; i < t.InputStreams().Len(); i++ {
+		open := t.OutputValues().Get(i).VarID
+		op.Sources = append(op.Sources, FailoverSource{
+			Input: t.InputStreams().Get(i).VarID,
+			Open:  &open,
+		})
+	}
+
+	return op, nil
+}
@@ -0,0 +1,278 @@
+package ops
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
+	"gitlink.org.cn/cloudream/common/utils/io2"
+	"gitlink.org.cn/cloudream/common/utils/math2"
+	"gitlink.org.cn/cloudream/common/utils/serder"
+)
+
+var errTestSource = errors.New("test source failed")
+
+// 记录测试来源被执行时的范围
+type testSourceLog struct {
+	lock   sync.Mutex
+	opened []string
+}
+
+func (l *testSourceLog) add(name string, rng math2.Range) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	length := "-"
+	if rng.Length != nil {
+		length = fmt.Sprintf("%d", *rng.Length)
+	}
+	l.opened = append(l.opened, fmt.Sprintf("%s:%d+%s", name, rng.Offset, length))
+}
+
+func (l *testSourceLog) get() []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return append([]string{}, l.opened...)
+}
+
+// 测试用的来源，输出Data中Range范围内的数据。FailAt大于等于0时，输出到Data的第FailAt个字节时返回错误
+type testRangedSource struct {
+	Name    string
+	Output  exec.VarID
+	Data    []byte
+	FailAt  int
+	OpenErr bool
+	Range   math2.Range
+	Log     *testSourceLog
+}
+
+func (o *testRangedSource) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
+	o.Log.add(o.Name, o.Range)
+	if o.OpenErr {
+		return errTestSource
+	}
+
+	start := int(o.Range.Offset)
+	end := len(o.Data)
+	if o.Range.Length != nil {
+		end = math2.Min(end, start+int(*o.Range.Length))
+	}
+
+	var str io.Reader = bytes.NewReader(o.Data[start:end])
+	if o.FailAt >= 0 && o.FailAt < end {
+		str = io.MultiReader(bytes.NewReader(o.Data[start:o.FailAt]), io2.ErrorReader(errTestSource))
+	}
+
+	e.PutVar(o.Output, &exec.StreamValue{Stream: io.NopCloser(str)})
+	return nil
+}
+
+func (o *testRangedSource) WithRange(rng math2.Range) exec.Op {
+	cp := *o
+	cp.Range = rng
+	return &cp
+}
+
+func (o *testRangedSource) String() string {
+	return o.Name
+}
+
+// 不支持范围读取的测试来源
+type testPlainSource struct {
+	src testRangedSource
+}
+
+func (o *testPlainSource) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
+	return o.src.Execute(ctx, e)
+}
+
+func (o *testPlainSource) String() string {
+	return o.src.Name
+}
+
+func Test_Failover(t *testing.T) {
+	data := make([]byte, 100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	length := int64(len(data))
+
+	// 按照生成计划时的方式包装来源，第i个来源的输出为i+1，打开请求为i+11，Failover的输出为100
+	newPlan := func(resume bool, srcs ...exec.Op) ([]exec.Op, *Failover) {
+		failover := &Failover{
+			Output: 100,
+			Resume: resume,
+			Length: &length,
+		}
+
+		var ops []exec.Op
+		for i, src := range srcs {
+			output := exec.VarID(i + 1)
+			open := exec.VarID(i + 11)
+			_, ranged := src.(RangedSource)
+
+			ops = append(ops, &Fallible{
+				Op:      &LazySource{Open: open, Op: src, Outputs: []exec.VarID{output}},
+				Outputs: []exec.VarID{output},
+			})
+			failover.Sources = append(failover.Sources, FailoverSource{Input: output, Open: &open, Ranged: ranged})
+		}
+
+		return append(ops, failover), failover
+	}
+
+	Convey("只打开第一个来源，其他来源收到不再需要的通知", t, func() {
+		log := &testSourceLog{}
+		ops, _ := newPlan(false,
+			&testRangedSource{Name: "s1", Output: 1, Data: data, FailAt: -1, Log: log},
+			&testRangedSource{Name: "s2", Output: 2, Data: data, FailAt: -1, Log: log},
+			&testRangedSource{Name: "s3", Output: 3, Data: data, FailAt: -1, Log: log},
+		)
+
+		e, wait := runTestOps(nil, ops...)
+		str, err := exec.BindVar[*exec.StreamValue](e, context.Background(), 100)
+		So(err, ShouldBeNil)
+
+		// 开始读取之前不会打开任何来源
+		So(log.get(), ShouldBeEmpty)
+
+		got, err := io.ReadAll(str.Stream)
+		So(err, ShouldBeNil)
+		So(got, ShouldResemble, data)
+		str.Stream.Close()
+
+		So(wait(), ShouldBeNil)
+		So(log.get(), ShouldResemble, []string{"s1:0+100"})
+	})
+
+	Convey("来源打开失败时按顺序打开下一个来源", t, func() {
+		log := &testSourceLog{}
+		ops, _ := newPlan(false,
+			&testRangedSource{Name: "s1", Output: 1, Data: data, OpenErr: true, Log: log},
+			&testRangedSource{Name: "s2", Output: 2, Data: data, FailAt: -1, Log: log},
+			&testRangedSource{Name: "s3", Output: 3, Data: data, FailAt: -1, Log: log},
+		)
+
+		e, wait := runTestOps(nil, ops...)
+		got, err := readTestStream(e, 100)
+		So(err, ShouldBeNil)
+		So(got, ShouldResemble, data)
+
+		So(wait(), ShouldBeNil)
+		So(log.get(), ShouldResemble, []string{"s1:0+100", "s2:0+100"})
+	})
+
+	Convey("读取中途失败，从已经输出的位置开始读取下一个来源", t, func() {
+		log := &testSourceLog{}
+		ops, _ := newPlan(true,
+			&testRangedSource{Name: "s1", Output: 1, Data: data, FailAt: 40, Log: log},
+			&testRangedSource{Name: "s2", Output: 2, Data: data, FailAt: 70, Log: log},
+			&testRangedSource{Name: "s3", Output: 3, Data: data, FailAt: -1, Log: log},
+		)
+
+		e, wait := runTestOps(nil, ops...)
+		got, err := readTestStream(e, 100)
+		So(err, ShouldBeNil)
+		So(got, ShouldResemble, data)
+
+		So(wait(), ShouldBeNil)
+		So(log.get(), ShouldResemble, []string{"s1:0+100", "s2:40+60", "s3:70+30"})
+	})
+
+	Convey("读取中途失败，不支持范围读取的来源从头读取并丢弃已经输出的部分", t, func() {
+		log := &testSourceLog{}
+		ops, failover := newPlan(true,
+			&testRangedSource{Name: "s1", Output: 1, Data: data, FailAt: 40, Log: log},
+			&testPlainSource{src: testRangedSource{Name: "s2", Output: 2, Data: data, FailAt: -1, Log: log}},
+		)
+		So(failover.Sources[1].Ranged, ShouldBeFalse)
+
+		e, wait := runTestOps(nil, ops...)
+		got, err := readTestStream(e, 100)
+		So(err, ShouldBeNil)
+		So(got, ShouldResemble, data)
+
+		So(wait(), ShouldBeNil)
+		So(log.get(), ShouldResemble, []string{"s1:0+100", "s2:0+-"})
+	})
+
+	Convey("不允许恢复时，读取中途失败直接返回错误", t, func() {
+		log := &testSourceLog{}
+		ops, _ := newPlan(false,
+			&testRangedSource{Name: "s1", Output: 1, Data: data, FailAt: 40, Log: log},
+			&testRangedSource{Name: "s2", Output: 2, Data: data, FailAt: -1, Log: log},
+		)
+
+		e, wait := runTestOps(nil, ops...)
+		_, err := readTestStream(e, 100)
+		So(errors.Is(err, errTestSource), ShouldBeTrue)
+
+		So(wait(), ShouldNotBeNil)
+		So(log.get(), ShouldResemble, []string{"s1:0+100"})
+	})
+
+	Convey("所有来源都失败", t, func() {
+		log := &testSourceLog{}
+		ops, _ := newPlan(true,
+			&testRangedSource{Name: "s1", Output: 1, Data: data, OpenErr: true, Log: log},
+			&testRangedSource{Name: "s2", Output: 2, Data: data, FailAt: 30, Log: log},
+			&testRangedSource{Name: "s3", Output: 3, Data: data[:50], FailAt: -1, Log: log},
+		)
+
+		e, wait := runTestOps(nil, ops...)
+		got, err := readTestStream(e, 100)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "all sources failed")
+		So(errors.Is(err, errTestSource), ShouldBeTrue)
+		So(errors.Is(err, io.ErrUnexpectedEOF), ShouldBeTrue)
+		So(got, ShouldResemble, data[:50])
+
+		So(wait(), ShouldNotBeNil)
+		So(log.get(), ShouldResemble, []string{"s1:0+100", "s2:0+100", "s3:30+70"})
+	})
+
+	Convey("JSON序列化", t, func() {
+		open := exec.VarID(3)
+		plan := exec.Plan{
+			Ops: []exec.Op{
+				&Fallible{
+					Op: &LazySource{
+						Open:    open,
+						Op:      &Compress{Input: 1, Output: 2, Algorithm: "gzip", Level: 0},
+						Outputs: []exec.VarID{2},
+					},
+					Outputs: []exec.VarID{2},
+				},
+				&Failover{
+					Sources: []FailoverSource{{Input: 2, Open: &open, Ranged: true}, {Input: 4}},
+					Output:  5,
+					Resume:  true,
+					Length:  &length,
+				},
+			},
+		}
+
+		data, err := serder.ObjectToJSONEx(plan)
+		So(err, ShouldBeNil)
+
+		ret, err := serder.JSONToObjectEx[exec.Plan](data)
+		So(err, ShouldBeNil)
+		So(ret, ShouldResemble, plan)
+
+		openLen := int64(10)
+		var val exec.VarValue = &FailoverOpenValue{Range: math2.Range{Offset: 5, Length: &openLen}}
+		data, err = serder.ObjectToJSONEx(val)
+		So(err, ShouldBeNil)
+
+		retVal, err := serder.JSONToObjectEx[exec.VarValue](data)
+		So(err, ShouldBeNil)
+		So(retVal, ShouldResemble, val)
+	})
+}
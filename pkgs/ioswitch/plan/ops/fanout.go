@@ -0,0 +1,112 @@
+package ops
+
+import (
+	"fmt"
+
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/dag"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/utils"
+	"gitlink.org.cn/cloudream/common/utils/io2"
+)
+
+func init() {
+	exec.UseOp[*FanOut]()
+}
+
+const (
+	// 锁步复制：每次从输入流读取一小块数据，所有输出流都读取完这块数据之后才读取下一块
+	FanOutLockStep = "lockStep"
+	// 每个输出流有一个大小为BufferSize的缓冲区，缓冲区满时才会阻塞其他输出流
+	FanOutBuffered = "buffered"
+	// 与FanOutBuffered相同，但缓冲区满时会将数据写入到临时文件，因此读取慢的输出流不会阻塞其他输出流
+	FanOutSpill = "spill"
+)
+
+const fanOutLockStepSize = 16 * 1024
+
+// 将一个流复制给多个接收者。任何一个输出流在读取完毕之前被关闭，都会停止读取输入流，
+// 其他输出流在读取时会返回错误，指令本身也会返回错误。
+type FanOut struct {
+	Input      exec.VarID   `json:"input"`
+	Outputs    []exec.VarID `json:"outputs"`
+	Policy     string       `json:"policy"`
+	BufferSize int          `json:"bufferSize"` // 每个输出流的内存缓冲区大小，对FanOutLockStep无效
+	TempDir    string       `json:"tempDir"`    // FanOutSpill使用的临时文件目录，为空则使用系统的临时目录
+}
+
+func (o *FanOut) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
+	input, err := exec.BindVar[*exec.StreamValue](e, ctx.Context, o.Input)
+	if err != nil {
+		return err
+	}
+	defer input.Stream.Close()
+
+	var group *io2.CloneGroup
+	switch o.Policy {
+	case FanOutLockStep:
+		group = io2.NewLockStepCloneGroup(input.Stream, len(o.Outputs), fanOutLockStepSize)
+	case FanOutBuffered:
+		group = io2.NewBufferedCloneGroup(input.Stream, len(o.Outputs), o.BufferSize)
+	case FanOutSpill:
+		group = io2.NewSpillCloneGroup(input.Stream, len(o.Outputs), o.BufferSize, o.TempDir)
+	default:
+		return fmt.Errorf("unknown fan out policy: %v", o.Policy)
+	}
+
+	for i, str := range group.Outputs {
+		e.PutVar(o.Outputs[i], &exec.StreamValue{Stream: str})
+	}
+
+	// 是否提前关闭由复制器根据输入流是否全部交付给了输出流来判断，
+	// 因此读取了所有数据但没有读到EOF就关闭的输出流（比如Range）不会被当作错误
+	return group.Wait(ctx.Context)
+}
+
+func (o *FanOut) EstimateMemory() int64 {
+	if o.Policy == FanOutLockStep {
+		return int64(fanOutLockStepSize * len(o.Outputs))
+	}
+
+	return int64(o.BufferSize * len(o.Outputs))
+}
+
+func (o *FanOut) String() string {
+	return fmt.Sprintf("FanOut(%v) %v->(%v)", o.Policy, o.Input, utils.FormatVarIDs(o.Outputs))
+}
+
+type FanOutNode struct {
+	dag.NodeBase
+	Policy     string
+	BufferSize int
+	TempDir    string
+}
+
+func (b *GraphNodeBuilder) NewFanOut(policy string, bufferSize int) *FanOutNode {
+	node := &FanOutNode{
+		Policy:     policy,
+		BufferSize: bufferSize,
+	}
+	b.AddNode(node)
+
+	node.InputStreams().Init(1)
+	return node
+}
+
+func (t *FanOutNode) SetInput(v *dag.StreamVar) {
+	v.To(t, 0)
+}
+
+// 增加一个输出流
+func (t *FanOutNode) NewOutput() dag.StreamOutputSlot {
+	return t.OutputStreams().AppendNew(t)
+}
+
+func (t *FanOutNode) GenerateOp() (exec.Op, error) {
+	return &FanOut{
+		Input:      t.InputStreams().Get(0).VarID,
+		Outputs:    t.OutputStreams().GetVarIDs(),
+		Policy:     t.Policy,
+		BufferSize: t.BufferSize,
+		TempDir:    t.TempDir,
+	}, nil
+}
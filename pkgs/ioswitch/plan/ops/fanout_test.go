@@ -0,0 +1,66 @@
+package ops
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
+	"gitlink.org.cn/cloudream/common/utils/io2"
+	"gitlink.org.cn/cloudream/common/utils/math2"
+)
+
+func Test_FanOut(t *testing.T) {
+	data := make([]byte, 1024*100)
+	for i := range data {
+		data[i] = byte(i * 5)
+	}
+
+	type result struct {
+		got2  []byte
+		err2  error
+		got4  []byte
+		err4  error
+		opErr error
+	}
+
+	// FanOut的输出2直接读取，输出3经过Range之后从4读取
+	run := func(policy string, rng math2.Range) result {
+		var ret result
+		e, wait := runTestOps(map[exec.VarID]exec.VarValue{1: newTestStream(data)},
+			&FanOut{Input: 1, Outputs: []exec.VarID{2, 3}, Policy: policy, BufferSize: 1000, TempDir: t.TempDir()},
+			&RangeStream{Input: 3, Output: 4, Range: rng},
+		)
+
+		done := make(chan any)
+		go func() {
+			defer close(done)
+			ret.got4, ret.err4 = readTestStream(e, 4)
+		}()
+		ret.got2, ret.err2 = readTestStream(e, 2)
+		<-done
+
+		ret.opErr = wait()
+		return ret
+	}
+
+	for _, policy := range []string{FanOutLockStep, FanOutBuffered, FanOutSpill} {
+		Convey(policy+"：Range读取了所有数据，没有读到EOF就关闭", t, func() {
+			length := int64(len(data))
+			ret := run(policy, math2.Range{Length: &length})
+			So(ret.err2, ShouldBeNil)
+			So(ret.got2, ShouldResemble, data)
+			So(ret.err4, ShouldBeNil)
+			So(ret.got4, ShouldResemble, data)
+			So(ret.opErr, ShouldBeNil)
+		})
+
+		Convey(policy+"：Range只读取了一部分数据就关闭", t, func() {
+			length := int64(len(data) / 2)
+			ret := run(policy, math2.Range{Length: &length})
+			So(ret.err4, ShouldBeNil)
+			So(ret.got4, ShouldResemble, data[:len(data)/2])
+			So(errors.Is(ret.opErr, io2.ErrCloneClosedEarly), ShouldBeTrue)
+		})
+	}
+}
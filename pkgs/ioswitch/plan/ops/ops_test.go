@@ -0,0 +1,44 @@
+package ops
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
+)
+
+// 在当前进程中执行ops，返回执行器以及等待执行结束的函数
+func runTestOps(inputs map[exec.VarID]exec.VarValue, ops ...exec.Op) (*exec.Executor, func() error) {
+	return runTestOpsWithContext(exec.NewExecContext(), inputs, ops...)
+}
+
+func runTestOpsWithContext(ctx *exec.ExecContext, inputs map[exec.VarID]exec.VarValue, ops ...exec.Op) (*exec.Executor, func() error) {
+	e := exec.NewExecutor(exec.Plan{Ops: ops})
+	for id, v := range inputs {
+		e.PutVar(id, v)
+	}
+
+	ch := make(chan error, 1)
+	go func() {
+		_, err := e.Run(ctx)
+		ch <- err
+	}()
+
+	return e, func() error { return <-ch }
+}
+
+// 读取流变量的全部数据并关闭流
+func readTestStream(e *exec.Executor, id exec.VarID) ([]byte, error) {
+	str, err := exec.BindVar[*exec.StreamValue](e, context.Background(), id)
+	if err != nil {
+		return nil, err
+	}
+	defer str.Stream.Close()
+
+	return io.ReadAll(str.Stream)
+}
+
+func newTestStream(data []byte) *exec.StreamValue {
+	return &exec.StreamValue{Stream: io.NopCloser(bytes.NewReader(data))}
+}
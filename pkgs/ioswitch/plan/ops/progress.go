@@ -0,0 +1,244 @@
+package ops
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sync"
+
+	"gitlink.org.cn/cloudream/common/pkgs/future"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/dag"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
+	"gitlink.org.cn/cloudream/common/utils/io2"
+	"gitlink.org.cn/cloudream/common/utils/serder"
+)
+
+func init() {
+	exec.UseOp[*TrackProgress]()
+	exec.UseOp[*CollectProgress]()
+}
+
+// 统计流的读取进度。
+//
+// 如果Progress不为nil，则会将进度报告编码后输出到Progress流中，一般会将这个流送到Driver上的CollectProgress指令，
+// 以此将Worker上的流的进度报告给Driver。否则直接报告给ExecContext中的ProgressReporter。
+type TrackProgress struct {
+	Input    exec.VarID  `json:"input"`
+	Output   exec.VarID  `json:"output"`
+	Progress *exec.VarID `json:"progress"`
+	Name     string      `json:"name"`
+	Worker   string      `json:"worker"`
+	Total    *int64      `json:"total"`
+}
+
+func (o *TrackProgress) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
+	input, err := exec.BindVar[*exec.StreamValue](e, ctx.Context, o.Input)
+	if err != nil {
+		return err
+	}
+	defer input.Stream.Close()
+
+	base := exec.StreamProgress{
+		VarID:  o.Input,
+		Name:   o.Name,
+		Worker: o.Worker,
+		Total:  o.Total,
+	}
+
+	fut := future.NewSetVoid()
+	putOutput := func(str io.ReadCloser) {
+		e.PutVar(o.Output, &exec.StreamValue{Stream: io2.AfterReadClosedOnce(str, func(closer io.ReadCloser) {
+			fut.SetVoid()
+		})})
+	}
+
+	if o.Progress == nil {
+		putOutput(exec.TrackProgressByContext(ctx, input.Stream, base))
+		return fut.Wait(ctx.Context)
+	}
+
+	// 只保留最新的进度，避免进度流的读取速度影响数据流
+	var lock sync.Mutex
+	var latest exec.StreamProgress
+	notify := make(chan any, 1)
+	putOutput(exec.TrackProgress(input.Stream, base, func(p exec.StreamProgress) {
+		lock.Lock()
+		latest = p
+		lock.Unlock()
+
+		select {
+		case notify <- nil:
+		default:
+		}
+	}))
+
+	pr, pw := io.Pipe()
+	e.PutVar(*o.Progress, &exec.StreamValue{Stream: pr})
+
+	for {
+		select {
+		case <-notify:
+		case <-ctx.Context.Done():
+			pw.CloseWithError(ctx.Context.Err())
+			return ctx.Context.Err()
+		}
+
+		lock.Lock()
+		p := latest
+		lock.Unlock()
+
+		data, err := serder.ObjectToJSON(p)
+		if err != nil {
+			pw.CloseWithError(err)
+			return fmt.Errorf("progress to json: %w", err)
+		}
+
+		// 进度流被提前关闭不影响数据流
+		if err := io2.WriteAll(pw, append(data, '\n')); err != nil {
+			break
+		}
+
+		if p.IsDone {
+			break
+		}
+	}
+	pw.Close()
+
+	return fut.Wait(ctx.Context)
+}
+
+func (o *TrackProgress) String() string {
+	if o.Progress == nil {
+		return fmt.Sprintf("TrackProgress(%v) %v->%v", o.Name, o.Input, o.Output)
+	}
+
+	return fmt.Sprintf("TrackProgress(%v) %v->%v P:%v", o.Name, o.Input, o.Output, *o.Progress)
+}
+
+// 读取TrackProgress指令输出的进度流，并报告给ExecContext中的ProgressReporter。
+type CollectProgress struct {
+	Input exec.VarID `json:"input"`
+}
+
+func (o *CollectProgress) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
+	input, err := exec.BindVar[*exec.StreamValue](e, ctx.Context, o.Input)
+	if err != nil {
+		return err
+	}
+	defer input.Stream.Close()
+
+	// 没有接收者时也需要读完进度流，否则会阻塞发送方
+	reporter, _ := exec.GetValueByType[exec.ProgressReporter](ctx)
+
+	scanner := bufio.NewScanner(input.Stream)
+	for scanner.Scan() {
+		var p exec.StreamProgress
+		if err := serder.JSONToObject(scanner.Bytes(), &p); err != nil {
+			return fmt.Errorf("parsing progress: %w", err)
+		}
+
+		if reporter != nil {
+			reporter.ReportProgress(p)
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (o *CollectProgress) String() string {
+	return fmt.Sprintf("CollectProgress %v", o.Input)
+}
+
+type TrackProgressNode struct {
+	dag.NodeBase
+	Name  string
+	Total *int64
+}
+
+func (b *GraphNodeBuilder) NewTrackProgress(name string, total *int64) *TrackProgressNode {
+	node := &TrackProgressNode{
+		Name:  name,
+		Total: total,
+	}
+	b.AddNode(node)
+
+	node.InputStreams().Init(1)
+	node.OutputStreams().Init(node, 1)
+	return node
+}
+
+func (t *TrackProgressNode) SetInput(v *dag.StreamVar) {
+	v.To(t, 0)
+}
+
+func (t *TrackProgressNode) Output() dag.StreamOutputSlot {
+	return dag.StreamOutputSlot{
+		Node:  t,
+		Index: 0,
+	}
+}
+
+// 让进度报告输出到一个流中，一般将这个流连接到在Driver上执行的CollectProgressNode。
+// 如果不调用此函数，则进度会报告给节点所在环境的ProgressReporter。
+func (t *TrackProgressNode) ProgressVar() *dag.StreamVar {
+	if t.OutputStreams().Len() < 2 {
+		t.OutputStreams().AppendNew(t)
+	}
+
+	return t.OutputStreams().Get(1)
+}
+
+// 让输入流跳过，同时减少进度的总长度。只能跳过数据流，不能跳过进度报告流。
+func (t *TrackProgressNode) SkipOutput(b *GraphNodeBuilder, idx int, skip int64) bool {
+	if idx != 0 {
+		return false
+	}
+
+	b.SkipInput(t, 0, skip)
+	if t.Total != nil {
+		total := *t.Total - skip
+		t.Total = &total
+	}
+	return true
+}
+
+func (t *TrackProgressNode) GenerateOp() (exec.Op, error) {
+	op := &TrackProgress{
+		Input:  t.InputStreams().Get(0).VarID,
+		Output: t.OutputStreams().Get(0).VarID,
+		Name:   t.Name,
+		Total:  t.Total,
+	}
+
+	if t.Env().Type == dag.EnvWorker {
+		op.Worker = t.Env().Worker.String()
+	}
+
+	if t.OutputStreams().Len() > 1 {
+		op.Progress = &t.OutputStreams().Get(1).VarID
+	}
+
+	return op, nil
+}
+
+type CollectProgressNode struct {
+	dag.NodeBase
+}
+
+func (b *GraphNodeBuilder) NewCollectProgress() *CollectProgressNode {
+	node := &CollectProgressNode{}
+	b.AddNode(node)
+
+	node.InputStreams().Init(1)
+	return node
+}
+
+func (t *CollectProgressNode) SetInput(v *dag.StreamVar) {
+	v.To(t, 0)
+}
+
+func (t *CollectProgressNode) GenerateOp() (exec.Op, error) {
+	return &CollectProgress{
+		Input: t.InputStreams().Get(0).VarID,
+	}, nil
+}
@@ -0,0 +1,71 @@
+package ops
+
+import (
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
+)
+
+type testProgressReporter struct {
+	lock    sync.Mutex
+	reports []exec.StreamProgress
+}
+
+func (r *testProgressReporter) ReportProgress(p exec.StreamProgress) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.reports = append(r.reports, p)
+}
+
+func Test_TrackProgress(t *testing.T) {
+	data := make([]byte, 1000)
+
+	Convey("通过进度流报告进度", t, func() {
+		reporter := &testProgressReporter{}
+		ctx := exec.NewExecContext()
+		exec.SetValueByType[exec.ProgressReporter](ctx, reporter)
+
+		total := int64(len(data))
+		progress := exec.VarID(3)
+		e, wait := runTestOpsWithContext(ctx, map[exec.VarID]exec.VarValue{1: newTestStream(data)},
+			&TrackProgress{Input: 1, Output: 2, Progress: &progress, Name: "a", Worker: "w", Total: &total},
+			&CollectProgress{Input: 3},
+		)
+
+		got, err := readTestStream(e, 2)
+		So(err, ShouldBeNil)
+		So(got, ShouldResemble, data)
+		So(wait(), ShouldBeNil)
+
+		p := reporter.reports[len(reporter.reports)-1]
+		So(p.Name, ShouldEqual, "a")
+		So(p.Worker, ShouldEqual, "w")
+		So(p.BytesRead, ShouldEqual, len(data))
+		So(p.IsDone, ShouldBeTrue)
+		So(p.Error, ShouldBeEmpty)
+	})
+
+	Convey("提前关闭时报告错误", t, func() {
+		reporter := &testProgressReporter{}
+		ctx := exec.NewExecContext()
+		exec.SetValueByType[exec.ProgressReporter](ctx, reporter)
+
+		total := int64(len(data))
+		e, wait := runTestOpsWithContext(ctx, map[exec.VarID]exec.VarValue{1: newTestStream(data)},
+			&TrackProgress{Input: 1, Output: 2, Total: &total},
+		)
+
+		str, err := exec.BindVar[*exec.StreamValue](e, ctx.Context, 2)
+		So(err, ShouldBeNil)
+		_, err = str.Stream.Read(make([]byte, 10))
+		So(err, ShouldBeNil)
+		str.Stream.Close()
+		So(wait(), ShouldBeNil)
+
+		p := reporter.reports[len(reporter.reports)-1]
+		So(p.IsDone, ShouldBeTrue)
+		So(p.Error, ShouldEqual, "stream closed early")
+	})
+}
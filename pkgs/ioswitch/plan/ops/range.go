@@ -0,0 +1,94 @@
+package ops
+
+import (
+	"fmt"
+	"io"
+
+	"gitlink.org.cn/cloudream/common/pkgs/future"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/dag"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
+	"gitlink.org.cn/cloudream/common/utils/io2"
+	"gitlink.org.cn/cloudream/common/utils/math2"
+)
+
+func init() {
+	exec.UseOp[*RangeStream]()
+}
+
+// 只输出输入流中Range范围内的数据
+type RangeStream struct {
+	Input  exec.VarID  `json:"input"`
+	Output exec.VarID  `json:"output"`
+	Range  math2.Range `json:"range"`
+}
+
+func (o *RangeStream) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
+	input, err := exec.BindVar[*exec.StreamValue](e, ctx.Context, o.Input)
+	if err != nil {
+		return err
+	}
+	defer input.Stream.Close()
+
+	// NewRange会修改Length的值
+	var length *int64
+	if o.Range.Length != nil {
+		l := *o.Range.Length
+		length = &l
+	}
+
+	fut := future.NewSetVoid()
+	e.PutVar(o.Output, &exec.StreamValue{Stream: io2.AfterReadClosedOnce(io2.NewRange(input.Stream, o.Range.Offset, length), func(closer io.ReadCloser) {
+		fut.SetVoid()
+	})})
+
+	return fut.Wait(ctx.Context)
+}
+
+func (o *RangeStream) String() string {
+	start, end := o.Range.ToStartEnd()
+	return fmt.Sprintf("RangeStream[%v:%v] %v->%v", start, end, o.Input, o.Output)
+}
+
+type RangeNode struct {
+	dag.NodeBase
+	Range math2.Range
+}
+
+func (b *GraphNodeBuilder) NewRange(rng math2.Range) *RangeNode {
+	node := &RangeNode{
+		Range: rng,
+	}
+	b.AddNode(node)
+
+	node.InputStreams().Init(1)
+	node.OutputStreams().Init(node, 1)
+	return node
+}
+
+func (t *RangeNode) SetInput(v *dag.StreamVar) {
+	v.To(t, 0)
+}
+
+func (t *RangeNode) Output() dag.StreamOutputSlot {
+	return dag.StreamOutputSlot{
+		Node:  t,
+		Index: 0,
+	}
+}
+
+func (t *RangeNode) SkipOutput(b *GraphNodeBuilder, idx int, skip int64) bool {
+	t.Range.Offset += skip
+	if t.Range.Length != nil {
+		length := *t.Range.Length - skip
+		t.Range.Length = &length
+	}
+	return true
+}
+
+func (t *RangeNode) GenerateOp() (exec.Op, error) {
+	return &RangeStream{
+		Input:  t.InputStreams().Get(0).VarID,
+		Output: t.OutputStreams().Get(0).VarID,
+		Range:  t.Range,
+	}, nil
+}
@@ -0,0 +1,296 @@
+package ops
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"gitlink.org.cn/cloudream/common/pkgs/future"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/dag"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/utils"
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+	"gitlink.org.cn/cloudream/common/utils/io2"
+	"gitlink.org.cn/cloudream/common/utils/math2"
+)
+
+func init() {
+	exec.UseOp[*SegmentSplit]()
+	exec.UseOp[*SegmentJoin]()
+}
+
+// 将一个流按照Segments中的大小依次切分为多个流。输入流的长度必须正好等于所有段的大小之和。
+//
+// 输出流需要按顺序读取，或者在不同的goroutine中读取。
+type SegmentSplit struct {
+	Input    exec.VarID   `json:"input"`
+	Outputs  []exec.VarID `json:"outputs"`
+	Segments []int64      `json:"segments"`
+}
+
+func (o *SegmentSplit) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
+	input, err := exec.BindVar[*exec.StreamValue](e, ctx.Context, o.Input)
+	if err != nil {
+		return err
+	}
+	defer input.Stream.Close()
+
+	if len(o.Outputs) != len(o.Segments) {
+		return fmt.Errorf("output count %v not equals to segment count %v", len(o.Outputs), len(o.Segments))
+	}
+
+	pws := make([]*io.PipeWriter, len(o.Outputs))
+	for i := range o.Outputs {
+		pr, pw := io.Pipe()
+		pws[i] = pw
+		e.PutVar(o.Outputs[i], &exec.StreamValue{Stream: pr})
+	}
+
+	err = func() error {
+		for i, size := range o.Segments {
+			_, err := io.CopyN(pws[i], input.Stream, size)
+			if err == io.EOF {
+				return fmt.Errorf("segment %v: %w", i, io.ErrUnexpectedEOF)
+			}
+			if err != nil {
+				return fmt.Errorf("segment %v: %w", i, err)
+			}
+			pws[i].Close()
+		}
+
+		// 输入流的长度需要正好等于所有段的大小之和
+		n, _ := input.Stream.Read(make([]byte, 1))
+		if n > 0 {
+			return fmt.Errorf("input stream is longer than the sum of segments")
+		}
+
+		return nil
+	}()
+
+	for _, pw := range pws {
+		pw.CloseWithError(err)
+	}
+
+	return err
+}
+
+func (o *SegmentSplit) String() string {
+	return fmt.Sprintf("SegmentSplit %v->(%v)", o.Input, utils.FormatVarIDs(o.Outputs))
+}
+
+// 将多个段的流依次连接起来。会跳过第一个流的前Offset个字节，并且最多输出Length个字节。
+// 输入流在需要读取时才会被绑定。
+type SegmentJoin struct {
+	Inputs []exec.VarID `json:"inputs"`
+	Output exec.VarID   `json:"output"`
+	Offset int64        `json:"offset"`
+	Length *int64       `json:"length"`
+}
+
+func (o *SegmentJoin) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
+	// 输入流可能在读取输出流的goroutine中绑定，所以它们的状态需要加锁访问
+	var lock sync.Mutex
+	closed := false
+	claimed := make([]bool, len(o.Inputs))
+	bound := make([]io.ReadCloser, len(o.Inputs))
+
+	strs := make([]io.Reader, len(o.Inputs))
+	for i := range o.Inputs {
+		idx := i
+		strs[i] = io2.Lazy(func() (io.ReadCloser, error) {
+			lock.Lock()
+			if closed {
+				lock.Unlock()
+				return nil, io.ErrClosedPipe
+			}
+			claimed[idx] = true
+			lock.Unlock()
+
+			str, err := exec.BindVar[*exec.StreamValue](e, ctx.Context, o.Inputs[idx])
+			if err != nil {
+				return nil, err
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+
+			// 绑定期间指令已经结束，由这里负责关闭
+			if closed {
+				str.Stream.Close()
+				return nil, io.ErrClosedPipe
+			}
+
+			bound[idx] = str.Stream
+			return str.Stream, nil
+		})
+	}
+
+	// NewRange会修改Length的值
+	var length *int64
+	if o.Length != nil {
+		l := *o.Length
+		length = &l
+	}
+	joined := io2.NewRange(io.NopCloser(io.MultiReader(strs...)), o.Offset, length)
+
+	fut := future.NewSetVoid()
+	e.PutVar(o.Output, &exec.StreamValue{Stream: io2.AfterReadClosedOnce(joined, func(closer io.ReadCloser) {
+		fut.SetVoid()
+	})})
+
+	err := fut.Wait(ctx.Context)
+
+	// 关闭所有输入流，没有读取到的也要绑定后关闭，否则产生这些流的指令会一直等待。
+	// 正在绑定的输入流会在绑定完成后自行关闭
+	var unbound []exec.VarID
+	lock.Lock()
+	closed = true
+	for i, id := range o.Inputs {
+		if !claimed[i] {
+			unbound = append(unbound, id)
+			continue
+		}
+		if bound[i] != nil {
+			bound[i].Close()
+		}
+	}
+	lock.Unlock()
+
+	for _, id := range unbound {
+		str, err := exec.BindVar[*exec.StreamValue](e, ctx.Context, id)
+		if err != nil {
+			return err
+		}
+		str.Stream.Close()
+	}
+
+	return err
+}
+
+func (o *SegmentJoin) String() string {
+	rng := math2.Range{Offset: o.Offset, Length: o.Length}
+	start, end := rng.ToStartEnd()
+
+	return fmt.Sprintf("SegmentJoin[%v:%v] (%v)->%v", start, end, utils.FormatVarIDs(o.Inputs), o.Output)
+}
+
+type SegmentSplitNode struct {
+	dag.NodeBase
+	Segments []int64
+}
+
+func (b *GraphNodeBuilder) NewSegmentSplit(segments []int64) *SegmentSplitNode {
+	node := &SegmentSplitNode{
+		Segments: segments,
+	}
+	b.AddNode(node)
+
+	node.InputStreams().Init(1)
+	node.OutputStreams().Init(node, len(segments))
+	return node
+}
+
+func (t *SegmentSplitNode) SetInput(v *dag.StreamVar) {
+	v.To(t, 0)
+}
+
+// 第idx段的输出流。所有段的输出流都需要被使用，不需要的段可以连接到DropNode。
+func (t *SegmentSplitNode) Segment(idx int) dag.StreamOutputSlot {
+	return dag.StreamOutputSlot{
+		Node:  t,
+		Index: idx,
+	}
+}
+
+func (t *SegmentSplitNode) GenerateOp() (exec.Op, error) {
+	return &SegmentSplit{
+		Input:    t.InputStreams().Get(0).VarID,
+		Outputs:  t.OutputStreams().GetVarIDs(),
+		Segments: t.Segments,
+	}, nil
+}
+
+type SegmentJoinNode struct {
+	dag.NodeBase
+	Redundancy *cdssdk.SegmentRedundancy
+	Range      math2.Range
+	segStart   int
+	segEnd     int
+}
+
+// 连接分段存储的文件的各个段，输出Range范围内的数据。只有Range所涉及的段才需要作为输入，
+// 可以通过SegmentRange获取需要的段的范围。
+func (b *GraphNodeBuilder) NewSegmentJoin(red *cdssdk.SegmentRedundancy, rng math2.Range) *SegmentJoinNode {
+	node := &SegmentJoinNode{
+		Redundancy: red,
+		Range:      rng,
+	}
+	b.AddNode(node)
+
+	var end *int64
+	if rng.Length != nil {
+		e := rng.Offset + *rng.Length
+		end = &e
+	}
+	node.segStart, node.segEnd = red.CalcSegmentRange(rng.Offset, end)
+	// 长度为0的范围不需要任何段
+	if rng.Length != nil && *rng.Length == 0 {
+		node.segEnd = node.segStart
+	}
+
+	node.InputStreams().Init(node.segEnd - node.segStart)
+	node.OutputStreams().Init(node, 1)
+	return node
+}
+
+// 需要作为输入的段的索引范围，左闭右开
+func (t *SegmentJoinNode) SegmentRange() (start int, end int) {
+	return t.segStart, t.segEnd
+}
+
+// 设置第segIdx段的输入流，segIdx需要在SegmentRange范围内，否则会忽略。输入流需要是这个段的完整数据。
+func (t *SegmentJoinNode) SetInput(segIdx int, v *dag.StreamVar) {
+	if segIdx < t.segStart || segIdx >= t.segEnd {
+		return
+	}
+
+	v.To(t, segIdx-t.segStart)
+}
+
+func (t *SegmentJoinNode) Output() dag.StreamOutputSlot {
+	return dag.StreamOutputSlot{
+		Node:  t,
+		Index: 0,
+	}
+}
+
+// 输入的段不变，只调整输出的范围
+func (t *SegmentJoinNode) SkipOutput(b *GraphNodeBuilder, idx int, skip int64) bool {
+	t.Range.Offset += skip
+	if t.Range.Length != nil {
+		length := *t.Range.Length - skip
+		t.Range.Length = &length
+	}
+	return true
+}
+
+func (t *SegmentJoinNode) GenerateOp() (exec.Op, error) {
+	for i := 0; i < t.InputStreams().Len(); i++ {
+		if t.InputStreams().Get(i) == nil {
+			return nil, fmt.Errorf("input of segment %v is not set", t.segStart+i)
+		}
+	}
+
+	// 第一个段可能只需要一部分
+	offset := t.Range.Offset
+	if t.segStart < t.Redundancy.SegmentCount() {
+		offset -= t.Redundancy.CalcSegmentStart(t.segStart)
+	}
+
+	return &SegmentJoin{
+		Inputs: t.InputStreams().GetVarIDs(),
+		Output: t.OutputStreams().Get(0).VarID,
+		Offset: offset,
+		Length: t.Range.Length,
+	}, nil
+}
@@ -0,0 +1,182 @@
+package ops
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+	"gitlink.org.cn/cloudream/common/utils/math2"
+)
+
+func Test_SegmentSplit(t *testing.T) {
+	data := make([]byte, 60)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	// 在不同的goroutine中读取所有输出流
+	readOutputs := func(e *exec.Executor, ids ...exec.VarID) ([][]byte, []error) {
+		rets := make([][]byte, len(ids))
+		errs := make([]error, len(ids))
+		wg := sync.WaitGroup{}
+		for i, id := range ids {
+			wg.Add(1)
+			go func(i int, id exec.VarID) {
+				defer wg.Done()
+				rets[i], errs[i] = readTestStream(e, id)
+			}(i, id)
+		}
+		wg.Wait()
+		return rets, errs
+	}
+
+	Convey("按段的大小切分", t, func() {
+		e, wait := runTestOps(map[exec.VarID]exec.VarValue{1: newTestStream(data)},
+			&SegmentSplit{Input: 1, Outputs: []exec.VarID{2, 3, 4}, Segments: []int64{10, 20, 30}},
+		)
+
+		rets, errs := readOutputs(e, 2, 3, 4)
+		So(errs, ShouldResemble, []error{nil, nil, nil})
+		So(rets[0], ShouldResemble, data[:10])
+		So(rets[1], ShouldResemble, data[10:30])
+		So(rets[2], ShouldResemble, data[30:])
+		So(wait(), ShouldBeNil)
+	})
+
+	Convey("输入流的长度与段的大小之和不相等", t, func() {
+		e, wait := runTestOps(map[exec.VarID]exec.VarValue{1: newTestStream(data[:50])},
+			&SegmentSplit{Input: 1, Outputs: []exec.VarID{2, 3}, Segments: []int64{10, 50}},
+		)
+		_, errs := readOutputs(e, 2, 3)
+		So(errs[0], ShouldBeNil)
+		So(errs[1], ShouldWrap, io.ErrUnexpectedEOF)
+		So(wait(), ShouldWrap, io.ErrUnexpectedEOF)
+
+		e, wait = runTestOps(map[exec.VarID]exec.VarValue{1: newTestStream(data)},
+			&SegmentSplit{Input: 1, Outputs: []exec.VarID{2, 3}, Segments: []int64{10, 20}},
+		)
+		_, errs = readOutputs(e, 2, 3)
+		So(errs[0], ShouldBeNil)
+		So(errs[1], ShouldBeNil)
+		So(wait(), ShouldNotBeNil)
+	})
+}
+
+func Test_SegmentJoin(t *testing.T) {
+	data := make([]byte, 60)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	red := &cdssdk.SegmentRedundancy{Segments: []int64{10, 20, 30}}
+
+	// 使用Range创建SegmentJoinNode，将它需要的段作为输入，然后执行生成的指令，返回读取到的数据
+	run := func(rng math2.Range) (*SegmentJoinNode, *SegmentJoin, []byte) {
+		b := NewGraphNodeBuilder()
+		join := b.NewSegmentJoin(red, rng)
+
+		inputs := make(map[exec.VarID]exec.VarValue)
+		start, end := join.SegmentRange()
+		for i := start; i < end; i++ {
+			src := b.NewFromDriver(&exec.DriverWriteStream{})
+			src.Output().Var().VarID = exec.VarID(10 + i)
+			join.SetInput(i, src.Output().Var())
+
+			segStart := red.CalcSegmentStart(i)
+			inputs[exec.VarID(10+i)] = newTestStream(data[segStart : segStart+red.Segments[i]])
+		}
+		join.Output().Var().VarID = 100
+
+		op, err := join.GenerateOp()
+		So(err, ShouldBeNil)
+
+		e, wait := runTestOps(inputs, op)
+		got, err := readTestStream(e, 100)
+		So(err, ShouldBeNil)
+		So(wait(), ShouldBeNil)
+
+		return join, op.(*SegmentJoin), got
+	}
+
+	Convey("范围的起止位置都在段的中间", t, func() {
+		join, op, got := run(math2.NewRange(15, 30))
+
+		start, end := join.SegmentRange()
+		So(start, ShouldEqual, 1)
+		So(end, ShouldEqual, 3)
+		So(op.Inputs, ShouldResemble, []exec.VarID{11, 12})
+		So(op.Offset, ShouldEqual, 5)
+		So(got, ShouldResemble, data[15:45])
+	})
+
+	Convey("范围正好是一个段", t, func() {
+		join, op, got := run(math2.NewRange(10, 20))
+
+		start, end := join.SegmentRange()
+		So(start, ShouldEqual, 1)
+		So(end, ShouldEqual, 2)
+		So(op.Inputs, ShouldResemble, []exec.VarID{11})
+		So(op.Offset, ShouldEqual, 0)
+		So(got, ShouldResemble, data[10:30])
+	})
+
+	Convey("范围到文件末尾", t, func() {
+		join, op, got := run(math2.Range{Offset: 25})
+
+		start, end := join.SegmentRange()
+		So(start, ShouldEqual, 1)
+		So(end, ShouldEqual, 3)
+		So(op.Offset, ShouldEqual, 15)
+		So(op.Length, ShouldBeNil)
+		So(got, ShouldResemble, data[25:])
+	})
+
+	Convey("读取输出流的过程中计划被取消", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		e, wait := runTestOpsWithContext(exec.NewWithContext(ctx), map[exec.VarID]exec.VarValue{
+			1: newTestStream(data[:10]),
+			2: newTestStream(data[10:30]),
+		},
+			&SegmentJoin{Inputs: []exec.VarID{1, 2}, Output: 3},
+		)
+
+		str, err := exec.BindVar[*exec.StreamValue](e, context.Background(), 3)
+		So(err, ShouldBeNil)
+
+		// 在另一个goroutine中读取，并且不与它同步，让竞态检测能发现对输入流状态的并发访问
+		buf := make([]byte, 5)
+		readErr := make(chan error, 1)
+		go func() {
+			_, err := io.ReadFull(str.Stream, buf)
+			readErr <- err
+		}()
+		time.Sleep(100 * time.Millisecond)
+
+		cancel()
+		So(wait(), ShouldNotBeNil)
+		So(<-readErr, ShouldBeNil)
+		So(buf, ShouldResemble, data[:5])
+
+		// 指令结束后再读取，不能再绑定输入流
+		_, err = io.ReadAll(str.Stream)
+		So(err, ShouldNotBeNil)
+		str.Stream.Close()
+	})
+
+	Convey("长度为0的范围不需要任何段", t, func() {
+		for _, offset := range []int64{0, 15, 30} {
+			join, op, got := run(math2.NewRange(offset, 0))
+
+			start, end := join.SegmentRange()
+			So(end, ShouldEqual, start)
+			So(op.Inputs, ShouldBeEmpty)
+			So(got, ShouldBeEmpty)
+		}
+	})
+}
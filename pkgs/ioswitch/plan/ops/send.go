@@ -18,9 +18,10 @@ func init() {
 }
 
 type SendStream struct {
-	Input  exec.VarID      `json:"input"`
-	Send   exec.VarID      `json:"send"`
-	Worker exec.WorkerInfo `json:"worker"`
+	Input     exec.VarID      `json:"input"`
+	Send      exec.VarID      `json:"send"`
+	Worker    exec.WorkerInfo `json:"worker"`
+	Bandwidth string          `json:"bandwidth,omitempty"` // 发送时使用的带宽预算，为空则不限速
 }
 
 func (o *SendStream) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
@@ -36,8 +37,10 @@ func (o *SendStream) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
 	}
 	defer cli.Close()
 
+	str := exec.ThrottleByBudget(ctx, e.Plan().ID, o.Bandwidth, inputStr.Stream)
+
 	// 发送后流的ID不同
-	err = cli.SendStream(ctx.Context, e.Plan().ID, o.Send, inputStr.Stream)
+	err = cli.SendStream(ctx.Context, e.Plan().ID, o.Send, str)
 	if err != nil {
 		return fmt.Errorf("sending stream: %w", err)
 	}
@@ -50,10 +53,11 @@ func (o *SendStream) String() string {
 }
 
 type GetStream struct {
-	Signal exec.SignalVar  `json:"signal"`
-	Target exec.VarID      `json:"target"`
-	Output exec.VarID      `json:"output"`
-	Worker exec.WorkerInfo `json:"worker"`
+	Signal    exec.SignalVar  `json:"signal"`
+	Target    exec.VarID      `json:"target"`
+	Output    exec.VarID      `json:"output"`
+	Worker    exec.WorkerInfo `json:"worker"`
+	Bandwidth string          `json:"bandwidth,omitempty"` // 接收时使用的带宽预算，为空则不限速
 }
 
 func (o *GetStream) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
@@ -68,6 +72,8 @@ func (o *GetStream) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
 		return fmt.Errorf("getting stream: %w", err)
 	}
 
+	str = exec.ThrottleByBudget(ctx, e.Plan().ID, o.Bandwidth, str)
+
 	fut := future.NewSetVoid()
 	// 获取后送到本地的流ID是不同的
 	str = io2.AfterReadClosedOnce(str, func(closer io.ReadCloser) {
@@ -142,7 +148,8 @@ func (o *GetVar) String() string {
 
 type SendStreamNode struct {
 	dag.NodeBase
-	ToWorker exec.WorkerInfo
+	ToWorker  exec.WorkerInfo
+	Bandwidth string
 }
 
 func (b *GraphNodeBuilder) NewSendStream(to exec.WorkerInfo) *SendStreamNode {
@@ -163,9 +170,10 @@ func (t *SendStreamNode) Send(v *dag.StreamVar) *dag.StreamVar {
 
 func (t *SendStreamNode) GenerateOp() (exec.Op, error) {
 	return &SendStream{
-		Input:  t.InputStreams().Get(0).VarID,
-		Send:   t.OutputStreams().Get(0).VarID,
-		Worker: t.ToWorker,
+		Input:     t.InputStreams().Get(0).VarID,
+		Send:      t.OutputStreams().Get(0).VarID,
+		Worker:    t.ToWorker,
+		Bandwidth: t.Bandwidth,
 	}, nil
 }
 
@@ -209,6 +217,7 @@ func (t *SendValueNode) GenerateOp() (exec.Op, error) {
 type GetStreamNode struct {
 	dag.NodeBase
 	FromWorker exec.WorkerInfo
+	Bandwidth  string
 }
 
 func (b *GraphNodeBuilder) NewGetStream(from exec.WorkerInfo) *GetStreamNode {
@@ -234,10 +243,11 @@ func (t *GetStreamNode) SignalVar() *dag.ValueVar {
 
 func (t *GetStreamNode) GenerateOp() (exec.Op, error) {
 	return &GetStream{
-		Signal: exec.NewSignalVar(t.OutputValues().Get(0).VarID),
-		Output: t.OutputStreams().Get(0).VarID,
-		Target: t.InputStreams().Get(0).VarID,
-		Worker: t.FromWorker,
+		Signal:    exec.NewSignalVar(t.OutputValues().Get(0).VarID),
+		Output:    t.OutputStreams().Get(0).VarID,
+		Target:    t.InputStreams().Get(0).VarID,
+		Worker:    t.FromWorker,
+		Bandwidth: t.Bandwidth,
 	}, nil
 }
 
@@ -0,0 +1,244 @@
+package ops
+
+import (
+	"fmt"
+
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/dag"
+)
+
+// 子图模板，描述一组可以重复使用的节点以及它们之间的连接。子图通过命名的端口与外部的节点连接。
+//
+// 子图实例化后只是普通的节点，因此生成计划时不需要特殊处理。
+type SubgraphTemplate struct {
+	Name         string
+	Inputs       []string // 输入流端口
+	Outputs      []string // 输出流端口
+	ValueInputs  []string // 输入值端口
+	ValueOutputs []string // 输出值端口
+	Build        SubgraphBuildFunc
+}
+
+// 在b中创建子图的节点，并通过sg的BindXXX函数将模板声明的每一个端口绑定到节点的槽位上
+type SubgraphBuildFunc func(b *GraphNodeBuilder, sg *Subgraph, params SubgraphParams) error
+
+// 实例化子图时的参数
+type SubgraphParams struct {
+	Envs map[string]dag.NodeEnv // 子图中节点的执行环境，名称由模板自己决定
+	Args map[string]any         // 其他参数
+}
+
+func (p SubgraphParams) Env(name string) (dag.NodeEnv, bool) {
+	env, ok := p.Envs[name]
+	return env, ok
+}
+
+// 将名为name的执行环境设置到所有节点上。如果参数中没有这个执行环境，则不做修改。
+func (p SubgraphParams) ApplyEnv(name string, nodes ...dag.Node) {
+	env, ok := p.Envs[name]
+	if !ok {
+		return
+	}
+
+	for _, n := range nodes {
+		*n.Env() = env
+	}
+}
+
+func (p SubgraphParams) Arg(name string) any {
+	return p.Args[name]
+}
+
+// 子图的一个实例
+type Subgraph struct {
+	Template     *SubgraphTemplate
+	Nodes        []dag.Node // 实例化时创建的所有节点
+	inputs       map[string][]dag.StreamInputSlot
+	outputs      map[string]dag.StreamOutputSlot
+	valueInputs  map[string][]dag.ValueInputSlot
+	valueOutputs map[string]dag.ValueOutputSlot
+	buildErr     error
+}
+
+// 实例化一个子图。模板的Build函数返回错误或者有端口没有绑定时，会移除已经创建的节点。
+func (b *GraphNodeBuilder) Instantiate(tmpl *SubgraphTemplate, params SubgraphParams) (*Subgraph, error) {
+	sg := &Subgraph{
+		Template:     tmpl,
+		inputs:       make(map[string][]dag.StreamInputSlot),
+		outputs:      make(map[string]dag.StreamOutputSlot),
+		valueInputs:  make(map[string][]dag.ValueInputSlot),
+		valueOutputs: make(map[string]dag.ValueOutputSlot),
+	}
+
+	// 新节点总是添加在末尾，因此可以通过前后的节点数量得到子图创建的节点
+	start := len(b.Nodes)
+	err := tmpl.Build(b, sg, params)
+	sg.Nodes = append([]dag.Node{}, b.Nodes[start:]...)
+	if err == nil {
+		err = sg.buildErr
+	}
+	if err == nil {
+		err = sg.checkPorts()
+	}
+	if err != nil {
+		sg.remove(b)
+		return nil, fmt.Errorf("instantiate subgraph %v: %w", tmpl.Name, err)
+	}
+
+	return sg, nil
+}
+
+// 将输入流端口绑定到一个节点的输入槽位上。同一个端口可以绑定多个槽位，此时输入流会同时输入给这些槽位。
+func (s *Subgraph) BindInput(port string, slot dag.StreamInputSlot) {
+	if !s.checkDeclared(port, s.Template.Inputs) {
+		return
+	}
+	s.inputs[port] = append(s.inputs[port], slot)
+}
+
+// 将输出流端口绑定到一个节点的输出槽位上，每个端口只能绑定一个槽位
+func (s *Subgraph) BindOutput(port string, slot dag.StreamOutputSlot) {
+	if !s.checkDeclared(port, s.Template.Outputs) {
+		return
+	}
+	if _, ok := s.outputs[port]; ok {
+		s.setBuildErr(fmt.Errorf("output port %v is bound more than once", port))
+		return
+	}
+	s.outputs[port] = slot
+}
+
+func (s *Subgraph) BindValueInput(port string, slot dag.ValueInputSlot) {
+	if !s.checkDeclared(port, s.Template.ValueInputs) {
+		return
+	}
+	s.valueInputs[port] = append(s.valueInputs[port], slot)
+}
+
+func (s *Subgraph) BindValueOutput(port string, slot dag.ValueOutputSlot) {
+	if !s.checkDeclared(port, s.Template.ValueOutputs) {
+		return
+	}
+	if _, ok := s.valueOutputs[port]; ok {
+		s.setBuildErr(fmt.Errorf("value output port %v is bound more than once", port))
+		return
+	}
+	s.valueOutputs[port] = slot
+}
+
+// 将流输入到子图的输入端口
+func (s *Subgraph) SetInput(port string, v *dag.StreamVar) error {
+	slots, ok := s.inputs[port]
+	if !ok {
+		return fmt.Errorf("subgraph %v has no input port %v", s.Template.Name, port)
+	}
+
+	for _, slot := range slots {
+		v.ToSlot(slot)
+	}
+	return nil
+}
+
+func (s *Subgraph) Output(port string) (dag.StreamOutputSlot, error) {
+	slot, ok := s.outputs[port]
+	if !ok {
+		return dag.StreamOutputSlot{}, fmt.Errorf("subgraph %v has no output port %v", s.Template.Name, port)
+	}
+	return slot, nil
+}
+
+func (s *Subgraph) SetValueInput(port string, v *dag.ValueVar) error {
+	slots, ok := s.valueInputs[port]
+	if !ok {
+		return fmt.Errorf("subgraph %v has no value input port %v", s.Template.Name, port)
+	}
+
+	for _, slot := range slots {
+		v.ToSlot(slot)
+	}
+	return nil
+}
+
+func (s *Subgraph) ValueOutput(port string) (dag.ValueOutputSlot, error) {
+	slot, ok := s.valueOutputs[port]
+	if !ok {
+		return dag.ValueOutputSlot{}, fmt.Errorf("subgraph %v has no value output port %v", s.Template.Name, port)
+	}
+	return slot, nil
+}
+
+// 将一个子图的输出流端口连接到另一个子图的输入流端口
+func ConnectSubgraph(from *Subgraph, output string, to *Subgraph, input string) error {
+	slot, err := from.Output(output)
+	if err != nil {
+		return err
+	}
+
+	return to.SetInput(input, slot.Var())
+}
+
+// 将一个子图的输出值端口连接到另一个子图的输入值端口
+func ConnectSubgraphValue(from *Subgraph, output string, to *Subgraph, input string) error {
+	slot, err := from.ValueOutput(output)
+	if err != nil {
+		return err
+	}
+
+	return to.SetValueInput(input, slot.Var())
+}
+
+func (s *Subgraph) checkDeclared(port string, ports []string) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+
+	s.setBuildErr(fmt.Errorf("port %v is not declared", port))
+	return false
+}
+
+func (s *Subgraph) setBuildErr(err error) {
+	if s.buildErr == nil {
+		s.buildErr = err
+	}
+}
+
+func (s *Subgraph) checkPorts() error {
+	for _, p := range s.Template.Inputs {
+		if len(s.inputs[p]) == 0 {
+			return fmt.Errorf("input port %v is not bound", p)
+		}
+	}
+	for _, p := range s.Template.Outputs {
+		if _, ok := s.outputs[p]; !ok {
+			return fmt.Errorf("output port %v is not bound", p)
+		}
+	}
+	for _, p := range s.Template.ValueInputs {
+		if len(s.valueInputs[p]) == 0 {
+			return fmt.Errorf("value input port %v is not bound", p)
+		}
+	}
+	for _, p := range s.Template.ValueOutputs {
+		if _, ok := s.valueOutputs[p]; !ok {
+			return fmt.Errorf("value output port %v is not bound", p)
+		}
+	}
+	return nil
+}
+
+// 断开子图节点的所有连接，并从图中移除
+func (s *Subgraph) remove(b *GraphNodeBuilder) {
+	for _, n := range s.Nodes {
+		n.InputStreams().ClearAllInput(n)
+		for i := 0; i < n.InputValues().Len(); i++ {
+			n.InputValues().ClearInputAt(n, i)
+		}
+		n.OutputStreams().ClearAllOutput(n)
+		n.OutputValues().ClearAllOutput(n)
+
+		b.RemoveNode(n)
+		n.SetGraph(nil)
+	}
+	s.Nodes = nil
+}
@@ -0,0 +1,110 @@
+package ops
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/dag"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
+)
+
+func Test_Subgraph(t *testing.T) {
+	// 先压缩再解压的子图，用于测试
+	tmpl := &SubgraphTemplate{
+		Name:         "roundtrip",
+		Inputs:       []string{"in"},
+		Outputs:      []string{"out"},
+		ValueOutputs: []string{"const"},
+		Build: func(b *GraphNodeBuilder, sg *Subgraph, params SubgraphParams) error {
+			comp := b.NewCompress(CompressGzip, 1)
+			decomp := b.NewDecompress(CompressGzip)
+			decomp.SetInput(comp.Output().Var())
+			params.ApplyEnv("worker", comp, decomp)
+
+			c := b.NewConst(&exec.StringValue{Value: "c"})
+
+			sg.BindInput("in", dag.StreamInputSlot{Node: comp, Index: 0})
+			sg.BindOutput("out", decomp.Output())
+			sg.BindValueOutput("const", c.Output())
+			return nil
+		},
+	}
+
+	Convey("同一个模板在一个图中实例化两次", t, func() {
+		b := NewGraphNodeBuilder()
+		src := b.NewCompress(CompressGzip, 1)
+
+		sg1, err := b.Instantiate(tmpl, SubgraphParams{})
+		So(err, ShouldBeNil)
+		sg2, err := b.Instantiate(tmpl, SubgraphParams{})
+		So(err, ShouldBeNil)
+
+		// 每个实例只包含自己创建的节点
+		So(sg1.Nodes, ShouldHaveLength, 3)
+		So(sg2.Nodes, ShouldHaveLength, 3)
+		So(b.Nodes, ShouldHaveLength, 7)
+		So(b.Nodes[0], ShouldEqual, src)
+		So(b.Nodes[1:4], ShouldResemble, sg1.Nodes)
+		So(b.Nodes[4:7], ShouldResemble, sg2.Nodes)
+
+		So(sg1.SetInput("in", src.Output().Var()), ShouldBeNil)
+		So(ConnectSubgraph(sg1, "out", sg2, "in"), ShouldBeNil)
+
+		// 连接的是各自实例中的节点
+		out1, err := sg1.Output("out")
+		So(err, ShouldBeNil)
+		So(out1.Node == sg1.Nodes[1], ShouldBeTrue)
+		So(out1.Var().Dst.Get(0) == sg2.Nodes[0], ShouldBeTrue)
+		So(src.Output().Var().Dst.Get(0) == sg1.Nodes[0], ShouldBeTrue)
+
+		c1, err := sg1.ValueOutput("const")
+		So(err, ShouldBeNil)
+		c2, err := sg2.ValueOutput("const")
+		So(err, ShouldBeNil)
+		So(c1.Node == c2.Node, ShouldBeFalse)
+	})
+
+	Convey("实例化失败时移除已经创建的节点，不影响之后的实例化", t, func() {
+		b := NewGraphNodeBuilder()
+		sg1, err := b.Instantiate(tmpl, SubgraphParams{})
+		So(err, ShouldBeNil)
+
+		buildErr := errors.New("build failed")
+		_, err = b.Instantiate(&SubgraphTemplate{
+			Name: "bad",
+			Build: func(b *GraphNodeBuilder, sg *Subgraph, params SubgraphParams) error {
+				b.NewCompress(CompressGzip, 1)
+				return buildErr
+			},
+		}, SubgraphParams{})
+		So(errors.Is(err, buildErr), ShouldBeTrue)
+
+		_, err = b.Instantiate(&SubgraphTemplate{
+			Name:    "unbound",
+			Outputs: []string{"out"},
+			Build: func(b *GraphNodeBuilder, sg *Subgraph, params SubgraphParams) error {
+				b.NewCompress(CompressGzip, 1)
+				return nil
+			},
+		}, SubgraphParams{})
+		So(err, ShouldNotBeNil)
+		So(b.Nodes, ShouldResemble, sg1.Nodes)
+
+		sg2, err := b.Instantiate(tmpl, SubgraphParams{})
+		So(err, ShouldBeNil)
+		So(sg2.Nodes, ShouldHaveLength, 3)
+		So(b.Nodes[3:], ShouldResemble, sg2.Nodes)
+	})
+
+	Convey("使用参数中的执行环境", t, func() {
+		b := NewGraphNodeBuilder()
+		worker := dag.NodeEnv{}
+		worker.ToEnvDriver()
+
+		sg, err := b.Instantiate(tmpl, SubgraphParams{Envs: map[string]dag.NodeEnv{"worker": worker}})
+		So(err, ShouldBeNil)
+		So(sg.Nodes[0].Env().Type, ShouldEqual, dag.EnvDriver)
+		So(sg.Nodes[1].Env().Type, ShouldEqual, dag.EnvDriver)
+	})
+}
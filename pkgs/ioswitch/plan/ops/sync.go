@@ -130,6 +130,13 @@ func (h *HangUntil) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
 	return h.Op.Execute(ctx, e)
 }
 
+func (h *HangUntil) EstimateMemory() int64 {
+	if est, ok := h.Op.(exec.MemoryEstimator); ok {
+		return est.EstimateMemory()
+	}
+	return 0
+}
+
 func (h *HangUntil) String() string {
 	return "HangUntil"
 }
@@ -0,0 +1,95 @@
+package ops
+
+import (
+	"fmt"
+	"io"
+
+	"gitlink.org.cn/cloudream/common/pkgs/future"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/dag"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
+	"gitlink.org.cn/cloudream/common/utils/io2"
+	"gitlink.org.cn/cloudream/common/utils/sync2"
+)
+
+func init() {
+	exec.UseOp[*ThrottleStream]()
+}
+
+// 限制流的速度。可以同时使用Worker上的带宽预算以及只属于这个流的速度限制。
+type ThrottleStream struct {
+	Input       exec.VarID `json:"input"`
+	Output      exec.VarID `json:"output"`
+	Budget      string     `json:"budget"`      // 使用的带宽预算的名称，为空则不使用
+	BytesPerSec int64      `json:"bytesPerSec"` // 这个流单独的速度限制，为0则不限制
+}
+
+func (o *ThrottleStream) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
+	input, err := exec.BindVar[*exec.StreamValue](e, ctx.Context, o.Input)
+	if err != nil {
+		return err
+	}
+	defer input.Stream.Close()
+
+	str := exec.ThrottleByBudget(ctx, e.Plan().ID, o.Budget, input.Stream)
+	if o.BytesPerSec > 0 {
+		bkt := sync2.NewTokenBucket(o.BytesPerSec, 0)
+		str = io2.Throttle(str, func(n int) error {
+			return bkt.Acquire(ctx.Context, nil, int64(n))
+		})
+	}
+
+	fut := future.NewSetVoid()
+	e.PutVar(o.Output, &exec.StreamValue{Stream: io2.AfterReadClosedOnce(str, func(closer io.ReadCloser) {
+		fut.SetVoid()
+	})})
+
+	return fut.Wait(ctx.Context)
+}
+
+func (o *ThrottleStream) String() string {
+	return fmt.Sprintf("ThrottleStream(B:%v, %v B/s) %v->%v", o.Budget, o.BytesPerSec, o.Input, o.Output)
+}
+
+type ThrottleNode struct {
+	dag.NodeBase
+	Budget      string
+	BytesPerSec int64
+}
+
+func (b *GraphNodeBuilder) NewThrottle(budget string, bytesPerSec int64) *ThrottleNode {
+	node := &ThrottleNode{
+		Budget:      budget,
+		BytesPerSec: bytesPerSec,
+	}
+	b.AddNode(node)
+
+	node.InputStreams().Init(1)
+	node.OutputStreams().Init(node, 1)
+	return node
+}
+
+func (t *ThrottleNode) SetInput(v *dag.StreamVar) {
+	v.To(t, 0)
+}
+
+func (t *ThrottleNode) Output() dag.StreamOutputSlot {
+	return dag.StreamOutputSlot{
+		Node:  t,
+		Index: 0,
+	}
+}
+
+// 限速不改变数据，因此直接让输入流跳过
+func (t *ThrottleNode) SkipOutput(b *GraphNodeBuilder, idx int, skip int64) bool {
+	b.SkipInput(t, 0, skip)
+	return true
+}
+
+func (t *ThrottleNode) GenerateOp() (exec.Op, error) {
+	return &ThrottleStream{
+		Input:       t.InputStreams().Get(0).VarID,
+		Output:      t.OutputStreams().Get(0).VarID,
+		Budget:      t.Budget,
+		BytesPerSec: t.BytesPerSec,
+	}, nil
+}
@@ -0,0 +1,493 @@
+package ops
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/dag"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/utils"
+)
+
+func init() {
+	exec.UseOp[*CombineValues]()
+	exec.UseOp[*CompareValues]()
+	exec.UseOp[*ConvertValue]()
+	exec.UseOp[*AssertEqual]()
+}
+
+const (
+	CombineConcat    = "concat"    // 拼接StringValue或者BytesValue，结果类型与输入相同
+	CombineSum       = "sum"       // 求IntValue的和
+	CombineJSONArray = "jsonArray" // 将所有输入转换为JSON后组成一个JSON数组
+)
+
+const (
+	ValueTypeInt    = "int"
+	ValueTypeString = "string"
+	ValueTypeBytes  = "bytes"
+	ValueTypeJSON   = "json"
+)
+
+// 将多个变量合并为一个
+type CombineValues struct {
+	Inputs []exec.VarID `json:"inputs"`
+	Output exec.VarID   `json:"output"`
+	Method string       `json:"method"`
+}
+
+func (o *CombineValues) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
+	inputs, err := exec.BindArray[exec.VarValue](e, ctx.Context, o.Inputs)
+	if err != nil {
+		return err
+	}
+
+	ret, err := combineValues(o.Method, inputs)
+	if err != nil {
+		return err
+	}
+
+	e.PutVar(o.Output, ret)
+	return nil
+}
+
+func (o *CombineValues) String() string {
+	return fmt.Sprintf("CombineValues(%v) (%v)->%v", o.Method, utils.FormatVarIDs(o.Inputs), o.Output)
+}
+
+func combineValues(method string, inputs []exec.VarValue) (exec.VarValue, error) {
+	switch method {
+	case CombineConcat:
+		if len(inputs) == 0 {
+			return &exec.StringValue{}, nil
+		}
+
+		switch inputs[0].(type) {
+		case *exec.StringValue:
+			sb := strings.Builder{}
+			for _, in := range inputs {
+				v, ok := in.(*exec.StringValue)
+				if !ok {
+					return nil, fmt.Errorf("cannot concat %T with StringValue", in)
+				}
+				sb.WriteString(v.Value)
+			}
+			return &exec.StringValue{Value: sb.String()}, nil
+
+		case *exec.BytesValue:
+			var buf []byte
+			for _, in := range inputs {
+				v, ok := in.(*exec.BytesValue)
+				if !ok {
+					return nil, fmt.Errorf("cannot concat %T with BytesValue", in)
+				}
+				buf = append(buf, v.Value...)
+			}
+			return &exec.BytesValue{Value: buf}, nil
+
+		default:
+			return nil, fmt.Errorf("cannot concat %T", inputs[0])
+		}
+
+	case CombineSum:
+		var sum int64
+		for _, in := range inputs {
+			v, ok := in.(*exec.IntValue)
+			if !ok {
+				return nil, fmt.Errorf("cannot sum %T", in)
+			}
+			sum += v.Value
+		}
+		return &exec.IntValue{Value: sum}, nil
+
+	case CombineJSONArray:
+		arr := make([]json.RawMessage, len(inputs))
+		for i, in := range inputs {
+			v, err := convertValue(in, ValueTypeJSON)
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = v.(*exec.JSONValue).Value
+		}
+		return exec.NewJSONValue(arr)
+
+	default:
+		return nil, fmt.Errorf("unknown combine method: %v", method)
+	}
+}
+
+// 比较两个相同类型的变量，结果为IntValue：A小于B时为-1，相等时为0，大于时为1。
+// JSONValue只能比较是否相等，不相等时结果为1。
+type CompareValues struct {
+	A      exec.VarID `json:"a"`
+	B      exec.VarID `json:"b"`
+	Output exec.VarID `json:"output"`
+}
+
+func (o *CompareValues) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
+	vals, err := exec.BindArray[exec.VarValue](e, ctx.Context, []exec.VarID{o.A, o.B})
+	if err != nil {
+		return err
+	}
+
+	ret, err := compareValues(vals[0], vals[1])
+	if err != nil {
+		return err
+	}
+
+	e.PutVar(o.Output, &exec.IntValue{Value: int64(ret)})
+	return nil
+}
+
+func (o *CompareValues) String() string {
+	return fmt.Sprintf("CompareValues %v,%v->%v", o.A, o.B, o.Output)
+}
+
+func compareValues(a, b exec.VarValue) (int, error) {
+	switch a := a.(type) {
+	case *exec.IntValue:
+		b, ok := b.(*exec.IntValue)
+		if !ok {
+			break
+		}
+		if a.Value < b.Value {
+			return -1, nil
+		}
+		if a.Value > b.Value {
+			return 1, nil
+		}
+		return 0, nil
+
+	case *exec.StringValue:
+		b, ok := b.(*exec.StringValue)
+		if !ok {
+			break
+		}
+		return strings.Compare(a.Value, b.Value), nil
+
+	case *exec.BytesValue:
+		b, ok := b.(*exec.BytesValue)
+		if !ok {
+			break
+		}
+		return bytes.Compare(a.Value, b.Value), nil
+
+	case *exec.JSONValue:
+		b, ok := b.(*exec.JSONValue)
+		if !ok {
+			break
+		}
+
+		// 重新编码一次，忽略空白以及对象字段顺序的差异
+		na, err := normalizeJSON(a.Value)
+		if err != nil {
+			return 0, err
+		}
+		nb, err := normalizeJSON(b.Value)
+		if err != nil {
+			return 0, err
+		}
+
+		if bytes.Equal(na, nb) {
+			return 0, nil
+		}
+		return 1, nil
+
+	case *exec.SignalValue:
+		if _, ok := b.(*exec.SignalValue); ok {
+			return 0, nil
+		}
+	}
+
+	return 0, fmt.Errorf("cannot compare %T with %T", a, b)
+}
+
+// 数字保留原本的文本，避免超过float64精度的整数在比较时被视为相等
+func normalizeJSON(data json.RawMessage) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("parsing json: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("parsing json: unexpected data after top-level value")
+	}
+
+	return json.Marshal(v)
+}
+
+// 转换变量的类型，To为ValueTypeXXX。支持的转换：
+//   - int与string：十进制数字
+//   - string与bytes：直接转换
+//   - 任意类型转换为json：int为数字，string为字符串，bytes为Base64编码的字符串
+//   - json转换为int、string、bytes：与上面相反。如果JSON不是字符串，那么转换为string时得到的是JSON文本
+type ConvertValue struct {
+	Input  exec.VarID `json:"input"`
+	Output exec.VarID `json:"output"`
+	To     string     `json:"to"`
+}
+
+func (o *ConvertValue) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
+	input, err := e.BindVar(ctx.Context, o.Input)
+	if err != nil {
+		return err
+	}
+
+	ret, err := convertValue(input, o.To)
+	if err != nil {
+		return err
+	}
+
+	e.PutVar(o.Output, ret)
+	return nil
+}
+
+func (o *ConvertValue) String() string {
+	return fmt.Sprintf("ConvertValue(%v) %v->%v", o.To, o.Input, o.Output)
+}
+
+func convertValue(val exec.VarValue, to string) (exec.VarValue, error) {
+	switch val := val.(type) {
+	case *exec.IntValue:
+		switch to {
+		case ValueTypeInt:
+			return val.Clone(), nil
+		case ValueTypeString:
+			return &exec.StringValue{Value: strconv.FormatInt(val.Value, 10)}, nil
+		case ValueTypeJSON:
+			return exec.NewJSONValue(val.Value)
+		}
+
+	case *exec.StringValue:
+		switch to {
+		case ValueTypeInt:
+			i, err := strconv.ParseInt(val.Value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("converting string to int: %w", err)
+			}
+			return &exec.IntValue{Value: i}, nil
+		case ValueTypeString:
+			return val.Clone(), nil
+		case ValueTypeBytes:
+			return &exec.BytesValue{Value: []byte(val.Value)}, nil
+		case ValueTypeJSON:
+			return exec.NewJSONValue(val.Value)
+		}
+
+	case *exec.BytesValue:
+		switch to {
+		case ValueTypeString:
+			return &exec.StringValue{Value: string(val.Value)}, nil
+		case ValueTypeBytes:
+			return val.Clone(), nil
+		case ValueTypeJSON:
+			return exec.NewJSONValue(val.Value)
+		}
+
+	case *exec.JSONValue:
+		switch to {
+		case ValueTypeInt:
+			var i int64
+			if err := val.Unmarshal(&i); err != nil {
+				return nil, fmt.Errorf("converting json to int: %w", err)
+			}
+			return &exec.IntValue{Value: i}, nil
+		case ValueTypeString:
+			var str string
+			if err := val.Unmarshal(&str); err != nil {
+				return &exec.StringValue{Value: string(val.Value)}, nil
+			}
+			return &exec.StringValue{Value: str}, nil
+		case ValueTypeBytes:
+			var data []byte
+			if err := val.Unmarshal(&data); err != nil {
+				return nil, fmt.Errorf("converting json to bytes: %w", err)
+			}
+			return &exec.BytesValue{Value: data}, nil
+		case ValueTypeJSON:
+			return val.Clone(), nil
+		}
+	}
+
+	return nil, fmt.Errorf("cannot convert %T to %v", val, to)
+}
+
+// 判断两个变量是否相等，不相等时让计划失败。比较规则与CompareValues相同。
+type AssertEqual struct {
+	A       exec.VarID `json:"a"`
+	B       exec.VarID `json:"b"`
+	Message string     `json:"message"` // 断言失败时返回的错误信息
+}
+
+func (o *AssertEqual) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
+	vals, err := exec.BindArray[exec.VarValue](e, ctx.Context, []exec.VarID{o.A, o.B})
+	if err != nil {
+		return err
+	}
+
+	ret, err := compareValues(vals[0], vals[1])
+	if err != nil {
+		return err
+	}
+
+	if ret != 0 {
+		return fmt.Errorf("assertion failed: %v: %v != %v", o.Message, formatValue(vals[0]), formatValue(vals[1]))
+	}
+
+	return nil
+}
+
+func (o *AssertEqual) String() string {
+	return fmt.Sprintf("AssertEqual(%v) %v,%v", o.Message, o.A, o.B)
+}
+
+func formatValue(val exec.VarValue) string {
+	switch val := val.(type) {
+	case *exec.IntValue:
+		return strconv.FormatInt(val.Value, 10)
+	case *exec.StringValue:
+		return strconv.Quote(val.Value)
+	case *exec.BytesValue:
+		return fmt.Sprintf("%X", val.Value)
+	case *exec.JSONValue:
+		return string(val.Value)
+	default:
+		return fmt.Sprintf("%T", val)
+	}
+}
+
+type CombineValuesNode struct {
+	dag.NodeBase
+	Method string
+}
+
+func (b *GraphNodeBuilder) NewCombineValues(method string) *CombineValuesNode {
+	node := &CombineValuesNode{
+		Method: method,
+	}
+	b.AddNode(node)
+
+	node.OutputValues().Init(node, 1)
+	return node
+}
+
+func (t *CombineValuesNode) AddInput(v *dag.ValueVar) {
+	v.To(t, t.InputValues().EnlargeOne())
+}
+
+func (t *CombineValuesNode) Output() dag.ValueOutputSlot {
+	return dag.ValueOutputSlot{
+		Node:  t,
+		Index: 0,
+	}
+}
+
+func (t *CombineValuesNode) GenerateOp() (exec.Op, error) {
+	return &CombineValues{
+		Inputs: t.InputValues().GetVarIDs(),
+		Output: t.OutputValues().Get(0).VarID,
+		Method: t.Method,
+	}, nil
+}
+
+type CompareValuesNode struct {
+	dag.NodeBase
+}
+
+func (b *GraphNodeBuilder) NewCompareValues() *CompareValuesNode {
+	node := &CompareValuesNode{}
+	b.AddNode(node)
+
+	node.InputValues().Init(2)
+	node.OutputValues().Init(node, 1)
+	return node
+}
+
+func (t *CompareValuesNode) SetInputs(a, b *dag.ValueVar) {
+	a.To(t, 0)
+	b.To(t, 1)
+}
+
+func (t *CompareValuesNode) Output() dag.ValueOutputSlot {
+	return dag.ValueOutputSlot{
+		Node:  t,
+		Index: 0,
+	}
+}
+
+func (t *CompareValuesNode) GenerateOp() (exec.Op, error) {
+	return &CompareValues{
+		A:      t.InputValues().Get(0).VarID,
+		B:      t.InputValues().Get(1).VarID,
+		Output: t.OutputValues().Get(0).VarID,
+	}, nil
+}
+
+type ConvertValueNode struct {
+	dag.NodeBase
+	To string
+}
+
+func (b *GraphNodeBuilder) NewConvertValue(to string) *ConvertValueNode {
+	node := &ConvertValueNode{
+		To: to,
+	}
+	b.AddNode(node)
+
+	node.InputValues().Init(1)
+	node.OutputValues().Init(node, 1)
+	return node
+}
+
+func (t *ConvertValueNode) SetInput(v *dag.ValueVar) {
+	v.To(t, 0)
+}
+
+func (t *ConvertValueNode) Output() dag.ValueOutputSlot {
+	return dag.ValueOutputSlot{
+		Node:  t,
+		Index: 0,
+	}
+}
+
+func (t *ConvertValueNode) GenerateOp() (exec.Op, error) {
+	return &ConvertValue{
+		Input:  t.InputValues().Get(0).VarID,
+		Output: t.OutputValues().Get(0).VarID,
+		To:     t.To,
+	}, nil
+}
+
+type AssertEqualNode struct {
+	dag.NodeBase
+	Message string
+}
+
+func (b *GraphNodeBuilder) NewAssertEqual(message string) *AssertEqualNode {
+	node := &AssertEqualNode{
+		Message: message,
+	}
+	b.AddNode(node)
+
+	node.InputValues().Init(2)
+	return node
+}
+
+func (t *AssertEqualNode) SetInputs(a, b *dag.ValueVar) {
+	a.To(t, 0)
+	b.To(t, 1)
+}
+
+func (t *AssertEqualNode) GenerateOp() (exec.Op, error) {
+	return &AssertEqual{
+		A:       t.InputValues().Get(0).VarID,
+		B:       t.InputValues().Get(1).VarID,
+		Message: t.Message,
+	}, nil
+}
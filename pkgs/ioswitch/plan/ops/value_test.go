@@ -0,0 +1,94 @@
+package ops
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
+)
+
+func Test_Values(t *testing.T) {
+	Convey("合并变量", t, func() {
+		e, wait := runTestOps(map[exec.VarID]exec.VarValue{
+			1: &exec.IntValue{Value: 1},
+			2: &exec.IntValue{Value: 2},
+			3: &exec.BytesValue{Value: []byte("ab")},
+			4: &exec.BytesValue{Value: []byte("cd")},
+			5: &exec.IntValue{Value: 1},
+			6: &exec.BytesValue{Value: []byte("ab")},
+			7: &exec.StringValue{Value: "x"},
+		},
+			&CombineValues{Inputs: []exec.VarID{1, 2}, Output: 11, Method: CombineSum},
+			&CombineValues{Inputs: []exec.VarID{3, 4}, Output: 12, Method: CombineConcat},
+			&CombineValues{Inputs: []exec.VarID{5, 6, 7}, Output: 13, Method: CombineJSONArray},
+		)
+
+		sum, err := exec.BindVar[*exec.IntValue](e, context.Background(), 11)
+		So(err, ShouldBeNil)
+		So(sum.Value, ShouldEqual, 3)
+
+		concat, err := exec.BindVar[*exec.BytesValue](e, context.Background(), 12)
+		So(err, ShouldBeNil)
+		So(string(concat.Value), ShouldEqual, "abcd")
+
+		arr, err := exec.BindVar[*exec.JSONValue](e, context.Background(), 13)
+		So(err, ShouldBeNil)
+		So(string(arr.Value), ShouldEqual, `[1,"YWI=","x"]`)
+
+		So(wait(), ShouldBeNil)
+	})
+
+	Convey("转换与比较变量", t, func() {
+		e, wait := runTestOps(map[exec.VarID]exec.VarValue{
+			1: &exec.StringValue{Value: "42"},
+			2: &exec.JSONValue{Value: []byte(` 42 `)},
+			3: &exec.JSONValue{Value: []byte(`{"b":1, "a":2}`)},
+			4: &exec.JSONValue{Value: []byte(`{"a":2,"b":1}`)},
+			5: &exec.JSONValue{Value: []byte(`{"id":9007199254740993}`)},
+			6: &exec.JSONValue{Value: []byte(`{"id": 9007199254740992}`)},
+		},
+			&ConvertValue{Input: 1, Output: 11, To: ValueTypeInt},
+			&ConvertValue{Input: 2, Output: 12, To: ValueTypeInt},
+			&CompareValues{A: 11, B: 12, Output: 13},
+			&CompareValues{A: 3, B: 4, Output: 14},
+			&CompareValues{A: 5, B: 6, Output: 15},
+		)
+
+		cmp, err := exec.BindVar[*exec.IntValue](e, context.Background(), 13)
+		So(err, ShouldBeNil)
+		So(cmp.Value, ShouldEqual, 0)
+
+		cmp, err = exec.BindVar[*exec.IntValue](e, context.Background(), 14)
+		So(err, ShouldBeNil)
+		So(cmp.Value, ShouldEqual, 0)
+
+		// 超过2^53的整数不能因为精度丢失而被视为相等
+		cmp, err = exec.BindVar[*exec.IntValue](e, context.Background(), 15)
+		So(err, ShouldBeNil)
+		So(cmp.Value, ShouldNotEqual, 0)
+
+		So(wait(), ShouldBeNil)
+	})
+
+	Convey("断言失败时计划失败", t, func() {
+		_, wait := runTestOps(map[exec.VarID]exec.VarValue{
+			1: &exec.IntValue{Value: 1},
+			2: &exec.IntValue{Value: 2},
+		},
+			&AssertEqual{A: 1, B: 2, Message: "size"},
+		)
+
+		err := wait()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "assertion failed: size: 1 != 2")
+	})
+
+	Convey("不支持的转换", t, func() {
+		_, err := convertValue(&exec.IntValue{Value: 1}, ValueTypeBytes)
+		So(err, ShouldNotBeNil)
+
+		_, err = compareValues(&exec.IntValue{Value: 1}, &exec.StringValue{Value: "1"})
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -1,6 +1,9 @@
 package ops
 
 import (
+	"fmt"
+
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/dag"
 	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
 )
 
@@ -21,3 +24,36 @@ func (o *ConstVar) Execute(ctx *exec.ExecContext, e *exec.Executor) error {
 func (o *ConstVar) String() string {
 	return "ConstVar"
 }
+
+type ConstNode struct {
+	dag.NodeBase
+	Value exec.VarValue
+}
+
+func (b *GraphNodeBuilder) NewConst(value exec.VarValue) *ConstNode {
+	node := &ConstNode{
+		Value: value,
+	}
+	b.AddNode(node)
+
+	node.OutputValues().Init(node, 1)
+	return node
+}
+
+func (t *ConstNode) Output() dag.ValueOutputSlot {
+	return dag.ValueOutputSlot{
+		Node:  t,
+		Index: 0,
+	}
+}
+
+func (t *ConstNode) GenerateOp() (exec.Op, error) {
+	if t.Value == nil {
+		return nil, fmt.Errorf("const value is nil")
+	}
+
+	return &ConstVar{
+		ID:    t.OutputValues().Get(0).VarID,
+		Value: t.Value,
+	}, nil
+}
@@ -0,0 +1,136 @@
+package plan
+
+import (
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/dag"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/plan/ops"
+)
+
+// 生成可恢复执行的计划的图。恢复执行时会再次调用这个函数，所以每次调用都应该生成同样的图，
+// 检查点的名称也应该相同。state是当前的执行进度，如果需要也可以根据它来调整生成的图。
+//
+// 恢复执行时会生成新的FromDriver、ToDriver节点的Handle，调用者需要使用最近一次调用时生成的Handle。
+type ResumableBuildFunc func(b *ops.GraphNodeBuilder, state *exec.PlanState) error
+
+// 生成一个可以通过Driver.Resume恢复执行的计划。state为nil代表从头开始执行。
+func GenerateResumable(state *exec.PlanState, build ResumableBuildFunc, cfg ...GenerateConfig) (*exec.PlanBuilder, error) {
+	if state == nil {
+		state = exec.NewPlanState()
+	}
+
+	b := ops.NewGraphNodeBuilder()
+	err := build(b, state)
+	if err != nil {
+		return nil, err
+	}
+
+	applyPlanState(b, state)
+
+	planBld := exec.NewPlanBuilder()
+	err = Generate(b.Graph, planBld, cfg...)
+	if err != nil {
+		return nil, err
+	}
+
+	planBld.State = state
+	planBld.Rebuild = func(state *exec.PlanState) (*exec.PlanBuilder, error) {
+		return GenerateResumable(state, build, cfg...)
+	}
+	return planBld, nil
+}
+
+// 根据执行进度移除已经完成的工作
+func applyPlanState(graph *ops.GraphNodeBuilder, state *exec.PlanState) {
+	var completed []dag.Node
+	graph.Walk(func(node dag.Node) bool {
+		r, ok := node.(ops.ResumableNode)
+		if ok && r.ApplyPlanState(graph, state) {
+			completed = append(completed, node)
+		}
+		return true
+	})
+
+	for _, node := range completed {
+		pruneNode(graph, node)
+	}
+}
+
+// 断开节点的所有输入，如果节点的所有输出都不再被使用，则移除节点。
+// 对于提供输入的节点，如果它的所有输出都不再被使用，那么同样移除它，否则丢弃不再被使用的输出流。
+func pruneNode(graph *ops.GraphNodeBuilder, node dag.Node) {
+	nodes := []dag.Node{node}
+	for len(nodes) > 0 {
+		n := nodes[0]
+		nodes = nodes[1:]
+
+		var srcs []dag.Node
+		for i := 0; i < n.InputStreams().Len(); i++ {
+			if in := n.InputStreams().Get(i); in != nil {
+				srcs = append(srcs, in.Src)
+			}
+		}
+		n.InputStreams().ClearAllInput(n)
+
+		for i := 0; i < n.InputValues().Len(); i++ {
+			if in := n.InputValues().Get(i); in != nil {
+				srcs = append(srcs, in.Src)
+			}
+			n.InputValues().ClearInputAt(n, i)
+		}
+
+		if isUnused(n) {
+			removeNode(graph, n)
+		}
+
+		for _, src := range srcs {
+			if src.Graph() == nil {
+				continue
+			}
+
+			if isUnused(src) {
+				nodes = append(nodes, src)
+				continue
+			}
+
+			for i := 0; i < src.OutputStreams().Len(); i++ {
+				out := src.OutputStreams().Get(i)
+				if out.Dst.Len() > 0 {
+					continue
+				}
+
+				drop := graph.NewDropStream()
+				*drop.Env() = *src.Env()
+				drop.SetInput(out)
+			}
+		}
+	}
+}
+
+func isUnused(node dag.Node) bool {
+	for i := 0; i < node.OutputStreams().Len(); i++ {
+		if node.OutputStreams().Get(i).Dst.Len() > 0 {
+			return false
+		}
+	}
+
+	for i := 0; i < node.OutputValues().Len(); i++ {
+		if node.OutputValues().Get(i).Dst.Len() > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func removeNode(graph *ops.GraphNodeBuilder, node dag.Node) {
+	graph.RemoveNode(node)
+	node.SetGraph(nil)
+
+	// 没有生成指令的Handle的ID为0，Driver会直接跳过它们
+	switch n := node.(type) {
+	case *ops.FromDriverNode:
+		n.Handle.ID = 0
+	case *ops.ToDriverNode:
+		n.Handle.ID = 0
+	}
+}
@@ -0,0 +1,203 @@
+package plan
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/dag"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/plan/ops"
+	"gitlink.org.cn/cloudream/common/utils/math2"
+)
+
+func Test_Resume(t *testing.T) {
+	data := make([]byte, 100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	type handles struct {
+		from *exec.DriverWriteStream
+		to   *exec.DriverReadStream
+	}
+
+	// FromDriver -> mid -> ToDriver，所有节点都在Driver上执行。每次生成图时都会更新hs中的Handle
+	newBuild := func(hs *handles, mid func(b *ops.GraphNodeBuilder, in *dag.StreamVar) *dag.StreamVar) ResumableBuildFunc {
+		return func(b *ops.GraphNodeBuilder, state *exec.PlanState) error {
+			hs.from = &exec.DriverWriteStream{RangeHint: &math2.Range{}}
+			hs.to = &exec.DriverReadStream{}
+
+			from := b.NewFromDriver(hs.from)
+			from.Env().ToEnvDriver()
+
+			to := b.NewToDriver(hs.to)
+			to.Env().ToEnvDriver()
+			to.Range = math2.NewRange(0, int64(len(data)))
+			to.Checkpoint = "out"
+			to.SetInput(mid(b, from.Output().Var()))
+			return nil
+		}
+	}
+
+	throttle := func(b *ops.GraphNodeBuilder, in *dag.StreamVar) *dag.StreamVar {
+		n := b.NewThrottle("", 0)
+		n.Env().ToEnvDriver()
+		n.SetInput(in)
+		return n.Output().Var()
+	}
+
+	compress := func(b *ops.GraphNodeBuilder, in *dag.StreamVar) *dag.StreamVar {
+		c := b.NewCompress(ops.CompressGzip, 1)
+		c.Env().ToEnvDriver()
+		c.SetInput(in)
+
+		d := b.NewDecompress(ops.CompressGzip)
+		d.Env().ToEnvDriver()
+		d.SetInput(c.Output().Var())
+		return d.Output().Var()
+	}
+
+	// 读取40个字节后中断执行，返回执行进度
+	runInterrupted := func(hs *handles, build ResumableBuildFunc) (*exec.Driver, *exec.PlanState) {
+		blder, err := GenerateResumable(nil, build)
+		So(err, ShouldBeNil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d := blder.Execute(exec.NewWithContext(ctx))
+		d.BeginWrite(io.NopCloser(bytes.NewReader(data)), hs.from)
+		str, err := d.BeginRead(hs.to)
+		So(err, ShouldBeNil)
+
+		buf := make([]byte, 40)
+		_, err = io.ReadFull(str, buf)
+		So(err, ShouldBeNil)
+		So(buf, ShouldResemble, data[:40])
+
+		str.Close()
+		cancel()
+		d.Wait(context.Background())
+
+		state := d.State()
+		So(state.Offset("out"), ShouldEqual, 40)
+		So(state.IsCompleted("out"), ShouldBeFalse)
+		return d, state
+	}
+
+	// 恢复执行，返回读取到的数据
+	resume := func(d *exec.Driver, hs *handles, state *exec.PlanState) []byte {
+		d2, err := d.Resume(exec.NewExecContext(), state)
+		So(err, ShouldBeNil)
+
+		d2.BeginWrite(io.NopCloser(bytes.NewReader(data)), hs.from)
+		str, err := d2.BeginRead(hs.to)
+		So(err, ShouldBeNil)
+
+		got, err := io.ReadAll(str)
+		So(err, ShouldBeNil)
+		str.Close()
+
+		_, err = d2.Wait(context.Background())
+		So(err, ShouldBeNil)
+		So(d2.State().IsCompleted("out"), ShouldBeTrue)
+		So(d2.State().Offset("out"), ShouldEqual, len(data))
+		return got
+	}
+
+	Convey("恢复执行时，已经读取的部分由FromDriver跳过", t, func() {
+		hs := &handles{}
+		build := newBuild(hs, throttle)
+		d, state := runInterrupted(hs, build)
+
+		got := resume(d, hs, state)
+		So(got, ShouldResemble, data[40:])
+		So(hs.from.RangeHint.Offset, ShouldEqual, 40)
+		So(*hs.to.RangeHint, ShouldResemble, math2.NewRange(40, 60))
+	})
+
+	Convey("上游节点不能跳过时插入Range节点", t, func() {
+		hs := &handles{}
+		build := newBuild(hs, compress)
+		d, state := runInterrupted(hs, build)
+
+		blder, err := GenerateResumable(state, build)
+		So(err, ShouldBeNil)
+
+		var rngs []*ops.RangeStream
+		for _, op := range blder.DriverPlan.Ops {
+			if r, ok := op.(*ops.RangeStream); ok {
+				rngs = append(rngs, r)
+			}
+		}
+		So(rngs, ShouldHaveLength, 1)
+		So(rngs[0].Range, ShouldResemble, math2.Range{Offset: 40})
+		So(rngs[0].Output, ShouldEqual, hs.to.ID)
+		So(hs.from.RangeHint.Offset, ShouldEqual, 0)
+
+		got := resume(d, hs, state)
+		So(got, ShouldResemble, data[40:])
+	})
+
+	Convey("已经完成的检查点不再执行", t, func() {
+		hs := &handles{}
+		build := func(b *ops.GraphNodeBuilder, state *exec.PlanState) error {
+			err := newBuild(hs, throttle)(b, state)
+			if err != nil {
+				return err
+			}
+
+			c := b.NewConst(&exec.IntValue{Value: 1})
+			c.Env().ToEnvDriver()
+			cp := b.NewCheckpoint("value")
+			cp.SetInput(c.Output().Var())
+
+			// 只有使用检查点记录的值时断言才会成功
+			expected := b.NewConst(&exec.IntValue{Value: 5})
+			expected.Env().ToEnvDriver()
+			assert := b.NewAssertEqual("value")
+			assert.Env().ToEnvDriver()
+			assert.SetInputs(cp.Output().Var(), expected.Output().Var())
+			return nil
+		}
+
+		state := exec.NewPlanState()
+		state.Completed["out"] = true
+		state.Completed["value"] = true
+		state.Values["value"] = &exec.IntValue{Value: 5}
+
+		blder, err := GenerateResumable(state, build)
+		So(err, ShouldBeNil)
+
+		// 产生检查点的值的指令被移除，改为直接输出记录的值
+		So(blder.DriverPlan.Ops, ShouldHaveLength, 3)
+		for _, op := range blder.DriverPlan.Ops {
+			if c, ok := op.(*ops.ConstVar); ok {
+				So(c.Value, ShouldResemble, &exec.IntValue{Value: 5})
+			}
+		}
+		So(hs.from.ID, ShouldEqual, 0)
+		So(hs.to.ID, ShouldEqual, 0)
+
+		d := blder.Execute(exec.NewExecContext())
+		d.BeginWrite(io.NopCloser(bytes.NewReader(data)), hs.from)
+		str, err := d.BeginRead(hs.to)
+		So(err, ShouldBeNil)
+		got, err := io.ReadAll(str)
+		So(err, ShouldBeNil)
+		So(got, ShouldBeEmpty)
+
+		_, err = d.Wait(context.Background())
+		So(err, ShouldBeNil)
+	})
+
+	Convey("不可恢复的计划", t, func() {
+		blder := exec.NewPlanBuilder()
+		d := blder.Execute(exec.NewExecContext())
+		_, err := d.Resume(exec.NewExecContext(), nil)
+		So(err, ShouldNotBeNil)
+	})
+}
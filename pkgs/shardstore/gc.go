@@ -0,0 +1,135 @@
+package shardstore
+
+import (
+	"fmt"
+	"time"
+
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+)
+
+// 仍在被使用的文件的哈希值集合
+type LiveSet map[cdssdk.FileHash]bool
+
+func NewLiveSet(hashes ...cdssdk.FileHash) LiveSet {
+	s := make(LiveSet)
+	s.Add(hashes...)
+	return s
+}
+
+func (s LiveSet) Add(hashes ...cdssdk.FileHash) {
+	for _, h := range hashes {
+		s[h] = true
+	}
+}
+
+func (s LiveSet) AddObjects(objs ...cdssdk.Object) {
+	for _, obj := range objs {
+		s[obj.FileHash] = true
+	}
+}
+
+// 将被固定的对象的文件加入集合。PinnedObject中只有ObjectID，因此需要同时提供这些对象的信息，找不到对象的记录会被忽略。
+func (s LiveSet) AddPinnedObjects(pinned []cdssdk.PinnedObject, objs []cdssdk.Object) {
+	objMap := make(map[cdssdk.ObjectID]cdssdk.Object, len(objs))
+	for _, obj := range objs {
+		objMap[obj.ObjectID] = obj
+	}
+
+	for _, p := range pinned {
+		obj, ok := objMap[p.ObjectID]
+		if ok {
+			s[obj.FileHash] = true
+		}
+	}
+}
+
+type GCOption struct {
+	// 在开始GC前的这段时间内写入的文件不会被清理。因为文件写入完成到被记录为某个对象的数据之间有一段时间，
+	// 在此期间这个文件不在LiveSet中，但不应该被清理。
+	GracePeriod time.Duration
+	// 只统计可以清理的文件，不实际删除
+	DryRun bool
+}
+
+type GCReport struct {
+	DryRun           bool       `json:"dryRun"`
+	TotalFiles       int        `json:"totalFiles"`
+	LiveFiles        int        `json:"liveFiles"`
+	RecentFiles      int        `json:"recentFiles"`      // 不在LiveSet中，但因为最近被写入过而没有清理的文件数
+	Garbage          []FileInfo `json:"garbage"`          // 被清理的文件，DryRun时为可以被清理的文件
+	ReclaimableBytes int64      `json:"reclaimableBytes"` // Garbage中文件的总大小
+}
+
+// 删除文件前再次检查文件的修改时间，保证检查与删除之间文件不会被重新写入。
+// 实现了这个接口的分片存储可以在有文件正在写入时安全地执行GC。
+type ConditionalRemover interface {
+	// 如果文件在since之后没有被修改过，则删除它并返回true。文件不存在时返回false。
+	RemoveIfNotModifiedSince(hash cdssdk.FileHash, since time.Time) (bool, error)
+}
+
+// 清理分片存储中不在live集合中的文件。
+//
+// 如果存储实现了ConditionalRemover接口，那么GC过程中写入的文件（包括重复写入已有的文件）都不会被清理。
+// 否则只能依靠GracePeriod来保护正在写入的文件。
+func GC(store ShardStore, live LiveSet, opt GCOption) (GCReport, error) {
+	// 先确定时间再列出文件，这样列出文件之后写入的文件的修改时间一定在cutoff之后
+	cutoff := time.Now().Add(-opt.GracePeriod)
+
+	report := GCReport{
+		DryRun: opt.DryRun,
+	}
+
+	infos, err := store.ListAll()
+	if err != nil {
+		return report, fmt.Errorf("list files: %w", err)
+	}
+	report.TotalFiles = len(infos)
+
+	var garbage []FileInfo
+	for _, info := range infos {
+		if live[info.Hash] {
+			report.LiveFiles++
+			continue
+		}
+
+		if !info.ModTime.Before(cutoff) {
+			report.RecentFiles++
+			continue
+		}
+
+		garbage = append(garbage, info)
+	}
+
+	if opt.DryRun {
+		for _, info := range garbage {
+			report.Garbage = append(report.Garbage, info)
+			report.ReclaimableBytes += info.Size
+		}
+		return report, nil
+	}
+
+	condRemover, isCond := store.(ConditionalRemover)
+	for _, info := range garbage {
+		if isCond {
+			removed, err := condRemover.RemoveIfNotModifiedSince(info.Hash, cutoff)
+			if err != nil {
+				return report, fmt.Errorf("remove %v: %w", info.Hash, err)
+			}
+
+			if !removed {
+				report.RecentFiles++
+				continue
+			}
+		} else {
+			err := store.Remove(info.Hash)
+			if err != nil {
+				return report, fmt.Errorf("remove %v: %w", info.Hash, err)
+			}
+		}
+
+		report.Garbage = append(report.Garbage, info)
+		report.ReclaimableBytes += info.Size
+	}
+
+	return report, nil
+}
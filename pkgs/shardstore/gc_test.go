@@ -0,0 +1,90 @@
+package shardstore
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+)
+
+func Test_GC(t *testing.T) {
+	old := time.Now().Add(-time.Hour)
+
+	create := func(store *LocalStore, data string, modTime time.Time) FileInfo {
+		info, err := store.Create(bytes.NewReader([]byte(data)))
+		So(err, ShouldBeNil)
+		So(os.Chtimes(info.Path, modTime, modTime), ShouldBeNil)
+		return info
+	}
+
+	Convey("清理不再使用的文件", t, func() {
+		store, err := NewLocal(&cdssdk.LocalShardStorage{Root: t.TempDir()})
+		So(err, ShouldBeNil)
+
+		live := create(store, "live", old)
+		garbage := create(store, "garbage", old)
+		recent := create(store, "recent", time.Now())
+
+		liveSet := NewLiveSet()
+		liveSet.AddObjects(cdssdk.Object{FileHash: live.Hash})
+
+		report, err := GC(store, liveSet, GCOption{GracePeriod: time.Minute, DryRun: true})
+		So(err, ShouldBeNil)
+		So(report.TotalFiles, ShouldEqual, 3)
+		So(report.LiveFiles, ShouldEqual, 1)
+		So(report.RecentFiles, ShouldEqual, 1)
+		So(report.Garbage, ShouldHaveLength, 1)
+		So(report.Garbage[0].Hash, ShouldEqual, garbage.Hash)
+		So(report.ReclaimableBytes, ShouldEqual, len("garbage"))
+		So(store.Stats().FileCount, ShouldEqual, 3)
+
+		report, err = GC(store, liveSet, GCOption{GracePeriod: time.Minute})
+		So(err, ShouldBeNil)
+		So(report.Garbage, ShouldHaveLength, 1)
+		So(report.ReclaimableBytes, ShouldEqual, len("garbage"))
+
+		_, err = store.Info(garbage.Hash)
+		So(err, ShouldNotBeNil)
+		_, err = store.Info(live.Hash)
+		So(err, ShouldBeNil)
+		_, err = store.Info(recent.Hash)
+		So(err, ShouldBeNil)
+		So(store.Stats().FileCount, ShouldEqual, 2)
+	})
+
+	Convey("被固定的对象", t, func() {
+		store, err := NewLocal(&cdssdk.LocalShardStorage{Root: t.TempDir()})
+		So(err, ShouldBeNil)
+
+		pinned := create(store, "pinned", old)
+
+		liveSet := NewLiveSet()
+		liveSet.AddPinnedObjects([]cdssdk.PinnedObject{{ObjectID: 1}}, []cdssdk.Object{{ObjectID: 1, FileHash: pinned.Hash}})
+
+		report, err := GC(store, liveSet, GCOption{})
+		So(err, ShouldBeNil)
+		So(report.LiveFiles, ShouldEqual, 1)
+		So(report.Garbage, ShouldBeEmpty)
+	})
+
+	Convey("检查之后被重新写入的文件不会被删除", t, func() {
+		store, err := NewLocal(&cdssdk.LocalShardStorage{Root: t.TempDir()})
+		So(err, ShouldBeNil)
+
+		info := create(store, "data", old)
+		cutoff := time.Now().Add(-time.Minute)
+
+		_, err = store.Create(bytes.NewReader([]byte("data")))
+		So(err, ShouldBeNil)
+
+		removed, err := store.RemoveIfNotModifiedSince(info.Hash, cutoff)
+		So(err, ShouldBeNil)
+		So(removed, ShouldBeFalse)
+
+		_, err = store.Info(info.Hash)
+		So(err, ShouldBeNil)
+	})
+}
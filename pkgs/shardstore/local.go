@@ -0,0 +1,388 @@
+package shardstore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+	"gitlink.org.cn/cloudream/common/utils/io2"
+)
+
+const (
+	localBlocksDir   = "blocks"
+	localTempDir     = "temp"
+	localHashDirLen  = 2
+	localCopyBufSize = 32 * 1024
+	localDirMode     = 0755
+)
+
+// 使用本地文件系统的分片存储。文件保存在Root/blocks/[哈希值前两位]/[FileHash]，
+// 写入时先写到Root/temp中的临时文件，写入完成后再移动过去。
+type LocalStore struct {
+	cfg       cdssdk.LocalShardStorage
+	lock      sync.Mutex
+	fileCount int
+	totalSize int64
+	writing   int64
+}
+
+// 创建本地分片存储，会删除上次运行时遗留的临时文件，并统计已有文件的大小
+func NewLocal(cfg *cdssdk.LocalShardStorage) (*LocalStore, error) {
+	s := &LocalStore{
+		cfg: *cfg,
+	}
+
+	err := os.RemoveAll(s.tempDir())
+	if err != nil {
+		return nil, fmt.Errorf("clean temp dir: %w", err)
+	}
+
+	err = os.MkdirAll(s.tempDir(), localDirMode)
+	if err != nil {
+		return nil, fmt.Errorf("create temp dir: %w", err)
+	}
+
+	err = os.MkdirAll(s.blocksDir(), localDirMode)
+	if err != nil {
+		return nil, fmt.Errorf("create blocks dir: %w", err)
+	}
+
+	infos, err := s.ListAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, info := range infos {
+		s.fileCount++
+		s.totalSize += info.Size
+	}
+
+	return s, nil
+}
+
+// 写入一个文件。如果配置了MaxSize，那么写入过程中存储的总大小（包括其他正在写入的文件）超过MaxSize时，会返回ErrStoreFull。
+// 因为写入完成前无法知道文件是否已经存在，所以即使写入的是已有的文件，也会占用空间。
+func (s *LocalStore) Create(stream io.Reader) (FileInfo, error) {
+	file, err := os.CreateTemp(s.tempDir(), "")
+	if err != nil {
+		return FileInfo{}, fmt.Errorf("create temp file: %w", err)
+	}
+
+	size, hash, err := s.writeTemp(file, stream)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		s.release(size)
+		return FileInfo{}, err
+	}
+
+	err = file.Close()
+	if err != nil {
+		os.Remove(file.Name())
+		s.release(size)
+		return FileInfo{}, fmt.Errorf("close temp file: %w", err)
+	}
+
+	return s.commit(file.Name(), hash, size)
+}
+
+func (s *LocalStore) writeTemp(file *os.File, stream io.Reader) (int64, cdssdk.FileHash, error) {
+	hasher := cdssdk.NewFullHasher()
+	buf := make([]byte, localCopyBufSize)
+	var size int64
+
+	for {
+		n, rerr := stream.Read(buf)
+		if n > 0 {
+			err := s.reserve(int64(n))
+			if err != nil {
+				return size, "", err
+			}
+			size += int64(n)
+
+			_, err = file.Write(buf[:n])
+			if err != nil {
+				return size, "", fmt.Errorf("write temp file: %w", err)
+			}
+			hasher.Write(buf[:n])
+		}
+
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return size, "", fmt.Errorf("read input: %w", rerr)
+		}
+	}
+
+	err := file.Sync()
+	if err != nil {
+		return size, "", fmt.Errorf("sync temp file: %w", err)
+	}
+
+	return size, hasher.Sum(), nil
+}
+
+func (s *LocalStore) reserve(size int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.cfg.MaxSize > 0 && s.totalSize+s.writing+size > s.cfg.MaxSize {
+		return ErrStoreFull
+	}
+
+	s.writing += size
+	return nil
+}
+
+func (s *LocalStore) release(size int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.writing -= size
+}
+
+// 将写入完成的临时文件移动到最终的位置
+func (s *LocalStore) commit(tempPath string, hash cdssdk.FileHash, size int64) (FileInfo, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// 写入时已经预留了空间，所以这里不需要再检查MaxSize
+	s.writing -= size
+	blockPath := s.blockPath(hash)
+
+	// 文件已经存在时直接使用已有的文件，但要更新它的修改时间，防止被当做长时间没有使用的文件而被清理掉
+	if _, err := os.Stat(blockPath); err == nil {
+		os.Remove(tempPath)
+
+		now := time.Now()
+		err := os.Chtimes(blockPath, now, now)
+		if err != nil {
+			return FileInfo{}, fmt.Errorf("touch existing file: %w", err)
+		}
+
+		return FileInfo{
+			Hash:    hash,
+			Size:    size,
+			Path:    blockPath,
+			ModTime: now,
+		}, nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(blockPath), localDirMode)
+	if err != nil {
+		os.Remove(tempPath)
+		return FileInfo{}, fmt.Errorf("create hash dir: %w", err)
+	}
+
+	err = os.Rename(tempPath, blockPath)
+	if err != nil {
+		os.Remove(tempPath)
+		return FileInfo{}, fmt.Errorf("move temp file: %w", err)
+	}
+
+	s.fileCount++
+	s.totalSize += size
+
+	info, err := os.Stat(blockPath)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	return FileInfo{
+		Hash:    hash,
+		Size:    size,
+		Path:    blockPath,
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+func (s *LocalStore) Open(opt OpenOption) (io.ReadCloser, error) {
+	_, err := cdssdk.ParseHash(string(opt.FileHash))
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(s.blockPath(opt.FileHash))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %v", ErrFileNotFound, opt.FileHash)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if opt.Offset > 0 {
+		_, err = file.Seek(opt.Offset, io.SeekStart)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	if opt.Length >= 0 {
+		return io2.Length(file, opt.Length), nil
+	}
+
+	return file, nil
+}
+
+func (s *LocalStore) Info(hash cdssdk.FileHash) (FileInfo, error) {
+	_, err := cdssdk.ParseHash(string(hash))
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	path := s.blockPath(hash)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return FileInfo{}, fmt.Errorf("%w: %v", ErrFileNotFound, hash)
+	}
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	return FileInfo{
+		Hash:    hash,
+		Size:    info.Size(),
+		Path:    path,
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+func (s *LocalStore) ListAll() ([]FileInfo, error) {
+	var infos []FileInfo
+
+	err := filepath.WalkDir(s.blocksDir(), func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		// 忽略不是由存储写入的文件
+		hash, err := cdssdk.ParseHash(d.Name())
+		if err != nil {
+			return nil
+		}
+
+		info, err := d.Info()
+		if os.IsNotExist(err) {
+			// 遍历的过程中可能被删除了
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		infos = append(infos, FileInfo{
+			Hash:    hash,
+			Size:    info.Size(),
+			Path:    path,
+			ModTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk blocks dir: %w", err)
+	}
+
+	return infos, nil
+}
+
+func (s *LocalStore) Remove(hashes ...cdssdk.FileHash) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, hash := range hashes {
+		err := s.removeLocked(hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *LocalStore) removeLocked(hash cdssdk.FileHash) error {
+	_, err := cdssdk.ParseHash(string(hash))
+	if err != nil {
+		return err
+	}
+
+	path := s.blockPath(hash)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove %v: %w", hash, err)
+	}
+
+	s.fileCount--
+	s.totalSize -= info.Size()
+	return nil
+}
+
+func (s *LocalStore) RemoveIfNotModifiedSince(hash cdssdk.FileHash, since time.Time) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	info, err := s.Info(hash)
+	if errors.Is(err, ErrFileNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// 重复写入同样的文件会在持有锁的情况下更新文件的修改时间，所以这里检查之后文件不会再被修改
+	if info.ModTime.After(since) {
+		return false, nil
+	}
+
+	err = s.removeLocked(hash)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *LocalStore) Stats() Stats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return Stats{
+		FileCount: s.fileCount,
+		TotalSize: s.totalSize,
+		Writing:   s.writing,
+		MaxSize:   s.cfg.MaxSize,
+	}
+}
+
+func (s *LocalStore) blocksDir() string {
+	return filepath.Join(s.cfg.Root, localBlocksDir)
+}
+
+func (s *LocalStore) tempDir() string {
+	return filepath.Join(s.cfg.Root, localTempDir)
+}
+
+func (s *LocalStore) blockPath(hash cdssdk.FileHash) string {
+	return filepath.Join(s.blocksDir(), hash.GetHashPrefix(localHashDirLen), string(hash))
+}
+
+var _ ShardStore = (*LocalStore)(nil)
+var _ ConditionalRemover = (*LocalStore)(nil)
@@ -0,0 +1,136 @@
+package shardstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+)
+
+func Test_LocalStore(t *testing.T) {
+	newStore := func(maxSize int64) (*LocalStore, string) {
+		root := t.TempDir()
+		store, err := NewLocal(&cdssdk.LocalShardStorage{Root: root, MaxSize: maxSize})
+		So(err, ShouldBeNil)
+		return store, root
+	}
+
+	Convey("写入并读取", t, func() {
+		store, _ := newStore(0)
+
+		data := []byte("0123456789")
+		info, err := store.Create(bytes.NewReader(data))
+		So(err, ShouldBeNil)
+
+		hash := sha256.Sum256(data)
+		So(info.Hash, ShouldEqual, cdssdk.NewFullHash(hash[:]))
+		So(info.Size, ShouldEqual, 10)
+
+		str, err := store.Open(NewOpen(info.Hash))
+		So(err, ShouldBeNil)
+		got, err := io.ReadAll(str)
+		str.Close()
+		So(err, ShouldBeNil)
+		So(got, ShouldResemble, data)
+
+		str, err = store.Open(NewOpen(info.Hash).WithStartEnd(2, 5))
+		So(err, ShouldBeNil)
+		got, _ = io.ReadAll(str)
+		str.Close()
+		So(string(got), ShouldEqual, "234")
+
+		str, err = store.Open(NewOpen(info.Hash).WithStartEnd(7, -1))
+		So(err, ShouldBeNil)
+		got, _ = io.ReadAll(str)
+		str.Close()
+		So(string(got), ShouldEqual, "789")
+
+		stat, err := store.Info(info.Hash)
+		So(err, ShouldBeNil)
+		So(stat.Size, ShouldEqual, 10)
+
+		So(store.Stats(), ShouldResemble, Stats{FileCount: 1, TotalSize: 10})
+	})
+
+	Convey("重复写入同样的文件", t, func() {
+		store, root := newStore(0)
+
+		info1, err := store.Create(bytes.NewReader([]byte("abc")))
+		So(err, ShouldBeNil)
+		info2, err := store.Create(bytes.NewReader([]byte("abc")))
+		So(err, ShouldBeNil)
+		So(info2.Hash, ShouldEqual, info1.Hash)
+
+		infos, err := store.ListAll()
+		So(err, ShouldBeNil)
+		So(infos, ShouldHaveLength, 1)
+		So(store.Stats().TotalSize, ShouldEqual, 3)
+
+		temps, _ := os.ReadDir(filepath.Join(root, localTempDir))
+		So(temps, ShouldBeEmpty)
+	})
+
+	Convey("删除文件", t, func() {
+		store, _ := newStore(0)
+
+		info, err := store.Create(bytes.NewReader([]byte("abc")))
+		So(err, ShouldBeNil)
+
+		So(store.Remove(info.Hash), ShouldBeNil)
+		So(store.Remove(info.Hash), ShouldBeNil)
+
+		_, err = store.Info(info.Hash)
+		So(errors.Is(err, ErrFileNotFound), ShouldBeTrue)
+		_, err = store.Open(NewOpen(info.Hash))
+		So(errors.Is(err, ErrFileNotFound), ShouldBeTrue)
+		So(store.Stats(), ShouldResemble, Stats{})
+	})
+
+	Convey("超过MaxSize", t, func() {
+		store, root := newStore(15)
+
+		_, err := store.Create(bytes.NewReader(make([]byte, 10)))
+		So(err, ShouldBeNil)
+
+		_, err = store.Create(bytes.NewReader(make([]byte, 6)))
+		So(err, ShouldEqual, ErrStoreFull)
+		So(store.Stats(), ShouldResemble, Stats{FileCount: 1, TotalSize: 10, MaxSize: 15})
+
+		temps, _ := os.ReadDir(filepath.Join(root, localTempDir))
+		So(temps, ShouldBeEmpty)
+
+		_, err = store.Create(bytes.NewReader([]byte("12345")))
+		So(err, ShouldBeNil)
+	})
+
+	Convey("重新打开时统计已有文件", t, func() {
+		store, root := newStore(0)
+
+		_, err := store.Create(bytes.NewReader([]byte("abc")))
+		So(err, ShouldBeNil)
+		_, err = store.Create(bytes.NewReader([]byte("defg")))
+		So(err, ShouldBeNil)
+
+		os.WriteFile(filepath.Join(root, localTempDir, "leftover"), []byte("x"), 0644)
+
+		store2, err := NewLocal(&cdssdk.LocalShardStorage{Root: root})
+		So(err, ShouldBeNil)
+		So(store2.Stats(), ShouldResemble, Stats{FileCount: 2, TotalSize: 7})
+
+		temps, _ := os.ReadDir(filepath.Join(root, localTempDir))
+		So(temps, ShouldBeEmpty)
+	})
+
+	Convey("非法的哈希值", t, func() {
+		store, _ := newStore(0)
+
+		_, err := store.Open(NewOpen("Full../../etc"))
+		So(err, ShouldNotBeNil)
+	})
+}
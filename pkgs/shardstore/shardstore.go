@@ -0,0 +1,75 @@
+package shardstore
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+)
+
+var ErrFileNotFound = errors.New("file not found")
+
+// 写入文件后存储的总大小会超过MaxSize
+var ErrStoreFull = errors.New("shard store is full")
+
+// 分片存储。文件以内容的哈希值作为标识，相同内容的文件只会保存一份。
+type ShardStore interface {
+	// 写入一个文件，写入的同时计算文件的哈希值。写入完成之前，文件对其他操作不可见。
+	Create(stream io.Reader) (FileInfo, error)
+	// 打开一个文件，可以只读取其中的一部分
+	Open(opt OpenOption) (io.ReadCloser, error)
+	// 获取文件的信息，文件不存在时返回ErrFileNotFound
+	Info(hash cdssdk.FileHash) (FileInfo, error)
+	// 列出所有文件
+	ListAll() ([]FileInfo, error)
+	// 删除文件，不存在的文件会被忽略
+	Remove(hashes ...cdssdk.FileHash) error
+	// 获取存储的使用情况
+	Stats() Stats
+}
+
+type FileInfo struct {
+	Hash    cdssdk.FileHash `json:"hash"`
+	Size    int64           `json:"size"`
+	Path    string          `json:"path"`    // 文件在存储中的路径
+	ModTime time.Time       `json:"modTime"` // 文件最后一次被写入的时间，重复写入同样的文件也会更新这个时间
+}
+
+type Stats struct {
+	FileCount int   `json:"fileCount"`
+	TotalSize int64 `json:"totalSize"` // 已经保存的文件的总大小
+	Writing   int64 `json:"writing"`   // 正在写入的文件已经写入的大小
+	MaxSize   int64 `json:"maxSize"`   // 为0代表不限制
+}
+
+type OpenOption struct {
+	FileHash cdssdk.FileHash
+	Offset   int64
+	Length   int64 // 为-1代表读取到文件末尾
+}
+
+func NewOpen(hash cdssdk.FileHash) OpenOption {
+	return OpenOption{
+		FileHash: hash,
+		Offset:   0,
+		Length:   -1,
+	}
+}
+
+// 读取[start, end)范围的数据，end为-1代表读取到文件末尾
+func (o OpenOption) WithStartEnd(start int64, end int64) OpenOption {
+	o.Offset = start
+	if end < 0 {
+		o.Length = -1
+	} else {
+		o.Length = end - start
+	}
+	return o
+}
+
+func (o OpenOption) WithOffsetLength(offset int64, length int64) OpenOption {
+	o.Offset = offset
+	o.Length = length
+	return o
+}
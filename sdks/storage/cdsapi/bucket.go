@@ -1,9 +1,8 @@
 package cdsapi
 
 import (
-	"net/url"
+	"context"
 
-	"gitlink.org.cn/cloudream/common/consts/errorcode"
 	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
 	"gitlink.org.cn/cloudream/common/utils/http2"
 )
@@ -27,28 +26,13 @@ type BucketGetByNameResp struct {
 }
 
 func (c *BucketService) GetByName(req BucketGetByName) (*BucketGetByNameResp, error) {
-	url, err := url.JoinPath(c.baseURL, BucketGetByNamePath)
-	if err != nil {
-		return nil, err
-	}
+	return c.GetByNameContext(context.Background(), req)
+}
 
-	resp, err := http2.GetForm(url, http2.RequestParam{
+func (c *BucketService) GetByNameContext(ctx context.Context, req BucketGetByName) (*BucketGetByNameResp, error) {
+	return requestJSON[BucketGetByNameResp](ctx, c.Client, true, BucketGetByNamePath, http2.GetForm, http2.RequestParam{
 		Query: req,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	codeResp, err := ParseJSONResponse[response[BucketGetByNameResp]](resp)
-	if err != nil {
-		return nil, err
-	}
-
-	if codeResp.Code == errorcode.OK {
-		return &codeResp.Data, nil
-	}
-
-	return nil, codeResp.ToError()
 }
 
 const BucketCreatePath = "/bucket/create"
@@ -63,28 +47,13 @@ type BucketCreateResp struct {
 }
 
 func (c *BucketService) Create(req BucketCreate) (*BucketCreateResp, error) {
-	url, err := url.JoinPath(c.baseURL, BucketCreatePath)
-	if err != nil {
-		return nil, err
-	}
+	return c.CreateContext(context.Background(), req)
+}
 
-	resp, err := http2.PostJSON(url, http2.RequestParam{
+func (c *BucketService) CreateContext(ctx context.Context, req BucketCreate) (*BucketCreateResp, error) {
+	return requestJSON[BucketCreateResp](ctx, c.Client, false, BucketCreatePath, http2.PostJSON, http2.RequestParam{
 		Body: req,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	codeResp, err := ParseJSONResponse[response[BucketCreateResp]](resp)
-	if err != nil {
-		return nil, err
-	}
-
-	if codeResp.Code == errorcode.OK {
-		return &codeResp.Data, nil
-	}
-
-	return nil, codeResp.ToError()
 }
 
 const BucketDeletePath = "/bucket/delete"
@@ -97,28 +66,14 @@ type BucketDelete struct {
 type BucketDeleteResp struct{}
 
 func (c *BucketService) Delete(req BucketDelete) error {
-	url, err := url.JoinPath(c.baseURL, BucketDeletePath)
-	if err != nil {
-		return err
-	}
+	return c.DeleteContext(context.Background(), req)
+}
 
-	resp, err := http2.PostJSON(url, http2.RequestParam{
+func (c *BucketService) DeleteContext(ctx context.Context, req BucketDelete) error {
+	_, err := requestJSON[BucketDeleteResp](ctx, c.Client, false, BucketDeletePath, http2.PostJSON, http2.RequestParam{
 		Body: req,
 	})
-	if err != nil {
-		return err
-	}
-
-	codeResp, err := ParseJSONResponse[response[BucketDeleteResp]](resp)
-	if err != nil {
-		return err
-	}
-
-	if codeResp.Code == errorcode.OK {
-		return nil
-	}
-
-	return codeResp.ToError()
+	return err
 }
 
 const BucketListUserBucketsPath = "/bucket/listUserBuckets"
@@ -132,26 +87,11 @@ type BucketListUserBucketsResp struct {
 }
 
 func (c *BucketService) ListUserBuckets(req BucketListUserBucketsReq) (*BucketListUserBucketsResp, error) {
-	url, err := url.JoinPath(c.baseURL, BucketListUserBucketsPath)
-	if err != nil {
-		return nil, err
-	}
+	return c.ListUserBucketsContext(context.Background(), req)
+}
 
-	resp, err := http2.GetForm(url, http2.RequestParam{
+func (c *BucketService) ListUserBucketsContext(ctx context.Context, req BucketListUserBucketsReq) (*BucketListUserBucketsResp, error) {
+	return requestJSON[BucketListUserBucketsResp](ctx, c.Client, true, BucketListUserBucketsPath, http2.GetForm, http2.RequestParam{
 		Query: req,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	codeResp, err := ParseJSONResponse[response[BucketListUserBucketsResp]](resp)
-	if err != nil {
-		return nil, err
-	}
-
-	if codeResp.Code == errorcode.OK {
-		return &codeResp.Data, nil
-	}
-
-	return nil, codeResp.ToError()
 }
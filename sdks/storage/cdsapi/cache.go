@@ -1,9 +1,8 @@
 package cdsapi
 
 import (
-	"net/url"
+	"context"
 
-	"gitlink.org.cn/cloudream/common/consts/errorcode"
 	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
 	"gitlink.org.cn/cloudream/common/utils/http2"
 )
@@ -18,26 +17,11 @@ type CacheMovePackageReq struct {
 type CacheMovePackageResp struct{}
 
 func (c *Client) CacheMovePackage(req CacheMovePackageReq) (*CacheMovePackageResp, error) {
-	url, err := url.JoinPath(c.baseURL, CacheMovePackagePath)
-	if err != nil {
-		return nil, err
-	}
+	return c.CacheMovePackageContext(context.Background(), req)
+}
 
-	resp, err := http2.PostJSON(url, http2.RequestParam{
+func (c *Client) CacheMovePackageContext(ctx context.Context, req CacheMovePackageReq) (*CacheMovePackageResp, error) {
+	return requestJSON[CacheMovePackageResp](ctx, c, false, CacheMovePackagePath, http2.PostJSON, http2.RequestParam{
 		Body: req,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	jsonResp, err := ParseJSONResponse[response[CacheMovePackageResp]](resp)
-	if err != nil {
-		return nil, err
-	}
-
-	if jsonResp.Code == errorcode.OK {
-		return &jsonResp.Data, nil
-	}
-
-	return nil, jsonResp.ToError()
 }
@@ -1,6 +1,9 @@
 package cdsapi
 
 import (
+	"net/http"
+
+	"gitlink.org.cn/cloudream/common/consts/errorcode"
 	"gitlink.org.cn/cloudream/common/sdks"
 )
 
@@ -10,20 +13,35 @@ type response[T any] struct {
 	Data    T      `json:"data"`
 }
 
-func (r *response[T]) ToError() *sdks.CodeMessageError {
-	return &sdks.CodeMessageError{
+// 将响应转换为错误。前提条件不满足时返回*PreconditionFailedError，其他情况返回*sdks.CodeMessageError
+func (r *response[T]) ToError() error {
+	err := &sdks.CodeMessageError{
 		Code:    r.Code,
 		Message: r.Message,
 	}
+
+	if r.Code == errorcode.PreconditionFailed {
+		return &PreconditionFailedError{CodeMessageError: err}
+	}
+	return err
 }
 
 type Client struct {
 	baseURL string
+	cfg     Config
+	httpCli *http.Client
 }
 
 func NewClient(cfg *Config) *Client {
+	httpCli := http.DefaultClient
+	if cfg.Transport != nil {
+		httpCli = &http.Client{Transport: cfg.Transport}
+	}
+
 	return &Client{
 		baseURL: cfg.URL,
+		cfg:     *cfg,
+		httpCli: httpCli,
 	}
 }
 
@@ -1,5 +1,22 @@
 package cdsapi
 
+import (
+	"net/http"
+	"time"
+)
+
 type Config struct {
 	URL string `json:"url"`
+	// 每次请求的超时时间，为0则不限制。
+	// 对于下载等返回数据流的接口，只限制收到响应头之前的时间；对于上传等发送数据流的接口，
+	// 以及ExecuteIOPlan、GetVar等需要等待计划执行的接口不生效，需要通过ctx控制
+	Timeout time.Duration `json:"timeout"`
+	// 幂等的接口（查询、下载等）请求失败后的最大重试次数，为0则不重试。服务端返回的业务错误不会重试
+	MaxRetries int `json:"maxRetries"`
+	// 第一次重试前的等待时间，之后每次翻倍。为0则使用默认值
+	RetryInterval time.Duration `json:"retryInterval"`
+	// 重试等待时间的上限，为0则使用默认值
+	MaxRetryInterval time.Duration `json:"maxRetryInterval"`
+	// 发送请求使用的RoundTripper，为nil则使用http.DefaultTransport
+	Transport http.RoundTripper `json:"-"`
 }
@@ -0,0 +1,357 @@
+package cdsapi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+	"gitlink.org.cn/cloudream/common/utils/math2"
+)
+
+const (
+	defaultMaxReconnects     = 5
+	defaultReconnectInterval = time.Second
+	defaultDownloadParallel  = 4
+	defaultDownloadPartSize  = 8 * 1024 * 1024
+)
+
+type DownloadOption struct {
+	// 连接中断后重新连接的最大次数，每次收到新的数据后重新计数。为0则使用默认值，小于0则不重连
+	MaxReconnects int
+	// 重新连接前的等待时间，为0则使用默认值
+	ReconnectInterval time.Duration
+	// 对象的FileHash是Composite哈希时，需要提供计算哈希时使用的分段大小才能校验，为0则不校验Composite哈希
+	CompositeSegmentSize int64
+}
+
+func (o *DownloadOption) normalize() {
+	if o.MaxReconnects == 0 {
+		o.MaxReconnects = defaultMaxReconnects
+	}
+	if o.MaxReconnects < 0 {
+		o.MaxReconnects = 0
+	}
+	if o.ReconnectInterval <= 0 {
+		o.ReconnectInterval = defaultReconnectInterval
+	}
+}
+
+// 下载对象，连接中断时会从已经收到的最后一个字节处重新连接，对调用者透明。
+// 下载整个对象时，读取到末尾后会校验FileHash，不一致则返回*cdssdk.HashMismatchError。
+func (c *ObjectService) DownloadResumable(ctx context.Context, req ObjectDownload, opt DownloadOption) (*DownloadingObject, error) {
+	opt.normalize()
+
+	obj, err := c.getObject(ctx, req.UserID, req.ObjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	rng := math2.Range{Offset: req.Offset, Length: req.Length}
+	end := obj.Size
+	if rng.Length != nil {
+		end = math2.Min(end, rng.Offset+*rng.Length)
+	}
+
+	rd := &resumableReader{
+		ctx: ctx,
+		svc: c,
+		req: req,
+		pos: math2.Min(rng.Offset, end),
+		end: end,
+		opt: opt,
+	}
+	// 先建立一次连接，以便尽早返回错误
+	if rd.pos < rd.end {
+		if err := rd.connect(); err != nil {
+			return nil, err
+		}
+	}
+
+	var file io.ReadCloser = rd
+	hasher := newObjectHasher(obj, opt)
+	if hasher != nil && rng.Offset == 0 && end == obj.Size {
+		file = &verifyReadCloser{
+			Reader: cdssdk.NewVerifyReader(rd, obj.FileHash, hasher),
+			Closer: rd,
+		}
+	}
+
+	return &DownloadingObject{
+		Path: obj.Path,
+		File: file,
+	}, nil
+}
+
+type resumableReader struct {
+	ctx        context.Context
+	svc        *ObjectService
+	req        ObjectDownload
+	pos        int64 // 下一个要读取的字节的位置
+	end        int64 // 下载范围的结尾，不包含
+	opt        DownloadOption
+	body       io.ReadCloser
+	reconnects int
+	closed     bool
+}
+
+func (r *resumableReader) connect() error {
+	req := r.req
+	req.Offset = r.pos
+	length := r.end - r.pos
+	req.Length = &length
+
+	obj, err := r.svc.DownloadContext(r.ctx, req)
+	if err != nil {
+		return err
+	}
+
+	r.body = obj.File
+	return nil
+}
+
+func (r *resumableReader) Read(p []byte) (int, error) {
+	if r.closed {
+		return 0, fmt.Errorf("reader closed")
+	}
+
+	for {
+		if r.pos >= r.end {
+			return 0, io.EOF
+		}
+
+		n, err := r.read(p)
+		if err == nil {
+			return n, nil
+		}
+
+		// 服务端返回的业务错误不需要重连
+		if !isRetryable(err) || r.reconnects >= r.opt.MaxReconnects || r.ctx.Err() != nil {
+			return n, err
+		}
+		r.reconnects++
+
+		select {
+		case <-time.After(r.opt.ReconnectInterval):
+		case <-r.ctx.Done():
+			return n, err
+		}
+
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (r *resumableReader) read(p []byte) (int, error) {
+	if r.body == nil {
+		err := r.connect()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if int64(len(p)) > r.end-r.pos {
+		p = p[:r.end-r.pos]
+	}
+
+	n, err := r.body.Read(p)
+	r.pos += int64(n)
+	if n > 0 {
+		r.reconnects = 0
+	}
+	if err == nil || r.pos >= r.end {
+		return n, nil
+	}
+
+	r.body.Close()
+	r.body = nil
+
+	// 数据未读取完就结束了，也算作连接中断
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *resumableReader) Close() error {
+	r.closed = true
+	if r.body != nil {
+		err := r.body.Close()
+		r.body = nil
+		return err
+	}
+	return nil
+}
+
+type verifyReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type ParallelDownloadOption struct {
+	DownloadOption
+	// 同时下载的分段数，为0则使用默认值
+	Parallel int
+	// 每个分段的大小，为0则使用默认值
+	PartSize int64
+}
+
+// 将整个对象分成多段并行下载到w中，每一段的连接中断时会从中断的位置继续下载。
+// 下载完成后会校验FileHash，不一致则返回*cdssdk.HashMismatchError，此时w中已经写入了数据。
+//
+// 为了按顺序计算哈希值，每个协程最多缓存一个分段的数据，因此最多占用Parallel*PartSize的内存。
+func (c *ObjectService) DownloadParallel(ctx context.Context, userID cdssdk.UserID, objectID cdssdk.ObjectID, w io.WriterAt, opt ParallelDownloadOption) (*cdssdk.Object, error) {
+	opt.normalize()
+	if opt.Parallel <= 0 {
+		opt.Parallel = defaultDownloadParallel
+	}
+	if opt.PartSize <= 0 {
+		opt.PartSize = defaultDownloadPartSize
+	}
+
+	obj, err := c.getObject(ctx, userID, objectID)
+	if err != nil {
+		return nil, err
+	}
+
+	partCnt := int((obj.Size + opt.PartSize - 1) / opt.PartSize)
+	parts := make(chan int, partCnt)
+	for i := 0; i < partCnt; i++ {
+		parts <- i
+	}
+	close(parts)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	hasher := newObjectHasher(obj, opt.DownloadOption)
+
+	// 各个分段的数据需要按顺序计算哈希值
+	var lock sync.Mutex
+	cond := sync.NewCond(&lock)
+	nextHashPart := 0
+	var firstErr error
+	setErr := func(err error) {
+		lock.Lock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+		cond.Broadcast()
+		lock.Unlock()
+	}
+
+	downloadPart := func(idx int, buf []byte) error {
+		offset := int64(idx) * opt.PartSize
+		length := math2.Min(opt.PartSize, obj.Size-offset)
+
+		rd := &resumableReader{
+			ctx: ctx,
+			svc: c,
+			req: ObjectDownload{
+				UserID:   userID,
+				ObjectID: objectID,
+			},
+			pos: offset,
+			end: offset + length,
+			opt: opt.DownloadOption,
+		}
+		defer rd.Close()
+
+		buf = buf[:length]
+		_, err := io.ReadFull(rd, buf)
+		if err != nil {
+			return fmt.Errorf("download part %v: %w", idx, err)
+		}
+
+		_, err = w.WriteAt(buf, offset)
+		if err != nil {
+			return fmt.Errorf("write part %v: %w", idx, err)
+		}
+
+		if hasher == nil {
+			return nil
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+		for nextHashPart != idx && firstErr == nil {
+			cond.Wait()
+		}
+		if firstErr != nil {
+			return firstErr
+		}
+
+		hasher.Write(buf)
+		nextHashPart++
+		cond.Broadcast()
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < math2.Min(opt.Parallel, partCnt); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			buf := make([]byte, opt.PartSize)
+			for idx := range parts {
+				err := downloadPart(idx, buf)
+				if err != nil {
+					setErr(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	if hasher != nil {
+		actual := hasher.Sum()
+		if actual != obj.FileHash {
+			return nil, &cdssdk.HashMismatchError{Expected: obj.FileHash, Actual: actual}
+		}
+	}
+
+	return &obj, nil
+}
+
+func (c *ObjectService) getObject(ctx context.Context, userID cdssdk.UserID, objectID cdssdk.ObjectID) (cdssdk.Object, error) {
+	resp, err := c.ListByIDsContext(ctx, ObjectListByIDs{
+		UserID:    userID,
+		ObjectIDs: []cdssdk.ObjectID{objectID},
+	})
+	if err != nil {
+		return cdssdk.Object{}, fmt.Errorf("getting object info: %w", err)
+	}
+
+	if len(resp.Objects) == 0 || resp.Objects[0] == nil {
+		return cdssdk.Object{}, fmt.Errorf("object %v not found", objectID)
+	}
+
+	return *resp.Objects[0], nil
+}
+
+// 根据对象的FileHash类型创建计算哈希值的对象，无法校验时返回nil
+func newObjectHasher(obj cdssdk.Object, opt DownloadOption) *cdssdk.FileHasher {
+	if len(obj.FileHash) < len(cdssdk.FullHashPrefix) {
+		return nil
+	}
+
+	if obj.FileHash.IsFullHash() {
+		return cdssdk.NewFullHasher()
+	}
+
+	if obj.FileHash.IsCompositeHash() && opt.CompositeSegmentSize > 0 {
+		return cdssdk.NewCompositeHasher(opt.CompositeSegmentSize)
+	}
+
+	return nil
+}
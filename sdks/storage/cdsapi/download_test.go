@@ -0,0 +1,162 @@
+package cdsapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+)
+
+// 模拟一个只提供下载功能的服务，前breaks次下载请求只会返回一半的数据就断开连接
+func newDownloadServer(data []byte, fileHash cdssdk.FileHash, breaks int32) (*httptest.Server, *atomic.Int32) {
+	var downloads atomic.Int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(ObjectListByIDsPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"code":"OK","data":{"object":[{"objectID":1,"packageID":1,"path":"dir/a.bin","size":"%d","fileHash":"%s"}]}}`, len(data), fileHash)
+	})
+	mux.HandleFunc(ObjectDownloadPath, func(w http.ResponseWriter, r *http.Request) {
+		cnt := downloads.Add(1)
+
+		offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+		end := int64(len(data))
+		if l := r.URL.Query().Get("length"); l != "" {
+			length, _ := strconv.ParseInt(l, 10, 64)
+			end = offset + length
+		}
+
+		w.Header().Set("Content-Disposition", `attachment; filename="a.bin"`)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.FormatInt(end-offset, 10))
+		if cnt <= breaks {
+			w.Write(data[offset : offset+(end-offset)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		w.Write(data[offset:end])
+	})
+
+	return httptest.NewServer(mux), &downloads
+}
+
+func Test_Download(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	sum := sha256.Sum256(data)
+	fileHash := cdssdk.NewFullHash(sum[:])
+
+	opt := DownloadOption{ReconnectInterval: time.Millisecond}
+
+	Convey("连接中断后继续下载", t, func() {
+		svr, downloads := newDownloadServer(data, fileHash, 3)
+		defer svr.Close()
+
+		cli := NewClient(&Config{URL: svr.URL})
+		obj, err := cli.Object().DownloadResumable(context.Background(), ObjectDownload{UserID: 1, ObjectID: 1}, opt)
+		So(err, ShouldBeNil)
+		defer obj.File.Close()
+
+		So(obj.Path, ShouldEqual, "dir/a.bin")
+		got, err := io.ReadAll(obj.File)
+		So(err, ShouldBeNil)
+		So(got, ShouldResemble, data)
+		So(downloads.Load(), ShouldEqual, 4)
+	})
+
+	Convey("下载部分数据", t, func() {
+		svr, _ := newDownloadServer(data, fileHash, 1)
+		defer svr.Close()
+
+		length := int64(300)
+		cli := NewClient(&Config{URL: svr.URL})
+		obj, err := cli.Object().DownloadResumable(context.Background(), ObjectDownload{UserID: 1, ObjectID: 1, Offset: 100, Length: &length}, opt)
+		So(err, ShouldBeNil)
+		defer obj.File.Close()
+
+		got, err := io.ReadAll(obj.File)
+		So(err, ShouldBeNil)
+		So(got, ShouldResemble, data[100:400])
+	})
+
+	Convey("超过重连次数", t, func() {
+		svr, _ := newDownloadServer(data, fileHash, 100)
+		defer svr.Close()
+
+		cli := NewClient(&Config{URL: svr.URL})
+		obj, err := cli.Object().DownloadResumable(context.Background(), ObjectDownload{UserID: 1, ObjectID: 1}, DownloadOption{MaxReconnects: -1})
+		So(err, ShouldBeNil)
+		defer obj.File.Close()
+
+		_, err = io.ReadAll(obj.File)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("哈希值不一致", t, func() {
+		svr, _ := newDownloadServer(data, cdssdk.NewFullHash(make([]byte, 32)), 0)
+		defer svr.Close()
+
+		cli := NewClient(&Config{URL: svr.URL})
+		obj, err := cli.Object().DownloadResumable(context.Background(), ObjectDownload{UserID: 1, ObjectID: 1}, opt)
+		So(err, ShouldBeNil)
+		defer obj.File.Close()
+
+		_, err = io.ReadAll(obj.File)
+		var mismatch *cdssdk.HashMismatchError
+		So(errors.As(err, &mismatch), ShouldBeTrue)
+	})
+
+	Convey("并行下载", t, func() {
+		svr, downloads := newDownloadServer(data, fileHash, 2)
+		defer svr.Close()
+
+		file, err := os.Create(filepath.Join(t.TempDir(), "a.bin"))
+		So(err, ShouldBeNil)
+		defer file.Close()
+
+		cli := NewClient(&Config{URL: svr.URL})
+		obj, err := cli.Object().DownloadParallel(context.Background(), 1, 1, file, ParallelDownloadOption{
+			DownloadOption: opt,
+			Parallel:       3,
+			PartSize:       128,
+		})
+		So(err, ShouldBeNil)
+		So(obj.Size, ShouldEqual, len(data))
+		So(downloads.Load(), ShouldEqual, 8+2)
+
+		got, err := os.ReadFile(file.Name())
+		So(err, ShouldBeNil)
+		So(got, ShouldResemble, data)
+	})
+
+	Convey("并行下载时哈希值不一致", t, func() {
+		svr, _ := newDownloadServer(data, cdssdk.NewFullHash(make([]byte, 32)), 0)
+		defer svr.Close()
+
+		file, err := os.Create(filepath.Join(t.TempDir(), "a.bin"))
+		So(err, ShouldBeNil)
+		defer file.Close()
+
+		cli := NewClient(&Config{URL: svr.URL})
+		_, err = cli.Object().DownloadParallel(context.Background(), 1, 1, file, ParallelDownloadOption{
+			DownloadOption: opt,
+			PartSize:       100,
+		})
+		var mismatch *cdssdk.HashMismatchError
+		So(errors.As(err, &mismatch), ShouldBeTrue)
+	})
+}
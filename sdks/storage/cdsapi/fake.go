@@ -0,0 +1,1134 @@
+package cdsapi
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlink.org.cn/cloudream/common/consts/errorcode"
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+	"gitlink.org.cn/cloudream/common/utils/http2"
+	"gitlink.org.cn/cloudream/common/utils/serder"
+)
+
+// 在内存中模拟的存储服务，实现了bucket、package、object、storage、cache、hub相关的接口，用于测试。
+//
+// 对象的FileHash为Full哈希。Storage和Hub只能通过AddStorage和AddHub添加，
+// 从存储服务上创建Package时只会创建一个空的Package。
+type FakeServer struct {
+	*httptest.Server
+	lock     sync.Mutex
+	nextID   int64
+	buckets  map[cdssdk.BucketID]*cdssdk.Bucket
+	packages map[cdssdk.PackageID]*cdssdk.Package
+	objects  map[cdssdk.ObjectID]*fakeObject
+	storages map[cdssdk.StorageID]*cdssdk.Storage
+	hubs     map[cdssdk.HubID]*cdssdk.Hub
+	// 通过cache/movePackage缓存过Package的存储
+	caches map[cdssdk.PackageID]map[cdssdk.StorageID]bool
+	// 通过storage/loadPackage加载过Package的存储，以及加载的路径
+	loads map[cdssdk.PackageID]map[cdssdk.StorageID]string
+}
+
+type fakeObject struct {
+	cdssdk.Object
+	data []byte
+}
+
+// 返回错误信息的响应
+type fakeError struct {
+	code    string
+	message string
+}
+
+func (e *fakeError) Error() string {
+	return e.message
+}
+
+func fakeErrorf(code string, format string, args ...any) error {
+	return &fakeError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+func NewFakeServer() *FakeServer {
+	s := &FakeServer{
+		buckets:  make(map[cdssdk.BucketID]*cdssdk.Bucket),
+		packages: make(map[cdssdk.PackageID]*cdssdk.Package),
+		objects:  make(map[cdssdk.ObjectID]*fakeObject),
+		storages: make(map[cdssdk.StorageID]*cdssdk.Storage),
+		hubs:     make(map[cdssdk.HubID]*cdssdk.Hub),
+		caches:   make(map[cdssdk.PackageID]map[cdssdk.StorageID]bool),
+		loads:    make(map[cdssdk.PackageID]map[cdssdk.StorageID]string),
+	}
+
+	mux := http.NewServeMux()
+	handlers := map[string]func(r *http.Request) (any, error){
+		BucketGetByNamePath:           s.bucketGetByName,
+		BucketCreatePath:              s.bucketCreate,
+		BucketDeletePath:              s.bucketDelete,
+		BucketListUserBucketsPath:     s.bucketListUserBuckets,
+		PackageGetPath:                s.packageGet,
+		PackageGetByNamePath:          s.packageGetByName,
+		PackageCreatePath:             s.packageCreate,
+		PackageCreateLoadPath:         s.packageCreateLoad,
+		PackageDeletePath:             s.packageDelete,
+		PackageClonePath:              s.packageClone,
+		PackageListBucketPackagesPath: s.packageListBucketPackages,
+		PackageGetCachedStoragesPath:  s.packageGetCachedStorages,
+		ObjectListPath:                s.objectList,
+		ObjectListByIDsPath:           s.objectListByIDs,
+		ObjectUploadPath:              s.objectUpload,
+		ObjectUpdateInfoPath:          s.objectUpdateInfo,
+		ObjectUpdateInfoByPathPath:    s.objectUpdateInfoByPath,
+		ObjectMovePath:                s.objectMove,
+		ObjectDeletePath:              s.objectDelete,
+		ObjectDeleteByPathPath:        s.objectDeleteByPath,
+		ObjectGetPackageObjectsPath:   s.objectGetPackageObjects,
+		StorageLoadPackagePath:        s.storageLoadPackage,
+		StorageCreatePackagePath:      s.storageCreatePackage,
+		StorageGetPath:                s.storageGet,
+		CacheMovePackagePath:          s.cacheMovePackage,
+		HubGetHubsPath:                s.hubGetHubs,
+	}
+	for path, h := range handlers {
+		mux.HandleFunc(path, serveFakeJSON(h))
+	}
+	mux.HandleFunc(ObjectDownloadPath, s.objectDownload)
+	mux.HandleFunc(ObjectDownloadByPathPath, s.objectDownloadByPath)
+
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// 访问这个服务的客户端配置
+func (s *FakeServer) Config() *Config {
+	return &Config{
+		URL: s.URL,
+	}
+}
+
+// 添加一个Bucket，BucketID为0时会自动分配
+func (s *FakeServer) AddBucket(bkt cdssdk.Bucket) cdssdk.Bucket {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	bkt.BucketID = cdssdk.BucketID(s.allocID(int64(bkt.BucketID)))
+	s.buckets[bkt.BucketID] = &bkt
+	return bkt
+}
+
+// 添加一个Storage，StorageID为0时会自动分配
+func (s *FakeServer) AddStorage(stg cdssdk.Storage) cdssdk.Storage {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stg.StorageID = cdssdk.StorageID(s.allocID(int64(stg.StorageID)))
+	s.storages[stg.StorageID] = &stg
+	return stg
+}
+
+// 添加一个Hub，HubID为0时会自动分配
+func (s *FakeServer) AddHub(hub cdssdk.Hub) cdssdk.Hub {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	hub.HubID = cdssdk.HubID(s.allocID(int64(hub.HubID)))
+	s.hubs[hub.HubID] = &hub
+	return hub
+}
+
+// 直接获取对象的数据，不存在时返回false
+func (s *FakeServer) ObjectData(objectID cdssdk.ObjectID) ([]byte, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	obj, ok := s.objects[objectID]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte{}, obj.data...), true
+}
+
+// 返回Package被加载到的存储以及加载的路径
+func (s *FakeServer) LoadedStorages(packageID cdssdk.PackageID) map[cdssdk.StorageID]string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ret := make(map[cdssdk.StorageID]string)
+	for stgID, path := range s.loads[packageID] {
+		ret[stgID] = path
+	}
+	return ret
+}
+
+// 分配一个ID。id不为0时直接使用，同时保证之后分配的ID不会与它重复
+func (s *FakeServer) allocID(id int64) int64 {
+	if id == 0 {
+		s.nextID++
+		return s.nextID
+	}
+
+	if id > s.nextID {
+		s.nextID = id
+	}
+	return id
+}
+
+func serveFakeJSON(h func(r *http.Request) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := h(r)
+		if err != nil {
+			writeFakeError(w, err)
+			return
+		}
+
+		writeFakeResponse(w, response[any]{Code: errorcode.OK, Data: data})
+	}
+}
+
+func writeFakeResponse(w http.ResponseWriter, resp response[any]) {
+	data, err := serder.ObjectToJSONEx(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", http2.ContentTypeJSON)
+	w.Write(data)
+}
+
+func writeFakeError(w http.ResponseWriter, err error) {
+	resp := response[any]{Code: errorcode.OperationFailed, Message: err.Error()}
+	if fe, ok := err.(*fakeError); ok {
+		resp.Code = fe.code
+	}
+	writeFakeResponse(w, resp)
+}
+
+func decodeFakeJSON[T any](r *http.Request) (T, error) {
+	ret, err := serder.JSONToObjectStreamEx[T](r.Body)
+	if err != nil {
+		return ret, fakeErrorf(errorcode.BadArgument, "parsing request: %v", err)
+	}
+	return ret, nil
+}
+
+func fakeQueryInt(r *http.Request, key string) (int64, error) {
+	str := r.URL.Query().Get(key)
+	if str == "" {
+		return 0, nil
+	}
+
+	val, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return 0, fakeErrorf(errorcode.BadArgument, "invalid %v: %v", key, str)
+	}
+	return val, nil
+}
+
+func (s *FakeServer) bucketGetByName(r *http.Request) (any, error) {
+	userID, err := fakeQueryInt(r, "userID")
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	bkt := s.findBucket(cdssdk.UserID(userID), r.URL.Query().Get("name"))
+	if bkt == nil {
+		return nil, fakeErrorf(errorcode.DataNotFound, "bucket not found")
+	}
+	return BucketGetByNameResp{Bucket: *bkt}, nil
+}
+
+func (s *FakeServer) bucketCreate(r *http.Request) (any, error) {
+	req, err := decodeFakeJSON[BucketCreate](r)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.findBucket(req.UserID, req.Name) != nil {
+		return nil, fakeErrorf(errorcode.DataExists, "bucket %v already exists", req.Name)
+	}
+
+	bkt := &cdssdk.Bucket{
+		BucketID:  cdssdk.BucketID(s.allocID(0)),
+		Name:      req.Name,
+		CreatorID: req.UserID,
+	}
+	s.buckets[bkt.BucketID] = bkt
+	return BucketCreateResp{Bucket: *bkt}, nil
+}
+
+func (s *FakeServer) bucketDelete(r *http.Request) (any, error) {
+	req, err := decodeFakeJSON[BucketDelete](r)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.buckets[req.BucketID]; !ok {
+		return nil, fakeErrorf(errorcode.DataNotFound, "bucket %v not found", req.BucketID)
+	}
+
+	for _, pkg := range s.packages {
+		if pkg.BucketID == req.BucketID {
+			s.removePackage(pkg.PackageID)
+		}
+	}
+	delete(s.buckets, req.BucketID)
+	return BucketDeleteResp{}, nil
+}
+
+func (s *FakeServer) bucketListUserBuckets(r *http.Request) (any, error) {
+	userID, err := fakeQueryInt(r, "userID")
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	bkts := []cdssdk.Bucket{}
+	for _, bkt := range s.buckets {
+		if bkt.CreatorID == cdssdk.UserID(userID) {
+			bkts = append(bkts, *bkt)
+		}
+	}
+	sort.Slice(bkts, func(i, j int) bool { return bkts[i].BucketID < bkts[j].BucketID })
+	return BucketListUserBucketsResp{Buckets: bkts}, nil
+}
+
+func (s *FakeServer) findBucket(userID cdssdk.UserID, name string) *cdssdk.Bucket {
+	for _, bkt := range s.buckets {
+		if bkt.CreatorID == userID && bkt.Name == name {
+			return bkt
+		}
+	}
+	return nil
+}
+
+func (s *FakeServer) packageGet(r *http.Request) (any, error) {
+	pkgID, err := fakeQueryInt(r, "packageID")
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	pkg, err := s.getPackage(cdssdk.PackageID(pkgID))
+	if err != nil {
+		return nil, err
+	}
+	return PackageGetResp{Package: *pkg}, nil
+}
+
+func (s *FakeServer) packageGetByName(r *http.Request) (any, error) {
+	userID, err := fakeQueryInt(r, "userID")
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	bkt := s.findBucket(cdssdk.UserID(userID), r.URL.Query().Get("bucketName"))
+	if bkt == nil {
+		return nil, fakeErrorf(errorcode.DataNotFound, "bucket not found")
+	}
+
+	pkg := s.findPackage(bkt.BucketID, r.URL.Query().Get("packageName"))
+	if pkg == nil {
+		return nil, fakeErrorf(errorcode.DataNotFound, "package not found")
+	}
+	return PackageGetByNameResp{Package: *pkg}, nil
+}
+
+func (s *FakeServer) packageCreate(r *http.Request) (any, error) {
+	req, err := decodeFakeJSON[PackageCreate](r)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	pkg, err := s.createPackage(req.BucketID, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return PackageCreateResp{Package: *pkg}, nil
+}
+
+func (s *FakeServer) packageCreateLoad(r *http.Request) (any, error) {
+	var info PackageCreateLoadInfo
+	files, err := readFakeUpload(r, &info)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	pkg, err := s.createPackage(info.BucketID, info.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	objs := s.putObjects(pkg.PackageID, files)
+
+	for i, stgID := range info.LoadTo {
+		if _, ok := s.storages[stgID]; !ok {
+			return nil, fakeErrorf(errorcode.DataNotFound, "storage %v not found", stgID)
+		}
+
+		path := ""
+		if i < len(info.LoadToPath) {
+			path = info.LoadToPath[i]
+		}
+		s.addLoad(pkg.PackageID, stgID, path)
+	}
+
+	return PackageCreateLoadResp{Package: *pkg, Objects: objs}, nil
+}
+
+func (s *FakeServer) packageDelete(r *http.Request) (any, error) {
+	req, err := decodeFakeJSON[PackageDelete](r)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, err := s.getPackage(req.PackageID); err != nil {
+		return nil, err
+	}
+
+	s.removePackage(req.PackageID)
+	return nil, nil
+}
+
+func (s *FakeServer) packageClone(r *http.Request) (any, error) {
+	req, err := decodeFakeJSON[PackageClone](r)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, err := s.getPackage(req.PackageID); err != nil {
+		return nil, err
+	}
+
+	pkg, err := s.createPackage(req.BucketID, req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, obj := range s.packageObjects(req.PackageID) {
+		newObj := *obj
+		newObj.ObjectID = cdssdk.ObjectID(s.allocID(0))
+		newObj.PackageID = pkg.PackageID
+		s.objects[newObj.ObjectID] = &newObj
+	}
+
+	return PackageCloneResp{Package: *pkg}, nil
+}
+
+func (s *FakeServer) packageListBucketPackages(r *http.Request) (any, error) {
+	bktID, err := fakeQueryInt(r, "bucketID")
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.buckets[cdssdk.BucketID(bktID)]; !ok {
+		return nil, fakeErrorf(errorcode.DataNotFound, "bucket %v not found", bktID)
+	}
+
+	pkgs := []cdssdk.Package{}
+	for _, pkg := range s.packages {
+		if pkg.BucketID == cdssdk.BucketID(bktID) {
+			pkgs = append(pkgs, *pkg)
+		}
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].PackageID < pkgs[j].PackageID })
+	return PackageListBucketPackagesResp{Packages: pkgs}, nil
+}
+
+func (s *FakeServer) packageGetCachedStorages(r *http.Request) (any, error) {
+	pkgID, err := fakeQueryInt(r, "packageID")
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, err := s.getPackage(cdssdk.PackageID(pkgID)); err != nil {
+		return nil, err
+	}
+
+	var pkgSize int64
+	objs := s.packageObjects(cdssdk.PackageID(pkgID))
+	for _, obj := range objs {
+		pkgSize += obj.Size
+	}
+
+	stgInfos := []cdssdk.StoragePackageCachingInfo{}
+	for stgID := range s.caches[cdssdk.PackageID(pkgID)] {
+		stgInfos = append(stgInfos, cdssdk.StoragePackageCachingInfo{
+			StorageID:   stgID,
+			FileSize:    pkgSize,
+			ObjectCount: int64(len(objs)),
+		})
+	}
+	sort.Slice(stgInfos, func(i, j int) bool { return stgInfos[i].StorageID < stgInfos[j].StorageID })
+
+	return PackageGetCachedStoragesResp{
+		PackageCachingInfo: cdssdk.NewPackageCachingInfo(stgInfos, pkgSize),
+	}, nil
+}
+
+func (s *FakeServer) getPackage(pkgID cdssdk.PackageID) (*cdssdk.Package, error) {
+	pkg, ok := s.packages[pkgID]
+	if !ok {
+		return nil, fakeErrorf(errorcode.DataNotFound, "package %v not found", pkgID)
+	}
+	return pkg, nil
+}
+
+func (s *FakeServer) findPackage(bktID cdssdk.BucketID, name string) *cdssdk.Package {
+	for _, pkg := range s.packages {
+		if pkg.BucketID == bktID && pkg.Name == name {
+			return pkg
+		}
+	}
+	return nil
+}
+
+func (s *FakeServer) createPackage(bktID cdssdk.BucketID, name string) (*cdssdk.Package, error) {
+	if _, ok := s.buckets[bktID]; !ok {
+		return nil, fakeErrorf(errorcode.DataNotFound, "bucket %v not found", bktID)
+	}
+
+	if s.findPackage(bktID, name) != nil {
+		return nil, fakeErrorf(errorcode.DataExists, "package %v already exists", name)
+	}
+
+	pkg := &cdssdk.Package{
+		PackageID: cdssdk.PackageID(s.allocID(0)),
+		Name:      name,
+		BucketID:  bktID,
+		State:     "Normal",
+	}
+	s.packages[pkg.PackageID] = pkg
+	return pkg, nil
+}
+
+func (s *FakeServer) removePackage(pkgID cdssdk.PackageID) {
+	for _, obj := range s.packageObjects(pkgID) {
+		delete(s.objects, obj.ObjectID)
+	}
+	delete(s.packages, pkgID)
+	delete(s.caches, pkgID)
+	delete(s.loads, pkgID)
+}
+
+// 按路径排序的Package中的所有对象
+func (s *FakeServer) packageObjects(pkgID cdssdk.PackageID) []*fakeObject {
+	var objs []*fakeObject
+	for _, obj := range s.objects {
+		if obj.PackageID == pkgID {
+			objs = append(objs, obj)
+		}
+	}
+	sort.Slice(objs, func(i, j int) bool { return objs[i].Path < objs[j].Path })
+	return objs
+}
+
+func (s *FakeServer) findObject(pkgID cdssdk.PackageID, path string) *fakeObject {
+	for _, obj := range s.objects {
+		if obj.PackageID == pkgID && obj.Path == path {
+			return obj
+		}
+	}
+	return nil
+}
+
+func (s *FakeServer) objectList(r *http.Request) (any, error) {
+	pkgID, err := fakeQueryInt(r, "packageID")
+	if err != nil {
+		return nil, err
+	}
+	path := r.URL.Query().Get("path")
+	isPrefix, _ := strconv.ParseBool(r.URL.Query().Get("isPrefix"))
+	startAfter := r.URL.Query().Get("startAfter")
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, err := s.getPackage(cdssdk.PackageID(pkgID)); err != nil {
+		return nil, err
+	}
+
+	var matched []*fakeObject
+	for _, obj := range s.packageObjects(cdssdk.PackageID(pkgID)) {
+		if startAfter != "" && obj.Path <= startAfter {
+			continue
+		}
+		if obj.Path == path || (isPrefix && strings.HasPrefix(obj.Path, path)) {
+			matched = append(matched, obj)
+		}
+	}
+
+	objs, next, err := pageFakeObjects(r, matched)
+	if err != nil {
+		return nil, err
+	}
+	return ObjectListResp{Objects: objs, NextCursor: next}, nil
+}
+
+// 按请求中的cursor和limit对已按路径排序的对象分页。游标是上一页最后一个对象的路径
+func pageFakeObjects(r *http.Request, objs []*fakeObject) ([]cdssdk.Object, string, error) {
+	limit, err := fakeQueryInt(r, "limit")
+	if err != nil {
+		return nil, "", err
+	}
+	cursor := r.URL.Query().Get("cursor")
+
+	start := 0
+	if cursor != "" {
+		start = sort.Search(len(objs), func(i int) bool { return objs[i].Path > cursor })
+	}
+
+	end := len(objs)
+	if limit > 0 && start+int(limit) < end {
+		end = start + int(limit)
+	}
+
+	page := []cdssdk.Object{}
+	for _, obj := range objs[start:end] {
+		page = append(page, obj.Object)
+	}
+
+	next := ""
+	if end < len(objs) {
+		next = objs[end-1].Path
+	}
+	return page, next, nil
+}
+
+func (s *FakeServer) objectListByIDs(r *http.Request) (any, error) {
+	req, err := decodeFakeJSON[ObjectListByIDs](r)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	objs := make([]*cdssdk.Object, len(req.ObjectIDs))
+	for i, id := range req.ObjectIDs {
+		if obj, ok := s.objects[id]; ok {
+			o := obj.Object
+			objs[i] = &o
+		}
+	}
+	return ObjectListByIDsResp{Objects: objs}, nil
+}
+
+func (s *FakeServer) objectUpload(r *http.Request) (any, error) {
+	var info ObjectUploadInfo
+	files, err := readFakeUpload(r, &info)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, err := s.getPackage(info.PackageID); err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		pre := info.Precondition
+		if p, ok := info.PathPreconditions[f.path]; ok {
+			pre = &p
+		}
+
+		if err := checkFakePrecondition(pre, s.findObject(info.PackageID, f.path), f.path); err != nil {
+			return nil, err
+		}
+	}
+
+	return ObjectUploadResp{Uploadeds: s.putObjects(info.PackageID, files)}, nil
+}
+
+func checkFakePrecondition(pre *Precondition, obj *fakeObject, name any) error {
+	var o *cdssdk.Object
+	if obj != nil {
+		o = &obj.Object
+	}
+
+	if !pre.Check(o) {
+		return fakeErrorf(errorcode.PreconditionFailed, "precondition failed for object %v", name)
+	}
+	return nil
+}
+
+type fakeUploadFile struct {
+	path string
+	data []byte
+}
+
+// 解析上传文件的请求，info字段会被解析到info中。同一个文件可能被拆分成多个连续的同名part
+func readFakeUpload(r *http.Request, info any) ([]fakeUploadFile, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, fakeErrorf(errorcode.BadArgument, "parsing multipart: %v", err)
+	}
+
+	var files []fakeUploadFile
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, fakeErrorf(errorcode.BadArgument, "reading multipart: %v", err)
+		}
+
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, fakeErrorf(errorcode.BadArgument, "reading multipart: %v", err)
+		}
+
+		switch part.FormName() {
+		case "info":
+			err := serder.JSONToObjectExRaw(data, info)
+			if err != nil {
+				return nil, fakeErrorf(errorcode.BadArgument, "parsing info: %v", err)
+			}
+
+		case "files":
+			path, err := url.PathUnescape(part.FileName())
+			if err != nil {
+				return nil, fakeErrorf(errorcode.BadArgument, "invalid file name: %v", part.FileName())
+			}
+
+			if len(files) > 0 && files[len(files)-1].path == path {
+				files[len(files)-1].data = append(files[len(files)-1].data, data...)
+			} else {
+				files = append(files, fakeUploadFile{path: path, data: data})
+			}
+		}
+	}
+}
+
+// 将文件保存为对象，路径相同的对象会被覆盖
+func (s *FakeServer) putObjects(pkgID cdssdk.PackageID, files []fakeUploadFile) []cdssdk.Object {
+	now := time.Now()
+
+	objs := []cdssdk.Object{}
+	for _, f := range files {
+		sum := sha256.Sum256(f.data)
+
+		obj := s.findObject(pkgID, f.path)
+		if obj == nil {
+			obj = &fakeObject{
+				Object: cdssdk.Object{
+					ObjectID:   cdssdk.ObjectID(s.allocID(0)),
+					PackageID:  pkgID,
+					Path:       f.path,
+					Redundancy: cdssdk.NewNoneRedundancy(),
+					CreateTime: now,
+				},
+			}
+			s.objects[obj.ObjectID] = obj
+		}
+
+		obj.Size = int64(len(f.data))
+		obj.FileHash = cdssdk.NewFullHash(sum[:])
+		obj.UpdateTime = now
+		obj.data = f.data
+		objs = append(objs, obj.Object)
+	}
+	return objs
+}
+
+func (s *FakeServer) objectDownload(w http.ResponseWriter, r *http.Request) {
+	objID, err := fakeQueryInt(r, "objectID")
+	if err != nil {
+		writeFakeError(w, err)
+		return
+	}
+
+	s.lock.Lock()
+	obj, ok := s.objects[cdssdk.ObjectID(objID)]
+	var objCopy fakeObject
+	if ok {
+		objCopy = *obj
+	}
+	s.lock.Unlock()
+
+	if !ok {
+		writeFakeError(w, fakeErrorf(errorcode.DataNotFound, "object %v not found", objID))
+		return
+	}
+
+	serveFakeObject(w, r, &objCopy)
+}
+
+func (s *FakeServer) objectDownloadByPath(w http.ResponseWriter, r *http.Request) {
+	pkgID, err := fakeQueryInt(r, "packageID")
+	if err != nil {
+		writeFakeError(w, err)
+		return
+	}
+
+	s.lock.Lock()
+	obj := s.findObject(cdssdk.PackageID(pkgID), r.URL.Query().Get("path"))
+	var objCopy fakeObject
+	if obj != nil {
+		objCopy = *obj
+	}
+	s.lock.Unlock()
+
+	if obj == nil {
+		writeFakeError(w, fakeErrorf(errorcode.DataNotFound, "object not found"))
+		return
+	}
+
+	serveFakeObject(w, r, &objCopy)
+}
+
+func serveFakeObject(w http.ResponseWriter, r *http.Request, obj *fakeObject) {
+	offset, err := fakeQueryInt(r, "offset")
+	if err != nil {
+		writeFakeError(w, err)
+		return
+	}
+	if offset < 0 || offset > obj.Size {
+		writeFakeError(w, fakeErrorf(errorcode.BadArgument, "offset %v out of range", offset))
+		return
+	}
+
+	end := obj.Size
+	if r.URL.Query().Get("length") != "" {
+		length, err := fakeQueryInt(r, "length")
+		if err != nil {
+			writeFakeError(w, err)
+			return
+		}
+		if length >= 0 && offset+length < end {
+			end = offset + length
+		}
+	}
+
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": obj.Path}))
+	w.Header().Set("Content-Type", http2.ContentTypeOctetStream)
+	w.Header().Set("Content-Length", strconv.FormatInt(end-offset, 10))
+	w.Write(obj.data[offset:end])
+}
+
+func (s *FakeServer) objectUpdateInfo(r *http.Request) (any, error) {
+	req, err := decodeFakeJSON[ObjectUpdateInfo](r)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, u := range req.Updatings {
+		if err := checkFakePrecondition(u.Precondition, s.objects[u.ObjectID], u.ObjectID); err != nil {
+			return nil, err
+		}
+	}
+
+	sucs := []cdssdk.ObjectID{}
+	for _, u := range req.Updatings {
+		obj, ok := s.objects[u.ObjectID]
+		if !ok {
+			continue
+		}
+
+		u.ApplyTo(&obj.Object)
+		sucs = append(sucs, u.ObjectID)
+	}
+	return ObjectUpdateInfoResp{Successes: sucs}, nil
+}
+
+func (s *FakeServer) objectUpdateInfoByPath(r *http.Request) (any, error) {
+	req, err := decodeFakeJSON[ObjectUpdateInfoByPath](r)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	obj := s.findObject(req.PackageID, req.Path)
+	if err := checkFakePrecondition(req.Precondition, obj, req.Path); err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return nil, fakeErrorf(errorcode.DataNotFound, "object %v not found", req.Path)
+	}
+
+	obj.UpdateTime = req.UpdateTime
+	return ObjectUpdateInfoByPathResp{}, nil
+}
+
+func (s *FakeServer) objectMove(r *http.Request) (any, error) {
+	req, err := decodeFakeJSON[ObjectMove](r)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, m := range req.Movings {
+		if err := checkFakePrecondition(m.Precondition, s.objects[m.ObjectID], m.ObjectID); err != nil {
+			return nil, err
+		}
+		if err := checkFakePrecondition(m.DestPrecondition, s.findObject(m.PackageID, m.Path), m.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	sucs := []cdssdk.ObjectID{}
+	for _, m := range req.Movings {
+		obj, ok := s.objects[m.ObjectID]
+		if !ok {
+			continue
+		}
+		if _, ok := s.packages[m.PackageID]; !ok {
+			continue
+		}
+
+		// 目标位置已经有其他对象时不移动
+		if other := s.findObject(m.PackageID, m.Path); other != nil && other != obj {
+			continue
+		}
+
+		m.ApplyTo(&obj.Object)
+		sucs = append(sucs, m.ObjectID)
+	}
+	return ObjectMoveResp{Successes: sucs}, nil
+}
+
+func (s *FakeServer) objectDelete(r *http.Request) (any, error) {
+	req, err := decodeFakeJSON[ObjectDelete](r)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i, id := range req.ObjectIDs {
+		if i >= len(req.Preconditions) {
+			break
+		}
+
+		if err := checkFakePrecondition(req.Preconditions[i], s.objects[id], id); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, id := range req.ObjectIDs {
+		delete(s.objects, id)
+	}
+	return ObjectDeleteResp{}, nil
+}
+
+func (s *FakeServer) objectDeleteByPath(r *http.Request) (any, error) {
+	req, err := decodeFakeJSON[ObjectDeleteByPath](r)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	obj := s.findObject(req.PackageID, req.Path)
+	if err := checkFakePrecondition(req.Precondition, obj, req.Path); err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return nil, fakeErrorf(errorcode.DataNotFound, "object %v not found", req.Path)
+	}
+
+	delete(s.objects, obj.ObjectID)
+	return ObjectDeleteByPathResp{}, nil
+}
+
+func (s *FakeServer) objectGetPackageObjects(r *http.Request) (any, error) {
+	pkgID, err := fakeQueryInt(r, "packageID")
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, err := s.getPackage(cdssdk.PackageID(pkgID)); err != nil {
+		return nil, err
+	}
+
+	objs, next, err := pageFakeObjects(r, s.packageObjects(cdssdk.PackageID(pkgID)))
+	if err != nil {
+		return nil, err
+	}
+	return ObjectGetPackageObjectsResp{Objects: objs, NextCursor: next}, nil
+}
+
+func (s *FakeServer) storageLoadPackage(r *http.Request) (any, error) {
+	req, err := decodeFakeJSON[StorageLoadPackageReq](r)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, err := s.getPackage(req.PackageID); err != nil {
+		return nil, err
+	}
+	if _, ok := s.storages[req.StorageID]; !ok {
+		return nil, fakeErrorf(errorcode.DataNotFound, "storage %v not found", req.StorageID)
+	}
+
+	s.addLoad(req.PackageID, req.StorageID, req.RootPath)
+	return StorageLoadPackageResp{}, nil
+}
+
+func (s *FakeServer) addLoad(pkgID cdssdk.PackageID, stgID cdssdk.StorageID, path string) {
+	loads, ok := s.loads[pkgID]
+	if !ok {
+		loads = make(map[cdssdk.StorageID]string)
+		s.loads[pkgID] = loads
+	}
+	loads[stgID] = path
+}
+
+func (s *FakeServer) storageCreatePackage(r *http.Request) (any, error) {
+	req, err := decodeFakeJSON[StorageCreatePackageReq](r)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.storages[req.StorageID]; !ok {
+		return nil, fakeErrorf(errorcode.DataNotFound, "storage %v not found", req.StorageID)
+	}
+
+	pkg, err := s.createPackage(req.BucketID, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return StorageCreatePackageResp{PackageID: pkg.PackageID}, nil
+}
+
+func (s *FakeServer) storageGet(r *http.Request) (any, error) {
+	stgID, err := fakeQueryInt(r, "storageID")
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stg, ok := s.storages[cdssdk.StorageID(stgID)]
+	if !ok {
+		return nil, fakeErrorf(errorcode.DataNotFound, "storage %v not found", stgID)
+	}
+	return StorageGetResp{Storage: *stg}, nil
+}
+
+func (s *FakeServer) cacheMovePackage(r *http.Request) (any, error) {
+	req, err := decodeFakeJSON[CacheMovePackageReq](r)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, err := s.getPackage(req.PackageID); err != nil {
+		return nil, err
+	}
+	if _, ok := s.storages[req.StorageID]; !ok {
+		return nil, fakeErrorf(errorcode.DataNotFound, "storage %v not found", req.StorageID)
+	}
+
+	caches, ok := s.caches[req.PackageID]
+	if !ok {
+		caches = make(map[cdssdk.StorageID]bool)
+		s.caches[req.PackageID] = caches
+	}
+	caches[req.StorageID] = true
+	return CacheMovePackageResp{}, nil
+}
+
+func (s *FakeServer) hubGetHubs(r *http.Request) (any, error) {
+	// 请求中的HubIDs会被格式化成[1 2 3]的形式
+	idsStr := r.URL.Query().Get("HubIDs")
+	if idsStr == "" {
+		idsStr = r.URL.Query().Get("hubIDs")
+	}
+
+	var hubIDs []cdssdk.HubID
+	for _, str := range strings.Fields(strings.Trim(idsStr, "[]")) {
+		id, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return nil, fakeErrorf(errorcode.BadArgument, "invalid hub id: %v", str)
+		}
+		hubIDs = append(hubIDs, cdssdk.HubID(id))
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	hubs := []*cdssdk.Hub{}
+	if len(hubIDs) == 0 {
+		for _, hub := range s.hubs {
+			h := *hub
+			hubs = append(hubs, &h)
+		}
+		sort.Slice(hubs, func(i, j int) bool { return hubs[i].HubID < hubs[j].HubID })
+	} else {
+		for _, id := range hubIDs {
+			if hub, ok := s.hubs[id]; ok {
+				h := *hub
+				hubs = append(hubs, &h)
+			}
+		}
+	}
+	return HubGetHubsResp{Hubs: hubs}, nil
+}
@@ -0,0 +1,105 @@
+package cdsapi
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlink.org.cn/cloudream/common/consts/errorcode"
+	"gitlink.org.cn/cloudream/common/pkgs/iterator"
+	"gitlink.org.cn/cloudream/common/sdks"
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+)
+
+func Test_FakeServer(t *testing.T) {
+	Convey("分段下载与克隆", t, func() {
+		svr := newTestFakeServer()
+		defer svr.Close()
+		cli := NewClient(svr.Config())
+
+		pkg, err := cli.Package().Create(PackageCreate{UserID: 1, BucketID: 1, Name: "pkg"})
+		So(err, ShouldBeNil)
+
+		_, err = cli.Package().Create(PackageCreate{UserID: 1, BucketID: 1, Name: "pkg"})
+		So(err, ShouldNotBeNil)
+		So(err.(*sdks.CodeMessageError).Code, ShouldEqual, errorcode.DataExists)
+
+		_, err = cli.Object().Upload(ObjectUpload{
+			ObjectUploadInfo: ObjectUploadInfo{UserID: 1, PackageID: pkg.Package.PackageID},
+			Files: iterator.Array(&UploadingObject{
+				Path: "目录/a b.txt",
+				File: io.NopCloser(bytes.NewBufferString("0123456789")),
+			}),
+		})
+		So(err, ShouldBeNil)
+
+		length := int64(3)
+		down, err := cli.Object().DownloadByPath(ObjectDownloadByPath{
+			UserID:    1,
+			PackageID: pkg.Package.PackageID,
+			Path:      "目录/a b.txt",
+			Offset:    2,
+			Length:    &length,
+		})
+		So(err, ShouldBeNil)
+		So(down.Path, ShouldEqual, "目录/a b.txt")
+		data, err := io.ReadAll(down.File)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, "234")
+		down.File.Close()
+
+		clone, err := cli.Package().Clone(PackageClone{
+			UserID:    1,
+			PackageID: pkg.Package.PackageID,
+			BucketID:  1,
+			Name:      "pkg2",
+		})
+		So(err, ShouldBeNil)
+
+		objs, err := cli.Object().GetPackageObjects(ObjectGetPackageObjects{UserID: 1, PackageID: clone.Package.PackageID})
+		So(err, ShouldBeNil)
+		So(objs.Objects, ShouldHaveLength, 1)
+		So(objs.Objects[0].FileHash.IsFullHash(), ShouldBeTrue)
+
+		_, err = cli.Object().DownloadByPath(ObjectDownloadByPath{UserID: 1, PackageID: clone.Package.PackageID, Path: "none"})
+		So(err, ShouldNotBeNil)
+		So(err.(*sdks.CodeMessageError).Code, ShouldEqual, errorcode.DataNotFound)
+	})
+
+	Convey("存储、缓存与节点", t, func() {
+		svr := newTestFakeServer()
+		defer svr.Close()
+		svr.AddHub(cdssdk.Hub{HubID: 1, Name: "hub1", Address: &cdssdk.GRPCAddressInfo{Type: "GRPC", LocalIP: "127.0.0.1"}})
+		svr.AddHub(cdssdk.Hub{HubID: 2, Name: "hub2"})
+		cli := NewClient(svr.Config())
+
+		stg, err := cli.StorageGet(StorageGet{UserID: 1, StorageID: 2})
+		So(err, ShouldBeNil)
+		So(stg.Storage.Name, ShouldEqual, "stg2")
+
+		hubs, err := cli.HubGetHubs(HubGetHubsReq{HubIDs: []cdssdk.HubID{1}})
+		So(err, ShouldBeNil)
+		So(hubs.Hubs, ShouldHaveLength, 1)
+		So(hubs.Hubs[0].Address, ShouldHaveSameTypeAs, &cdssdk.GRPCAddressInfo{})
+
+		hubs, err = cli.HubGetHubs(HubGetHubsReq{})
+		So(err, ShouldBeNil)
+		So(hubs.Hubs, ShouldHaveLength, 2)
+
+		pkg, err := cli.Package().Create(PackageCreate{UserID: 1, BucketID: 1, Name: "pkg"})
+		So(err, ShouldBeNil)
+
+		_, err = cli.CacheMovePackage(CacheMovePackageReq{UserID: 1, PackageID: pkg.Package.PackageID, StorageID: 1})
+		So(err, ShouldBeNil)
+
+		cached, err := cli.Package().GetCachedStorages(PackageGetCachedStoragesReq{UserID: 1, PackageID: pkg.Package.PackageID})
+		So(err, ShouldBeNil)
+		So(cached.StorageInfos, ShouldHaveLength, 1)
+		So(cached.StorageInfos[0].StorageID, ShouldEqual, 1)
+
+		_, err = cli.StorageLoadPackage(StorageLoadPackageReq{UserID: 1, PackageID: pkg.Package.PackageID, StorageID: 2, RootPath: "load"})
+		So(err, ShouldBeNil)
+		So(svr.LoadedStorages(pkg.Package.PackageID), ShouldResemble, map[cdssdk.StorageID]string{2: "load"})
+	})
+}
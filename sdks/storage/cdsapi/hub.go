@@ -1,9 +1,8 @@
 package cdsapi
 
 import (
-	"net/url"
+	"context"
 
-	"gitlink.org.cn/cloudream/common/consts/errorcode"
 	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
 	"gitlink.org.cn/cloudream/common/utils/http2"
 )
@@ -19,26 +18,11 @@ type HubGetHubsResp struct {
 }
 
 func (c *Client) HubGetHubs(req HubGetHubsReq) (*HubGetHubsResp, error) {
-	url, err := url.JoinPath(c.baseURL, HubGetHubsPath)
-	if err != nil {
-		return nil, err
-	}
+	return c.HubGetHubsContext(context.Background(), req)
+}
 
-	resp, err := http2.GetForm(url, http2.RequestParam{
+func (c *Client) HubGetHubsContext(ctx context.Context, req HubGetHubsReq) (*HubGetHubsResp, error) {
+	return requestJSON[HubGetHubsResp](ctx, c, true, HubGetHubsPath, http2.GetForm, http2.RequestParam{
 		Query: req,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	jsonResp, err := ParseJSONResponse[response[HubGetHubsResp]](resp)
-	if err != nil {
-		return nil, err
-	}
-
-	if jsonResp.Code == errorcode.OK {
-		return &jsonResp.Data, nil
-	}
-
-	return nil, jsonResp.ToError()
 }
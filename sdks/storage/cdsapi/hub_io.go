@@ -1,11 +1,11 @@
 package cdsapi
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/url"
 
-	"gitlink.org.cn/cloudream/common/consts/errorcode"
 	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
 	"gitlink.org.cn/cloudream/common/utils/http2"
 	"gitlink.org.cn/cloudream/common/utils/io2"
@@ -24,17 +24,16 @@ type GetStreamReq struct {
 }
 
 func (c *Client) GetStream(req GetStreamReq) (io.ReadCloser, error) {
-	targetUrl, err := url.JoinPath(c.baseURL, GetStreamPath)
-	if err != nil {
-		return nil, err
-	}
+	return c.GetStreamContext(context.Background(), req)
+}
 
+func (c *Client) GetStreamContext(ctx context.Context, req GetStreamReq) (io.ReadCloser, error) {
 	body, err := serder.ObjectToJSONEx(req)
 	if err != nil {
 		return nil, fmt.Errorf("request to json: %w", err)
 	}
 
-	resp, err := http2.GetJSON(targetUrl, http2.RequestParam{
+	resp, err := requestStream(ctx, c, false, GetStreamPath, http2.GetJSON, http2.RequestParam{
 		Body: body,
 	})
 	if err != nil {
@@ -44,6 +43,7 @@ func (c *Client) GetStream(req GetStreamReq) (io.ReadCloser, error) {
 	cr := http2.NewChunkedReader(resp.Body)
 	_, str, err := cr.NextPart()
 	if err != nil {
+		cr.Close()
 		return nil, fmt.Errorf("reading response: %w", err)
 	}
 
@@ -65,6 +65,11 @@ type SendStreamInfo struct {
 }
 
 func (c *Client) SendStream(req SendStreamReq) error {
+	return c.SendStreamContext(context.Background(), req)
+}
+
+// 发送数据流。请求不会重试，也不受Config.Timeout限制
+func (c *Client) SendStreamContext(ctx context.Context, req SendStreamReq) error {
 	targetUrl, err := url.JoinPath(c.baseURL, SendStreamPath)
 	if err != nil {
 		return err
@@ -103,27 +108,22 @@ func (c *Client) SendStream(req SendStreamReq) error {
 	}()
 
 	resp, err := http2.PostChunked2(targetUrl, http2.Chunked2RequestParam{
-		Body: pr,
+		Body:    pr,
+		Context: ctx,
+		Client:  c.httpCli,
 	})
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 
 	err = <-errCh
 	if err != nil {
 		return err
 	}
 
-	codeResp, err := ParseJSONResponse[response[any]](resp)
-	if err != nil {
-		return err
-	}
-
-	if codeResp.Code == errorcode.OK {
-		return nil
-	}
-
-	return codeResp.ToError()
+	_, err = parseCodeResponse[any](resp)
+	return err
 }
 
 const ExecuteIOPlanPath = "/hubIO/executeIOPlan"
@@ -133,33 +133,20 @@ type ExecuteIOPlanReq struct {
 }
 
 func (c *Client) ExecuteIOPlan(req ExecuteIOPlanReq) error {
-	targetUrl, err := url.JoinPath(c.baseURL, ExecuteIOPlanPath)
-	if err != nil {
-		return err
-	}
+	return c.ExecuteIOPlanContext(context.Background(), req)
+}
 
+// 执行一个计划，直到计划执行结束才会返回。请求不会重试，也不受Config.Timeout限制
+func (c *Client) ExecuteIOPlanContext(ctx context.Context, req ExecuteIOPlanReq) error {
 	body, err := serder.ObjectToJSONEx(req)
 	if err != nil {
 		return fmt.Errorf("request to json: %w", err)
 	}
 
-	resp, err := http2.PostJSON(targetUrl, http2.RequestParam{
+	_, err = requestJSONNoTimeout[any](ctx, c, false, ExecuteIOPlanPath, http2.PostJSON, http2.RequestParam{
 		Body: body,
 	})
-	if err != nil {
-		return err
-	}
-
-	codeResp, err := ParseJSONResponse[response[any]](resp)
-	if err != nil {
-		return err
-	}
-
-	if codeResp.Code == errorcode.OK {
-		return nil
-	}
-
-	return codeResp.ToError()
+	return err
 }
 
 const SendVarPath = "/hubIO/sendVar"
@@ -171,33 +158,19 @@ type SendVarReq struct {
 }
 
 func (c *Client) SendVar(req SendVarReq) error {
-	targetUrl, err := url.JoinPath(c.baseURL, SendVarPath)
-	if err != nil {
-		return err
-	}
+	return c.SendVarContext(context.Background(), req)
+}
 
+func (c *Client) SendVarContext(ctx context.Context, req SendVarReq) error {
 	body, err := serder.ObjectToJSONEx(req)
 	if err != nil {
 		return fmt.Errorf("request to json: %w", err)
 	}
 
-	resp, err := http2.PostJSON(targetUrl, http2.RequestParam{
+	_, err = requestJSON[any](ctx, c, false, SendVarPath, http2.PostJSON, http2.RequestParam{
 		Body: body,
 	})
-	if err != nil {
-		return err
-	}
-
-	jsonResp, err := ParseJSONResponse[response[any]](resp)
-	if err != nil {
-		return err
-	}
-
-	if jsonResp.Code == errorcode.OK {
-		return nil
-	}
-
-	return jsonResp.ToError()
+	return err
 }
 
 const GetVarPath = "/hubIO/getVar"
@@ -214,31 +187,17 @@ type GetVarResp struct {
 }
 
 func (c *Client) GetVar(req GetVarReq) (*GetVarResp, error) {
-	targetUrl, err := url.JoinPath(c.baseURL, GetVarPath)
-	if err != nil {
-		return nil, err
-	}
+	return c.GetVarContext(context.Background(), req)
+}
 
+// 获取计划中的变量，直到变量被设置才会返回。请求不会重试，也不受Config.Timeout限制
+func (c *Client) GetVarContext(ctx context.Context, req GetVarReq) (*GetVarResp, error) {
 	body, err := serder.ObjectToJSONEx(req)
 	if err != nil {
 		return nil, fmt.Errorf("request to json: %w", err)
 	}
 
-	resp, err := http2.GetJSON(targetUrl, http2.RequestParam{
+	return requestJSONNoTimeout[GetVarResp](ctx, c, false, GetVarPath, http2.GetJSON, http2.RequestParam{
 		Body: body,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	jsonResp, err := ParseJSONResponse[response[GetVarResp]](resp)
-	if err != nil {
-		return nil, err
-	}
-
-	if jsonResp.Code == errorcode.OK {
-		return &jsonResp.Data, nil
-	}
-
-	return nil, jsonResp.ToError()
 }
@@ -1,14 +1,14 @@
 package cdsapi
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"mime"
+	"net/http"
 	"net/url"
-	"strings"
 	"time"
 
-	"gitlink.org.cn/cloudream/common/consts/errorcode"
 	"gitlink.org.cn/cloudream/common/pkgs/iterator"
 	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
 	"gitlink.org.cn/cloudream/common/utils/http2"
@@ -32,34 +32,24 @@ type ObjectList struct {
 	PackageID cdssdk.PackageID `form:"packageID" binding:"required"`
 	Path      string           `form:"path"` // 允许为空字符串
 	IsPrefix  bool             `form:"isPrefix"`
+	Cursor    string           `form:"cursor"` // 上一页返回的NextCursor，为空时从头开始查询
+	Limit     int              `form:"limit"`  // 每页最多返回的对象数量，为0时不分页
+	// 只返回路径（按字节序）大于StartAfter的对象，为空时不限制。可以与Cursor同时使用
+	StartAfter string `form:"startAfter"`
 }
 type ObjectListResp struct {
-	Objects []cdssdk.Object `json:"objects"`
+	Objects    []cdssdk.Object `json:"objects"`
+	NextCursor string          `json:"nextCursor"` // 查询下一页使用的游标，为空时代表没有更多的对象了
 }
 
 func (c *ObjectService) List(req ObjectList) (*ObjectListResp, error) {
-	url, err := url.JoinPath(c.baseURL, ObjectListPath)
-	if err != nil {
-		return nil, err
-	}
+	return c.ListContext(context.Background(), req)
+}
 
-	resp, err := http2.GetForm(url, http2.RequestParam{
+func (c *ObjectService) ListContext(ctx context.Context, req ObjectList) (*ObjectListResp, error) {
+	return requestJSON[ObjectListResp](ctx, c.Client, true, ObjectListPath, http2.GetForm, http2.RequestParam{
 		Query: req,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	jsonResp, err := ParseJSONResponse[response[ObjectListResp]](resp)
-	if err != nil {
-		return nil, err
-	}
-
-	if jsonResp.Code == errorcode.OK {
-		return &jsonResp.Data, nil
-	}
-
-	return nil, jsonResp.ToError()
 }
 
 const ObjectListByIDsPath = "/object/listByIDs"
@@ -73,28 +63,13 @@ type ObjectListByIDsResp struct {
 }
 
 func (c *ObjectService) ListByIDs(req ObjectListByIDs) (*ObjectListByIDsResp, error) {
-	url, err := url.JoinPath(c.baseURL, ObjectListByIDsPath)
-	if err != nil {
-		return nil, err
-	}
+	return c.ListByIDsContext(context.Background(), req)
+}
 
-	resp, err := http2.PostJSON(url, http2.RequestParam{
+func (c *ObjectService) ListByIDsContext(ctx context.Context, req ObjectListByIDs) (*ObjectListByIDsResp, error) {
+	return requestJSON[ObjectListByIDsResp](ctx, c.Client, true, ObjectListByIDsPath, http2.PostJSON, http2.RequestParam{
 		Body: req,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	jsonResp, err := ParseJSONResponse[response[ObjectListByIDsResp]](resp)
-	if err != nil {
-		return nil, err
-	}
-
-	if jsonResp.Code == errorcode.OK {
-		return &jsonResp.Data, nil
-	}
-
-	return nil, jsonResp.ToError()
 }
 
 const ObjectUploadPath = "/object/upload"
@@ -110,6 +85,10 @@ type ObjectUploadInfo struct {
 	Affinity   cdssdk.StorageID   `json:"affinity"`
 	LoadTo     []cdssdk.StorageID `json:"loadTo"`
 	LoadToPath []string           `json:"loadToPath"`
+	// 对所有上传的文件生效的前提条件，不满足时所有文件都不会上传
+	Precondition *Precondition `json:"precondition,omitempty"`
+	// 对指定路径的文件生效的前提条件，会覆盖Precondition
+	PathPreconditions map[string]Precondition `json:"pathPreconditions,omitempty"`
 }
 
 type UploadingObject struct {
@@ -124,6 +103,11 @@ type ObjectUploadResp struct {
 }
 
 func (c *ObjectService) Upload(req ObjectUpload) (*ObjectUploadResp, error) {
+	return c.UploadContext(context.Background(), req)
+}
+
+// 上传文件。请求不会重试，也不受Config.Timeout限制
+func (c *ObjectService) UploadContext(ctx context.Context, req ObjectUpload) (*ObjectUploadResp, error) {
 	url, err := url.JoinPath(c.baseURL, ObjectUploadPath)
 	if err != nil {
 		return nil, err
@@ -143,28 +127,15 @@ func (c *ObjectService) Upload(req ObjectUpload) (*ObjectUploadResp, error) {
 				File:      src.File,
 			}, nil
 		}),
+		Context: ctx,
+		Client:  c.httpCli,
 	})
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 
-	contType := resp.Header.Get("Content-Type")
-	if strings.Contains(contType, http2.ContentTypeJSON) {
-		var err error
-		var codeResp response[ObjectUploadResp]
-		if codeResp, err = serder.JSONToObjectStreamEx[response[ObjectUploadResp]](resp.Body); err != nil {
-			return nil, fmt.Errorf("parsing response: %w", err)
-		}
-
-		if codeResp.Code == errorcode.OK {
-			return &codeResp.Data, nil
-		}
-
-		return nil, codeResp.ToError()
-	}
-
-	return nil, fmt.Errorf("unknow response content type: %s", contType)
-
+	return parseCodeResponse[ObjectUploadResp](resp)
 }
 
 const ObjectDownloadPath = "/object/download"
@@ -181,38 +152,19 @@ type DownloadingObject struct {
 }
 
 func (c *ObjectService) Download(req ObjectDownload) (*DownloadingObject, error) {
-	url, err := url.JoinPath(c.baseURL, ObjectDownloadPath)
-	if err != nil {
-		return nil, err
-	}
+	return c.DownloadContext(context.Background(), req)
+}
 
-	resp, err := http2.GetJSON(url, http2.RequestParam{
+// 下载文件。Config.Timeout只限制收到响应头之前的时间，之后读取文件数据的过程受ctx控制
+func (c *ObjectService) DownloadContext(ctx context.Context, req ObjectDownload) (*DownloadingObject, error) {
+	resp, err := requestStream(ctx, c.Client, true, ObjectDownloadPath, http2.GetJSON, http2.RequestParam{
 		Query: req,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	contType := resp.Header.Get("Content-Type")
-
-	if strings.Contains(contType, http2.ContentTypeJSON) {
-		var codeResp response[any]
-		if err := serder.JSONToObjectStream(resp.Body, &codeResp); err != nil {
-			return nil, fmt.Errorf("parsing response: %w", err)
-		}
-
-		return nil, codeResp.ToError()
-	}
-
-	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition"))
-	if err != nil {
-		return nil, fmt.Errorf("parsing content disposition: %w", err)
-	}
-
-	return &DownloadingObject{
-		Path: params["filename"],
-		File: resp.Body,
-	}, nil
+	return parseDownloadingObject(resp)
 }
 
 const ObjectDownloadByPathPath = "/object/downloadByPath"
@@ -226,31 +178,24 @@ type ObjectDownloadByPath struct {
 }
 
 func (c *ObjectService) DownloadByPath(req ObjectDownloadByPath) (*DownloadingObject, error) {
-	url, err := url.JoinPath(c.baseURL, ObjectDownloadByPathPath)
-	if err != nil {
-		return nil, err
-	}
+	return c.DownloadByPathContext(context.Background(), req)
+}
 
-	resp, err := http2.GetJSON(url, http2.RequestParam{
+func (c *ObjectService) DownloadByPathContext(ctx context.Context, req ObjectDownloadByPath) (*DownloadingObject, error) {
+	resp, err := requestStream(ctx, c.Client, true, ObjectDownloadByPathPath, http2.GetJSON, http2.RequestParam{
 		Query: req,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	contType := resp.Header.Get("Content-Type")
-
-	if strings.Contains(contType, http2.ContentTypeJSON) {
-		var codeResp response[any]
-		if err := serder.JSONToObjectStream(resp.Body, &codeResp); err != nil {
-			return nil, fmt.Errorf("parsing response: %w", err)
-		}
-
-		return nil, codeResp.ToError()
-	}
+	return parseDownloadingObject(resp)
+}
 
+func parseDownloadingObject(resp *http.Response) (*DownloadingObject, error) {
 	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition"))
 	if err != nil {
+		resp.Body.Close()
 		return nil, fmt.Errorf("parsing content disposition: %w", err)
 	}
 
@@ -263,8 +208,9 @@ func (c *ObjectService) DownloadByPath(req ObjectDownloadByPath) (*DownloadingOb
 const ObjectUpdateInfoPath = "/object/updateInfo"
 
 type UpdatingObject struct {
-	ObjectID   cdssdk.ObjectID `json:"objectID" binding:"required"`
-	UpdateTime time.Time       `json:"updateTime" binding:"required"`
+	ObjectID     cdssdk.ObjectID `json:"objectID" binding:"required"`
+	UpdateTime   time.Time       `json:"updateTime" binding:"required"`
+	Precondition *Precondition   `json:"precondition,omitempty"`
 }
 
 func (u *UpdatingObject) ApplyTo(obj *cdssdk.Object) {
@@ -281,64 +227,35 @@ type ObjectUpdateInfoResp struct {
 }
 
 func (c *ObjectService) UpdateInfo(req ObjectUpdateInfo) (*ObjectUpdateInfoResp, error) {
-	url, err := url.JoinPath(c.baseURL, ObjectUpdateInfoPath)
-	if err != nil {
-		return nil, err
-	}
+	return c.UpdateInfoContext(context.Background(), req)
+}
 
-	resp, err := http2.PostJSON(url, http2.RequestParam{
+func (c *ObjectService) UpdateInfoContext(ctx context.Context, req ObjectUpdateInfo) (*ObjectUpdateInfoResp, error) {
+	return requestJSON[ObjectUpdateInfoResp](ctx, c.Client, false, ObjectUpdateInfoPath, http2.PostJSON, http2.RequestParam{
 		Body: req,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	jsonResp, err := ParseJSONResponse[response[ObjectUpdateInfoResp]](resp)
-	if err != nil {
-		return nil, err
-	}
-
-	if jsonResp.Code == errorcode.OK {
-		return &jsonResp.Data, nil
-	}
-
-	return nil, jsonResp.ToError()
 }
 
 const ObjectUpdateInfoByPathPath = "/object/updateInfoByPath"
 
 type ObjectUpdateInfoByPath struct {
-	UserID     cdssdk.UserID    `json:"userID" binding:"required"`
-	PackageID  cdssdk.PackageID `json:"packageID" binding:"required"`
-	Path       string           `json:"path" binding:"required"`
-	UpdateTime time.Time        `json:"updateTime" binding:"required"`
+	UserID       cdssdk.UserID    `json:"userID" binding:"required"`
+	PackageID    cdssdk.PackageID `json:"packageID" binding:"required"`
+	Path         string           `json:"path" binding:"required"`
+	UpdateTime   time.Time        `json:"updateTime" binding:"required"`
+	Precondition *Precondition    `json:"precondition,omitempty"`
 }
 
 type ObjectUpdateInfoByPathResp struct{}
 
 func (c *ObjectService) UpdateInfoByPath(req ObjectUpdateInfoByPath) (*ObjectUpdateInfoByPathResp, error) {
-	url, err := url.JoinPath(c.baseURL, ObjectUpdateInfoByPathPath)
-	if err != nil {
-		return nil, err
-	}
+	return c.UpdateInfoByPathContext(context.Background(), req)
+}
 
-	resp, err := http2.PostJSON(url, http2.RequestParam{
+func (c *ObjectService) UpdateInfoByPathContext(ctx context.Context, req ObjectUpdateInfoByPath) (*ObjectUpdateInfoByPathResp, error) {
+	return requestJSON[ObjectUpdateInfoByPathResp](ctx, c.Client, false, ObjectUpdateInfoByPathPath, http2.PostJSON, http2.RequestParam{
 		Body: req,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	jsonResp, err := ParseJSONResponse[response[ObjectUpdateInfoByPathResp]](resp)
-	if err != nil {
-		return nil, err
-	}
-
-	if jsonResp.Code == errorcode.OK {
-		return &jsonResp.Data, nil
-	}
-
-	return nil, jsonResp.ToError()
 }
 
 const ObjectMovePath = "/object/move"
@@ -347,6 +264,10 @@ type MovingObject struct {
 	ObjectID  cdssdk.ObjectID  `json:"objectID" binding:"required"`
 	PackageID cdssdk.PackageID `json:"packageID" binding:"required"`
 	Path      string           `json:"path" binding:"required"`
+	// 被移动的对象需要满足的条件
+	Precondition *Precondition `json:"precondition,omitempty"`
+	// 目标位置上的对象需要满足的条件，比如IfNoneMatch要求目标位置没有对象
+	DestPrecondition *Precondition `json:"destPrecondition,omitempty"`
 }
 
 func (m *MovingObject) ApplyTo(obj *cdssdk.Object) {
@@ -364,28 +285,13 @@ type ObjectMoveResp struct {
 }
 
 func (c *ObjectService) Move(req ObjectMove) (*ObjectMoveResp, error) {
-	url, err := url.JoinPath(c.baseURL, ObjectMovePath)
-	if err != nil {
-		return nil, err
-	}
+	return c.MoveContext(context.Background(), req)
+}
 
-	resp, err := http2.PostJSON(url, http2.RequestParam{
+func (c *ObjectService) MoveContext(ctx context.Context, req ObjectMove) (*ObjectMoveResp, error) {
+	return requestJSON[ObjectMoveResp](ctx, c.Client, false, ObjectMovePath, http2.PostJSON, http2.RequestParam{
 		Body: req,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	jsonResp, err := ParseJSONResponse[response[ObjectMoveResp]](resp)
-	if err != nil {
-		return nil, err
-	}
-
-	if jsonResp.Code == errorcode.OK {
-		return &jsonResp.Data, nil
-	}
-
-	return nil, jsonResp.ToError()
 }
 
 const ObjectDeletePath = "/object/delete"
@@ -393,67 +299,42 @@ const ObjectDeletePath = "/object/delete"
 type ObjectDelete struct {
 	UserID    cdssdk.UserID     `json:"userID" binding:"required"`
 	ObjectIDs []cdssdk.ObjectID `json:"objectIDs" binding:"required"`
+	// 与ObjectIDs一一对应，为空或者对应位置为nil时代表没有条件
+	Preconditions []*Precondition `json:"preconditions,omitempty"`
 }
 
 type ObjectDeleteResp struct{}
 
 func (c *ObjectService) Delete(req ObjectDelete) error {
-	url, err := url.JoinPath(c.baseURL, ObjectDeletePath)
-	if err != nil {
-		return err
-	}
+	return c.DeleteContext(context.Background(), req)
+}
 
-	resp, err := http2.PostJSON(url, http2.RequestParam{
+func (c *ObjectService) DeleteContext(ctx context.Context, req ObjectDelete) error {
+	_, err := requestJSON[ObjectDeleteResp](ctx, c.Client, false, ObjectDeletePath, http2.PostJSON, http2.RequestParam{
 		Body: req,
 	})
-	if err != nil {
-		return err
-	}
-
-	jsonResp, err := ParseJSONResponse[response[ObjectDeleteResp]](resp)
-	if err != nil {
-		return err
-	}
-
-	if jsonResp.Code == errorcode.OK {
-		return nil
-	}
-
-	return jsonResp.ToError()
+	return err
 }
 
 const ObjectDeleteByPathPath = "/object/deleteByPath"
 
 type ObjectDeleteByPath struct {
-	UserID    cdssdk.UserID    `json:"userID" binding:"required"`
-	PackageID cdssdk.PackageID `json:"packageID" binding:"required"`
-	Path      string           `json:"path" binding:"required"`
+	UserID       cdssdk.UserID    `json:"userID" binding:"required"`
+	PackageID    cdssdk.PackageID `json:"packageID" binding:"required"`
+	Path         string           `json:"path" binding:"required"`
+	Precondition *Precondition    `json:"precondition,omitempty"`
 }
 type ObjectDeleteByPathResp struct{}
 
 func (c *ObjectService) DeleteByPath(req ObjectDeleteByPath) error {
-	url, err := url.JoinPath(c.baseURL, ObjectDeleteByPathPath)
-	if err != nil {
-		return err
-	}
+	return c.DeleteByPathContext(context.Background(), req)
+}
 
-	resp, err := http2.PostJSON(url, http2.RequestParam{
+func (c *ObjectService) DeleteByPathContext(ctx context.Context, req ObjectDeleteByPath) error {
+	_, err := requestJSON[ObjectDeleteByPathResp](ctx, c.Client, false, ObjectDeleteByPathPath, http2.PostJSON, http2.RequestParam{
 		Body: req,
 	})
-	if err != nil {
-		return err
-	}
-
-	jsonResp, err := ParseJSONResponse[response[ObjectDeleteByPathResp]](resp)
-	if err != nil {
-		return err
-	}
-
-	if jsonResp.Code == errorcode.OK {
-		return nil
-	}
-
-	return jsonResp.ToError()
+	return err
 }
 
 const ObjectGetPackageObjectsPath = "/object/getPackageObjects"
@@ -461,32 +342,20 @@ const ObjectGetPackageObjectsPath = "/object/getPackageObjects"
 type ObjectGetPackageObjects struct {
 	UserID    cdssdk.UserID    `form:"userID" json:"userID" binding:"required"`
 	PackageID cdssdk.PackageID `form:"packageID" json:"packageID" binding:"required"`
+	Cursor    string           `form:"cursor" json:"cursor"` // 上一页返回的NextCursor，为空时从头开始查询
+	Limit     int              `form:"limit" json:"limit"`   // 每页最多返回的对象数量，为0时不分页
 }
 type ObjectGetPackageObjectsResp struct {
-	Objects []cdssdk.Object `json:"objects"`
+	Objects    []cdssdk.Object `json:"objects"`
+	NextCursor string          `json:"nextCursor"` // 查询下一页使用的游标，为空时代表没有更多的对象了
 }
 
 func (c *ObjectService) GetPackageObjects(req ObjectGetPackageObjects) (*ObjectGetPackageObjectsResp, error) {
-	url, err := url.JoinPath(c.baseURL, ObjectGetPackageObjectsPath)
-	if err != nil {
-		return nil, err
-	}
+	return c.GetPackageObjectsContext(context.Background(), req)
+}
 
-	resp, err := http2.GetForm(url, http2.RequestParam{
+func (c *ObjectService) GetPackageObjectsContext(ctx context.Context, req ObjectGetPackageObjects) (*ObjectGetPackageObjectsResp, error) {
+	return requestJSON[ObjectGetPackageObjectsResp](ctx, c.Client, true, ObjectGetPackageObjectsPath, http2.GetForm, http2.RequestParam{
 		Query: req,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	jsonResp, err := ParseJSONResponse[response[ObjectGetPackageObjectsResp]](resp)
-	if err != nil {
-		return nil, err
-	}
-
-	if jsonResp.Code == errorcode.OK {
-		return &jsonResp.Data, nil
-	}
-
-	return nil, jsonResp.ToError()
 }
@@ -0,0 +1,108 @@
+package cdsapi
+
+import (
+	"context"
+	"fmt"
+
+	"gitlink.org.cn/cloudream/common/pkgs/iterator"
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+)
+
+// 分页查询对象时默认的每页数量
+const DefaultObjectPageSize = 1000
+
+// 逐页查询对象的迭代器，只有在当前页的对象遍历完之后才会查询下一页。
+// 查询失败时MoveNext会返回错误，再次调用MoveNext会重新查询失败的那一页。
+type ObjectIterator struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	fetch  func(ctx context.Context, cursor string) ([]cdssdk.Object, string, error)
+	cursor string
+	page   []cdssdk.Object
+	index  int
+	done   bool // 已经查询到了最后一页
+	closed bool
+}
+
+var _ iterator.Iterator[cdssdk.Object] = (*ObjectIterator)(nil)
+
+// 逐页查询满足条件的对象。IsPrefix为true时返回路径以Path开头的所有对象。
+// req.Cursor为起始游标，req.Limit为每页的数量，为0时使用DefaultObjectPageSize。
+func (c *ObjectService) ListIterator(ctx context.Context, req ObjectList) *ObjectIterator {
+	if req.Limit <= 0 {
+		req.Limit = DefaultObjectPageSize
+	}
+
+	return newObjectIterator(ctx, req.Cursor, func(ctx context.Context, cursor string) ([]cdssdk.Object, string, error) {
+		req.Cursor = cursor
+		resp, err := c.ListContext(ctx, req)
+		if err != nil {
+			return nil, "", err
+		}
+		return resp.Objects, resp.NextCursor, nil
+	})
+}
+
+// 逐页查询Package中的所有对象。req.Limit为0时使用DefaultObjectPageSize
+func (c *ObjectService) GetPackageObjectsIterator(ctx context.Context, req ObjectGetPackageObjects) *ObjectIterator {
+	if req.Limit <= 0 {
+		req.Limit = DefaultObjectPageSize
+	}
+
+	return newObjectIterator(ctx, req.Cursor, func(ctx context.Context, cursor string) ([]cdssdk.Object, string, error) {
+		req.Cursor = cursor
+		resp, err := c.GetPackageObjectsContext(ctx, req)
+		if err != nil {
+			return nil, "", err
+		}
+		return resp.Objects, resp.NextCursor, nil
+	})
+}
+
+func newObjectIterator(ctx context.Context, cursor string, fetch func(ctx context.Context, cursor string) ([]cdssdk.Object, string, error)) *ObjectIterator {
+	ctx, cancel := context.WithCancel(ctx)
+	return &ObjectIterator{
+		ctx:    ctx,
+		cancel: cancel,
+		fetch:  fetch,
+		cursor: cursor,
+	}
+}
+
+func (i *ObjectIterator) MoveNext() (cdssdk.Object, error) {
+	for !i.closed && i.index >= len(i.page) {
+		if i.done {
+			return cdssdk.Object{}, iterator.ErrNoMoreItem
+		}
+
+		objs, next, err := i.fetch(i.ctx, i.cursor)
+		if err != nil {
+			return cdssdk.Object{}, fmt.Errorf("listing objects: %w", err)
+		}
+
+		// 不分页的服务会一次返回所有对象，且不返回游标
+		if next != "" && next == i.cursor {
+			return cdssdk.Object{}, fmt.Errorf("listing objects: cursor %v not advanced", next)
+		}
+
+		i.page = objs
+		i.index = 0
+		i.cursor = next
+		i.done = next == ""
+	}
+
+	if i.closed {
+		return cdssdk.Object{}, iterator.ErrNoMoreItem
+	}
+
+	obj := i.page[i.index]
+	i.index++
+	return obj, nil
+}
+
+// 停止遍历，之后MoveNext只会返回ErrNoMoreItem。可以在遍历中途调用
+func (i *ObjectIterator) Close() {
+	i.closed = true
+	i.page = nil
+	i.cancel()
+}
@@ -0,0 +1,118 @@
+package cdsapi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlink.org.cn/cloudream/common/pkgs/iterator"
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+)
+
+func Test_ObjectIterator(t *testing.T) {
+	svr := newTestFakeServer()
+	defer svr.Close()
+
+	cli := NewClient(svr.Config())
+	pkg, err := cli.Package().Create(PackageCreate{UserID: 1, BucketID: 1, Name: "pkg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var files []*UploadingObject
+	for i := 0; i < 25; i++ {
+		files = append(files, &UploadingObject{
+			Path: fmt.Sprintf("a/%02d", i),
+			File: io.NopCloser(bytes.NewBufferString("a")),
+		})
+	}
+	files = append(files, &UploadingObject{Path: "b", File: io.NopCloser(bytes.NewBufferString("b"))})
+	_, err = cli.Object().Upload(ObjectUpload{
+		ObjectUploadInfo: ObjectUploadInfo{UserID: 1, PackageID: pkg.Package.PackageID},
+		Files:            iterator.Array(files...),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readAll := func(iter iterator.Iterator[cdssdk.Object]) ([]string, error) {
+		defer iter.Close()
+
+		var paths []string
+		for {
+			obj, err := iter.MoveNext()
+			if err == iterator.ErrNoMoreItem {
+				return paths, nil
+			}
+			if err != nil {
+				return paths, err
+			}
+			paths = append(paths, obj.Path)
+		}
+	}
+
+	Convey("按前缀逐页查询", t, func() {
+		trans := &countingTransport{}
+		cfg := svr.Config()
+		cfg.Transport = trans
+		cli := NewClient(cfg)
+
+		paths, err := readAll(cli.Object().ListIterator(context.Background(), ObjectList{
+			UserID:    1,
+			PackageID: pkg.Package.PackageID,
+			Path:      "a/",
+			IsPrefix:  true,
+			Limit:     10,
+		}))
+		So(err, ShouldBeNil)
+		So(paths, ShouldHaveLength, 25)
+		So(paths[0], ShouldEqual, "a/00")
+		So(paths[24], ShouldEqual, "a/24")
+		So(trans.cnt.Load(), ShouldEqual, 3)
+	})
+
+	Convey("查询Package中的所有对象", t, func() {
+		paths, err := readAll(cli.Object().GetPackageObjectsIterator(context.Background(), ObjectGetPackageObjects{
+			UserID:    1,
+			PackageID: pkg.Package.PackageID,
+			Limit:     7,
+		}))
+		So(err, ShouldBeNil)
+		So(paths, ShouldHaveLength, 26)
+		So(paths[25], ShouldEqual, "b")
+	})
+
+	Convey("中途关闭", t, func() {
+		trans := &countingTransport{}
+		cfg := svr.Config()
+		cfg.Transport = trans
+		cli := NewClient(cfg)
+
+		iter := cli.Object().ListIterator(context.Background(), ObjectList{
+			UserID:    1,
+			PackageID: pkg.Package.PackageID,
+			IsPrefix:  true,
+			Limit:     10,
+		})
+		for i := 0; i < 5; i++ {
+			_, err := iter.MoveNext()
+			So(err, ShouldBeNil)
+		}
+		iter.Close()
+
+		_, err := iter.MoveNext()
+		So(err, ShouldEqual, iterator.ErrNoMoreItem)
+		So(trans.cnt.Load(), ShouldEqual, 1)
+	})
+
+	Convey("查询失败", t, func() {
+		_, err := readAll(cli.Object().ListIterator(context.Background(), ObjectList{
+			UserID:    1,
+			PackageID: 100,
+		}))
+		So(err, ShouldNotBeNil)
+	})
+}
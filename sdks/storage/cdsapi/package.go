@@ -1,11 +1,10 @@
 package cdsapi
 
 import (
+	"context"
 	"fmt"
 	"net/url"
-	"strings"
 
-	"gitlink.org.cn/cloudream/common/consts/errorcode"
 	"gitlink.org.cn/cloudream/common/pkgs/iterator"
 	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
 	"gitlink.org.cn/cloudream/common/utils/http2"
@@ -31,28 +30,13 @@ type PackageGetResp struct {
 }
 
 func (c *PackageService) Get(req PackageGetReq) (*PackageGetResp, error) {
-	url, err := url.JoinPath(c.baseURL, PackageGetPath)
-	if err != nil {
-		return nil, err
-	}
+	return c.GetContext(context.Background(), req)
+}
 
-	resp, err := http2.GetForm(url, http2.RequestParam{
+func (c *PackageService) GetContext(ctx context.Context, req PackageGetReq) (*PackageGetResp, error) {
+	return requestJSON[PackageGetResp](ctx, c.Client, true, PackageGetPath, http2.GetForm, http2.RequestParam{
 		Query: req,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	codeResp, err := ParseJSONResponse[response[PackageGetResp]](resp)
-	if err != nil {
-		return nil, err
-	}
-
-	if codeResp.Code == errorcode.OK {
-		return &codeResp.Data, nil
-	}
-
-	return nil, codeResp.ToError()
 }
 
 const PackageGetByNamePath = "/package/getByName"
@@ -67,28 +51,13 @@ type PackageGetByNameResp struct {
 }
 
 func (c *PackageService) GetByName(req PackageGetByName) (*PackageGetByNameResp, error) {
-	url, err := url.JoinPath(c.baseURL, PackageGetByNamePath)
-	if err != nil {
-		return nil, err
-	}
+	return c.GetByNameContext(context.Background(), req)
+}
 
-	resp, err := http2.GetForm(url, http2.RequestParam{
+func (c *PackageService) GetByNameContext(ctx context.Context, req PackageGetByName) (*PackageGetByNameResp, error) {
+	return requestJSON[PackageGetByNameResp](ctx, c.Client, true, PackageGetByNamePath, http2.GetForm, http2.RequestParam{
 		Query: req,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	codeResp, err := ParseJSONResponse[response[PackageGetByNameResp]](resp)
-	if err != nil {
-		return nil, err
-	}
-
-	if codeResp.Code == errorcode.OK {
-		return &codeResp.Data, nil
-	}
-
-	return nil, codeResp.ToError()
 }
 
 const PackageCreatePath = "/package/create"
@@ -104,28 +73,13 @@ type PackageCreateResp struct {
 }
 
 func (s *PackageService) Create(req PackageCreate) (*PackageCreateResp, error) {
-	url, err := url.JoinPath(s.baseURL, PackageCreatePath)
-	if err != nil {
-		return nil, err
-	}
+	return s.CreateContext(context.Background(), req)
+}
 
-	resp, err := http2.PostJSON(url, http2.RequestParam{
+func (s *PackageService) CreateContext(ctx context.Context, req PackageCreate) (*PackageCreateResp, error) {
+	return requestJSON[PackageCreateResp](ctx, s.Client, false, PackageCreatePath, http2.PostJSON, http2.RequestParam{
 		Body: req,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	codeResp, err := ParseJSONResponse[response[PackageCreateResp]](resp)
-	if err != nil {
-		return nil, err
-	}
-
-	if codeResp.Code == errorcode.OK {
-		return &codeResp.Data, nil
-	}
-
-	return nil, codeResp.ToError()
 }
 
 const PackageCreateLoadPath = "/package/createLoad"
@@ -147,6 +101,11 @@ type PackageCreateLoadResp struct {
 }
 
 func (c *PackageService) CreateLoad(req PackageCreateLoad) (*PackageCreateLoadResp, error) {
+	return c.CreateLoadContext(context.Background(), req)
+}
+
+// 创建Package并上传文件。请求不会重试，也不受Config.Timeout限制
+func (c *PackageService) CreateLoadContext(ctx context.Context, req PackageCreateLoad) (*PackageCreateLoadResp, error) {
 	url, err := url.JoinPath(c.baseURL, PackageCreateLoadPath)
 	if err != nil {
 		return nil, err
@@ -166,21 +125,15 @@ func (c *PackageService) CreateLoad(req PackageCreateLoad) (*PackageCreateLoadRe
 				File:      src.File,
 			}, nil
 		}),
+		Context: ctx,
+		Client:  c.httpCli,
 	})
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 
-	codeResp, err := ParseJSONResponse[response[PackageCreateLoadResp]](resp)
-	if err != nil {
-		return nil, err
-	}
-
-	if codeResp.Code == errorcode.OK {
-		return &codeResp.Data, nil
-	}
-
-	return nil, codeResp.ToError()
+	return parseCodeResponse[PackageCreateLoadResp](resp)
 }
 
 const PackageDeletePath = "/package/delete"
@@ -191,34 +144,14 @@ type PackageDelete struct {
 }
 
 func (c *PackageService) Delete(req PackageDelete) error {
-	url, err := url.JoinPath(c.baseURL, PackageDeletePath)
-	if err != nil {
-		return err
-	}
+	return c.DeleteContext(context.Background(), req)
+}
 
-	resp, err := http2.PostJSON(url, http2.RequestParam{
+func (c *PackageService) DeleteContext(ctx context.Context, req PackageDelete) error {
+	_, err := requestJSON[any](ctx, c.Client, false, PackageDeletePath, http2.PostJSON, http2.RequestParam{
 		Body: req,
 	})
-	if err != nil {
-		return err
-	}
-
-	contType := resp.Header.Get("Content-Type")
-
-	if strings.Contains(contType, http2.ContentTypeJSON) {
-		var codeResp response[any]
-		if err := serder.JSONToObjectStream(resp.Body, &codeResp); err != nil {
-			return fmt.Errorf("parsing response: %w", err)
-		}
-
-		if codeResp.Code == errorcode.OK {
-			return nil
-		}
-
-		return codeResp.ToError()
-	}
-
-	return fmt.Errorf("unknow response content type: %s", contType)
+	return err
 }
 
 const PackageClonePath = "/package/clone"
@@ -235,28 +168,13 @@ type PackageCloneResp struct {
 }
 
 func (c *PackageService) Clone(req PackageClone) (*PackageCloneResp, error) {
-	url, err := url.JoinPath(c.baseURL, PackageClonePath)
-	if err != nil {
-		return nil, err
-	}
+	return c.CloneContext(context.Background(), req)
+}
 
-	resp, err := http2.PostJSON(url, http2.RequestParam{
+func (c *PackageService) CloneContext(ctx context.Context, req PackageClone) (*PackageCloneResp, error) {
+	return requestJSON[PackageCloneResp](ctx, c.Client, false, PackageClonePath, http2.PostJSON, http2.RequestParam{
 		Body: req,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	codeResp, err := ParseJSONResponse[response[PackageCloneResp]](resp)
-	if err != nil {
-		return nil, err
-	}
-
-	if codeResp.Code == errorcode.OK {
-		return &codeResp.Data, nil
-	}
-
-	return nil, codeResp.ToError()
 }
 
 const PackageListBucketPackagesPath = "/package/listBucketPackages"
@@ -271,28 +189,13 @@ type PackageListBucketPackagesResp struct {
 }
 
 func (c *PackageService) ListBucketPackages(req PackageListBucketPackages) (*PackageListBucketPackagesResp, error) {
-	url, err := url.JoinPath(c.baseURL, PackageListBucketPackagesPath)
-	if err != nil {
-		return nil, err
-	}
+	return c.ListBucketPackagesContext(context.Background(), req)
+}
 
-	resp, err := http2.GetForm(url, http2.RequestParam{
+func (c *PackageService) ListBucketPackagesContext(ctx context.Context, req PackageListBucketPackages) (*PackageListBucketPackagesResp, error) {
+	return requestJSON[PackageListBucketPackagesResp](ctx, c.Client, true, PackageListBucketPackagesPath, http2.GetForm, http2.RequestParam{
 		Query: req,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	codeResp, err := ParseJSONResponse[response[PackageListBucketPackagesResp]](resp)
-	if err != nil {
-		return nil, err
-	}
-
-	if codeResp.Code == errorcode.OK {
-		return &codeResp.Data, nil
-	}
-
-	return nil, codeResp.ToError()
 }
 
 const PackageGetCachedStoragesPath = "/package/getCachedStorages"
@@ -307,25 +210,11 @@ type PackageGetCachedStoragesResp struct {
 }
 
 func (c *PackageService) GetCachedStorages(req PackageGetCachedStoragesReq) (*PackageGetCachedStoragesResp, error) {
-	url, err := url.JoinPath(c.baseURL, PackageGetCachedStoragesPath)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := http2.GetJSON(url, http2.RequestParam{
+	return c.GetCachedStoragesContext(context.Background(), req)
+}
+
+func (c *PackageService) GetCachedStoragesContext(ctx context.Context, req PackageGetCachedStoragesReq) (*PackageGetCachedStoragesResp, error) {
+	return requestJSON[PackageGetCachedStoragesResp](ctx, c.Client, true, PackageGetCachedStoragesPath, http2.GetJSON, http2.RequestParam{
 		Query: req,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	codeResp, err := ParseJSONResponse[response[PackageGetCachedStoragesResp]](resp)
-	if err != nil {
-		return nil, err
-	}
-
-	if codeResp.Code == errorcode.OK {
-		return &codeResp.Data, nil
-	}
-
-	return nil, codeResp.ToError()
 }
@@ -0,0 +1,160 @@
+package cdsapi
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"gitlink.org.cn/cloudream/common/pkgs/iterator"
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+)
+
+type PackageExportTar struct {
+	UserID    cdssdk.UserID
+	PackageID cdssdk.PackageID
+}
+
+func (c *PackageService) ExportTar(req PackageExportTar, w io.Writer) error {
+	return c.ExportTarContext(context.Background(), req, w)
+}
+
+// 将Package中的所有对象按路径顺序写成tar流，文件的修改时间为对象的UpdateTime。
+// 对象是逐个下载并直接写入w的，不会缓存整个对象。
+func (c *PackageService) ExportTarContext(ctx context.Context, req PackageExportTar, w io.Writer) error {
+	resp, err := c.Object().GetPackageObjectsContext(ctx, ObjectGetPackageObjects{
+		UserID:    req.UserID,
+		PackageID: req.PackageID,
+	})
+	if err != nil {
+		return fmt.Errorf("getting package objects: %w", err)
+	}
+
+	objs := resp.Objects
+	sort.Slice(objs, func(i, j int) bool { return objs[i].Path < objs[j].Path })
+
+	tw := tar.NewWriter(w)
+	for _, obj := range objs {
+		err := c.exportObject(ctx, req.UserID, obj, tw)
+		if err != nil {
+			return fmt.Errorf("exporting object %v: %w", obj.Path, err)
+		}
+	}
+
+	return tw.Close()
+}
+
+func (c *PackageService) exportObject(ctx context.Context, userID cdssdk.UserID, obj cdssdk.Object, tw *tar.Writer) error {
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     obj.Path,
+		Size:     obj.Size,
+		Mode:     0644,
+		ModTime:  obj.UpdateTime,
+		Format:   tar.FormatPAX,
+	})
+	if err != nil {
+		return err
+	}
+
+	down, err := c.Object().DownloadContext(ctx, ObjectDownload{
+		UserID:   userID,
+		ObjectID: obj.ObjectID,
+	})
+	if err != nil {
+		return err
+	}
+	defer down.File.Close()
+
+	var rd io.Reader = down.File
+	hasher := newObjectHasher(obj, DownloadOption{})
+	if hasher != nil {
+		rd = hasher.WrapReader(rd)
+	}
+
+	// 数据比对象大小多时tar.Writer会返回错误
+	n, err := io.Copy(tw, rd)
+	if err != nil {
+		return err
+	}
+	if n != obj.Size {
+		return fmt.Errorf("object size is %v, but only %v bytes downloaded", obj.Size, n)
+	}
+
+	if hasher != nil {
+		actual := hasher.Sum()
+		if actual != obj.FileHash {
+			return &cdssdk.HashMismatchError{Expected: obj.FileHash, Actual: actual}
+		}
+	}
+
+	return nil
+}
+
+type PackageImportTar struct {
+	UserID    cdssdk.UserID
+	PackageID cdssdk.PackageID
+	Affinity  cdssdk.StorageID
+}
+
+func (c *PackageService) ImportTar(req PackageImportTar, r io.Reader) (*ObjectUploadResp, error) {
+	return c.ImportTarContext(context.Background(), req, r)
+}
+
+// 将tar流中的所有普通文件上传到Package中，文件在tar中的路径即为对象路径，目录等其他类型的条目会被忽略。
+// 每个文件的数据直接从r中读取后上传，不会缓存整个文件。
+func (c *PackageService) ImportTarContext(ctx context.Context, req PackageImportTar, r io.Reader) (*ObjectUploadResp, error) {
+	return c.Object().UploadContext(ctx, ObjectUpload{
+		ObjectUploadInfo: ObjectUploadInfo{
+			UserID:    req.UserID,
+			PackageID: req.PackageID,
+			Affinity:  req.Affinity,
+		},
+		Files: &tarObjectIterator{tr: tar.NewReader(r)},
+	})
+}
+
+// 依次返回tar中的文件。返回的文件必须在下一次调用MoveNext之前读取完毕
+type tarObjectIterator struct {
+	tr *tar.Reader
+}
+
+func (i *tarObjectIterator) MoveNext() (*UploadingObject, error) {
+	for {
+		hdr, err := i.tr.Next()
+		if err == io.EOF {
+			return nil, iterator.ErrNoMoreItem
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading tar: %w", err)
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		objPath, err := tarEntryPath(hdr.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		return &UploadingObject{
+			Path: objPath,
+			File: io.NopCloser(i.tr),
+		}, nil
+	}
+}
+
+func (i *tarObjectIterator) Close() {}
+
+func tarEntryPath(name string) (string, error) {
+	p := path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+	p = strings.TrimPrefix(p, "/")
+	if p == "" || p == "." {
+		return "", fmt.Errorf("invalid tar entry name: %v", name)
+	}
+	return p, nil
+}
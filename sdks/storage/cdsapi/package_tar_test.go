@@ -0,0 +1,116 @@
+package cdsapi
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+)
+
+func newTarServer(files map[string]string, uploaded map[string]string) *httptest.Server {
+	var paths []string
+	for p := range files {
+		paths = append(paths, p)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(ObjectGetPackageObjectsPath, func(w http.ResponseWriter, r *http.Request) {
+		var objs []string
+		for i, p := range paths {
+			sum := sha256.Sum256([]byte(files[p]))
+			objs = append(objs, fmt.Sprintf(`{"objectID":%d,"packageID":1,"path":"%s","size":"%d","fileHash":"%s","updateTime":"2024-01-02T03:04:05Z"}`,
+				i+1, p, len(files[p]), cdssdk.NewFullHash(sum[:])))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"code":"OK","data":{"objects":[%s]}}`, strings.Join(objs, ","))
+	})
+	mux.HandleFunc(ObjectDownloadPath, func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(r.URL.Query().Get("objectID"))
+		p := paths[id-1]
+		w.Header().Set("Content-Disposition", "attachment; filename="+url.PathEscape(p))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		io.WriteString(w, files[p])
+	})
+	mux.HandleFunc(ObjectUploadPath, func(w http.ResponseWriter, r *http.Request) {
+		mr, _ := r.MultipartReader()
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+			if part.FormName() == "files" {
+				name, _ := url.PathUnescape(part.FileName())
+				data, _ := io.ReadAll(part)
+				uploaded[name] += string(data)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"code":"OK","data":{"uploadeds":[]}}`)
+	})
+	return httptest.NewServer(mux)
+}
+
+func Test_PackageTar(t *testing.T) {
+	Convey("导出后再导入", t, func() {
+		files := map[string]string{
+			"a.txt":       "hello",
+			"dir/b.txt":   "world",
+			"dir/c/empty": "",
+		}
+		uploaded := make(map[string]string)
+		svr := newTarServer(files, uploaded)
+		defer svr.Close()
+
+		cli := NewClient(&Config{URL: svr.URL})
+
+		buf := bytes.NewBuffer(nil)
+		err := cli.Package().ExportTar(PackageExportTar{UserID: 1, PackageID: 1}, buf)
+		So(err, ShouldBeNil)
+
+		tr := tar.NewReader(bytes.NewReader(buf.Bytes()))
+		var names []string
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			So(err, ShouldBeNil)
+			So(hdr.ModTime.UTC(), ShouldEqual, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+			names = append(names, hdr.Name)
+		}
+		So(names, ShouldResemble, []string{"a.txt", "dir/b.txt", "dir/c/empty"})
+
+		_, err = cli.Package().ImportTar(PackageImportTar{UserID: 1, PackageID: 2}, buf)
+		So(err, ShouldBeNil)
+		So(uploaded, ShouldResemble, files)
+	})
+
+	Convey("导入时忽略目录并规范化路径", t, func() {
+		uploaded := make(map[string]string)
+		svr := newTarServer(nil, uploaded)
+		defer svr.Close()
+
+		buf := bytes.NewBuffer(nil)
+		tw := tar.NewWriter(buf)
+		tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "./dir/", Mode: 0755})
+		tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "./dir/../../x.txt", Size: 1, Mode: 0644})
+		tw.Write([]byte("x"))
+		tw.Close()
+
+		cli := NewClient(&Config{URL: svr.URL})
+		_, err := cli.Package().ImportTar(PackageImportTar{UserID: 1, PackageID: 2}, buf)
+		So(err, ShouldBeNil)
+		So(uploaded, ShouldResemble, map[string]string{"x.txt": "x"})
+	})
+}
@@ -0,0 +1,63 @@
+package cdsapi
+
+import (
+	"time"
+
+	"gitlink.org.cn/cloudream/common/sdks"
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+)
+
+// 对象操作的前提条件，用于实现乐观并发控制。条件不满足时服务端返回PreconditionFailed，整个请求都不会执行。
+// 所有字段都为零值时代表没有条件。
+type Precondition struct {
+	// 对象必须存在，且FileHash与之相同
+	IfMatchFileHash cdssdk.FileHash `json:"ifMatchFileHash,omitempty"`
+	// 对象必须存在，且UpdateTime与之相同
+	IfMatchUpdateTime *time.Time `json:"ifMatchUpdateTime,omitempty"`
+	// 对象必须不存在，用于只创建不覆盖的场景。不能与IfMatch条件同时使用
+	IfNoneMatch bool `json:"ifNoneMatch,omitempty"`
+}
+
+// 检查对象是否满足条件，obj为nil代表对象不存在
+func (p *Precondition) Check(obj *cdssdk.Object) bool {
+	if p == nil {
+		return true
+	}
+
+	if p.IfNoneMatch && obj != nil {
+		return false
+	}
+
+	if p.IfMatchFileHash != "" && (obj == nil || obj.FileHash != p.IfMatchFileHash) {
+		return false
+	}
+
+	if p.IfMatchUpdateTime != nil && (obj == nil || !obj.UpdateTime.Equal(*p.IfMatchUpdateTime)) {
+		return false
+	}
+
+	return true
+}
+
+// 要求对象的FileHash和UpdateTime都与obj相同
+func IfMatch(obj cdssdk.Object) *Precondition {
+	t := obj.UpdateTime
+	return &Precondition{
+		IfMatchFileHash:   obj.FileHash,
+		IfMatchUpdateTime: &t,
+	}
+}
+
+// 要求对象不存在
+func IfNoneMatch() *Precondition {
+	return &Precondition{IfNoneMatch: true}
+}
+
+// 服务端返回PreconditionFailed时的错误。可以通过errors.As区分它与其他的*sdks.CodeMessageError
+type PreconditionFailedError struct {
+	*sdks.CodeMessageError
+}
+
+func (e *PreconditionFailedError) Unwrap() error {
+	return e.CodeMessageError
+}
@@ -0,0 +1,94 @@
+package cdsapi
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlink.org.cn/cloudream/common/pkgs/iterator"
+	"gitlink.org.cn/cloudream/common/sdks"
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+)
+
+func Test_Precondition(t *testing.T) {
+	Convey("条件操作", t, func() {
+		svr := newTestFakeServer()
+		defer svr.Close()
+		cli := NewClient(svr.Config())
+
+		pkg, err := cli.Package().Create(PackageCreate{UserID: 1, BucketID: 1, Name: "pkg"})
+		So(err, ShouldBeNil)
+		pkgID := pkg.Package.PackageID
+
+		upload := func(path string, data string, pre *Precondition) (*ObjectUploadResp, error) {
+			return cli.Object().Upload(ObjectUpload{
+				ObjectUploadInfo: ObjectUploadInfo{UserID: 1, PackageID: pkgID, Precondition: pre},
+				Files:            iterator.Array(&UploadingObject{Path: path, File: io.NopCloser(bytes.NewBufferString(data))}),
+			})
+		}
+
+		isPreconditionFailed := func(err error) bool {
+			var preErr *PreconditionFailedError
+			return errors.As(err, &preErr)
+		}
+
+		up, err := upload("a.txt", "v1", IfNoneMatch())
+		So(err, ShouldBeNil)
+		v1 := up.Uploadeds[0]
+
+		_, err = upload("a.txt", "v2", IfNoneMatch())
+		So(isPreconditionFailed(err), ShouldBeTrue)
+
+		// 仍然可以作为普通的CodeMessageError处理
+		var codeErr *sdks.CodeMessageError
+		So(errors.As(err, &codeErr), ShouldBeTrue)
+
+		up, err = upload("a.txt", "v2", &Precondition{IfMatchFileHash: v1.FileHash})
+		So(err, ShouldBeNil)
+		v2 := up.Uploadeds[0]
+		So(v2.ObjectID, ShouldEqual, v1.ObjectID)
+
+		// 使用旧版本的FileHash时其他操作都会失败
+		stale := IfMatch(v1)
+
+		_, err = cli.Object().UpdateInfo(ObjectUpdateInfo{
+			UserID:    1,
+			Updatings: []UpdatingObject{{ObjectID: v1.ObjectID, UpdateTime: time.Now(), Precondition: stale}},
+		})
+		So(isPreconditionFailed(err), ShouldBeTrue)
+
+		_, err = cli.Object().Move(ObjectMove{
+			UserID:  1,
+			Movings: []MovingObject{{ObjectID: v1.ObjectID, PackageID: pkgID, Path: "b.txt", Precondition: stale}},
+		})
+		So(isPreconditionFailed(err), ShouldBeTrue)
+
+		err = cli.Object().Delete(ObjectDelete{
+			UserID:        1,
+			ObjectIDs:     []cdssdk.ObjectID{v1.ObjectID},
+			Preconditions: []*Precondition{stale},
+		})
+		So(isPreconditionFailed(err), ShouldBeTrue)
+
+		data, ok := svr.ObjectData(v1.ObjectID)
+		So(ok, ShouldBeTrue)
+		So(string(data), ShouldEqual, "v2")
+
+		// 目标位置已有对象时不移动
+		_, err = upload("c.txt", "c", nil)
+		So(err, ShouldBeNil)
+		_, err = cli.Object().Move(ObjectMove{
+			UserID:  1,
+			Movings: []MovingObject{{ObjectID: v2.ObjectID, PackageID: pkgID, Path: "c.txt", DestPrecondition: IfNoneMatch()}},
+		})
+		So(isPreconditionFailed(err), ShouldBeTrue)
+
+		err = cli.Object().DeleteByPath(ObjectDeleteByPath{UserID: 1, PackageID: pkgID, Path: "a.txt", Precondition: IfMatch(v2)})
+		So(err, ShouldBeNil)
+		_, ok = svr.ObjectData(v2.ObjectID)
+		So(ok, ShouldBeFalse)
+	})
+}
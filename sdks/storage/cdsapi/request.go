@@ -0,0 +1,179 @@
+package cdsapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gitlink.org.cn/cloudream/common/consts/errorcode"
+	"gitlink.org.cn/cloudream/common/sdks"
+	"gitlink.org.cn/cloudream/common/utils/http2"
+	"gitlink.org.cn/cloudream/common/utils/io2"
+)
+
+const (
+	defaultRetryInterval    = 500 * time.Millisecond
+	defaultMaxRetryInterval = 10 * time.Second
+)
+
+type sendFunc func(url string, param http2.RequestParam) (*http.Response, error)
+
+// 发送一个返回JSON的请求，并解析响应中的数据
+func requestJSON[T any](ctx context.Context, c *Client, idempotent bool, path string, send sendFunc, param http2.RequestParam) (*T, error) {
+	return doRequestJSON[T](ctx, c, idempotent, true, path, send, param)
+}
+
+// 与requestJSON相同，但不受Config.Timeout限制，用于服务端需要等待较长时间才会返回的请求，只能通过ctx控制
+func requestJSONNoTimeout[T any](ctx context.Context, c *Client, idempotent bool, path string, send sendFunc, param http2.RequestParam) (*T, error) {
+	return doRequestJSON[T](ctx, c, idempotent, false, path, send, param)
+}
+
+func doRequestJSON[T any](ctx context.Context, c *Client, idempotent bool, timeout bool, path string, send sendFunc, param http2.RequestParam) (*T, error) {
+	targetURL, err := url.JoinPath(c.baseURL, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret *T
+	err = c.withRetry(ctx, idempotent, func(ctx context.Context) error {
+		var cancel context.CancelFunc
+		if timeout {
+			ctx, cancel = c.withTimeout(ctx)
+		} else {
+			ctx, cancel = context.WithCancel(ctx)
+		}
+		defer cancel()
+
+		param.Context = ctx
+		param.Client = c.httpCli
+		resp, err := send(targetURL, param)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		ret, err = parseCodeResponse[T](resp)
+		return err
+	})
+	return ret, err
+}
+
+// 发送一个返回数据流的请求，成功时返回的响应体需要由调用者关闭。
+// 如果服务端返回的是JSON，则会被当做错误信息解析。
+func requestStream(ctx context.Context, c *Client, idempotent bool, path string, send sendFunc, param http2.RequestParam) (*http.Response, error) {
+	targetURL, err := url.JoinPath(c.baseURL, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret *http.Response
+	err = c.withRetry(ctx, idempotent, func(ctx context.Context) error {
+		ctx, cancel := context.WithCancel(ctx)
+
+		// 超时时间只限制收到响应头之前的时间，之后的数据读取由调用者控制
+		var timer *time.Timer
+		if c.cfg.Timeout > 0 {
+			timer = time.AfterFunc(c.cfg.Timeout, cancel)
+		}
+
+		param.Context = ctx
+		param.Client = c.httpCli
+		resp, err := send(targetURL, param)
+		if timer != nil && !timer.Stop() {
+			if err == nil {
+				resp.Body.Close()
+			}
+			cancel()
+			return fmt.Errorf("waiting for response: %w", context.DeadlineExceeded)
+		}
+		if err != nil {
+			cancel()
+			return err
+		}
+
+		if strings.Contains(resp.Header.Get("Content-Type"), http2.ContentTypeJSON) || resp.StatusCode >= 500 {
+			defer cancel()
+			defer resp.Body.Close()
+
+			codeResp, err := ParseJSONResponse[response[any]](resp)
+			if err != nil {
+				return err
+			}
+			return codeResp.ToError()
+		}
+
+		body := resp.Body
+		resp.Body = io2.DelegateReadCloser(body, func() error {
+			err := body.Close()
+			cancel()
+			return err
+		})
+		ret = resp
+		return nil
+	})
+	return ret, err
+}
+
+func parseCodeResponse[T any](resp *http.Response) (*T, error) {
+	codeResp, err := ParseJSONResponse[response[T]](resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if codeResp.Code == errorcode.OK {
+		return &codeResp.Data, nil
+	}
+
+	return nil, codeResp.ToError()
+}
+
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.cfg.Timeout > 0 {
+		return context.WithTimeout(ctx, c.cfg.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// 执行fn，如果失败且接口是幂等的，则按配置等待一段时间后重试。服务端返回的业务错误不会重试
+func (c *Client) withRetry(ctx context.Context, idempotent bool, fn func(ctx context.Context) error) error {
+	maxRetries := 0
+	if idempotent {
+		maxRetries = c.cfg.MaxRetries
+	}
+
+	interval := c.cfg.RetryInterval
+	if interval <= 0 {
+		interval = defaultRetryInterval
+	}
+	maxInterval := c.cfg.MaxRetryInterval
+	if maxInterval <= 0 {
+		maxInterval = defaultMaxRetryInterval
+	}
+
+	for i := 0; ; i++ {
+		err := fn(ctx)
+		if err == nil || i >= maxRetries || !isRetryable(err) || ctx.Err() != nil {
+			return err
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return err
+		}
+
+		interval *= 2
+		if interval > maxInterval {
+			interval = maxInterval
+		}
+	}
+}
+
+func isRetryable(err error) bool {
+	var codeErr *sdks.CodeMessageError
+	return !errors.As(err, &codeErr)
+}
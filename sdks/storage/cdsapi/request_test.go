@@ -0,0 +1,143 @@
+package cdsapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlink.org.cn/cloudream/common/pkgs/ioswitch/exec"
+	"gitlink.org.cn/cloudream/common/sdks"
+)
+
+type countingTransport struct {
+	cnt atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.cnt.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func Test_Request(t *testing.T) {
+	Convey("幂等接口失败后重试", t, func() {
+		var cnt atomic.Int32
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cnt.Add(1) < 3 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"code":"OK","data":{"packages":[{"packageID":1,"name":"pkg"}]}}`)
+		}))
+		defer svr.Close()
+
+		cli := NewClient(&Config{URL: svr.URL, MaxRetries: 3, RetryInterval: time.Millisecond})
+		resp, err := cli.Package().ListBucketPackages(PackageListBucketPackages{UserID: 1, BucketID: 1})
+		So(err, ShouldBeNil)
+		So(resp.Packages, ShouldHaveLength, 1)
+		So(resp.Packages[0].Name, ShouldEqual, "pkg")
+		So(cnt.Load(), ShouldEqual, 3)
+	})
+
+	Convey("非幂等接口和业务错误不重试", t, func() {
+		var cnt atomic.Int32
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cnt.Add(1)
+			if r.URL.Path == PackageCreatePath {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"code":"DataNotFound","message":"not found"}`)
+		}))
+		defer svr.Close()
+
+		cli := NewClient(&Config{URL: svr.URL, MaxRetries: 3, RetryInterval: time.Millisecond})
+		_, err := cli.Package().Create(PackageCreate{UserID: 1, BucketID: 1, Name: "pkg"})
+		So(err, ShouldNotBeNil)
+		So(cnt.Load(), ShouldEqual, 1)
+
+		_, err = cli.Package().Get(PackageGetReq{UserID: 1, PackageID: 1})
+		var codeErr *sdks.CodeMessageError
+		So(errors.As(err, &codeErr), ShouldBeTrue)
+		So(codeErr.Code, ShouldEqual, "DataNotFound")
+		So(cnt.Load(), ShouldEqual, 2)
+	})
+
+	Convey("请求超时", t, func() {
+		stop := make(chan struct{})
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-stop:
+			case <-r.Context().Done():
+			}
+		}))
+		defer svr.Close()
+		defer close(stop)
+
+		cli := NewClient(&Config{URL: svr.URL, Timeout: 50 * time.Millisecond})
+		start := time.Now()
+		_, err := cli.Object().Download(ObjectDownload{UserID: 1, ObjectID: 1})
+		So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+		So(time.Since(start), ShouldBeLessThan, time.Second)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		cli = NewClient(&Config{URL: svr.URL, MaxRetries: 10})
+		_, err = cli.Bucket().GetByNameContext(ctx, BucketGetByName{UserID: 1, Name: "bkt"})
+		So(err, ShouldNotBeNil)
+		So(time.Since(start), ShouldBeLessThan, time.Second)
+	})
+
+	Convey("等待计划执行的接口不受超时限制", t, func() {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"code":"OK","data":{}}`)
+		}))
+		defer svr.Close()
+
+		cli := NewClient(&Config{URL: svr.URL, Timeout: 50 * time.Millisecond})
+		err := cli.ExecuteIOPlan(ExecuteIOPlanReq{Plan: exec.Plan{ID: "plan"}})
+		So(err, ShouldBeNil)
+
+		_, err = cli.GetVar(GetVarReq{PlanID: "plan", VarID: 1, SignalID: 2, Signal: &exec.SignalValue{}})
+		So(err, ShouldBeNil)
+
+		// 仍然可以通过ctx控制
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err = cli.ExecuteIOPlanContext(ctx, ExecuteIOPlanReq{Plan: exec.Plan{ID: "plan"}})
+		So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+	})
+
+	Convey("超时只限制下载的响应头", t, func() {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Disposition", `attachment; filename="a.txt"`)
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+			io.WriteString(w, "hello")
+		}))
+		defer svr.Close()
+
+		trans := &countingTransport{}
+		cli := NewClient(&Config{URL: svr.URL, Timeout: 50 * time.Millisecond, Transport: trans})
+		obj, err := cli.Object().Download(ObjectDownload{UserID: 1, ObjectID: 1})
+		So(err, ShouldBeNil)
+		defer obj.File.Close()
+
+		So(obj.Path, ShouldEqual, "a.txt")
+		data, err := io.ReadAll(obj.File)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, "hello")
+		So(trans.cnt.Load(), ShouldEqual, 1)
+	})
+}
@@ -1,14 +1,10 @@
 package cdsapi
 
 import (
-	"fmt"
-	"net/url"
-	"strings"
+	"context"
 
-	"gitlink.org.cn/cloudream/common/consts/errorcode"
 	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
 	"gitlink.org.cn/cloudream/common/utils/http2"
-	"gitlink.org.cn/cloudream/common/utils/serder"
 )
 
 const StorageLoadPackagePath = "/storage/loadPackage"
@@ -22,28 +18,13 @@ type StorageLoadPackageReq struct {
 type StorageLoadPackageResp struct{}
 
 func (c *Client) StorageLoadPackage(req StorageLoadPackageReq) (*StorageLoadPackageResp, error) {
-	url, err := url.JoinPath(c.baseURL, StorageLoadPackagePath)
-	if err != nil {
-		return nil, err
-	}
+	return c.StorageLoadPackageContext(context.Background(), req)
+}
 
-	resp, err := http2.PostJSON(url, http2.RequestParam{
+func (c *Client) StorageLoadPackageContext(ctx context.Context, req StorageLoadPackageReq) (*StorageLoadPackageResp, error) {
+	return requestJSON[StorageLoadPackageResp](ctx, c, false, StorageLoadPackagePath, http2.PostJSON, http2.RequestParam{
 		Body: req,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	codeResp, err := ParseJSONResponse[response[StorageLoadPackageResp]](resp)
-	if err != nil {
-		return nil, err
-	}
-
-	if codeResp.Code == errorcode.OK {
-		return &codeResp.Data, nil
-	}
-
-	return nil, codeResp.ToError()
 }
 
 const StorageCreatePackagePath = "/storage/createPackage"
@@ -62,33 +43,13 @@ type StorageCreatePackageResp struct {
 }
 
 func (c *Client) StorageCreatePackage(req StorageCreatePackageReq) (*StorageCreatePackageResp, error) {
-	url, err := url.JoinPath(c.baseURL, StorageCreatePackagePath)
-	if err != nil {
-		return nil, err
-	}
+	return c.StorageCreatePackageContext(context.Background(), req)
+}
 
-	resp, err := http2.PostJSON(url, http2.RequestParam{
+func (c *Client) StorageCreatePackageContext(ctx context.Context, req StorageCreatePackageReq) (*StorageCreatePackageResp, error) {
+	return requestJSON[StorageCreatePackageResp](ctx, c, false, StorageCreatePackagePath, http2.PostJSON, http2.RequestParam{
 		Body: req,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	contType := resp.Header.Get("Content-Type")
-	if strings.Contains(contType, http2.ContentTypeJSON) {
-		var codeResp response[StorageCreatePackageResp]
-		if err := serder.JSONToObjectStream(resp.Body, &codeResp); err != nil {
-			return nil, fmt.Errorf("parsing response: %w", err)
-		}
-
-		if codeResp.Code == errorcode.OK {
-			return &codeResp.Data, nil
-		}
-
-		return nil, codeResp.ToError()
-	}
-
-	return nil, fmt.Errorf("unknow response content type: %s", contType)
 }
 
 const StorageGetPath = "/storage/get"
@@ -102,26 +63,11 @@ type StorageGetResp struct {
 }
 
 func (c *Client) StorageGet(req StorageGet) (*StorageGetResp, error) {
-	url, err := url.JoinPath(c.baseURL, StorageGetPath)
-	if err != nil {
-		return nil, err
-	}
+	return c.StorageGetContext(context.Background(), req)
+}
 
-	resp, err := http2.GetForm(url, http2.RequestParam{
+func (c *Client) StorageGetContext(ctx context.Context, req StorageGet) (*StorageGetResp, error) {
+	return requestJSON[StorageGetResp](ctx, c, true, StorageGetPath, http2.GetForm, http2.RequestParam{
 		Query: req,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	codeResp, err := ParseJSONResponse[response[StorageGetResp]](resp)
-	if err != nil {
-		return nil, err
-	}
-
-	if codeResp.Code == errorcode.OK {
-		return &codeResp.Data, nil
-	}
-
-	return nil, codeResp.ToError()
 }
@@ -2,7 +2,6 @@ package cdsapi
 
 import (
 	"bytes"
-	"fmt"
 	"io"
 	"testing"
 
@@ -12,11 +11,20 @@ import (
 	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
 )
 
+// 预置了用户1的Bucket 1以及Storage 1、2
+func newTestFakeServer() *FakeServer {
+	svr := NewFakeServer()
+	svr.AddBucket(cdssdk.Bucket{BucketID: 1, Name: "test", CreatorID: 1})
+	svr.AddStorage(cdssdk.Storage{StorageID: 1, Name: "stg1"})
+	svr.AddStorage(cdssdk.Storage{StorageID: 2, Name: "stg2"})
+	return svr
+}
+
 func Test_PackageGet(t *testing.T) {
 	Convey("上传后获取Package信息", t, func() {
-		cli := NewClient(&Config{
-			URL: "http://localhost:7890",
-		})
+		svr := newTestFakeServer()
+		defer svr.Close()
+		cli := NewClient(svr.Config())
 
 		fileData := make([]byte, 4096)
 		for i := 0; i < len(fileData); i++ {
@@ -68,9 +76,9 @@ func Test_PackageGet(t *testing.T) {
 
 func Test_Object(t *testing.T) {
 	Convey("上传，下载，删除", t, func() {
-		cli := NewClient(&Config{
-			URL: "http://localhost:7890",
-		})
+		svr := newTestFakeServer()
+		defer svr.Close()
+		cli := NewClient(svr.Config())
 
 		fileData := make([]byte, 4096)
 		for i := 0; i < len(fileData); i++ {
@@ -87,7 +95,7 @@ func Test_Object(t *testing.T) {
 		})
 		So(err, ShouldBeNil)
 
-		_, err = cli.Object().Upload(ObjectUpload{
+		upResp, err := cli.Object().Upload(ObjectUpload{
 			ObjectUploadInfo: ObjectUploadInfo{
 				UserID:    1,
 				PackageID: createResp.Package.PackageID,
@@ -106,16 +114,19 @@ func Test_Object(t *testing.T) {
 		})
 		So(err, ShouldBeNil)
 
-		// downFs, err := cli.ObjectDownload(ObjectDownloadReq{
-		// 	UserID:   1,
-		// 	ObjectID: upResp.ObjectID,
-		// })
-		// So(err, ShouldBeNil)
-		//
-		// downFileData, err := io.ReadAll(downFs)
-		// So(err, ShouldBeNil)
-		// So(downFileData, ShouldResemble, fileData)
-		// downFs.Close()
+		So(upResp.Uploadeds, ShouldHaveLength, 2)
+
+		downFs, err := cli.Object().Download(ObjectDownload{
+			UserID:   1,
+			ObjectID: upResp.Uploadeds[0].ObjectID,
+		})
+		So(err, ShouldBeNil)
+		So(downFs.Path, ShouldEqual, "test")
+
+		downFileData, err := io.ReadAll(downFs.File)
+		So(err, ShouldBeNil)
+		So(downFileData, ShouldResemble, fileData)
+		downFs.File.Close()
 
 		err = cli.Package().Delete(PackageDelete{
 			UserID:    1,
@@ -127,26 +138,60 @@ func Test_Object(t *testing.T) {
 
 func Test_ObjectList(t *testing.T) {
 	Convey("路径查询", t, func() {
-		cli := NewClient(&Config{
-			URL: "http://localhost:7890",
+		svr := newTestFakeServer()
+		defer svr.Close()
+		cli := NewClient(svr.Config())
+
+		createResp, err := cli.Package().Create(PackageCreate{
+			UserID:   1,
+			BucketID: 1,
+			Name:     uuid.NewString(),
+		})
+		So(err, ShouldBeNil)
+
+		_, err = cli.Object().Upload(ObjectUpload{
+			ObjectUploadInfo: ObjectUploadInfo{
+				UserID:    1,
+				PackageID: createResp.Package.PackageID,
+			},
+			Files: iterator.Array(
+				&UploadingObject{
+					Path: "100x100K/zexema",
+					File: io.NopCloser(bytes.NewBufferString("zexema")),
+				},
+				&UploadingObject{
+					Path: "100x100K/zexema2",
+					File: io.NopCloser(bytes.NewBufferString("zexema2")),
+				},
+			),
 		})
+		So(err, ShouldBeNil)
 
 		resp, err := cli.Object().List(ObjectList{
 			UserID:    1,
-			PackageID: 10,
+			PackageID: createResp.Package.PackageID,
 			Path:      "100x100K/zexema",
 		})
 		So(err, ShouldBeNil)
-		fmt.Printf("\n")
-		fmt.Printf("%+v\n", resp.Objects[0])
+		So(resp.Objects, ShouldHaveLength, 1)
+		So(resp.Objects[0].Size, ShouldEqual, 6)
+
+		resp, err = cli.Object().List(ObjectList{
+			UserID:    1,
+			PackageID: createResp.Package.PackageID,
+			Path:      "100x100K/",
+			IsPrefix:  true,
+		})
+		So(err, ShouldBeNil)
+		So(resp.Objects, ShouldHaveLength, 2)
 	})
 }
 
 func Test_Storage(t *testing.T) {
 	Convey("上传后调度文件", t, func() {
-		cli := NewClient(&Config{
-			URL: "http://localhost:7890",
-		})
+		svr := newTestFakeServer()
+		defer svr.Close()
+		cli := NewClient(svr.Config())
 
 		fileData := make([]byte, 4096)
 		for i := 0; i < len(fileData); i++ {
@@ -196,9 +241,9 @@ func Test_Storage(t *testing.T) {
 
 func Test_Cache(t *testing.T) {
 	Convey("上传后移动文件", t, func() {
-		cli := NewClient(&Config{
-			URL: "http://localhost:7890",
-		})
+		svr := newTestFakeServer()
+		defer svr.Close()
+		cli := NewClient(svr.Config())
 
 		fileData := make([]byte, 4096)
 		for i := 0; i < len(fileData); i++ {
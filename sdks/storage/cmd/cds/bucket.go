@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+	"gitlink.org.cn/cloudream/common/sdks/storage/cdsapi"
+)
+
+// bucket ls
+func listBuckets(ctx *CommandContext) error {
+	resp, err := ctx.Client.Bucket().ListUserBucketsContext(ctx.Ctx, cdsapi.BucketListUserBucketsReq{
+		UserID: ctx.UserID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.Print(resp.Buckets, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tName")
+		for _, bkt := range resp.Buckets {
+			fmt.Fprintf(tw, "%d\t%s\n", bkt.BucketID, bkt.Name)
+		}
+		tw.Flush()
+	})
+}
+
+// bucket create <名称>
+func createBucket(ctx *CommandContext, name string) error {
+	resp, err := ctx.Client.Bucket().CreateContext(ctx.Ctx, cdsapi.BucketCreate{
+		UserID: ctx.UserID,
+		Name:   name,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.Print(resp.Bucket, func(w io.Writer) {
+		fmt.Fprintf(w, "bucket %v created, id: %d\n", resp.Bucket.Name, resp.Bucket.BucketID)
+	})
+}
+
+// bucket rm <BucketID>
+func removeBucket(ctx *CommandContext, bucketID cdssdk.BucketID) error {
+	err := ctx.Client.Bucket().DeleteContext(ctx.Ctx, cdsapi.BucketDelete{
+		UserID:   ctx.UserID,
+		BucketID: bucketID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.Print(map[string]any{"bucketID": bucketID}, func(w io.Writer) {
+		fmt.Fprintf(w, "bucket %d removed\n", bucketID)
+	})
+}
+
+func init() {
+	commands.MustAdd(listBuckets, "bucket", "ls")
+	commands.MustAdd(createBucket, "bucket", "create")
+	commands.MustAdd(removeBucket, "bucket", "rm")
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+	"gitlink.org.cn/cloudream/common/sdks/storage/cdsapi"
+)
+
+// hub list [HubID]...
+//
+// 不指定HubID时列出所有Hub
+func listHubs(ctx *CommandContext, hubIDs []cdssdk.HubID) error {
+	resp, err := ctx.Client.HubGetHubsContext(ctx.Ctx, cdsapi.HubGetHubsReq{
+		HubIDs: hubIDs,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.Print(resp.Hubs, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tName\tLocation\tState")
+		for _, hub := range resp.Hubs {
+			fmt.Fprintf(tw, "%d\t%s\t%d\t%s\n", hub.HubID, hub.Name, hub.LocationID, hub.State)
+		}
+		tw.Flush()
+	})
+}
+
+func init() {
+	commands.MustAdd(listHubs, "hub", "list")
+}
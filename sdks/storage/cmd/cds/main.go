@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"gitlink.org.cn/cloudream/common/pkgs/cmdtrie"
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+	"gitlink.org.cn/cloudream/common/sdks/storage/cdsapi"
+	"gitlink.org.cn/cloudream/common/utils/config"
+	"gitlink.org.cn/cloudream/common/utils/serder"
+)
+
+const usage = `用法: cds [-config 配置文件] [-url 地址] [-user 用户ID] [-json] <命令> [参数]
+
+命令:
+  bucket ls
+  bucket create <名称>
+  bucket rm <BucketID>
+  package ls <BucketID>
+  package create <BucketID> <名称>
+  package clone <PackageID> <BucketID> <名称>
+  package rm <PackageID>
+  object ls <PackageID> [路径前缀]
+  object get <ObjectID> <本地文件|-> [-offset 起始位置] [-length 长度]
+  object put <PackageID> <本地文件> <对象路径> [-if-none-match] [-if-match-hash FileHash]
+  object mv <ObjectID> <PackageID> <对象路径>
+  object rm <ObjectID>...
+  storage load <PackageID> <StorageID> [加载路径]
+  hub list [HubID]...
+  sync <本地目录> <PackageID> [-delete] [-dry-run] [-seg-size 分段大小]
+
+配置的优先级从高到低为：命令行参数，环境变量CDS_URL、CDS_USER_ID，配置文件。
+配置文件默认使用环境变量CDS_CONFIG指定的文件，或者~/.cds.json。
+`
+
+type Config struct {
+	URL    string        `json:"url"`
+	UserID cdssdk.UserID `json:"userID"`
+}
+
+type CommandContext struct {
+	Ctx    context.Context
+	Client *cdsapi.Client
+	UserID cdssdk.UserID
+	// 是否以JSON格式输出结果
+	JSON bool
+	Out  io.Writer
+}
+
+// 输出命令的结果。JSON模式下输出v，否则调用text输出便于阅读的格式
+func (c *CommandContext) Print(v any, text func(w io.Writer)) error {
+	if !c.JSON {
+		text(c.Out)
+		return nil
+	}
+
+	data, err := serder.ObjectToJSONEx(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(c.Out, string(data))
+	return err
+}
+
+var commands = cmdtrie.NewCommandTrie[*CommandContext, error]()
+
+func main() {
+	err := run(os.Args[1:], os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if errors.Is(err, cmdtrie.ErrCommandNotFound) {
+			fmt.Fprint(os.Stderr, usage)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("cds", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), usage) }
+	cfgPath := fs.String("config", "", "配置文件路径")
+	url := fs.String("url", "", "存储服务的地址")
+	userID := fs.Int64("user", 0, "用户ID")
+	jsonOut := fs.Bool("json", false, "以JSON格式输出结果")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(*cfgPath)
+	if err != nil {
+		return err
+	}
+	if *url != "" {
+		cfg.URL = *url
+	}
+	if *userID != 0 {
+		cfg.UserID = cdssdk.UserID(*userID)
+	}
+
+	ctx := &CommandContext{
+		Ctx:    context.Background(),
+		Client: cdsapi.NewClient(&cdsapi.Config{URL: cfg.URL}),
+		UserID: cfg.UserID,
+		JSON:   *jsonOut,
+		Out:    out,
+	}
+
+	cmdErr, err := commands.Execute(ctx, fs.Args(), cmdtrie.ExecuteOption{ReplaceEmptyArrayWithNil: true})
+	if err != nil {
+		return err
+	}
+	return cmdErr
+}
+
+// 按默认值、配置文件、环境变量的顺序加载配置，后面的会覆盖前面的
+func loadConfig(path string) (Config, error) {
+	cfg := Config{
+		URL:    "http://127.0.0.1:7890",
+		UserID: 1,
+	}
+
+	if path == "" {
+		path = os.Getenv("CDS_CONFIG")
+	}
+	if path == "" {
+		// 默认的配置文件不存在时忽略
+		home, err := os.UserHomeDir()
+		if err == nil {
+			defPath := filepath.Join(home, ".cds.json")
+			if _, err := os.Stat(defPath); err == nil {
+				path = defPath
+			}
+		}
+	}
+
+	if path != "" {
+		var fileCfg Config
+		if err := config.Load(path, &fileCfg); err != nil {
+			return cfg, fmt.Errorf("loading config %v: %w", path, err)
+		}
+		if err := config.Merge(&fileCfg, cfg); err != nil {
+			return cfg, err
+		}
+		cfg = fileCfg
+	}
+
+	if url := os.Getenv("CDS_URL"); url != "" {
+		cfg.URL = url
+	}
+	if str := os.Getenv("CDS_USER_ID"); str != "" {
+		id, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid CDS_USER_ID: %v", str)
+		}
+		cfg.UserID = cdssdk.UserID(id)
+	}
+
+	return cfg, nil
+}
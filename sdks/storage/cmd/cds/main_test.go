@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+	"gitlink.org.cn/cloudream/common/sdks/storage/cdsapi"
+	"gitlink.org.cn/cloudream/common/utils/serder"
+)
+
+func Test_Commands(t *testing.T) {
+	svr := cdsapi.NewFakeServer()
+	defer svr.Close()
+	svr.AddBucket(cdssdk.Bucket{BucketID: 1, Name: "test", CreatorID: 2})
+	svr.AddStorage(cdssdk.Storage{StorageID: 1})
+	svr.AddHub(cdssdk.Hub{HubID: 1, Name: "hub1"})
+
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "cds.json")
+	os.WriteFile(cfgPath, []byte(fmt.Sprintf(`{"url":"%s"}`, svr.URL)), 0644)
+	t.Setenv("CDS_CONFIG", cfgPath)
+	t.Setenv("CDS_URL", "")
+	t.Setenv("CDS_USER_ID", "2")
+
+	exec := func(args ...string) (string, error) {
+		buf := bytes.NewBuffer(nil)
+		err := run(args, buf)
+		return buf.String(), err
+	}
+
+	Convey("通过命令操作存储服务", t, func() {
+		out, err := exec("bucket", "ls")
+		So(err, ShouldBeNil)
+		So(out, ShouldContainSubstring, "test")
+
+		out, err = exec("-json", "package", "create", "1", "pkg")
+		So(err, ShouldBeNil)
+		var pkg cdssdk.Package
+		So(serder.JSONToObjectExRaw([]byte(out), &pkg), ShouldBeNil)
+		pkgID := fmt.Sprint(pkg.PackageID)
+
+		localPath := filepath.Join(dir, "a.txt")
+		So(os.WriteFile(localPath, []byte("hello"), 0644), ShouldBeNil)
+
+		_, err = exec("object", "put", pkgID, localPath, "dir/a.txt")
+		So(err, ShouldBeNil)
+
+		_, err = exec("object", "put", pkgID, localPath, "dir/a.txt", "-if-none-match")
+		So(err, ShouldNotBeNil)
+
+		out, err = exec("-json", "object", "ls", pkgID, "dir/")
+		So(err, ShouldBeNil)
+		var obj cdssdk.Object
+		So(serder.JSONToObjectExRaw([]byte(strings.TrimSpace(out)), &obj), ShouldBeNil)
+		So(obj.Path, ShouldEqual, "dir/a.txt")
+		objID := fmt.Sprint(obj.ObjectID)
+
+		out, err = exec("object", "get", objID, "-", "-offset", "1", "-length", "2")
+		So(err, ShouldBeNil)
+		So(out, ShouldEqual, "el")
+
+		_, err = exec("object", "mv", objID, pkgID, "b.txt")
+		So(err, ShouldBeNil)
+
+		getPath := filepath.Join(dir, "b.txt")
+		_, err = exec("object", "get", objID, getPath)
+		So(err, ShouldBeNil)
+		data, err := os.ReadFile(getPath)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, "hello")
+
+		_, err = exec("storage", "load", pkgID, "1", "load")
+		So(err, ShouldBeNil)
+		So(svr.LoadedStorages(pkg.PackageID), ShouldResemble, map[cdssdk.StorageID]string{1: "load"})
+
+		out, err = exec("-json", "hub", "list")
+		So(err, ShouldBeNil)
+		So(out, ShouldContainSubstring, "hub1")
+
+		_, err = exec("object", "rm", objID)
+		So(err, ShouldBeNil)
+		_, ok := svr.ObjectData(obj.ObjectID)
+		So(ok, ShouldBeFalse)
+
+		_, err = exec("package", "clone", pkgID, "1", "pkg2")
+		So(err, ShouldBeNil)
+		out, err = exec("package", "ls", "1")
+		So(err, ShouldBeNil)
+		So(out, ShouldContainSubstring, "pkg2")
+
+		_, err = exec("package", "rm", pkgID)
+		So(err, ShouldBeNil)
+
+		_, err = exec("-url", "http://127.0.0.1:1", "bucket", "ls")
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"gitlink.org.cn/cloudream/common/pkgs/iterator"
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+	"gitlink.org.cn/cloudream/common/sdks/storage/cdsapi"
+)
+
+// object ls <PackageID> [路径前缀]
+//
+// 对象是逐页查询并输出的，JSON模式下每行输出一个对象
+func listObjects(ctx *CommandContext, packageID cdssdk.PackageID, args []string) error {
+	prefix := ""
+	if len(args) > 0 {
+		prefix = args[0]
+	}
+
+	iter := ctx.Client.Object().ListIterator(ctx.Ctx, cdsapi.ObjectList{
+		UserID:    ctx.UserID,
+		PackageID: packageID,
+		Path:      prefix,
+		IsPrefix:  true,
+	})
+	defer iter.Close()
+
+	for {
+		obj, err := iter.MoveNext()
+		if err == iterator.ErrNoMoreItem {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = ctx.Print(obj, func(w io.Writer) {
+			fmt.Fprintf(w, "%-10d %12d  %s  %s\n", obj.ObjectID, obj.Size, obj.UpdateTime.Format("2006-01-02 15:04:05"), obj.Path)
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// object get <ObjectID> <本地文件|-> [-offset 起始位置] [-length 长度]
+//
+// 本地文件为-时输出到标准输出
+func getObject(ctx *CommandContext, objectID cdssdk.ObjectID, localPath string, args []string) error {
+	fs := flag.NewFlagSet("object get", flag.ContinueOnError)
+	offset := fs.Int64("offset", 0, "下载的起始位置")
+	length := fs.Int64("length", -1, "下载的长度，小于0时下载到对象末尾")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	req := cdsapi.ObjectDownload{
+		UserID:   ctx.UserID,
+		ObjectID: objectID,
+		Offset:   *offset,
+	}
+	if *length >= 0 {
+		req.Length = length
+	}
+
+	down, err := ctx.Client.Object().DownloadContext(ctx.Ctx, req)
+	if err != nil {
+		return err
+	}
+	defer down.File.Close()
+
+	if localPath == "-" {
+		_, err := io.Copy(ctx.Out, down.File)
+		return err
+	}
+
+	file, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	n, err := io.Copy(file, down.File)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Print(map[string]any{"path": down.Path, "localPath": localPath, "size": n}, func(w io.Writer) {
+		fmt.Fprintf(w, "%v -> %v (%d bytes)\n", down.Path, localPath, n)
+	})
+}
+
+// object put <PackageID> <本地文件> <对象路径> [-if-none-match] [-if-match-hash FileHash]
+func putObject(ctx *CommandContext, packageID cdssdk.PackageID, localPath string, objPath string, args []string) error {
+	fs := flag.NewFlagSet("object put", flag.ContinueOnError)
+	ifNoneMatch := fs.Bool("if-none-match", false, "只在对象不存在时上传")
+	ifMatchHash := fs.String("if-match-hash", "", "只在对象的FileHash与之相同时上传")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var pre *cdsapi.Precondition
+	if *ifNoneMatch || *ifMatchHash != "" {
+		pre = &cdsapi.Precondition{
+			IfNoneMatch:     *ifNoneMatch,
+			IfMatchFileHash: cdssdk.FileHash(*ifMatchHash),
+		}
+	}
+
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+
+	resp, err := ctx.Client.Object().UploadContext(ctx.Ctx, cdsapi.ObjectUpload{
+		ObjectUploadInfo: cdsapi.ObjectUploadInfo{
+			UserID:       ctx.UserID,
+			PackageID:    packageID,
+			Precondition: pre,
+		},
+		Files: iterator.Array(&cdsapi.UploadingObject{
+			Path: objPath,
+			File: file,
+		}),
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.Print(resp.Uploadeds, func(w io.Writer) {
+		for _, obj := range resp.Uploadeds {
+			fmt.Fprintf(w, "%v uploaded, id: %d, hash: %v\n", obj.Path, obj.ObjectID, obj.FileHash)
+		}
+	})
+}
+
+// object mv <ObjectID> <PackageID> <对象路径>
+func moveObject(ctx *CommandContext, objectID cdssdk.ObjectID, packageID cdssdk.PackageID, objPath string) error {
+	resp, err := ctx.Client.Object().MoveContext(ctx.Ctx, cdsapi.ObjectMove{
+		UserID: ctx.UserID,
+		Movings: []cdsapi.MovingObject{{
+			ObjectID:  objectID,
+			PackageID: packageID,
+			Path:      objPath,
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(resp.Successes) == 0 {
+		return fmt.Errorf("object %d not moved", objectID)
+	}
+
+	return ctx.Print(resp, func(w io.Writer) {
+		fmt.Fprintf(w, "object %d moved to %d:%v\n", objectID, packageID, objPath)
+	})
+}
+
+// object rm <ObjectID>...
+func removeObjects(ctx *CommandContext, objectIDs []cdssdk.ObjectID) error {
+	if len(objectIDs) == 0 {
+		return fmt.Errorf("no object id")
+	}
+
+	err := ctx.Client.Object().DeleteContext(ctx.Ctx, cdsapi.ObjectDelete{
+		UserID:    ctx.UserID,
+		ObjectIDs: objectIDs,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.Print(map[string]any{"objectIDs": objectIDs}, func(w io.Writer) {
+		fmt.Fprintf(w, "%d objects removed\n", len(objectIDs))
+	})
+}
+
+func init() {
+	commands.MustAdd(listObjects, "object", "ls")
+	commands.MustAdd(getObject, "object", "get")
+	commands.MustAdd(putObject, "object", "put")
+	commands.MustAdd(moveObject, "object", "mv")
+	commands.MustAdd(removeObjects, "object", "rm")
+}
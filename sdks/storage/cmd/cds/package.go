@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+	"gitlink.org.cn/cloudream/common/sdks/storage/cdsapi"
+)
+
+// package ls <BucketID>
+func listPackages(ctx *CommandContext, bucketID cdssdk.BucketID) error {
+	resp, err := ctx.Client.Package().ListBucketPackagesContext(ctx.Ctx, cdsapi.PackageListBucketPackages{
+		UserID:   ctx.UserID,
+		BucketID: bucketID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.Print(resp.Packages, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tName\tState")
+		for _, pkg := range resp.Packages {
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", pkg.PackageID, pkg.Name, pkg.State)
+		}
+		tw.Flush()
+	})
+}
+
+// package create <BucketID> <名称>
+func createPackage(ctx *CommandContext, bucketID cdssdk.BucketID, name string) error {
+	resp, err := ctx.Client.Package().CreateContext(ctx.Ctx, cdsapi.PackageCreate{
+		UserID:   ctx.UserID,
+		BucketID: bucketID,
+		Name:     name,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.Print(resp.Package, func(w io.Writer) {
+		fmt.Fprintf(w, "package %v created, id: %d\n", resp.Package.Name, resp.Package.PackageID)
+	})
+}
+
+// package clone <PackageID> <BucketID> <名称>
+func clonePackage(ctx *CommandContext, packageID cdssdk.PackageID, bucketID cdssdk.BucketID, name string) error {
+	resp, err := ctx.Client.Package().CloneContext(ctx.Ctx, cdsapi.PackageClone{
+		UserID:    ctx.UserID,
+		PackageID: packageID,
+		BucketID:  bucketID,
+		Name:      name,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.Print(resp.Package, func(w io.Writer) {
+		fmt.Fprintf(w, "package %d cloned as %v, id: %d\n", packageID, resp.Package.Name, resp.Package.PackageID)
+	})
+}
+
+// package rm <PackageID>
+func removePackage(ctx *CommandContext, packageID cdssdk.PackageID) error {
+	err := ctx.Client.Package().DeleteContext(ctx.Ctx, cdsapi.PackageDelete{
+		UserID:    ctx.UserID,
+		PackageID: packageID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.Print(map[string]any{"packageID": packageID}, func(w io.Writer) {
+		fmt.Fprintf(w, "package %d removed\n", packageID)
+	})
+}
+
+func init() {
+	commands.MustAdd(listPackages, "package", "ls")
+	commands.MustAdd(createPackage, "package", "create")
+	commands.MustAdd(clonePackage, "package", "clone")
+	commands.MustAdd(removePackage, "package", "rm")
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+	"gitlink.org.cn/cloudream/common/sdks/storage/cdsapi"
+)
+
+// storage load <PackageID> <StorageID> [加载路径]
+func loadPackage(ctx *CommandContext, packageID cdssdk.PackageID, storageID cdssdk.StorageID, args []string) error {
+	rootPath := ""
+	if len(args) > 0 {
+		rootPath = args[0]
+	}
+
+	_, err := ctx.Client.StorageLoadPackageContext(ctx.Ctx, cdsapi.StorageLoadPackageReq{
+		UserID:    ctx.UserID,
+		PackageID: packageID,
+		StorageID: storageID,
+		RootPath:  rootPath,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.Print(map[string]any{"packageID": packageID, "storageID": storageID, "rootPath": rootPath}, func(w io.Writer) {
+		fmt.Fprintf(w, "package %d loaded to storage %d\n", packageID, storageID)
+	})
+}
+
+func init() {
+	commands.MustAdd(loadPackage, "storage", "load")
+}
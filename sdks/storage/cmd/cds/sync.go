@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+	"gitlink.org.cn/cloudream/common/sdks/storage/dirsync"
+)
+
+// sync <本地目录> <PackageID> [-delete] [-dry-run] [-seg-size 分段大小]
+func syncDir(ctx *CommandContext, localDir string, packageID cdssdk.PackageID, args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	del := fs.Bool("delete", false, "删除本地不存在的远端对象")
+	dryRun := fs.Bool("dry-run", false, "只输出同步计划，不实际执行")
+	segSize := fs.Int64("seg-size", 0, "远端对象使用Composite哈希时，计算本地文件哈希值使用的分段大小")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	plan, err := dirsync.Sync(ctx.Ctx, ctx.Client, dirsync.Option{
+		UserID:               ctx.UserID,
+		PackageID:            packageID,
+		LocalDir:             localDir,
+		Delete:               *del,
+		DryRun:               *dryRun,
+		CompositeSegmentSize: *segSize,
+		HashParallel:         4,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.Print(plan, func(w io.Writer) {
+		for _, a := range plan.Actions {
+			fmt.Fprintf(w, "%-6s %s (%d bytes)\n", a.Type, a.Path, a.Size)
+		}
+		fmt.Fprintf(w, "upload: %d, update: %d, delete: %d, unchanged: %d\n",
+			plan.Count(dirsync.ActionUpload), plan.Count(dirsync.ActionUpdate), plan.Count(dirsync.ActionDelete), plan.Unchanged)
+	})
+}
+
+func init() {
+	commands.MustAdd(syncDir, "sync")
+}
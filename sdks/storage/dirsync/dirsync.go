@@ -0,0 +1,238 @@
+package dirsync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gitlink.org.cn/cloudream/common/pkgs/iterator"
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+	"gitlink.org.cn/cloudream/common/sdks/storage/cdsapi"
+	"gitlink.org.cn/cloudream/common/utils/os2"
+)
+
+type ActionType string
+
+const (
+	ActionUpload ActionType = "Upload" // 远端不存在的文件
+	ActionUpdate ActionType = "Update" // 远端存在但内容不同的文件
+	ActionDelete ActionType = "Delete" // 本地不存在的远端对象
+)
+
+type Option struct {
+	UserID    cdssdk.UserID
+	PackageID cdssdk.PackageID
+	LocalDir  string
+	// 是否删除本地不存在的远端对象
+	Delete bool
+	// 只生成同步计划，不实际执行
+	DryRun bool
+	// 远端对象的FileHash是Composite哈希时，计算本地文件哈希值使用的分段大小。
+	// 为0时无法比较Composite哈希，大小相同的文件也会被重新上传
+	CompositeSegmentSize int64
+	// 计算本地文件哈希值时的并发数
+	HashParallel int
+}
+
+type Action struct {
+	Type      ActionType     `json:"type"`
+	Path      string         `json:"path"`      // 对象路径，使用/分隔
+	LocalPath string         `json:"localPath"` // 本地文件路径，删除对象时为空
+	Size      int64          `json:"size"`
+	Object    *cdssdk.Object `json:"object"` // 远端对象，上传新文件时为nil
+}
+
+type Plan struct {
+	Actions   []Action `json:"actions"`
+	Unchanged int      `json:"unchanged"` // 内容相同，不需要同步的文件数
+}
+
+func (p *Plan) Count(typ ActionType) int {
+	cnt := 0
+	for _, a := range p.Actions {
+		if a.Type == typ {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+// 将本地目录同步到Package中，返回执行的同步计划。DryRun时只生成计划
+func Sync(ctx context.Context, cli *cdsapi.Client, opt Option) (*Plan, error) {
+	plan, err := MakePlan(ctx, cli, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	if opt.DryRun {
+		return plan, nil
+	}
+
+	err = Execute(ctx, cli, opt, plan)
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// 比较本地目录与Package中的对象，生成同步计划。
+// 路径相同的文件，如果大小或者FileHash不同，则需要更新。
+func MakePlan(ctx context.Context, cli *cdsapi.Client, opt Option) (*Plan, error) {
+	resp, err := cli.Object().GetPackageObjectsContext(ctx, cdsapi.ObjectGetPackageObjects{
+		UserID:    opt.UserID,
+		PackageID: opt.PackageID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting package objects: %w", err)
+	}
+
+	remotes := make(map[string]*cdssdk.Object)
+	for i := range resp.Objects {
+		remotes[resp.Objects[i].Path] = &resp.Objects[i]
+	}
+
+	plan := &Plan{}
+
+	dirIter := os2.WalkDir(opt.LocalDir)
+	defer dirIter.Close()
+	for {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		file, err := dirIter.MoveNext()
+		if err == iterator.ErrNoMoreItem {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("walking local dir: %w", err)
+		}
+
+		relPath, err := filepath.Rel(opt.LocalDir, file.Path)
+		if err != nil {
+			return nil, err
+		}
+		objPath := filepath.ToSlash(relPath)
+
+		remote, ok := remotes[objPath]
+		if !ok {
+			plan.Actions = append(plan.Actions, Action{
+				Type:      ActionUpload,
+				Path:      objPath,
+				LocalPath: file.Path,
+				Size:      file.Info.Size(),
+			})
+			continue
+		}
+		delete(remotes, objPath)
+
+		same, err := isSameFile(file.Path, file.Info.Size(), remote, opt)
+		if err != nil {
+			return nil, fmt.Errorf("comparing %v: %w", objPath, err)
+		}
+
+		if same {
+			plan.Unchanged++
+			continue
+		}
+
+		plan.Actions = append(plan.Actions, Action{
+			Type:      ActionUpdate,
+			Path:      objPath,
+			LocalPath: file.Path,
+			Size:      file.Info.Size(),
+			Object:    remote,
+		})
+	}
+
+	if opt.Delete {
+		var dels []Action
+		for _, obj := range remotes {
+			dels = append(dels, Action{
+				Type:   ActionDelete,
+				Path:   obj.Path,
+				Size:   obj.Size,
+				Object: obj,
+			})
+		}
+		sort.Slice(dels, func(i, j int) bool { return dels[i].Path < dels[j].Path })
+		plan.Actions = append(plan.Actions, dels...)
+	}
+
+	return plan, nil
+}
+
+func isSameFile(localPath string, size int64, remote *cdssdk.Object, opt Option) (bool, error) {
+	if size != remote.Size {
+		return false, nil
+	}
+
+	var segSize int64
+	if remote.FileHash.IsCompositeHash() {
+		if opt.CompositeSegmentSize <= 0 {
+			return false, nil
+		}
+		segSize = opt.CompositeSegmentSize
+	}
+
+	hash, err := cdssdk.CalcLocalFileHash(localPath, segSize, opt.HashParallel)
+	if err != nil {
+		return false, err
+	}
+
+	return hash == remote.FileHash, nil
+}
+
+// 执行同步计划：上传新增和修改的文件，然后删除多余的对象
+func Execute(ctx context.Context, cli *cdsapi.Client, opt Option, plan *Plan) error {
+	var uploads []Action
+	var delIDs []cdssdk.ObjectID
+	for _, a := range plan.Actions {
+		switch a.Type {
+		case ActionUpload, ActionUpdate:
+			uploads = append(uploads, a)
+		case ActionDelete:
+			delIDs = append(delIDs, a.Object.ObjectID)
+		}
+	}
+
+	if len(uploads) > 0 {
+		// 文件在上传时才打开，同一时间只会打开一个文件
+		files := iterator.Map[Action, *cdsapi.UploadingObject](iterator.Array(uploads...), func(a Action) (*cdsapi.UploadingObject, error) {
+			file, err := os.Open(a.LocalPath)
+			if err != nil {
+				return nil, err
+			}
+
+			return &cdsapi.UploadingObject{
+				Path: a.Path,
+				File: file,
+			}, nil
+		})
+
+		_, err := cli.Object().UploadContext(ctx, cdsapi.ObjectUpload{
+			ObjectUploadInfo: cdsapi.ObjectUploadInfo{
+				UserID:    opt.UserID,
+				PackageID: opt.PackageID,
+			},
+			Files: files,
+		})
+		if err != nil {
+			return fmt.Errorf("uploading files: %w", err)
+		}
+	}
+
+	if len(delIDs) > 0 {
+		err := cli.Object().DeleteContext(ctx, cdsapi.ObjectDelete{
+			UserID:    opt.UserID,
+			ObjectIDs: delIDs,
+		})
+		if err != nil {
+			return fmt.Errorf("deleting objects: %w", err)
+		}
+	}
+
+	return nil
+}
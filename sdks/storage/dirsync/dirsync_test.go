@@ -0,0 +1,150 @@
+package dirsync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+	"gitlink.org.cn/cloudream/common/sdks/storage/cdsapi"
+)
+
+type stubObject struct {
+	id   cdssdk.ObjectID
+	path string
+	data string
+}
+
+// 只实现了同步用到的接口
+type stubServer struct {
+	lock     sync.Mutex
+	objs     []stubObject
+	uploaded []string
+	deleted  []cdssdk.ObjectID
+}
+
+func (s *stubServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.URL.Path {
+	case cdsapi.ObjectGetPackageObjectsPath:
+		var objs []string
+		for _, o := range s.objs {
+			sum := sha256.Sum256([]byte(o.data))
+			objs = append(objs, fmt.Sprintf(`{"objectID":%d,"packageID":1,"path":"%s","size":"%d","fileHash":"%s"}`, o.id, o.path, len(o.data), cdssdk.NewFullHash(sum[:])))
+		}
+		fmt.Fprintf(w, `{"code":"OK","data":{"objects":[%s]}}`, strings.Join(objs, ","))
+
+	case cdsapi.ObjectUploadPath:
+		mr, err := r.MultipartReader()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if part.FormName() != "files" {
+				continue
+			}
+			name, _ := url.PathUnescape(part.FileName())
+			data, _ := io.ReadAll(part)
+			s.uploaded = append(s.uploaded, name+":"+string(data))
+		}
+		io.WriteString(w, `{"code":"OK","data":{"uploadeds":[]}}`)
+
+	case cdsapi.ObjectDeletePath:
+		var req cdsapi.ObjectDelete
+		json.NewDecoder(r.Body).Decode(&req)
+		s.deleted = append(s.deleted, req.ObjectIDs...)
+		io.WriteString(w, `{"code":"OK","data":{}}`)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func Test_Sync(t *testing.T) {
+	Convey("同步本地目录", t, func() {
+		dir := t.TempDir()
+		So(os.MkdirAll(filepath.Join(dir, "sub"), 0755), ShouldBeNil)
+		So(os.WriteFile(filepath.Join(dir, "same.txt"), []byte("same"), 0644), ShouldBeNil)
+		So(os.WriteFile(filepath.Join(dir, "changed.txt"), []byte("new!"), 0644), ShouldBeNil)
+		So(os.WriteFile(filepath.Join(dir, "sub", "added.txt"), []byte("added"), 0644), ShouldBeNil)
+
+		stub := &stubServer{
+			objs: []stubObject{
+				{id: 1, path: "same.txt", data: "same"},
+				{id: 2, path: "changed.txt", data: "old!"},
+				{id: 3, path: "removed.txt", data: "removed"},
+			},
+		}
+		svr := httptest.NewServer(stub)
+		defer svr.Close()
+
+		cli := cdsapi.NewClient(&cdsapi.Config{URL: svr.URL})
+		opt := Option{
+			UserID:    1,
+			PackageID: 1,
+			LocalDir:  dir,
+			Delete:    true,
+			DryRun:    true,
+		}
+
+		plan, err := Sync(context.Background(), cli, opt)
+		So(err, ShouldBeNil)
+		So(plan.Unchanged, ShouldEqual, 1)
+		So(plan.Count(ActionUpload), ShouldEqual, 1)
+		So(plan.Count(ActionUpdate), ShouldEqual, 1)
+		So(plan.Count(ActionDelete), ShouldEqual, 1)
+		So(stub.uploaded, ShouldBeEmpty)
+		So(stub.deleted, ShouldBeEmpty)
+
+		opt.DryRun = false
+		_, err = Sync(context.Background(), cli, opt)
+		So(err, ShouldBeNil)
+		So(stub.uploaded, ShouldResemble, []string{"changed.txt:new!", "sub/added.txt:added"})
+		So(stub.deleted, ShouldResemble, []cdssdk.ObjectID{3})
+	})
+
+	Convey("不删除远端多余的对象", t, func() {
+		dir := t.TempDir()
+		So(os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644), ShouldBeNil)
+
+		stub := &stubServer{
+			objs: []stubObject{
+				{id: 1, path: "b.txt", data: "b"},
+			},
+		}
+		svr := httptest.NewServer(stub)
+		defer svr.Close()
+
+		cli := cdsapi.NewClient(&cdsapi.Config{URL: svr.URL})
+		plan, err := Sync(context.Background(), cli, Option{UserID: 1, PackageID: 1, LocalDir: dir})
+		So(err, ShouldBeNil)
+		So(plan.Actions, ShouldHaveLength, 1)
+		So(plan.Actions[0].Type, ShouldEqual, ActionUpload)
+		So(stub.uploaded, ShouldResemble, []string{"a.txt:a"})
+		So(stub.deleted, ShouldBeEmpty)
+	})
+}
@@ -0,0 +1,256 @@
+package cdssdk
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sync"
+)
+
+// 计算FileHash。写入数据的同时计算哈希值，因此只需要读取一遍数据。
+//
+// 计算Composite哈希时，每一段数据单独计算SHA256，最后再使用CalculateCompositeHash合并。
+type FileHasher struct {
+	composite bool
+	segments  []int64 // 每一段的大小。写入的数据超过所有段的总大小后，剩余的数据按fixedSize分段
+	fixedSize int64   // 为0则剩余的数据作为一段
+	cur       hash.Hash
+	curSize   int64
+	segHashes [][]byte
+	total     int64
+}
+
+// 计算完整文件的哈希值
+func NewFullHasher() *FileHasher {
+	return &FileHasher{
+		cur: sha256.New(),
+	}
+}
+
+// 将数据按segmentSize大小分段计算哈希值，最后一段可以小于segmentSize。
+// 与分段上传时使用同样的分段方式，就能得到同样的哈希值。
+func NewCompositeHasher(segmentSize int64) *FileHasher {
+	return &FileHasher{
+		composite: true,
+		fixedSize: segmentSize,
+		cur:       sha256.New(),
+	}
+}
+
+// 按segments中指定的每一段的大小分段计算哈希值，超出所有段的总大小的数据会作为最后一段
+func NewSegmentedHasher(segments []int64) *FileHasher {
+	return &FileHasher{
+		composite: true,
+		segments:  segments,
+		cur:       sha256.New(),
+	}
+}
+
+func (h *FileHasher) Write(p []byte) (int, error) {
+	n := len(p)
+	h.total += int64(n)
+
+	if !h.composite {
+		h.cur.Write(p)
+		return n, nil
+	}
+
+	for len(p) > 0 {
+		segSize := h.curSegmentSize()
+		if segSize < 0 {
+			h.cur.Write(p)
+			h.curSize += int64(len(p))
+			break
+		}
+
+		l := int64(len(p))
+		if l > segSize-h.curSize {
+			l = segSize - h.curSize
+		}
+
+		h.cur.Write(p[:l])
+		h.curSize += l
+		p = p[l:]
+
+		if h.curSize == segSize {
+			h.finishSegment()
+		}
+	}
+
+	return n, nil
+}
+
+// 当前段的大小，为-1代表没有限制
+func (h *FileHasher) curSegmentSize() int64 {
+	idx := len(h.segHashes)
+	if idx < len(h.segments) {
+		return h.segments[idx]
+	}
+
+	if h.fixedSize > 0 {
+		return h.fixedSize
+	}
+
+	return -1
+}
+
+func (h *FileHasher) finishSegment() {
+	h.segHashes = append(h.segHashes, h.cur.Sum(nil))
+	h.cur.Reset()
+	h.curSize = 0
+}
+
+// 已经写入的数据量
+func (h *FileHasher) Size() int64 {
+	return h.total
+}
+
+// 计算当前已经写入的数据的哈希值。不影响继续写入数据。
+func (h *FileHasher) Sum() FileHash {
+	if !h.composite {
+		return NewFullHash(h.cur.Sum(nil))
+	}
+
+	hashes := append([][]byte{}, h.segHashes...)
+	// 最后一段不完整的数据，或者没有写入任何数据时的空段
+	if h.curSize > 0 || len(hashes) == 0 {
+		hashes = append(hashes, h.cur.Sum(nil))
+	}
+
+	return CalculateCompositeHash(hashes)
+}
+
+// 返回一个Reader，从中读取的数据都会被计算哈希值
+func (h *FileHasher) WrapReader(r io.Reader) io.Reader {
+	return io.TeeReader(r, h)
+}
+
+// 返回一个Writer，写入到其中的数据都会被计算哈希值
+func (h *FileHasher) WrapWriter(w io.Writer) io.Writer {
+	return io.MultiWriter(w, h)
+}
+
+// 读取的数据的哈希值与期望的不一致
+type HashMismatchError struct {
+	Expected FileHash
+	Actual   FileHash
+}
+
+func (e *HashMismatchError) Error() string {
+	return fmt.Sprintf("file hash mismatch, expected: %v, actual: %v", e.Expected, e.Actual)
+}
+
+type verifyReader struct {
+	inner    io.Reader
+	hasher   *FileHasher
+	expected FileHash
+	err      error
+}
+
+// 读取数据的同时计算哈希值，读取到末尾时，如果哈希值与expected不一致，则返回*HashMismatchError而不是io.EOF。
+// hasher为nil时计算Full哈希。
+func NewVerifyReader(r io.Reader, expected FileHash, hasher *FileHasher) io.Reader {
+	if hasher == nil {
+		hasher = NewFullHasher()
+	}
+
+	return &verifyReader{
+		inner:    r,
+		hasher:   hasher,
+		expected: expected,
+	}
+}
+
+func (r *verifyReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	n, err := r.inner.Read(p)
+	r.hasher.Write(p[:n])
+
+	if err == io.EOF {
+		actual := r.hasher.Sum()
+		if actual != r.expected {
+			err = &HashMismatchError{Expected: r.expected, Actual: actual}
+		}
+	}
+
+	r.err = err
+	return n, err
+}
+
+// 计算本地文件的哈希值。segmentSize为0时计算Full哈希，否则计算按segmentSize分段的Composite哈希。
+// 计算Composite哈希时，会使用parallel个协程同时计算不同分段的哈希值。
+func CalcLocalFileHash(path string, segmentSize int64, parallel int) (FileHash, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if segmentSize <= 0 || parallel <= 1 {
+		var hasher *FileHasher
+		if segmentSize <= 0 {
+			hasher = NewFullHasher()
+		} else {
+			hasher = NewCompositeHasher(segmentSize)
+		}
+
+		_, err := io.Copy(hasher, file)
+		if err != nil {
+			return "", err
+		}
+		return hasher.Sum(), nil
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	segCnt := int((info.Size() + segmentSize - 1) / segmentSize)
+	if segCnt == 0 {
+		segCnt = 1
+	}
+	hashes := make([][]byte, segCnt)
+
+	segs := make(chan int, segCnt)
+	for i := 0; i < segCnt; i++ {
+		segs <- i
+	}
+	close(segs)
+
+	var errLock sync.Mutex
+	var firstErr error
+
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range segs {
+				h := sha256.New()
+				_, err := io.Copy(h, io.NewSectionReader(file, int64(idx)*segmentSize, segmentSize))
+				if err != nil {
+					errLock.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errLock.Unlock()
+					return
+				}
+				hashes[idx] = h.Sum(nil)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return "", firstErr
+	}
+
+	return CalculateCompositeHash(hashes), nil
+}
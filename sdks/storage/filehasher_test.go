@@ -0,0 +1,98 @@
+package cdssdk
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_FileHasher(t *testing.T) {
+	data := make([]byte, 1000)
+	rand.New(rand.NewSource(0)).Read(data)
+
+	compositeOf := func(segs ...[]byte) FileHash {
+		var hashes [][]byte
+		for _, s := range segs {
+			h := sha256.Sum256(s)
+			hashes = append(hashes, h[:])
+		}
+		return CalculateCompositeHash(hashes)
+	}
+
+	Convey("Full哈希", t, func() {
+		h := NewFullHasher()
+		io.Copy(h, bytes.NewReader(data))
+
+		sum := sha256.Sum256(data)
+		So(h.Sum(), ShouldEqual, NewFullHash(sum[:]))
+		So(h.Size(), ShouldEqual, 1000)
+	})
+
+	Convey("固定大小分段的Composite哈希", t, func() {
+		h := NewCompositeHasher(300)
+		// 写入的块与分段的边界不对齐
+		for i := 0; i < len(data); i += 7 {
+			end := i + 7
+			if end > len(data) {
+				end = len(data)
+			}
+			h.Write(data[i:end])
+		}
+
+		So(h.Sum(), ShouldEqual, compositeOf(data[:300], data[300:600], data[600:900], data[900:]))
+
+		h = NewCompositeHasher(500)
+		h.Write(data)
+		So(h.Sum(), ShouldEqual, compositeOf(data[:500], data[500:]))
+
+		So(NewCompositeHasher(500).Sum(), ShouldEqual, compositeOf([]byte{}))
+	})
+
+	Convey("指定每一段大小的Composite哈希", t, func() {
+		h := NewSegmentedHasher([]int64{100, 400})
+		h.WrapWriter(io.Discard).Write(data)
+		So(h.Sum(), ShouldEqual, compositeOf(data[:100], data[100:500], data[500:]))
+	})
+
+	Convey("校验读取的数据", t, func() {
+		sum := sha256.Sum256(data)
+
+		got, err := io.ReadAll(NewVerifyReader(bytes.NewReader(data), NewFullHash(sum[:]), nil))
+		So(err, ShouldBeNil)
+		So(got, ShouldResemble, data)
+
+		_, err = io.ReadAll(NewVerifyReader(bytes.NewReader(data[1:]), NewFullHash(sum[:]), nil))
+		var mismatch *HashMismatchError
+		So(errors.As(err, &mismatch), ShouldBeTrue)
+		So(mismatch.Expected, ShouldEqual, NewFullHash(sum[:]))
+
+		_, err = io.ReadAll(NewVerifyReader(bytes.NewReader(data), compositeOf(data[:600], data[600:]), NewCompositeHasher(600)))
+		So(err, ShouldBeNil)
+	})
+
+	Convey("计算本地文件的哈希值", t, func() {
+		path := filepath.Join(t.TempDir(), "file")
+		So(os.WriteFile(path, data, 0644), ShouldBeNil)
+
+		sum := sha256.Sum256(data)
+		hash, err := CalcLocalFileHash(path, 0, 4)
+		So(err, ShouldBeNil)
+		So(hash, ShouldEqual, NewFullHash(sum[:]))
+
+		expected := compositeOf(data[:128], data[128:256], data[256:384], data[384:512], data[512:640], data[640:768], data[768:896], data[896:])
+		hash, err = CalcLocalFileHash(path, 128, 3)
+		So(err, ShouldBeNil)
+		So(hash, ShouldEqual, expected)
+
+		hash, err = CalcLocalFileHash(path, 128, 1)
+		So(err, ShouldBeNil)
+		So(hash, ShouldEqual, expected)
+	})
+}
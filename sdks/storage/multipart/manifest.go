@@ -0,0 +1,128 @@
+package multipart
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"gitlink.org.cn/cloudream/common/utils/serder"
+)
+
+// 分段上传的进度记录，保存在临时目录中，用于失败后恢复上传
+type manifest struct {
+	Key      string       `json:"key"`
+	UploadID string       `json:"uploadID"`
+	PartSize int64        `json:"partSize"`
+	Parts    map[int]Part `json:"parts"` // 已经上传完成的分段
+	path     string
+	lock     sync.Mutex
+}
+
+func manifestPath(tempDir string, key string) string {
+	if tempDir == "" {
+		tempDir = os.TempDir()
+	}
+
+	h := sha256.Sum256([]byte(key))
+	return filepath.Join(tempDir, fmt.Sprintf("multipart-%s.json", hex.EncodeToString(h[:8])))
+}
+
+func newManifest(tempDir string, key string, uploadID string, partSize int64) *manifest {
+	return &manifest{
+		Key:      key,
+		UploadID: uploadID,
+		PartSize: partSize,
+		Parts:    make(map[int]Part),
+		path:     manifestPath(tempDir, key),
+	}
+}
+
+// 读取之前的上传记录，没有记录时返回nil
+func loadManifest(tempDir string, key string) (*manifest, error) {
+	path := manifestPath(tempDir, key)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+
+	mani, err := serder.JSONToObjectEx[*manifest](data)
+	if err != nil {
+		// 记录损坏时当做没有记录
+		return nil, nil
+	}
+
+	// 哈希值可能冲突
+	if mani.Key != key {
+		return nil, nil
+	}
+
+	if mani.Parts == nil {
+		mani.Parts = make(map[int]Part)
+	}
+	mani.path = path
+	return mani, nil
+}
+
+func (m *manifest) HasPart(part Part) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	p, ok := m.Parts[part.PartNumber]
+	return ok && p.Size == part.Size && bytes.Equal(p.Hash, part.Hash)
+}
+
+func (m *manifest) GetPart(partNumber int) (Part, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	p, ok := m.Parts[partNumber]
+	return p, ok
+}
+
+func (m *manifest) AddPart(part Part) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.Parts[part.PartNumber] = part
+	return m.saveLocked()
+}
+
+func (m *manifest) Save() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.saveLocked()
+}
+
+func (m *manifest) saveLocked() error {
+	data, err := serder.ObjectToJSONEx(m)
+	if err != nil {
+		return fmt.Errorf("serialize manifest: %w", err)
+	}
+
+	// 先写入临时文件再改名，避免中途失败导致记录损坏
+	tempPath := m.path + ".tmp"
+	err = os.WriteFile(tempPath, data, 0644)
+	if err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+
+	err = os.Rename(tempPath, m.path)
+	if err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("write manifest: %w", err)
+	}
+
+	return nil
+}
+
+func (m *manifest) Remove() {
+	os.Remove(m.path)
+}
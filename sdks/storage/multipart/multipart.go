@@ -0,0 +1,377 @@
+package multipart
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+	"gitlink.org.cn/cloudream/common/utils/math2"
+)
+
+const (
+	// 分段编号的上限，与S3协议相同
+	MaxPartCount = 10000
+
+	defaultPartSize      = 8 * 1024 * 1024
+	defaultConcurrency   = 4
+	defaultMaxRetries    = 3
+	defaultRetryInterval = time.Second
+)
+
+// 上传任务不存在，比如已经被存储服务清理掉了
+var ErrUploadNotFound = errors.New("multipart upload not found")
+
+// 实际执行分段上传的存储服务。上传任务不存在时，UploadPart和Complete返回的错误需要包装ErrUploadNotFound
+type Backend interface {
+	// 开始一个分段上传任务，返回任务ID
+	Initiate(ctx context.Context, key string) (string, error)
+	// 上传一个分段，返回分段的ETag。分段编号从1开始
+	UploadPart(ctx context.Context, key string, uploadID string, partNumber int, body io.Reader, size int64) (string, error)
+	// 按顺序合并所有分段
+	Complete(ctx context.Context, key string, uploadID string, parts []Part) error
+	// 取消上传任务
+	Abort(ctx context.Context, key string, uploadID string) error
+}
+
+type Part struct {
+	PartNumber int    `json:"partNumber"`
+	Size       int64  `json:"size"`
+	ETag       string `json:"etag"`
+	Hash       []byte `json:"hash"` // 分段数据的SHA256
+}
+
+type Config struct {
+	// 分段大小的限制以及临时文件目录。TempDir为空时使用系统的临时目录
+	Feature cdssdk.MultipartUploadFeature
+	// 期望的分段大小，会被限制在MinPartSize和MaxPartSize之间。为0则使用默认值
+	PartSize int64
+	// 同时上传的分段数，为0则使用默认值
+	Concurrency int
+	// 每个分段上传失败后的重试次数，为0则使用默认值，小于0则不重试
+	MaxRetries int
+	// 第一次重试前的等待时间，之后每次重试等待时间翻倍。为0则使用默认值
+	RetryInterval time.Duration
+}
+
+type Result struct {
+	Key      string          `json:"key"`
+	UploadID string          `json:"uploadID"`
+	Size     int64           `json:"size"`
+	FileHash cdssdk.FileHash `json:"fileHash"` // 使用每个分段的哈希值计算得到的Composite哈希
+	Parts    []Part          `json:"parts"`
+}
+
+// 将流切分成多个分段并发上传。
+//
+// 上传过程中会在TempDir中记录已经上传的分段，上传失败后再次上传同一个Key的同样的数据时，会跳过已经上传的分段。
+// 如果ctx被取消，则会取消整个上传任务并删除记录。
+//
+// 如果记录中的上传任务已经不存在，则会删除记录。此时如果流实现了io.Seeker，会回到流的起始位置重新开始上传一次，
+// 否则直接返回错误，下次上传时会重新开始。
+type Uploader struct {
+	backend Backend
+	cfg     Config
+}
+
+func NewUploader(backend Backend, cfg Config) *Uploader {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = defaultConcurrency
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = defaultMaxRetries
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = defaultRetryInterval
+	}
+
+	return &Uploader{
+		backend: backend,
+		cfg:     cfg,
+	}
+}
+
+// 计算分段大小。sizeHint为流的总长度，不知道时传-1，此时流的长度不能超过分段大小*MaxPartCount
+func (u *Uploader) PartSize(sizeHint int64) int64 {
+	size := u.cfg.PartSize
+	if size <= 0 {
+		size = defaultPartSize
+	}
+
+	if sizeHint > 0 {
+		size = math2.Max(size, (sizeHint+MaxPartCount-1)/MaxPartCount)
+	}
+
+	if u.cfg.Feature.MinPartSize > 0 {
+		size = math2.Max(size, u.cfg.Feature.MinPartSize)
+	}
+	if u.cfg.Feature.MaxPartSize > 0 {
+		size = math2.Min(size, u.cfg.Feature.MaxPartSize)
+	}
+
+	return size
+}
+
+type partTask struct {
+	part Part
+	file *os.File // 分段数据的临时文件，为nil代表这个分段已经上传过了
+}
+
+func (u *Uploader) Upload(ctx context.Context, key string, stream io.Reader, sizeHint int64) (*Result, error) {
+	partSize := u.PartSize(sizeHint)
+
+	mani, err := loadManifest(u.cfg.Feature.TempDir, key)
+	if err != nil {
+		return nil, err
+	}
+
+	// 分段大小不同时，之前上传的分段都无法使用
+	if mani != nil && mani.PartSize != partSize {
+		u.backend.Abort(ctx, key, mani.UploadID)
+		mani.Remove()
+		mani = nil
+	}
+
+	// 记录流的起始位置，上传任务不存在时可以从头重新上传
+	seeker, seekable := stream.(io.Seeker)
+	var start int64
+	if seekable {
+		start, err = seeker.Seek(0, io.SeekCurrent)
+		seekable = err == nil
+	}
+
+	if mani == nil {
+		mani, err = u.initiate(ctx, key, partSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ret, err := u.upload(ctx, mani, stream)
+	if errors.Is(err, ErrUploadNotFound) && ctx.Err() == nil {
+		mani.Remove()
+		if !seekable {
+			return nil, err
+		}
+
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("seek stream to restart upload: %w", err)
+		}
+
+		mani, err = u.initiate(ctx, key, partSize)
+		if err != nil {
+			return nil, err
+		}
+		ret, err = u.upload(ctx, mani, stream)
+	}
+	if err == nil {
+		mani.Remove()
+		return ret, nil
+	}
+
+	// 只有被取消时才放弃整个上传任务，其他情况下保留记录用于下次恢复上传
+	if ctx.Err() != nil {
+		u.backend.Abort(context.Background(), key, mani.UploadID)
+		mani.Remove()
+	}
+
+	return nil, err
+}
+
+// 开始一个新的上传任务并保存记录
+func (u *Uploader) initiate(ctx context.Context, key string, partSize int64) (*manifest, error) {
+	uploadID, err := u.backend.Initiate(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("initiate multipart upload: %w", err)
+	}
+
+	mani := newManifest(u.cfg.Feature.TempDir, key, uploadID, partSize)
+	err = mani.Save()
+	if err != nil {
+		u.backend.Abort(context.Background(), key, uploadID)
+		return nil, err
+	}
+
+	return mani, nil
+}
+
+func (u *Uploader) upload(ctx context.Context, mani *manifest, stream io.Reader) (*Result, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tasks := make(chan partTask, u.cfg.Concurrency)
+
+	var errLock sync.Mutex
+	var firstErr error
+	setErr := func(err error) {
+		errLock.Lock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+		errLock.Unlock()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < u.cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range tasks {
+				err := u.uploadPart(ctx, mani, t)
+				if err != nil {
+					setErr(err)
+				}
+			}
+		}()
+	}
+
+	parts, err := u.splitParts(ctx, mani, stream, tasks)
+	close(tasks)
+	wg.Wait()
+
+	if err != nil {
+		setErr(err)
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	// 上传过的分段的ETag保存在记录中
+	var hashes [][]byte
+	var size int64
+	for i := range parts {
+		p, _ := mani.GetPart(parts[i].PartNumber)
+		parts[i].ETag = p.ETag
+		hashes = append(hashes, parts[i].Hash)
+		size += parts[i].Size
+	}
+
+	err = u.backend.Complete(ctx, mani.Key, mani.UploadID, parts)
+	if err != nil {
+		return nil, fmt.Errorf("complete multipart upload: %w", err)
+	}
+
+	return &Result{
+		Key:      mani.Key,
+		UploadID: mani.UploadID,
+		Size:     size,
+		FileHash: cdssdk.CalculateCompositeHash(hashes),
+		Parts:    parts,
+	}, nil
+}
+
+// 将流切分为分段，每个分段先写入临时文件，以便失败重试。返回所有分段的信息，不包括ETag
+func (u *Uploader) splitParts(ctx context.Context, mani *manifest, stream io.Reader, tasks chan<- partTask) ([]Part, error) {
+	var parts []Part
+	for partNumber := 1; ; partNumber++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		file, err := os.CreateTemp(u.cfg.Feature.TempDir, "part-*")
+		if err != nil {
+			return nil, fmt.Errorf("create temp file: %w", err)
+		}
+
+		hasher := sha256.New()
+		n, err := io.CopyN(io.MultiWriter(file, hasher), stream, mani.PartSize)
+		if err != nil && err != io.EOF {
+			closeTemp(file)
+			return nil, fmt.Errorf("read part %v: %w", partNumber, err)
+		}
+
+		// 流的长度正好是分段大小的整数倍时，最后会读到一个空的分段，但至少需要一个分段
+		if n == 0 && partNumber > 1 {
+			closeTemp(file)
+			return parts, nil
+		}
+
+		if partNumber > MaxPartCount {
+			closeTemp(file)
+			return nil, fmt.Errorf("too many parts, part size %v is too small", mani.PartSize)
+		}
+
+		part := Part{
+			PartNumber: partNumber,
+			Size:       n,
+			Hash:       hasher.Sum(nil),
+		}
+		parts = append(parts, part)
+
+		t := partTask{part: part, file: file}
+		if mani.HasPart(part) {
+			closeTemp(file)
+			t.file = nil
+		}
+
+		select {
+		case tasks <- t:
+		case <-ctx.Done():
+			if t.file != nil {
+				closeTemp(t.file)
+			}
+			return nil, ctx.Err()
+		}
+
+		if n < mani.PartSize {
+			return parts, nil
+		}
+	}
+}
+
+func (u *Uploader) uploadPart(ctx context.Context, mani *manifest, t partTask) error {
+	if t.file == nil {
+		return nil
+	}
+	defer closeTemp(t.file)
+
+	// 其他分段失败后，剩下的分段都不需要上传了
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	var err error
+	interval := u.cfg.RetryInterval
+	for i := 0; i <= u.cfg.MaxRetries; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			interval *= 2
+		}
+
+		var etag string
+		etag, err = u.backend.UploadPart(ctx, mani.Key, mani.UploadID, t.part.PartNumber, io.NewSectionReader(t.file, 0, t.part.Size), t.part.Size)
+		if err == nil {
+			t.part.ETag = etag
+			return mani.AddPart(t.part)
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// 上传任务不存在时重试也没有用
+		if errors.Is(err, ErrUploadNotFound) {
+			break
+		}
+	}
+
+	return fmt.Errorf("upload part %v: %w", t.part.PartNumber, err)
+}
+
+func closeTemp(file *os.File) {
+	file.Close()
+	os.Remove(file.Name())
+}
@@ -0,0 +1,245 @@
+package multipart
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+	"gitlink.org.cn/cloudream/common/sdks/storage/s3"
+)
+
+// 可以让指定的分段上传失败的后端
+type flakyBackend struct {
+	Backend
+	lock             sync.Mutex
+	failures         map[int]int // 分段编号 -> 剩余的失败次数
+	completeFailures int         // 合并分段的剩余失败次数
+	uploaded         []int
+	onUpload         func(partNumber int)
+}
+
+func (b *flakyBackend) UploadPart(ctx context.Context, key string, uploadID string, partNumber int, body io.Reader, size int64) (string, error) {
+	if b.onUpload != nil {
+		b.onUpload(partNumber)
+	}
+
+	b.lock.Lock()
+	if b.failures[partNumber] > 0 {
+		b.failures[partNumber]--
+		b.lock.Unlock()
+		return "", errors.New("injected failure")
+	}
+	b.uploaded = append(b.uploaded, partNumber)
+	b.lock.Unlock()
+
+	return b.Backend.UploadPart(ctx, key, uploadID, partNumber, body, size)
+}
+
+func (b *flakyBackend) Complete(ctx context.Context, key string, uploadID string, parts []Part) error {
+	b.lock.Lock()
+	if b.completeFailures > 0 {
+		b.completeFailures--
+		b.lock.Unlock()
+		return errors.New("injected failure")
+	}
+	b.lock.Unlock()
+
+	return b.Backend.Complete(ctx, key, uploadID, parts)
+}
+
+func Test_Uploader(t *testing.T) {
+	ctx := context.Background()
+
+	data := make([]byte, 1000)
+	rand.New(rand.NewSource(0)).Read(data)
+
+	newBackend := func() (*s3.FakeServer, *flakyBackend) {
+		srv := s3.NewFakeServer("bucket")
+		cli, err := s3.NewClient(srv.Config())
+		So(err, ShouldBeNil)
+		return srv, &flakyBackend{Backend: NewS3Backend(cli), failures: make(map[int]int)}
+	}
+
+	newConfig := func() Config {
+		return Config{
+			Feature: cdssdk.MultipartUploadFeature{
+				TempDir:     t.TempDir(),
+				MinPartSize: 100,
+				MaxPartSize: 300,
+			},
+			PartSize:      64,
+			Concurrency:   3,
+			RetryInterval: time.Millisecond,
+		}
+	}
+
+	expectedHash := func(data []byte, partSize int) cdssdk.FileHash {
+		var hashes [][]byte
+		for i := 0; i < len(data); i += partSize {
+			end := i + partSize
+			if end > len(data) {
+				end = len(data)
+			}
+			h := sha256.Sum256(data[i:end])
+			hashes = append(hashes, h[:])
+		}
+		return cdssdk.CalculateCompositeHash(hashes)
+	}
+
+	Convey("分段大小限制", t, func() {
+		u := NewUploader(nil, newConfig())
+		So(u.PartSize(-1), ShouldEqual, 100)
+		So(u.PartSize(100*MaxPartCount+1), ShouldEqual, 101)
+		So(u.PartSize(1000*MaxPartCount), ShouldEqual, 300)
+	})
+
+	Convey("上传并计算哈希", t, func() {
+		srv, backend := newBackend()
+		defer srv.Close()
+
+		backend.failures[3] = 2
+		cfg := newConfig()
+		ret, err := NewUploader(backend, cfg).Upload(ctx, "obj", bytes.NewReader(data), -1)
+		So(err, ShouldBeNil)
+		So(ret.Size, ShouldEqual, len(data))
+		So(ret.Parts, ShouldHaveLength, 10)
+		So(ret.FileHash, ShouldEqual, expectedHash(data, 100))
+
+		got, ok := srv.GetObjectData("obj")
+		So(ok, ShouldBeTrue)
+		So(got, ShouldResemble, data)
+
+		entries, _ := os.ReadDir(cfg.Feature.TempDir)
+		So(entries, ShouldBeEmpty)
+	})
+
+	Convey("长度为分段大小的整数倍以及空的流", t, func() {
+		srv, backend := newBackend()
+		defer srv.Close()
+
+		ret, err := NewUploader(backend, newConfig()).Upload(ctx, "obj", bytes.NewReader(data[:200]), -1)
+		So(err, ShouldBeNil)
+		So(ret.Parts, ShouldHaveLength, 2)
+
+		ret, err = NewUploader(backend, newConfig()).Upload(ctx, "empty", bytes.NewReader(nil), -1)
+		So(err, ShouldBeNil)
+		So(ret.Parts, ShouldHaveLength, 1)
+		So(ret.Size, ShouldEqual, 0)
+	})
+
+	Convey("失败后恢复上传", t, func() {
+		srv, backend := newBackend()
+		defer srv.Close()
+
+		cfg := newConfig()
+		cfg.MaxRetries = -1
+		cfg.Concurrency = 1
+		backend.failures[5] = 1
+
+		_, err := NewUploader(backend, cfg).Upload(ctx, "obj", bytes.NewReader(data), -1)
+		So(err, ShouldNotBeNil)
+		So(srv.UploadCount(), ShouldEqual, 1)
+		So(backend.uploaded, ShouldResemble, []int{1, 2, 3, 4})
+
+		backend.uploaded = nil
+		ret, err := NewUploader(backend, cfg).Upload(ctx, "obj", bytes.NewReader(data), -1)
+		So(err, ShouldBeNil)
+		So(backend.uploaded, ShouldResemble, []int{5, 6, 7, 8, 9, 10})
+		So(ret.FileHash, ShouldEqual, expectedHash(data, 100))
+
+		got, _ := srv.GetObjectData("obj")
+		So(got, ShouldResemble, data)
+		So(srv.UploadCount(), ShouldEqual, 0)
+	})
+
+	Convey("恢复上传时上传任务已经不存在", t, func() {
+		srv, backend := newBackend()
+		defer srv.Close()
+
+		cfg := newConfig()
+		cfg.MaxRetries = -1
+		cfg.Concurrency = 1
+
+		// 上传失败，然后让存储服务清理掉这个上传任务
+		forget := func() {
+			_, err := NewUploader(backend, cfg).Upload(ctx, "obj", bytes.NewReader(data), -1)
+			So(err, ShouldNotBeNil)
+
+			mani, err := loadManifest(cfg.Feature.TempDir, "obj")
+			So(err, ShouldBeNil)
+			So(mani, ShouldNotBeNil)
+			So(backend.Abort(ctx, "obj", mani.UploadID), ShouldBeNil)
+			So(srv.UploadCount(), ShouldEqual, 0)
+			backend.uploaded = nil
+		}
+
+		backend.failures[5] = 1
+		forget()
+		ret, err := NewUploader(backend, cfg).Upload(ctx, "obj", bytes.NewReader(data), -1)
+		So(err, ShouldBeNil)
+		So(backend.uploaded, ShouldResemble, []int{5, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+		So(ret.FileHash, ShouldEqual, expectedHash(data, 100))
+
+		got, _ := srv.GetObjectData("obj")
+		So(got, ShouldResemble, data)
+		So(srv.UploadCount(), ShouldEqual, 0)
+
+		entries, _ := os.ReadDir(cfg.Feature.TempDir)
+		So(entries, ShouldBeEmpty)
+
+		// 所有分段都已经上传过，合并时才发现上传任务不存在
+		backend.completeFailures = 1
+		forget()
+		_, err = NewUploader(backend, cfg).Upload(ctx, "obj", bytes.NewReader(data), -1)
+		So(err, ShouldBeNil)
+		So(backend.uploaded, ShouldResemble, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+		So(srv.UploadCount(), ShouldEqual, 0)
+
+		// 流不能回到起始位置时，删除记录后返回错误，下次上传时重新开始
+		backend.failures[5] = 1
+		forget()
+		_, err = NewUploader(backend, cfg).Upload(ctx, "obj", io.MultiReader(bytes.NewReader(data)), -1)
+		So(errors.Is(err, ErrUploadNotFound), ShouldBeTrue)
+
+		mani, err := loadManifest(cfg.Feature.TempDir, "obj")
+		So(err, ShouldBeNil)
+		So(mani, ShouldBeNil)
+
+		backend.uploaded = nil
+		_, err = NewUploader(backend, cfg).Upload(ctx, "obj", io.MultiReader(bytes.NewReader(data)), -1)
+		So(err, ShouldBeNil)
+		So(backend.uploaded, ShouldResemble, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+	})
+
+	Convey("取消上传", t, func() {
+		srv, backend := newBackend()
+		defer srv.Close()
+
+		cfg := newConfig()
+		cctx, cancel := context.WithCancel(ctx)
+		backend.onUpload = func(partNumber int) {
+			if partNumber == 4 {
+				cancel()
+			}
+		}
+
+		_, err := NewUploader(backend, cfg).Upload(cctx, "obj", bytes.NewReader(data), -1)
+		So(errors.Is(err, context.Canceled), ShouldBeTrue)
+		So(srv.UploadCount(), ShouldEqual, 0)
+
+		_, ok := srv.GetObjectData("obj")
+		So(ok, ShouldBeFalse)
+
+		entries, _ := os.ReadDir(cfg.Feature.TempDir)
+		So(entries, ShouldBeEmpty)
+	})
+}
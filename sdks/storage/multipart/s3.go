@@ -0,0 +1,59 @@
+package multipart
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"gitlink.org.cn/cloudream/common/sdks/storage/s3"
+)
+
+type s3Backend struct {
+	cli *s3.Client
+}
+
+// 使用兼容S3协议的对象存储作为分段上传的后端
+func NewS3Backend(cli *s3.Client) Backend {
+	return &s3Backend{
+		cli: cli,
+	}
+}
+
+func (b *s3Backend) Initiate(ctx context.Context, key string) (string, error) {
+	return b.cli.CreateMultipartUpload(ctx, key)
+}
+
+func (b *s3Backend) UploadPart(ctx context.Context, key string, uploadID string, partNumber int, body io.Reader, size int64) (string, error) {
+	part, err := b.cli.UploadPart(ctx, key, uploadID, partNumber, body, size)
+	if err != nil {
+		return "", convertS3Error(err)
+	}
+
+	return part.ETag, nil
+}
+
+func (b *s3Backend) Complete(ctx context.Context, key string, uploadID string, parts []Part) error {
+	s3Parts := make([]s3.UploadedPart, len(parts))
+	for i, p := range parts {
+		s3Parts[i] = s3.UploadedPart{
+			PartNumber: p.PartNumber,
+			ETag:       p.ETag,
+			Size:       p.Size,
+		}
+	}
+
+	_, err := b.cli.CompleteMultipartUpload(ctx, key, uploadID, s3Parts)
+	return convertS3Error(err)
+}
+
+func (b *s3Backend) Abort(ctx context.Context, key string, uploadID string) error {
+	return b.cli.AbortMultipartUpload(ctx, key, uploadID)
+}
+
+// 上传任务不存在的错误需要包装ErrUploadNotFound
+func convertS3Error(err error) error {
+	if s3.IsNotFound(err) {
+		return fmt.Errorf("%w: %w", ErrUploadNotFound, err)
+	}
+	return err
+}
@@ -0,0 +1,240 @@
+package placement
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+	"gitlink.org.cn/cloudream/common/utils/math2"
+	"gitlink.org.cn/cloudream/common/utils/sort2"
+)
+
+var ErrNoAvailableStorage = errors.New("no storage has enough free space")
+
+type Storage struct {
+	cdssdk.Storage
+	// 剩余可用空间，小于0时代表未知，不做限制
+	FreeSpace int64
+}
+
+type Input struct {
+	// 候选的Hub，Storage的位置由它的MasterHub的LocationID决定
+	Hubs []cdssdk.Hub
+	// 候选的Storage，MasterHub不在Hubs中的会被忽略
+	Storages []Storage
+	// Hub之间的延迟，只会用到从Uploader出发的记录
+	Connectivities []cdssdk.HubConnectivity
+	// 上传者所在的Hub，为0时不考虑延迟
+	Uploader cdssdk.HubID
+	// 对象的冗余方式
+	Redundancy cdssdk.Redundancy
+	// 对象的大小，用于计算每个块的大小
+	ObjectSize int64
+}
+
+type Assignment struct {
+	Index      int               `json:"index"` // 块的编号
+	Size       int64             `json:"size"`  // 块的大小
+	StorageID  cdssdk.StorageID  `json:"storageID"`
+	HubID      cdssdk.HubID      `json:"hubID"`
+	LocationID cdssdk.LocationID `json:"locationID"`
+}
+
+// 为对象的每个块选择一个Storage，返回的结果按块的编号排列。选择的规则按优先级从高到低为：
+//  1. 同一个LRC组的块（包括组校验块）分布在不同的Location，使得任意一个Location故障时每个组最多只丢失一个块
+//  2. 所有块尽量均匀地分布在不同的Location
+//  3. 块尽量放在不同的Storage
+//  4. 优先选择离上传者近的Storage：同一个Hub，同一个Location，最后是其他Location，同一级中按延迟从小到大选择
+//
+// 候选的Storage比块少时，同一个Storage会被分配多个块。
+func Plan(input Input) ([]Assignment, error) {
+	blocks, err := splitBlocks(input.Redundancy, input.ObjectSize)
+	if err != nil {
+		return nil, err
+	}
+
+	cands := makeCandidates(input)
+
+	// 记录已分配的块的分布情况
+	locBlocks := make(map[cdssdk.LocationID]int)
+	grpLocBlocks := make(map[int]map[cdssdk.LocationID]int)
+
+	var asses []Assignment
+	for _, blk := range blocks {
+		var best *candidate
+		for _, cand := range cands {
+			if cand.freeSpace >= 0 && cand.freeSpace < blk.size {
+				continue
+			}
+
+			if best == nil || compareCandidate(cand, best, blk.group, locBlocks, grpLocBlocks) < 0 {
+				best = cand
+			}
+		}
+
+		if best == nil {
+			return nil, fmt.Errorf("placing block %v: %w", blk.index, ErrNoAvailableStorage)
+		}
+
+		if best.freeSpace >= 0 {
+			best.freeSpace -= blk.size
+		}
+		best.blocks++
+		locBlocks[best.locationID]++
+		if blk.group >= 0 {
+			if grpLocBlocks[blk.group] == nil {
+				grpLocBlocks[blk.group] = make(map[cdssdk.LocationID]int)
+			}
+			grpLocBlocks[blk.group][best.locationID]++
+		}
+
+		asses = append(asses, Assignment{
+			Index:      blk.index,
+			Size:       blk.size,
+			StorageID:  best.storageID,
+			HubID:      best.hubID,
+			LocationID: best.locationID,
+		})
+	}
+
+	return asses, nil
+}
+
+type block struct {
+	index int
+	size  int64
+	group int // 所属的LRC组，不属于任何组时为-1
+}
+
+// 根据冗余方式计算每个块的大小
+func splitBlocks(red cdssdk.Redundancy, objSize int64) ([]block, error) {
+	var blocks []block
+	switch red := red.(type) {
+	case *cdssdk.NoneRedundancy:
+		blocks = append(blocks, block{index: 0, size: objSize, group: -1})
+
+	case *cdssdk.RepRedundancy:
+		for i := 0; i < red.RepCount; i++ {
+			blocks = append(blocks, block{index: i, size: objSize, group: -1})
+		}
+
+	case *cdssdk.ECRedundancy:
+		size := math2.CeilDiv(objSize, red.StripSize()) * int64(red.ChunkSize)
+		for i := 0; i < red.N; i++ {
+			blocks = append(blocks, block{index: i, size: size, group: -1})
+		}
+
+	case *cdssdk.LRCRedundancy:
+		size := math2.CeilDiv(objSize, int64(red.ChunkSize)*int64(red.K)) * int64(red.ChunkSize)
+		for i := 0; i < red.N; i++ {
+			blocks = append(blocks, block{index: i, size: size, group: red.FindGroup(i)})
+		}
+
+	case *cdssdk.SegmentRedundancy:
+		for i, seg := range red.Segments {
+			blocks = append(blocks, block{index: i, size: seg, group: -1})
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported redundancy type: %T", red)
+	}
+
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("redundancy has no block")
+	}
+	return blocks, nil
+}
+
+type distanceLevel int
+
+const (
+	distanceSameHub distanceLevel = iota
+	distanceSameLocation
+	distanceOther
+)
+
+type candidate struct {
+	storageID  cdssdk.StorageID
+	hubID      cdssdk.HubID
+	locationID cdssdk.LocationID
+	freeSpace  int64
+	distance   distanceLevel
+	latency    float64 // 未知时为+Inf
+	blocks     int     // 已经分配的块数
+}
+
+func makeCandidates(input Input) []*candidate {
+	hubs := make(map[cdssdk.HubID]*cdssdk.Hub)
+	for i := range input.Hubs {
+		hubs[input.Hubs[i].HubID] = &input.Hubs[i]
+	}
+
+	latencies := make(map[cdssdk.HubID]float64)
+	for _, conn := range input.Connectivities {
+		if conn.FromHubID == input.Uploader && conn.Latency != nil {
+			latencies[conn.ToHubID] = float64(*conn.Latency)
+		}
+	}
+
+	uploader, hasUploader := hubs[input.Uploader]
+
+	var cands []*candidate
+	for _, stg := range input.Storages {
+		hub, ok := hubs[stg.MasterHub]
+		if !ok {
+			continue
+		}
+
+		cand := &candidate{
+			storageID:  stg.StorageID,
+			hubID:      hub.HubID,
+			locationID: hub.LocationID,
+			freeSpace:  stg.FreeSpace,
+			distance:   distanceOther,
+			latency:    math.Inf(1),
+		}
+
+		if lat, ok := latencies[hub.HubID]; ok {
+			cand.latency = lat
+		}
+
+		if input.Uploader != 0 && hub.HubID == input.Uploader {
+			cand.distance = distanceSameHub
+			cand.latency = 0
+		} else if hasUploader && hub.LocationID == uploader.LocationID {
+			cand.distance = distanceSameLocation
+		}
+
+		cands = append(cands, cand)
+	}
+
+	return cands
+}
+
+func compareCandidate(left, right *candidate, group int, locBlocks map[cdssdk.LocationID]int, grpLocBlocks map[int]map[cdssdk.LocationID]int) int {
+	if group >= 0 {
+		grpBlocks := grpLocBlocks[group]
+		if c := sort2.Cmp(grpBlocks[left.locationID], grpBlocks[right.locationID]); c != 0 {
+			return c
+		}
+	}
+
+	if c := sort2.Cmp(locBlocks[left.locationID], locBlocks[right.locationID]); c != 0 {
+		return c
+	}
+
+	if c := sort2.Cmp(left.blocks, right.blocks); c != 0 {
+		return c
+	}
+
+	if c := sort2.Cmp(left.distance, right.distance); c != 0 {
+		return c
+	}
+
+	if c := sort2.Cmp(left.latency, right.latency); c != 0 {
+		return c
+	}
+
+	return sort2.Cmp(left.storageID, right.storageID)
+}
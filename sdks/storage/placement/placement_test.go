@@ -0,0 +1,108 @@
+package placement
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+)
+
+func latency(from, to cdssdk.HubID, lat float32) cdssdk.HubConnectivity {
+	return cdssdk.HubConnectivity{FromHubID: from, ToHubID: to, Latency: &lat}
+}
+
+func storage(id cdssdk.StorageID, hub cdssdk.HubID, free int64) Storage {
+	return Storage{Storage: cdssdk.Storage{StorageID: id, MasterHub: hub}, FreeSpace: free}
+}
+
+func Test_Plan(t *testing.T) {
+	hubs := []cdssdk.Hub{
+		{HubID: 1, LocationID: 1},
+		{HubID: 2, LocationID: 2},
+		{HubID: 3, LocationID: 3},
+		{HubID: 4, LocationID: 3},
+	}
+	conns := []cdssdk.HubConnectivity{
+		latency(1, 2, 10),
+		latency(1, 3, 50),
+		latency(1, 4, 5),
+	}
+
+	Convey("EC的块分布在不同的Location，并优先选择近的", t, func() {
+		asses, err := Plan(Input{
+			Hubs: hubs,
+			Storages: []Storage{
+				storage(1, 1, -1),
+				storage(2, 1, -1),
+				storage(3, 2, -1),
+				storage(4, 3, -1),
+				storage(5, 4, -1),
+			},
+			Connectivities: conns,
+			Uploader:       1,
+			Redundancy:     cdssdk.NewECRedundancy(2, 3, 1024),
+			ObjectSize:     4096,
+		})
+		So(err, ShouldBeNil)
+		So(asses, ShouldResemble, []Assignment{
+			{Index: 0, Size: 2048, StorageID: 1, HubID: 1, LocationID: 1},
+			{Index: 1, Size: 2048, StorageID: 5, HubID: 4, LocationID: 3},
+			{Index: 2, Size: 2048, StorageID: 3, HubID: 2, LocationID: 2},
+		})
+	})
+
+	Convey("LRC同一个组的块不在同一个Location", t, func() {
+		asses, err := Plan(Input{
+			Hubs: hubs,
+			Storages: []Storage{
+				storage(1, 1, -1),
+				storage(2, 1, -1),
+				storage(3, 2, -1),
+				storage(4, 3, -1),
+			},
+			Connectivities: conns,
+			Uploader:       1,
+			Redundancy:     cdssdk.NewLRCRedundancy(4, 6, []int{2, 2}, 1024),
+			ObjectSize:     4096,
+		})
+		So(err, ShouldBeNil)
+		So(asses, ShouldHaveLength, 6)
+
+		red := cdssdk.NewLRCRedundancy(4, 6, []int{2, 2}, 1024)
+		for grp := range red.Groups {
+			locs := make(map[cdssdk.LocationID]bool)
+			for _, idx := range red.GetGroupElements(grp) {
+				So(locs[asses[idx].LocationID], ShouldBeFalse)
+				locs[asses[idx].LocationID] = true
+			}
+		}
+	})
+
+	Convey("跳过空间不足的Storage，Storage不足时重复使用", t, func() {
+		asses, err := Plan(Input{
+			Hubs: hubs,
+			Storages: []Storage{
+				storage(1, 1, 100),
+				storage(2, 2, 2000),
+				storage(3, 3, 1000),
+			},
+			Connectivities: conns,
+			Uploader:       1,
+			Redundancy:     cdssdk.NewRepRedundancy(3),
+			ObjectSize:     1000,
+		})
+		So(err, ShouldBeNil)
+		So(asses[0].StorageID, ShouldEqual, 2)
+		So(asses[1].StorageID, ShouldEqual, 3)
+		So(asses[2].StorageID, ShouldEqual, 2)
+
+		_, err = Plan(Input{
+			Hubs:       hubs,
+			Storages:   []Storage{storage(1, 1, 100)},
+			Redundancy: cdssdk.NewRepRedundancy(1),
+			ObjectSize: 1000,
+		})
+		So(errors.Is(err, ErrNoAvailableStorage), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,255 @@
+package s3
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// 请求体使用aws-chunked编码时X-Amz-Content-Sha256的前缀
+	streamingPayloadPrefix = "STREAMING-"
+	// 每个分块都带有签名
+	streamingSignedPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	// 分块不签名，最后一个分块之后带有校验和
+	streamingUnsignedTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+
+	headerDecodedContentLength = "X-Amz-Decoded-Content-Length"
+
+	chunkSignAlgorithm = "AWS4-HMAC-SHA256-PAYLOAD"
+)
+
+var (
+	errUnsupportedPayload     = errors.New("unsupported " + headerContentSHA256)
+	errChunkSignatureMismatch = errors.New("chunk signature does not match")
+	errInvalidChunk           = errors.New("invalid aws-chunked body")
+)
+
+// 计算aws-chunked编码中每个分块的签名。第一个分块的上一个签名是请求本身的签名
+type chunkSigner struct {
+	key       []byte
+	timestamp string
+	scope     string
+	prev      string
+}
+
+// 计算下一个分块的签名，dataHash是分块数据的SHA256
+func (c *chunkSigner) next(dataHash string) string {
+	strToSign := strings.Join([]string{
+		chunkSignAlgorithm,
+		c.timestamp,
+		c.scope,
+		c.prev,
+		emptyPayloadHash,
+		dataHash,
+	}, "\n")
+
+	c.prev = hex.EncodeToString(hmacSHA256(c.key, strToSign))
+	return c.prev
+}
+
+// 如果请求体使用了aws-chunked编码，则将请求体替换为解码后的流。signer不为nil时会检查每个分块的签名，
+// 读取到签名不一致的分块时返回errChunkSignatureMismatch。最后一个分块之后的校验和不会检查。
+//
+// 不支持的编码方式返回errUnsupportedPayload。
+func decodeChunkedBody(req *http.Request, signer *chunkSigner) error {
+	payloadHash := req.Header.Get(headerContentSHA256)
+	if !strings.HasPrefix(payloadHash, streamingPayloadPrefix) || req.Body == nil {
+		return nil
+	}
+
+	reader := &chunkedReader{
+		body:       req.Body,
+		rd:         bufio.NewReader(req.Body),
+		hash:       sha256.New(),
+		decodedLen: -1,
+	}
+
+	switch payloadHash {
+	case streamingSignedPayload:
+		reader.signer = signer
+	case streamingUnsignedTrailer:
+		reader.trailer = true
+	default:
+		return fmt.Errorf("%w: %v", errUnsupportedPayload, payloadHash)
+	}
+
+	if l := req.Header.Get(headerDecodedContentLength); l != "" {
+		n, err := strconv.ParseInt(l, 10, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("%w: invalid %v header: %q", errInvalidChunk, headerDecodedContentLength, l)
+		}
+		reader.decodedLen = n
+	}
+
+	req.Body = reader
+	req.ContentLength = reader.decodedLen
+	return nil
+}
+
+// 解码aws-chunked编码的数据流
+type chunkedReader struct {
+	body       io.ReadCloser
+	rd         *bufio.Reader
+	signer     *chunkSigner // 为nil时不检查分块的签名
+	trailer    bool         // 最后一个分块之后是否带有尾部
+	decodedLen int64        // 解码后的长度，为-1代表不检查
+	hash       hash.Hash    // 当前分块数据的SHA256
+	chunkSig   string       // 当前分块的签名
+	remain     int64        // 当前分块剩余的数据量
+	total      int64
+	err        error
+}
+
+func (r *chunkedReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	if r.remain == 0 {
+		if err := r.nextChunk(); err != nil {
+			r.err = err
+			return 0, err
+		}
+		if r.err != nil {
+			return 0, r.err
+		}
+	}
+
+	if int64(len(p)) > r.remain {
+		p = p[:r.remain]
+	}
+
+	n, err := r.rd.Read(p)
+	r.hash.Write(p[:n])
+	r.remain -= int64(n)
+	r.total += int64(n)
+
+	if err == io.EOF {
+		err = fmt.Errorf("%w: %v", errInvalidChunk, io.ErrUnexpectedEOF)
+	}
+	// 分块的数据读完后立刻检查签名，以便尽早发现错误
+	if err == nil && r.remain == 0 {
+		err = r.endChunk()
+	}
+	if err != nil {
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *chunkedReader) Close() error {
+	return r.body.Close()
+}
+
+// 读取下一个分块的头部。如果是最后一个分块，则读取尾部，然后将r.err设置为io.EOF
+func (r *chunkedReader) nextChunk() error {
+	line, err := r.readLine()
+	if err != nil {
+		return err
+	}
+
+	sizeStr, ext, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(sizeStr, 16, 64)
+	if err != nil || size < 0 {
+		return fmt.Errorf("%w: invalid chunk size: %q", errInvalidChunk, sizeStr)
+	}
+
+	r.chunkSig = ""
+	if k, v, ok := strings.Cut(ext, "="); ok && k == "chunk-signature" {
+		r.chunkSig = v
+	}
+	r.hash.Reset()
+	r.remain = size
+	if size > 0 {
+		return nil
+	}
+
+	// 最后一个分块没有数据
+	if err := r.verifyChunk(); err != nil {
+		return err
+	}
+
+	if r.trailer {
+		// 尾部是若干行校验和，以空行结束。部分客户端会省略最后的空行
+		for {
+			line, err := r.readLine()
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if line == "" {
+				break
+			}
+		}
+	} else {
+		line, err := r.readLine()
+		if err != nil {
+			return err
+		}
+		if line != "" {
+			return fmt.Errorf("%w: unexpected data after last chunk", errInvalidChunk)
+		}
+	}
+
+	if r.decodedLen >= 0 && r.total != r.decodedLen {
+		return fmt.Errorf("%w: decoded length %v not equals to %v header %v", errInvalidChunk, r.total, headerDecodedContentLength, r.decodedLen)
+	}
+
+	r.err = io.EOF
+	return nil
+}
+
+// 读取分块数据之后的换行，并检查分块的签名
+func (r *chunkedReader) endChunk() error {
+	line, err := r.readLine()
+	if err != nil {
+		return err
+	}
+	if line != "" {
+		return fmt.Errorf("%w: chunk is longer than its size", errInvalidChunk)
+	}
+
+	return r.verifyChunk()
+}
+
+func (r *chunkedReader) verifyChunk() error {
+	if r.signer == nil {
+		return nil
+	}
+
+	expected := r.signer.next(hex.EncodeToString(r.hash.Sum(nil)))
+	if !hmac.Equal([]byte(expected), []byte(r.chunkSig)) {
+		return errChunkSignatureMismatch
+	}
+	return nil
+}
+
+// 读取以\r\n结尾的一行，返回的内容不包括\r\n
+func (r *chunkedReader) readLine() (string, error) {
+	line, err := r.rd.ReadSlice('\n')
+	if err == io.EOF {
+		return "", fmt.Errorf("%w: %v", errInvalidChunk, io.ErrUnexpectedEOF)
+	}
+	if err == bufio.ErrBufferFull {
+		return "", fmt.Errorf("%w: line too long", errInvalidChunk)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.HasSuffix(string(line), "\r\n") {
+		return "", fmt.Errorf("%w: line does not end with CRLF", errInvalidChunk)
+	}
+	return strings.TrimSuffix(string(line), "\r\n"), nil
+}
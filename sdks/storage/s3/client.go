@@ -0,0 +1,221 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+	"gitlink.org.cn/cloudream/common/utils/math2"
+)
+
+type Config struct {
+	Endpoint string `json:"endpoint"` // 可以包含协议，不包含时使用https
+	Region   string `json:"region"`
+	AK       string `json:"accessKeyId"`
+	SK       string `json:"secretAccessKey"`
+	Bucket   string `json:"bucket"`
+	// 使用路径风格的地址（http://endpoint/bucket/key），否则使用虚拟主机风格的地址（http://bucket.endpoint/key）
+	PathStyle bool `json:"pathStyle"`
+	// 为nil时使用http.DefaultClient
+	HTTPClient *http.Client `json:"-"`
+}
+
+// 兼容S3协议的对象存储客户端
+type Client struct {
+	cfg    Config
+	scheme string
+	host   string
+	signer signer
+	http   *http.Client
+}
+
+func NewClient(cfg Config) (*Client, error) {
+	endpoint := cfg.Endpoint
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parsing endpoint: %w", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("endpoint %q has no host", cfg.Endpoint)
+	}
+
+	cli := &Client{
+		cfg:    cfg,
+		scheme: u.Scheme,
+		host:   u.Host,
+		signer: signer{
+			ak:     cfg.AK,
+			sk:     cfg.SK,
+			region: cfg.Region,
+		},
+		http: cfg.HTTPClient,
+	}
+	if cli.http == nil {
+		cli.http = http.DefaultClient
+	}
+
+	return cli, nil
+}
+
+// 根据存储服务的类型创建客户端，支持OBS、OSS、COS
+func NewClientFromStorage(typ cdssdk.StorageType) (*Client, error) {
+	switch t := typ.(type) {
+	case *cdssdk.OBSType:
+		return NewClient(Config{Endpoint: t.Endpoint, Region: t.Region, AK: t.AK, SK: t.SK, Bucket: t.Bucket})
+	case *cdssdk.OSSType:
+		return NewClient(Config{Endpoint: t.Endpoint, Region: t.Region, AK: t.AK, SK: t.SK, Bucket: t.Bucket})
+	case *cdssdk.COSType:
+		return NewClient(Config{Endpoint: t.Endpoint, Region: t.Region, AK: t.AK, SK: t.SK, Bucket: t.Bucket})
+	}
+
+	return nil, fmt.Errorf("unsupported storage type: %v", typ)
+}
+
+// 服务端返回的错误
+type Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+	RequestID  string `xml:"RequestId"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("s3 error: status: %d, code: %s, message: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// 判断错误是否代表对象或者分段上传任务不存在
+func IsNotFound(err error) bool {
+	var e *Error
+	if !errors.As(err, &e) {
+		return false
+	}
+
+	return e.StatusCode == http.StatusNotFound || e.Code == "NoSuchKey" || e.Code == "NoSuchUpload"
+}
+
+type request struct {
+	method string
+	key    string
+	query  url.Values
+	header http.Header
+	body   io.Reader
+	size   int64
+	// 请求体的SHA256，为空时：没有请求体则使用空字符串的SHA256，否则不对请求体签名
+	payloadHash string
+}
+
+func (c *Client) do(ctx context.Context, r request) (*http.Response, error) {
+	u := url.URL{
+		Scheme:   c.scheme,
+		Host:     c.host,
+		Path:     "/" + r.key,
+		RawQuery: strings.ReplaceAll(r.query.Encode(), "+", "%20"),
+	}
+	if c.cfg.PathStyle {
+		u.Path = "/" + c.cfg.Bucket + "/" + r.key
+	} else {
+		u.Host = c.cfg.Bucket + "." + c.host
+	}
+	u.RawPath = uriEncode(u.Path, false)
+
+	req, err := http.NewRequestWithContext(ctx, r.method, u.String(), r.body)
+	if err != nil {
+		return nil, err
+	}
+	if r.body != nil {
+		req.ContentLength = r.size
+	}
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+
+	payloadHash := r.payloadHash
+	if payloadHash == "" {
+		if r.body == nil {
+			payloadHash = emptyPayloadHash
+		} else {
+			payloadHash = unsignedPayload
+		}
+	}
+	c.signer.Sign(req, payloadHash, time.Now())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, parseError(resp)
+	}
+
+	return resp, nil
+}
+
+func (c *Client) doXML(ctx context.Context, r request, ret any) error {
+	resp, err := c.do(ctx, r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading response: %w", err)
+	}
+
+	// 部分接口（比如CompleteMultipartUpload）在返回200之后，仍然可能在响应体中返回错误
+	var root struct {
+		XMLName xml.Name
+	}
+	if xml.Unmarshal(body, &root) == nil && root.XMLName.Local == "Error" {
+		e := &Error{
+			StatusCode: resp.StatusCode,
+		}
+		xml.Unmarshal(body, e)
+		return e
+	}
+
+	err = xml.Unmarshal(body, ret)
+	if err != nil {
+		return fmt.Errorf("parsing response: %w", err)
+	}
+
+	return nil
+}
+
+func parseError(resp *http.Response) error {
+	e := &Error{
+		StatusCode: resp.StatusCode,
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if len(body) > 0 {
+		xml.Unmarshal(body, e)
+	}
+
+	if e.Code == "" {
+		e.Code = http.StatusText(resp.StatusCode)
+	}
+
+	return e
+}
+
+func formatRange(rng math2.Range) string {
+	if rng.Length == nil {
+		return fmt.Sprintf("bytes=%d-", rng.Offset)
+	}
+
+	return fmt.Sprintf("bytes=%d-%d", rng.Offset, rng.Offset+*rng.Length-1)
+}
@@ -0,0 +1,450 @@
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	FakeAK     = "fake-access-key"
+	FakeSK     = "fake-secret-key"
+	FakeRegion = "fake-region"
+)
+
+// 在内存中模拟的S3服务，只有一个桶，使用路径风格的地址，会检查请求的签名。用于测试。
+type FakeServer struct {
+	*httptest.Server
+	Bucket  string
+	signer  signer
+	lock    sync.Mutex
+	objects map[string]*fakeObject
+	uploads map[string]*fakeUpload
+}
+
+type fakeObject struct {
+	data    []byte
+	etag    string
+	modTime time.Time
+}
+
+type fakeUpload struct {
+	key   string
+	parts map[int]*fakeObject
+}
+
+func NewFakeServer(bucket string) *FakeServer {
+	s := &FakeServer{
+		Bucket: bucket,
+		signer: signer{
+			ak:     FakeAK,
+			sk:     FakeSK,
+			region: FakeRegion,
+		},
+		objects: make(map[string]*fakeObject),
+		uploads: make(map[string]*fakeUpload),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// 访问这个服务的客户端配置
+func (s *FakeServer) Config() Config {
+	return Config{
+		Endpoint:  s.URL,
+		Region:    FakeRegion,
+		AK:        FakeAK,
+		SK:        FakeSK,
+		Bucket:    s.Bucket,
+		PathStyle: true,
+	}
+}
+
+// 直接获取对象的数据，不存在时返回false
+func (s *FakeServer) GetObjectData(key string) ([]byte, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	obj, ok := s.objects[key]
+	if !ok {
+		return nil, false
+	}
+	return obj.data, true
+}
+
+// 正在进行的分段上传任务的数量
+func (s *FakeServer) UploadCount() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.uploads)
+}
+
+func (s *FakeServer) serve(w http.ResponseWriter, r *http.Request) {
+	err := s.signer.Verify(r)
+	if err != nil {
+		writeFakeError(w, http.StatusForbidden, "SignatureDoesNotMatch", err.Error())
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.Bucket {
+		writeFakeError(w, http.StatusNotFound, "NoSuchBucket", bucket)
+		return
+	}
+
+	query := r.URL.Query()
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		s.listObjects(w, r)
+	case query.Has("uploads") && r.Method == http.MethodPost:
+		s.createUpload(w, key)
+	case query.Has("uploadId"):
+		s.serveUpload(w, r, key, query.Get("uploadId"))
+	case r.Method == http.MethodPut:
+		s.putObject(w, r, key)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		s.getObject(w, r, key)
+	case r.Method == http.MethodDelete:
+		s.lock.Lock()
+		delete(s.objects, key)
+		s.lock.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeFakeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+func (s *FakeServer) putObject(w http.ResponseWriter, r *http.Request, key string) {
+	obj, err := readFakeObject(r.Body)
+	if err != nil {
+		writeFakeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+
+	s.lock.Lock()
+	s.objects[key] = obj
+	s.lock.Unlock()
+
+	w.Header().Set("ETag", obj.etag)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *FakeServer) getObject(w http.ResponseWriter, r *http.Request, key string) {
+	s.lock.Lock()
+	obj, ok := s.objects[key]
+	s.lock.Unlock()
+
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "NoSuchKey", key)
+		return
+	}
+
+	w.Header().Set("ETag", obj.etag)
+	w.Header().Set("Last-Modified", obj.modTime.UTC().Format(http.TimeFormat))
+
+	data := obj.data
+	status := http.StatusOK
+	if rng := r.Header.Get("Range"); rng != "" {
+		start, end, err := parseFakeRange(rng, int64(len(data)))
+		if err != nil {
+			writeFakeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, len(data)))
+		data = data[start:end]
+		status = http.StatusPartialContent
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		w.Write(data)
+	}
+}
+
+func (s *FakeServer) listObjects(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	token := query.Get("continuation-token")
+	maxKeys := 1000
+	if mk, err := strconv.Atoi(query.Get("max-keys")); err == nil && mk > 0 {
+		maxKeys = mk
+	}
+
+	s.lock.Lock()
+	var keys []string
+	for k := range s.objects {
+		if strings.HasPrefix(k, prefix) && k > token {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	type commonPrefix struct {
+		Prefix string `xml:"Prefix"`
+	}
+	type contents struct {
+		Key          string `xml:"Key"`
+		Size         int64  `xml:"Size"`
+		ETag         string `xml:"ETag"`
+		LastModified string `xml:"LastModified"`
+	}
+	type listBucketResult struct {
+		XMLName               xml.Name       `xml:"ListBucketResult"`
+		Name                  string         `xml:"Name"`
+		Prefix                string         `xml:"Prefix"`
+		KeyCount              int            `xml:"KeyCount"`
+		IsTruncated           bool           `xml:"IsTruncated"`
+		NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+		Contents              []contents     `xml:"Contents"`
+		CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+	}
+
+	ret := listBucketResult{
+		Name:   s.Bucket,
+		Prefix: prefix,
+	}
+	prefixes := make(map[string]bool)
+	for _, k := range keys {
+		if ret.KeyCount >= maxKeys {
+			ret.IsTruncated = true
+			break
+		}
+
+		if delimiter != "" {
+			if idx := strings.Index(k[len(prefix):], delimiter); idx >= 0 {
+				p := k[:len(prefix)+idx+len(delimiter)]
+				if !prefixes[p] {
+					prefixes[p] = true
+					ret.CommonPrefixes = append(ret.CommonPrefixes, commonPrefix{Prefix: p})
+					ret.KeyCount++
+				}
+				ret.NextContinuationToken = k
+				continue
+			}
+		}
+
+		obj := s.objects[k]
+		ret.Contents = append(ret.Contents, contents{
+			Key:          k,
+			Size:         int64(len(obj.data)),
+			ETag:         obj.etag,
+			LastModified: obj.modTime.UTC().Format(time.RFC3339),
+		})
+		ret.KeyCount++
+		ret.NextContinuationToken = k
+	}
+	s.lock.Unlock()
+
+	if !ret.IsTruncated {
+		ret.NextContinuationToken = ""
+	}
+
+	writeFakeXML(w, ret)
+}
+
+func (s *FakeServer) createUpload(w http.ResponseWriter, key string) {
+	id := uuid.NewString()
+
+	s.lock.Lock()
+	s.uploads[id] = &fakeUpload{
+		key:   key,
+		parts: make(map[int]*fakeObject),
+	}
+	s.lock.Unlock()
+
+	writeFakeXML(w, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Bucket   string   `xml:"Bucket"`
+		Key      string   `xml:"Key"`
+		UploadID string   `xml:"UploadId"`
+	}{Bucket: s.Bucket, Key: key, UploadID: id})
+}
+
+func (s *FakeServer) serveUpload(w http.ResponseWriter, r *http.Request, key string, uploadID string) {
+	s.lock.Lock()
+	upload, ok := s.uploads[uploadID]
+	s.lock.Unlock()
+
+	if !ok || upload.key != key {
+		writeFakeError(w, http.StatusNotFound, "NoSuchUpload", uploadID)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		partNumber, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+		if err != nil || partNumber < 1 || partNumber > 10000 {
+			writeFakeError(w, http.StatusBadRequest, "InvalidArgument", "invalid part number")
+			return
+		}
+
+		part, err := readFakeObject(r.Body)
+		if err != nil {
+			writeFakeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+
+		s.lock.Lock()
+		upload.parts[partNumber] = part
+		s.lock.Unlock()
+
+		w.Header().Set("ETag", part.etag)
+		w.WriteHeader(http.StatusOK)
+
+	case http.MethodGet:
+		type part struct {
+			PartNumber int    `xml:"PartNumber"`
+			ETag       string `xml:"ETag"`
+			Size       int64  `xml:"Size"`
+		}
+		ret := struct {
+			XMLName  xml.Name `xml:"ListPartsResult"`
+			UploadID string   `xml:"UploadId"`
+			Parts    []part   `xml:"Part"`
+		}{UploadID: uploadID}
+
+		s.lock.Lock()
+		for num, p := range upload.parts {
+			ret.Parts = append(ret.Parts, part{PartNumber: num, ETag: p.etag, Size: int64(len(p.data))})
+		}
+		s.lock.Unlock()
+		sort.Slice(ret.Parts, func(i, j int) bool { return ret.Parts[i].PartNumber < ret.Parts[j].PartNumber })
+
+		writeFakeXML(w, ret)
+
+	case http.MethodPost:
+		var req completeMultipartUpload
+		err := xml.NewDecoder(r.Body).Decode(&req)
+		if err != nil || len(req.Parts) == 0 {
+			writeFakeError(w, http.StatusBadRequest, "MalformedXML", "invalid complete request")
+			return
+		}
+
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		var data []byte
+		md5s := md5.New()
+		lastNum := 0
+		for _, p := range req.Parts {
+			part, ok := upload.parts[p.PartNumber]
+			if !ok || part.etag != p.ETag {
+				writeFakeError(w, http.StatusBadRequest, "InvalidPart", strconv.Itoa(p.PartNumber))
+				return
+			}
+			if p.PartNumber <= lastNum {
+				writeFakeError(w, http.StatusBadRequest, "InvalidPartOrder", strconv.Itoa(p.PartNumber))
+				return
+			}
+			lastNum = p.PartNumber
+
+			data = append(data, part.data...)
+			sum, _ := hex.DecodeString(strings.Trim(part.etag, "\""))
+			md5s.Write(sum)
+		}
+
+		etag := fmt.Sprintf("\"%s-%d\"", hex.EncodeToString(md5s.Sum(nil)), len(req.Parts))
+		s.objects[key] = &fakeObject{
+			data:    data,
+			etag:    etag,
+			modTime: time.Now(),
+		}
+		delete(s.uploads, uploadID)
+
+		writeFakeXML(w, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string   `xml:"Bucket"`
+			Key     string   `xml:"Key"`
+			ETag    string   `xml:"ETag"`
+		}{Bucket: s.Bucket, Key: key, ETag: etag})
+
+	case http.MethodDelete:
+		s.lock.Lock()
+		delete(s.uploads, uploadID)
+		s.lock.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeFakeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+func readFakeObject(body io.Reader) (*fakeObject, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := md5.Sum(data)
+	return &fakeObject{
+		data:    data,
+		etag:    "\"" + hex.EncodeToString(sum[:]) + "\"",
+		modTime: time.Now(),
+	}, nil
+}
+
+// 解析"bytes=start-end"或者"bytes=start-"格式的Range头，返回的范围左闭右开
+func parseFakeRange(rng string, size int64) (int64, int64, error) {
+	startStr, endStr, ok := strings.Cut(strings.TrimPrefix(rng, "bytes="), "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid range: %v", rng)
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, fmt.Errorf("invalid range: %v", rng)
+	}
+
+	end := size
+	if endStr != "" {
+		e, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || e < start {
+			return 0, 0, fmt.Errorf("invalid range: %v", rng)
+		}
+		if e+1 < size {
+			end = e + 1
+		}
+	}
+
+	return start, end, nil
+}
+
+func writeFakeXML(w http.ResponseWriter, v any) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		writeFakeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
+
+func writeFakeError(w http.ResponseWriter, status int, code string, message string) {
+	data, _ := xml.Marshal(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{Code: code, Message: message})
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write(data)
+}
@@ -0,0 +1,966 @@
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gitlink.org.cn/cloudream/common/consts/errorcode"
+	"gitlink.org.cn/cloudream/common/pkgs/iterator"
+	"gitlink.org.cn/cloudream/common/sdks"
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+	"gitlink.org.cn/cloudream/common/sdks/storage/cdsapi"
+)
+
+type GatewayConfig struct {
+	// 以这个用户的身份访问存储服务
+	UserID cdssdk.UserID `json:"userID"`
+	// 不为空时会检查请求的签名
+	AK     string `json:"accessKeyId"`
+	SK     string `json:"secretAccessKey"`
+	Region string `json:"region"`
+	// 分段上传时暂存分段的目录，为空时使用系统的临时目录
+	TempDir string `json:"tempDir"`
+	// 分段上传超过这个时间没有任何请求时会被清除，为0则使用DefaultUploadTTL
+	UploadTTL time.Duration `json:"uploadTTL"`
+}
+
+// 默认的分段上传过期时间
+const DefaultUploadTTL = 24 * time.Hour
+
+// 兼容S3协议的网关，只支持路径风格的地址。
+//
+// S3的桶对应存储服务的Bucket，对象Key的第一段为Package名，剩余部分为对象在Package中的路径，
+// 比如bkt/pkg/dir/a.txt对应Bucket bkt中Package pkg里的对象dir/a.txt。上传对象时Package不存在则会自动创建。
+type Gateway struct {
+	cfg     GatewayConfig
+	cli     *cdsapi.Client
+	signer  *signer
+	lock    sync.Mutex
+	uploads map[string]*gatewayUpload
+}
+
+type gatewayUpload struct {
+	bucket     string
+	key        string
+	dir        string // 存放分段的临时目录
+	parts      map[int]*gatewayPart
+	lastActive time.Time
+}
+
+type gatewayPart struct {
+	path string
+	etag string
+	size int64
+}
+
+// 返回给客户端的错误
+type gatewayError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *gatewayError) Error() string {
+	return fmt.Sprintf("%v: %v", e.code, e.message)
+}
+
+func NewGateway(cli *cdsapi.Client, cfg GatewayConfig) *Gateway {
+	if cfg.UploadTTL <= 0 {
+		cfg.UploadTTL = DefaultUploadTTL
+	}
+
+	g := &Gateway{
+		cfg:     cfg,
+		cli:     cli,
+		uploads: make(map[string]*gatewayUpload),
+	}
+
+	if cfg.AK != "" {
+		g.signer = &signer{
+			ak:     cfg.AK,
+			sk:     cfg.SK,
+			region: cfg.Region,
+		}
+	}
+	return g
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := g.serve(w, r)
+	if err != nil {
+		writeGatewayError(w, err)
+	}
+}
+
+func (g *Gateway) serve(w http.ResponseWriter, r *http.Request) error {
+	if g.signer != nil {
+		err := g.signer.Verify(r)
+		if errors.Is(err, errRequestTimeTooSkewed) {
+			return &gatewayError{http.StatusForbidden, "RequestTimeTooSkewed", err.Error()}
+		}
+		if errors.Is(err, errUnsupportedPayload) || errors.Is(err, errInvalidChunk) {
+			return err
+		}
+		if err != nil {
+			return &gatewayError{http.StatusForbidden, "SignatureDoesNotMatch", err.Error()}
+		}
+	} else {
+		// 不检查签名时也需要解码aws-chunked编码的请求体
+		err := decodeChunkedBody(r, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+
+	if bucket == "" {
+		if r.Method != http.MethodGet {
+			return &gatewayError{http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method}
+		}
+		return g.listBuckets(w, r)
+	}
+
+	if key == "" {
+		switch r.Method {
+		case http.MethodGet:
+			return g.listObjects(w, r, bucket)
+		case http.MethodHead:
+			_, err := g.getBucket(r, bucket)
+			return err
+		case http.MethodPut:
+			return g.createBucket(w, r, bucket)
+		case http.MethodDelete:
+			return g.deleteBucket(w, r, bucket)
+		}
+		return &gatewayError{http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method}
+	}
+
+	switch {
+	case query.Has("uploads") && r.Method == http.MethodPost:
+		return g.createUpload(w, r, bucket, key)
+	case query.Has("uploadId"):
+		return g.serveUpload(w, r, bucket, key, query.Get("uploadId"))
+	case r.Method == http.MethodPut:
+		return g.putObject(w, r, bucket, key)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return g.getObject(w, r, bucket, key)
+	case r.Method == http.MethodDelete:
+		return g.deleteObject(w, r, bucket, key)
+	}
+	return &gatewayError{http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method}
+}
+
+func (g *Gateway) listBuckets(w http.ResponseWriter, r *http.Request) error {
+	resp, err := g.cli.Bucket().ListUserBucketsContext(r.Context(), cdsapi.BucketListUserBucketsReq{
+		UserID: g.cfg.UserID,
+	})
+	if err != nil {
+		return err
+	}
+
+	type bucket struct {
+		Name string `xml:"Name"`
+	}
+	ret := struct {
+		XMLName xml.Name `xml:"ListAllMyBucketsResult"`
+		Buckets []bucket `xml:"Buckets>Bucket"`
+	}{}
+	for _, bkt := range resp.Buckets {
+		ret.Buckets = append(ret.Buckets, bucket{Name: bkt.Name})
+	}
+
+	return writeGatewayXML(w, ret)
+}
+
+func (g *Gateway) getBucket(r *http.Request, name string) (*cdssdk.Bucket, error) {
+	resp, err := g.cli.Bucket().GetByNameContext(r.Context(), cdsapi.BucketGetByName{
+		UserID: g.cfg.UserID,
+		Name:   name,
+	})
+	if isDataNotFound(err) {
+		return nil, &gatewayError{http.StatusNotFound, "NoSuchBucket", name}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &resp.Bucket, nil
+}
+
+func (g *Gateway) createBucket(w http.ResponseWriter, r *http.Request, name string) error {
+	_, err := g.cli.Bucket().CreateContext(r.Context(), cdsapi.BucketCreate{
+		UserID: g.cfg.UserID,
+		Name:   name,
+	})
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (g *Gateway) deleteBucket(w http.ResponseWriter, r *http.Request, name string) error {
+	bkt, err := g.getBucket(r, name)
+	if err != nil {
+		return err
+	}
+
+	err = g.cli.Bucket().DeleteContext(r.Context(), cdsapi.BucketDelete{
+		UserID:   g.cfg.UserID,
+		BucketID: bkt.BucketID,
+	})
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// 将对象Key拆分为Package名和对象路径
+func splitGatewayKey(key string) (string, string, error) {
+	pkgName, objPath, _ := strings.Cut(key, "/")
+	if pkgName == "" || objPath == "" {
+		return "", "", &gatewayError{http.StatusBadRequest, "InvalidArgument", fmt.Sprintf("key %q must be in the form of <package>/<path>", key)}
+	}
+	return pkgName, objPath, nil
+}
+
+// 查找对象，Package或者对象不存在时返回NoSuchKey
+func (g *Gateway) findObject(r *http.Request, bucket string, key string) (*cdssdk.Object, error) {
+	pkgName, objPath, err := splitGatewayKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg, err := g.cli.Package().GetByNameContext(r.Context(), cdsapi.PackageGetByName{
+		UserID:      g.cfg.UserID,
+		BucketName:  bucket,
+		PackageName: pkgName,
+	})
+	if isDataNotFound(err) {
+		return nil, &gatewayError{http.StatusNotFound, "NoSuchKey", key}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := g.cli.Object().ListContext(r.Context(), cdsapi.ObjectList{
+		UserID:    g.cfg.UserID,
+		PackageID: pkg.Package.PackageID,
+		Path:      objPath,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Objects) == 0 {
+		return nil, &gatewayError{http.StatusNotFound, "NoSuchKey", key}
+	}
+	return &resp.Objects[0], nil
+}
+
+// 获取Package，不存在时创建
+func (g *Gateway) ensurePackage(r *http.Request, bucket string, pkgName string) (*cdssdk.Package, error) {
+	getPkg := func() (*cdssdk.Package, error) {
+		resp, err := g.cli.Package().GetByNameContext(r.Context(), cdsapi.PackageGetByName{
+			UserID:      g.cfg.UserID,
+			BucketName:  bucket,
+			PackageName: pkgName,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &resp.Package, nil
+	}
+
+	pkg, err := getPkg()
+	if !isDataNotFound(err) {
+		return pkg, err
+	}
+
+	bkt, err := g.getBucket(r, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := g.cli.Package().CreateContext(r.Context(), cdsapi.PackageCreate{
+		UserID:   g.cfg.UserID,
+		BucketID: bkt.BucketID,
+		Name:     pkgName,
+	})
+	if err != nil {
+		// 可能同时有其他请求创建了这个Package
+		var codeErr *sdks.CodeMessageError
+		if errors.As(err, &codeErr) && codeErr.Code == errorcode.DataExists {
+			return getPkg()
+		}
+		return nil, err
+	}
+	return &resp.Package, nil
+}
+
+// 上传对象。请求头中有If-None-Match: *时，只在对象不存在时上传
+func (g *Gateway) upload(r *http.Request, bucket string, key string, body io.ReadCloser) (*cdssdk.Object, error) {
+	pkgName, objPath, err := splitGatewayKey(key)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+
+	pkg, err := g.ensurePackage(r, bucket, pkgName)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+
+	var pre *cdsapi.Precondition
+	if r.Header.Get("If-None-Match") == "*" {
+		pre = cdsapi.IfNoneMatch()
+	}
+
+	resp, err := g.cli.Object().UploadContext(r.Context(), cdsapi.ObjectUpload{
+		ObjectUploadInfo: cdsapi.ObjectUploadInfo{
+			UserID:       g.cfg.UserID,
+			PackageID:    pkg.PackageID,
+			Precondition: pre,
+		},
+		Files: iterator.Array(&cdsapi.UploadingObject{
+			Path: objPath,
+			File: body,
+		}),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Uploadeds) == 0 {
+		return nil, fmt.Errorf("object %v not uploaded", key)
+	}
+	return &resp.Uploadeds[0], nil
+}
+
+func (g *Gateway) putObject(w http.ResponseWriter, r *http.Request, bucket string, key string) error {
+	obj, err := g.upload(r, bucket, key, r.Body)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("ETag", gatewayETag(obj))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (g *Gateway) getObject(w http.ResponseWriter, r *http.Request, bucket string, key string) error {
+	obj, err := g.findObject(r, bucket, key)
+	if err != nil {
+		return err
+	}
+
+	start, end := int64(0), obj.Size
+	status := http.StatusOK
+	if rng := r.Header.Get("Range"); rng != "" {
+		start, end, err = parseGatewayRange(rng, obj.Size)
+		if err != nil {
+			return &gatewayError{http.StatusRequestedRangeNotSatisfiable, "InvalidRange", err.Error()}
+		}
+		status = http.StatusPartialContent
+	}
+
+	// 只有确定能返回数据时才设置这些头，否则会出现在错误响应中
+	writeHeader := func() {
+		if status == http.StatusPartialContent {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, obj.Size))
+		}
+		w.Header().Set("ETag", gatewayETag(obj))
+		w.Header().Set("Last-Modified", obj.UpdateTime.UTC().Format(http.TimeFormat))
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.FormatInt(end-start, 10))
+		w.WriteHeader(status)
+	}
+
+	if r.Method == http.MethodHead || end == start {
+		writeHeader()
+		return nil
+	}
+
+	length := end - start
+	down, err := g.cli.Object().DownloadContext(r.Context(), cdsapi.ObjectDownload{
+		UserID:   g.cfg.UserID,
+		ObjectID: obj.ObjectID,
+		Offset:   start,
+		Length:   &length,
+	})
+	if err != nil {
+		return err
+	}
+	defer down.File.Close()
+
+	// 开始写入数据之后就无法再返回错误了，客户端会因为数据长度不足而发现错误
+	writeHeader()
+	io.Copy(w, down.File)
+	return nil
+}
+
+func (g *Gateway) deleteObject(w http.ResponseWriter, r *http.Request, bucket string, key string) error {
+	obj, err := g.findObject(r, bucket, key)
+	var gwErr *gatewayError
+	// 与S3一样，删除不存在的对象不是错误
+	if errors.As(err, &gwErr) && gwErr.code == "NoSuchKey" {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = g.cli.Object().DeleteContext(r.Context(), cdsapi.ObjectDelete{
+		UserID:    g.cfg.UserID,
+		ObjectIDs: []cdssdk.ObjectID{obj.ObjectID},
+	})
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+type gatewayCommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type gatewayListResult struct {
+	XMLName               xml.Name              `xml:"ListBucketResult"`
+	Name                  string                `xml:"Name"`
+	Prefix                string                `xml:"Prefix"`
+	Delimiter             string                `xml:"Delimiter,omitempty"`
+	MaxKeys               int                   `xml:"MaxKeys"`
+	KeyCount              int                   `xml:"KeyCount"`
+	IsTruncated           bool                  `xml:"IsTruncated"`
+	ContinuationToken     string                `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string                `xml:"NextContinuationToken,omitempty"`
+	Contents              []ObjectInfo          `xml:"Contents"`
+	CommonPrefixes        []gatewayCommonPrefix `xml:"CommonPrefixes"`
+}
+
+// 按ListObjectsV2的格式列出对象。
+//
+// 所有Key按Package名+"/"排序后再按对象路径排序。续传标记记录了上一页最后一个Key或者CommonPrefix，
+// 获取下一页时会跳过之前的Package，并从标记中的对象路径之后开始查询标记所在的Package。
+func (g *Gateway) listObjects(w http.ResponseWriter, r *http.Request, bucket string) error {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	maxKeys := 1000
+	if mk, err := strconv.Atoi(query.Get("max-keys")); err == nil && mk > 0 && mk < maxKeys {
+		maxKeys = mk
+	}
+
+	after, afterIsPrefix := query.Get("start-after"), false
+	if token := query.Get("continuation-token"); token != "" {
+		var err error
+		after, afterIsPrefix, err = decodeGatewayToken(token)
+		if err != nil {
+			return &gatewayError{http.StatusBadRequest, "InvalidArgument", "invalid continuation token"}
+		}
+	}
+
+	bkt, err := g.getBucket(r, bucket)
+	if err != nil {
+		return err
+	}
+
+	pkgResp, err := g.cli.Package().ListBucketPackagesContext(r.Context(), cdsapi.PackageListBucketPackages{
+		UserID:   g.cfg.UserID,
+		BucketID: bkt.BucketID,
+	})
+	if err != nil {
+		return err
+	}
+	pkgs := pkgResp.Packages
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Name+"/" < pkgs[j].Name+"/" })
+
+	ret := gatewayListResult{
+		Name:              bucket,
+		Prefix:            prefix,
+		Delimiter:         delimiter,
+		MaxKeys:           maxKeys,
+		ContinuationToken: query.Get("continuation-token"),
+	}
+	var lastKey string
+	var lastIsPrefix bool
+
+	// 加入一个Key或者CommonPrefix，返回false代表这一页已经满了
+	add := func(key string, isPrefix bool, obj *cdssdk.Object) bool {
+		if key <= after || (afterIsPrefix && strings.HasPrefix(key, after)) {
+			return true
+		}
+		if isPrefix && lastIsPrefix && key == lastKey {
+			return true
+		}
+
+		if ret.KeyCount >= maxKeys {
+			ret.IsTruncated = true
+			return false
+		}
+
+		if isPrefix {
+			ret.CommonPrefixes = append(ret.CommonPrefixes, gatewayCommonPrefix{Prefix: key})
+		} else {
+			ret.Contents = append(ret.Contents, ObjectInfo{
+				Key:          key,
+				Size:         obj.Size,
+				ETag:         gatewayETag(obj),
+				LastModified: obj.UpdateTime.UTC(),
+			})
+		}
+		ret.KeyCount++
+		lastKey, lastIsPrefix = key, isPrefix
+		return true
+	}
+
+	// 如果key在prefix之后的部分包含delimiter，则返回对应的CommonPrefix
+	commonPrefix := func(key string) (string, bool) {
+		if delimiter == "" || len(key) < len(prefix) {
+			return "", false
+		}
+
+		idx := strings.Index(key[len(prefix):], delimiter)
+		if idx < 0 {
+			return "", false
+		}
+		return key[:len(prefix)+idx+len(delimiter)], true
+	}
+
+	for _, pkg := range pkgs {
+		pkgKey := pkg.Name + "/"
+		if !strings.HasPrefix(pkgKey, prefix) && !strings.HasPrefix(prefix, pkgKey) {
+			continue
+		}
+
+		// 跳过上一页已经列出的Package。标记在这个Package中时，从标记中的对象路径之后开始查询
+		startAfter := ""
+		if after != "" {
+			if afterIsPrefix && strings.HasPrefix(pkgKey, after) {
+				continue
+			}
+			if strings.HasPrefix(after, pkgKey) {
+				startAfter = after[len(pkgKey):]
+			} else if pkgKey < after {
+				continue
+			}
+		}
+
+		// Package内的所有对象都属于同一个CommonPrefix，不需要查询对象
+		if cp, ok := commonPrefix(pkgKey); ok {
+			if !add(cp, true, nil) {
+				break
+			}
+			continue
+		}
+
+		full, err := g.listPackageObjects(r, pkg.PackageID, pkgKey, prefix, startAfter, func(key string, obj *cdssdk.Object) bool {
+			if cp, ok := commonPrefix(key); ok {
+				return add(cp, true, nil)
+			}
+			return add(key, false, obj)
+		})
+		if err != nil {
+			return err
+		}
+		if full {
+			break
+		}
+	}
+
+	if ret.IsTruncated {
+		ret.NextContinuationToken = encodeGatewayToken(lastKey, lastIsPrefix)
+	}
+
+	return writeGatewayXML(w, ret)
+}
+
+// 从对象路径startAfter之后开始，逐页遍历Package中以prefix开头的对象，fn返回false时停止遍历，此时返回true
+func (g *Gateway) listPackageObjects(r *http.Request, pkgID cdssdk.PackageID, pkgKey string, prefix string, startAfter string, fn func(key string, obj *cdssdk.Object) bool) (bool, error) {
+	objPrefix := ""
+	if len(prefix) > len(pkgKey) {
+		objPrefix = prefix[len(pkgKey):]
+	}
+
+	iter := g.cli.Object().ListIterator(r.Context(), cdsapi.ObjectList{
+		UserID:     g.cfg.UserID,
+		PackageID:  pkgID,
+		Path:       objPrefix,
+		IsPrefix:   true,
+		StartAfter: startAfter,
+	})
+	defer iter.Close()
+
+	for {
+		obj, err := iter.MoveNext()
+		if err == iterator.ErrNoMoreItem {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		if !fn(pkgKey+obj.Path, &obj) {
+			return true, nil
+		}
+	}
+}
+
+func encodeGatewayToken(key string, isPrefix bool) string {
+	typ := "k"
+	if isPrefix {
+		typ = "p"
+	}
+	return base64.URLEncoding.EncodeToString([]byte(typ + key))
+}
+
+func decodeGatewayToken(token string) (string, bool, error) {
+	data, err := base64.URLEncoding.DecodeString(token)
+	if err != nil || len(data) == 0 {
+		return "", false, fmt.Errorf("invalid token")
+	}
+
+	switch data[0] {
+	case 'k':
+		return string(data[1:]), false, nil
+	case 'p':
+		return string(data[1:]), true, nil
+	}
+	return "", false, fmt.Errorf("invalid token")
+}
+
+func (g *Gateway) createUpload(w http.ResponseWriter, r *http.Request, bucket string, key string) error {
+	if _, _, err := splitGatewayKey(key); err != nil {
+		return err
+	}
+	if _, err := g.getBucket(r, bucket); err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp(g.cfg.TempDir, "s3gateway-")
+	if err != nil {
+		return err
+	}
+
+	// 客户端没有完成也没有取消的分段上传，在创建新的分段上传时清除
+	g.removeExpiredUploads()
+
+	id := uuid.NewString()
+	g.lock.Lock()
+	g.uploads[id] = &gatewayUpload{
+		bucket:     bucket,
+		key:        key,
+		dir:        dir,
+		parts:      make(map[int]*gatewayPart),
+		lastActive: time.Now(),
+	}
+	g.lock.Unlock()
+
+	return writeGatewayXML(w, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Bucket   string   `xml:"Bucket"`
+		Key      string   `xml:"Key"`
+		UploadID string   `xml:"UploadId"`
+	}{Bucket: bucket, Key: key, UploadID: id})
+}
+
+func (g *Gateway) serveUpload(w http.ResponseWriter, r *http.Request, bucket string, key string, uploadID string) error {
+	g.lock.Lock()
+	upload, ok := g.uploads[uploadID]
+	if ok {
+		upload.lastActive = time.Now()
+	}
+	g.lock.Unlock()
+
+	if !ok || upload.bucket != bucket || upload.key != key {
+		return &gatewayError{http.StatusNotFound, "NoSuchUpload", uploadID}
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		return g.uploadPart(w, r, upload)
+	case http.MethodGet:
+		return g.listParts(w, upload, uploadID)
+	case http.MethodPost:
+		return g.completeUpload(w, r, upload, uploadID)
+	case http.MethodDelete:
+		g.removeUpload(uploadID)
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return &gatewayError{http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method}
+}
+
+func (g *Gateway) uploadPart(w http.ResponseWriter, r *http.Request, upload *gatewayUpload) error {
+	partNumber, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > 10000 {
+		return &gatewayError{http.StatusBadRequest, "InvalidArgument", "invalid part number"}
+	}
+
+	// 同一个分段可能被重复上传，先写入临时文件再替换
+	file, err := os.CreateTemp(upload.dir, "part-")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := md5.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), r.Body)
+	if err != nil {
+		os.Remove(file.Name())
+		if errors.Is(err, errPayloadHashMismatch) || errors.Is(err, errChunkSignatureMismatch) {
+			return err
+		}
+		return &gatewayError{http.StatusBadRequest, "IncompleteBody", err.Error()}
+	}
+
+	part := &gatewayPart{
+		path: file.Name(),
+		etag: "\"" + hex.EncodeToString(hash.Sum(nil)) + "\"",
+		size: size,
+	}
+
+	g.lock.Lock()
+	old := upload.parts[partNumber]
+	upload.parts[partNumber] = part
+	// 上传分段可能需要很长时间
+	upload.lastActive = time.Now()
+	g.lock.Unlock()
+
+	if old != nil {
+		os.Remove(old.path)
+	}
+
+	w.Header().Set("ETag", part.etag)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (g *Gateway) listParts(w http.ResponseWriter, upload *gatewayUpload, uploadID string) error {
+	ret := struct {
+		XMLName  xml.Name       `xml:"ListPartsResult"`
+		UploadID string         `xml:"UploadId"`
+		Parts    []UploadedPart `xml:"Part"`
+	}{UploadID: uploadID}
+
+	g.lock.Lock()
+	for num, p := range upload.parts {
+		ret.Parts = append(ret.Parts, UploadedPart{PartNumber: num, ETag: p.etag, Size: p.size})
+	}
+	g.lock.Unlock()
+	sort.Slice(ret.Parts, func(i, j int) bool { return ret.Parts[i].PartNumber < ret.Parts[j].PartNumber })
+
+	return writeGatewayXML(w, ret)
+}
+
+// 按顺序合并所有分段，作为一个对象上传到存储服务
+func (g *Gateway) completeUpload(w http.ResponseWriter, r *http.Request, upload *gatewayUpload, uploadID string) error {
+	var req completeMultipartUpload
+	err := xml.NewDecoder(r.Body).Decode(&req)
+	if err != nil || len(req.Parts) == 0 {
+		return &gatewayError{http.StatusBadRequest, "MalformedXML", "invalid complete request"}
+	}
+
+	var parts []*gatewayPart
+	lastNum := 0
+	g.lock.Lock()
+	for _, p := range req.Parts {
+		part, ok := upload.parts[p.PartNumber]
+		if !ok || part.etag != p.ETag {
+			g.lock.Unlock()
+			return &gatewayError{http.StatusBadRequest, "InvalidPart", strconv.Itoa(p.PartNumber)}
+		}
+		if p.PartNumber <= lastNum {
+			g.lock.Unlock()
+			return &gatewayError{http.StatusBadRequest, "InvalidPartOrder", strconv.Itoa(p.PartNumber)}
+		}
+		lastNum = p.PartNumber
+		parts = append(parts, part)
+	}
+	g.lock.Unlock()
+
+	var files []io.Reader
+	var closers []io.Closer
+	defer func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}()
+	for _, part := range parts {
+		file, err := os.Open(part.path)
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+		closers = append(closers, file)
+	}
+
+	obj, err := g.upload(r, upload.bucket, upload.key, io.NopCloser(io.MultiReader(files...)))
+	if err != nil {
+		return err
+	}
+
+	g.removeUpload(uploadID)
+
+	return writeGatewayXML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Bucket  string   `xml:"Bucket"`
+		Key     string   `xml:"Key"`
+		ETag    string   `xml:"ETag"`
+	}{Bucket: upload.bucket, Key: upload.key, ETag: gatewayETag(obj)})
+}
+
+func (g *Gateway) removeUpload(uploadID string) {
+	g.lock.Lock()
+	upload, ok := g.uploads[uploadID]
+	delete(g.uploads, uploadID)
+	g.lock.Unlock()
+
+	if ok {
+		os.RemoveAll(upload.dir)
+	}
+}
+
+// 清除超过UploadTTL没有活动的分段上传
+func (g *Gateway) removeExpiredUploads() {
+	var expired []string
+	g.lock.Lock()
+	for id, upload := range g.uploads {
+		if time.Since(upload.lastActive) > g.cfg.UploadTTL {
+			expired = append(expired, id)
+		}
+	}
+	g.lock.Unlock()
+
+	for _, id := range expired {
+		g.removeUpload(id)
+	}
+}
+
+// 正在进行的分段上传任务的数量
+func (g *Gateway) UploadCount() int {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return len(g.uploads)
+}
+
+// 使用FileHash作为对象的ETag
+func gatewayETag(obj *cdssdk.Object) string {
+	return "\"" + string(obj.FileHash) + "\""
+}
+
+// 解析"bytes=start-end"、"bytes=start-"或者"bytes=-suffix"格式的Range头，返回的范围左闭右开
+func parseGatewayRange(rng string, size int64) (int64, int64, error) {
+	startStr, endStr, ok := strings.Cut(strings.TrimPrefix(rng, "bytes="), "-")
+	if !ok || strings.Contains(endStr, ",") {
+		return 0, 0, fmt.Errorf("invalid range: %v", rng)
+	}
+
+	if startStr == "" {
+		suffix, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || suffix <= 0 {
+			return 0, 0, fmt.Errorf("invalid range: %v", rng)
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, size, nil
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, fmt.Errorf("invalid range: %v", rng)
+	}
+
+	end := size
+	if endStr != "" {
+		e, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || e < start {
+			return 0, 0, fmt.Errorf("invalid range: %v", rng)
+		}
+		if e+1 < size {
+			end = e + 1
+		}
+	}
+
+	return start, end, nil
+}
+
+func isDataNotFound(err error) bool {
+	var codeErr *sdks.CodeMessageError
+	return errors.As(err, &codeErr) && codeErr.Code == errorcode.DataNotFound
+}
+
+func writeGatewayXML(w http.ResponseWriter, v any) error {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+	return nil
+}
+
+// 将错误转换为S3格式的错误响应
+func writeGatewayError(w http.ResponseWriter, err error) {
+	gwErr := &gatewayError{http.StatusInternalServerError, "InternalError", err.Error()}
+
+	var preErr *cdsapi.PreconditionFailedError
+	var codeErr *sdks.CodeMessageError
+	switch {
+	case errors.As(err, &gwErr):
+	case errors.Is(err, errPayloadHashMismatch):
+		gwErr = &gatewayError{http.StatusBadRequest, "XAmzContentSHA256Mismatch", err.Error()}
+	case errors.Is(err, errChunkSignatureMismatch):
+		gwErr = &gatewayError{http.StatusForbidden, "SignatureDoesNotMatch", err.Error()}
+	case errors.Is(err, errInvalidChunk):
+		gwErr = &gatewayError{http.StatusBadRequest, "IncompleteBody", err.Error()}
+	case errors.Is(err, errUnsupportedPayload):
+		gwErr = &gatewayError{http.StatusNotImplemented, "NotImplemented", err.Error()}
+	case errors.As(err, &preErr):
+		gwErr = &gatewayError{http.StatusPreconditionFailed, "PreconditionFailed", preErr.Message}
+	case errors.As(err, &codeErr):
+		switch codeErr.Code {
+		case errorcode.DataNotFound:
+			gwErr = &gatewayError{http.StatusNotFound, "NoSuchKey", codeErr.Message}
+		case errorcode.DataExists:
+			gwErr = &gatewayError{http.StatusConflict, "BucketAlreadyExists", codeErr.Message}
+		case errorcode.BadArgument:
+			gwErr = &gatewayError{http.StatusBadRequest, "InvalidArgument", codeErr.Message}
+		}
+	}
+
+	data, _ := xml.Marshal(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{Code: gwErr.code, Message: gwErr.message})
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(gwErr.status)
+	w.Write(data)
+}
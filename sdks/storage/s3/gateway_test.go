@@ -0,0 +1,554 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	cdssdk "gitlink.org.cn/cloudream/common/sdks/storage"
+	"gitlink.org.cn/cloudream/common/sdks/storage/cdsapi"
+	"gitlink.org.cn/cloudream/common/utils/math2"
+)
+
+func Test_Gateway(t *testing.T) {
+	ctx := context.Background()
+
+	// 在存储服务之前加一层代理，由handle决定是否自己处理请求，返回false时转发给存储服务
+	proxyCDS := func(handle func(w http.ResponseWriter, r *http.Request) bool) func(cds *cdsapi.FakeServer, cdsCfg *cdsapi.Config, cfg *GatewayConfig) {
+		return func(cds *cdsapi.FakeServer, cdsCfg *cdsapi.Config, cfg *GatewayConfig) {
+			target, _ := url.Parse(cds.URL)
+			rp := httputil.NewSingleHostReverseProxy(target)
+
+			proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !handle(w, r) {
+					rp.ServeHTTP(w, r)
+				}
+			}))
+			t.Cleanup(proxy.Close)
+
+			cdsCfg.URL = proxy.URL
+		}
+	}
+
+	// 不经过Client，直接发送签名后的请求，返回响应以及错误码
+	doSigned := func(svr *httptest.Server, method string, path string, body []byte, payloadHash string, now time.Time) (*http.Response, string) {
+		req, err := http.NewRequest(method, svr.URL+path, bytes.NewReader(body))
+		So(err, ShouldBeNil)
+
+		s := &signer{ak: FakeAK, sk: FakeSK, region: FakeRegion}
+		s.Sign(req, payloadHash, now)
+
+		resp, err := http.DefaultClient.Do(req)
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+
+		var ret struct {
+			Code string `xml:"Code"`
+		}
+		data, _ := io.ReadAll(resp.Body)
+		xml.Unmarshal(data, &ret)
+		return resp, ret.Code
+	}
+
+	// 发送使用aws-chunked编码的PUT请求，每个元素是一个分块。tamper为true时，签名之后再修改最后一个分块的数据
+	doChunked := func(svr *httptest.Server, path string, payloadHash string, chunks []string, tamper bool) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodPut, svr.URL+path, nil)
+		So(err, ShouldBeNil)
+
+		size := 0
+		for _, c := range chunks {
+			size += len(c)
+		}
+		req.Header.Set("Content-Encoding", "aws-chunked")
+		req.Header.Set(headerDecodedContentLength, strconv.Itoa(size))
+		if payloadHash == streamingUnsignedTrailer {
+			req.Header.Set("X-Amz-Trailer", "x-amz-checksum-crc32")
+		}
+
+		now := time.Now()
+		s := &signer{ak: FakeAK, sk: FakeSK, region: FakeRegion}
+		s.Sign(req, payloadHash, now)
+		_, seed, _ := strings.Cut(req.Header.Get(headerAuthorization), "Signature=")
+		cs := &chunkSigner{key: s.signingKey(now), timestamp: now.Format(signTimeFormat), scope: s.scope(now), prev: seed}
+
+		body := bytes.Buffer{}
+		for i, c := range append(chunks, "") {
+			if payloadHash == streamingUnsignedTrailer {
+				fmt.Fprintf(&body, "%x\r\n", len(c))
+			} else {
+				fmt.Fprintf(&body, "%x;chunk-signature=%s\r\n", len(c), cs.next(hexSHA256([]byte(c))))
+			}
+
+			if tamper && i == len(chunks)-1 {
+				c = strings.ToUpper(c)
+			}
+			body.WriteString(c)
+			if c != "" {
+				body.WriteString("\r\n")
+			}
+		}
+		if payloadHash == streamingUnsignedTrailer {
+			body.WriteString("x-amz-checksum-crc32:AAAAAA==\r\n")
+		}
+		body.WriteString("\r\n")
+
+		req.Body = io.NopCloser(bytes.NewReader(body.Bytes()))
+		req.ContentLength = int64(body.Len())
+
+		resp, err := http.DefaultClient.Do(req)
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+
+		var ret struct {
+			Code string `xml:"Code"`
+		}
+		data, _ := io.ReadAll(resp.Body)
+		xml.Unmarshal(data, &ret)
+		return resp, ret.Code
+	}
+
+	// setup不为nil时，可以在创建网关之前修改网关的配置，以及网关访问存储服务使用的配置
+	newGateway := func(setup func(cds *cdsapi.FakeServer, cdsCfg *cdsapi.Config, cfg *GatewayConfig)) (*cdsapi.FakeServer, *Gateway, *httptest.Server, *Client) {
+		cds := cdsapi.NewFakeServer()
+		cds.AddBucket(cdssdk.Bucket{BucketID: 1, Name: "bkt", CreatorID: 1})
+
+		cdsCfg := cds.Config()
+		cfg := GatewayConfig{
+			UserID:  1,
+			AK:      FakeAK,
+			SK:      FakeSK,
+			Region:  FakeRegion,
+			TempDir: t.TempDir(),
+		}
+		if setup != nil {
+			setup(cds, cdsCfg, &cfg)
+		}
+
+		gw := NewGateway(cdsapi.NewClient(cdsCfg), cfg)
+		svr := httptest.NewServer(gw)
+
+		cli, err := NewClient(Config{
+			Endpoint:  svr.URL,
+			Region:    FakeRegion,
+			AK:        FakeAK,
+			SK:        FakeSK,
+			Bucket:    "bkt",
+			PathStyle: true,
+		})
+		So(err, ShouldBeNil)
+		return cds, gw, svr, cli
+	}
+
+	Convey("上传、下载、删除", t, func() {
+		cds, _, svr, cli := newGateway(nil)
+		defer cds.Close()
+		defer svr.Close()
+
+		data := []byte("0123456789")
+		key := "pkg/dir/文件 1.txt"
+		put, err := cli.PutObject(ctx, key, bytes.NewReader(data), int64(len(data)))
+		So(err, ShouldBeNil)
+
+		str, err := cli.GetObject(ctx, key, math2.Range{})
+		So(err, ShouldBeNil)
+		got, _ := io.ReadAll(str)
+		str.Close()
+		So(got, ShouldResemble, data)
+
+		str, err = cli.GetObject(ctx, key, math2.NewRange(3, 4))
+		So(err, ShouldBeNil)
+		got, _ = io.ReadAll(str)
+		str.Close()
+		So(string(got), ShouldEqual, "3456")
+
+		str, err = cli.GetObject(ctx, key, math2.NewRange(8, -1))
+		So(err, ShouldBeNil)
+		got, _ = io.ReadAll(str)
+		str.Close()
+		So(string(got), ShouldEqual, "89")
+
+		info, err := cli.HeadObject(ctx, key)
+		So(err, ShouldBeNil)
+		So(info.Size, ShouldEqual, 10)
+		So(info.ETag, ShouldEqual, put.ETag)
+
+		So(cli.DeleteObject(ctx, key), ShouldBeNil)
+		_, err = cli.HeadObject(ctx, key)
+		So(IsNotFound(err), ShouldBeTrue)
+		_, err = cli.GetObject(ctx, "nopkg/a", math2.Range{})
+		So(IsNotFound(err), ShouldBeTrue)
+
+		// 删除不存在的对象不是错误
+		So(cli.DeleteObject(ctx, key), ShouldBeNil)
+	})
+
+	Convey("错误的密钥与不存在的桶", t, func() {
+		cds, _, svr, cli := newGateway(nil)
+		defer cds.Close()
+		defer svr.Close()
+
+		cfg := cli.cfg
+		cfg.SK = "wrong"
+		wrong, err := NewClient(cfg)
+		So(err, ShouldBeNil)
+		_, err = wrong.PutObject(ctx, "pkg/a", bytes.NewReader(nil), 0)
+		So(err, ShouldNotBeNil)
+		So(err.(*Error).Code, ShouldEqual, "SignatureDoesNotMatch")
+
+		cfg = cli.cfg
+		cfg.Bucket = "nobkt"
+		nobkt, err := NewClient(cfg)
+		So(err, ShouldBeNil)
+		_, err = nobkt.PutObject(ctx, "pkg/a", bytes.NewReader(nil), 0)
+		So(err, ShouldNotBeNil)
+		So(err.(*Error).Code, ShouldEqual, "NoSuchBucket")
+
+		// Key中必须包含Package名和对象路径
+		_, err = cli.PutObject(ctx, "a", bytes.NewReader(nil), 0)
+		So(err, ShouldNotBeNil)
+		So(err.(*Error).Code, ShouldEqual, "InvalidArgument")
+	})
+
+	Convey("下载失败时不返回对象的响应头", t, func() {
+		cds, _, svr, cli := newGateway(proxyCDS(func(w http.ResponseWriter, r *http.Request) bool {
+			if r.URL.Path != cdsapi.ObjectDownloadPath {
+				return false
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			return true
+		}))
+		defer cds.Close()
+		defer svr.Close()
+
+		_, err := cli.PutObject(ctx, "pkg/a", bytes.NewReader([]byte("0123456789")), 10)
+		So(err, ShouldBeNil)
+
+		req, err := http.NewRequest(http.MethodGet, svr.URL+"/bkt/pkg/a", nil)
+		So(err, ShouldBeNil)
+		req.Header.Set("Range", "bytes=3-6")
+		(&signer{ak: FakeAK, sk: FakeSK, region: FakeRegion}).Sign(req, emptyPayloadHash, time.Now())
+
+		resp, err := http.DefaultClient.Do(req)
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, http.StatusInternalServerError)
+		So(resp.Header.Get("Content-Type"), ShouldEqual, "application/xml")
+		So(resp.Header.Get("ETag"), ShouldBeEmpty)
+		So(resp.Header.Get("Content-Range"), ShouldBeEmpty)
+		So(resp.Header.Get("Last-Modified"), ShouldBeEmpty)
+	})
+
+	Convey("请求时间与服务端时间相差太大", t, func() {
+		cds, _, svr, _ := newGateway(nil)
+		defer cds.Close()
+		defer svr.Close()
+
+		resp, code := doSigned(svr, http.MethodGet, "/bkt/", nil, emptyPayloadHash, time.Now().Add(-20*time.Minute))
+		So(resp.StatusCode, ShouldEqual, http.StatusForbidden)
+		So(code, ShouldEqual, "RequestTimeTooSkewed")
+
+		resp, code = doSigned(svr, http.MethodGet, "/bkt/", nil, emptyPayloadHash, time.Now().Add(20*time.Minute))
+		So(resp.StatusCode, ShouldEqual, http.StatusForbidden)
+		So(code, ShouldEqual, "RequestTimeTooSkewed")
+
+		resp, _ = doSigned(svr, http.MethodGet, "/bkt/", nil, emptyPayloadHash, time.Now().Add(-10*time.Minute))
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+	})
+
+	Convey("请求体与X-Amz-Content-Sha256不一致", t, func() {
+		cds, _, svr, cli := newGateway(nil)
+		defer cds.Close()
+		defer svr.Close()
+
+		data := []byte("0123456789")
+		resp, code := doSigned(svr, http.MethodPut, "/bkt/pkg/a", data, hexSHA256([]byte("other")), time.Now())
+		So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+		So(code, ShouldEqual, "XAmzContentSHA256Mismatch")
+
+		_, err := cli.HeadObject(ctx, "pkg/a")
+		So(IsNotFound(err), ShouldBeTrue)
+
+		uploadID, err := cli.CreateMultipartUpload(ctx, "pkg/big")
+		So(err, ShouldBeNil)
+		resp, code = doSigned(svr, http.MethodPut, "/bkt/pkg/big?partNumber=1&uploadId="+uploadID, data, hexSHA256([]byte("other")), time.Now())
+		So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+		So(code, ShouldEqual, "XAmzContentSHA256Mismatch")
+
+		// 哈希正确，或者不检查哈希时可以上传
+		resp, _ = doSigned(svr, http.MethodPut, "/bkt/pkg/a", data, hexSHA256(data), time.Now())
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		resp, _ = doSigned(svr, http.MethodPut, "/bkt/pkg/b", data, unsignedPayload, time.Now())
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+
+		info, err := cli.HeadObject(ctx, "pkg/a")
+		So(err, ShouldBeNil)
+		So(info.Size, ShouldEqual, len(data))
+	})
+
+	Convey("使用aws-chunked编码上传", t, func() {
+		cds, _, svr, cli := newGateway(nil)
+		defer cds.Close()
+		defer svr.Close()
+
+		readObject := func(cli *Client, key string) string {
+			str, err := cli.GetObject(ctx, key, math2.Range{})
+			So(err, ShouldBeNil)
+			defer str.Close()
+			got, _ := io.ReadAll(str)
+			return string(got)
+		}
+
+		resp, _ := doChunked(svr, "/bkt/pkg/signed", streamingSignedPayload, []string{"hello ", "world"}, false)
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(readObject(cli, "pkg/signed"), ShouldEqual, "hello world")
+
+		resp, _ = doChunked(svr, "/bkt/pkg/trailer", streamingUnsignedTrailer, []string{"hello ", "world"}, false)
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(readObject(cli, "pkg/trailer"), ShouldEqual, "hello world")
+
+		// 分块的签名不正确时不保存对象
+		resp, code := doChunked(svr, "/bkt/pkg/tampered", streamingSignedPayload, []string{"hello ", "world"}, true)
+		So(resp.StatusCode, ShouldEqual, http.StatusForbidden)
+		So(code, ShouldEqual, "SignatureDoesNotMatch")
+		_, err := cli.HeadObject(ctx, "pkg/tampered")
+		So(IsNotFound(err), ShouldBeTrue)
+
+		resp, code = doChunked(svr, "/bkt/pkg/other", "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER", []string{"hello"}, false)
+		So(resp.StatusCode, ShouldEqual, http.StatusNotImplemented)
+		So(code, ShouldEqual, "NotImplemented")
+
+		// 上传分段
+		uploadID, err := cli.CreateMultipartUpload(ctx, "pkg/big")
+		So(err, ShouldBeNil)
+		resp, _ = doChunked(svr, "/bkt/pkg/big?partNumber=1&uploadId="+uploadID, streamingSignedPayload, []string{"part", "1"}, false)
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		resp, code = doChunked(svr, "/bkt/pkg/big?partNumber=2&uploadId="+uploadID, streamingSignedPayload, []string{"part", "two"}, true)
+		So(resp.StatusCode, ShouldEqual, http.StatusForbidden)
+		So(code, ShouldEqual, "SignatureDoesNotMatch")
+
+		parts, err := cli.ListParts(ctx, "pkg/big", uploadID)
+		So(err, ShouldBeNil)
+		So(parts, ShouldHaveLength, 1)
+		_, err = cli.CompleteMultipartUpload(ctx, "pkg/big", uploadID, parts)
+		So(err, ShouldBeNil)
+		So(readObject(cli, "pkg/big"), ShouldEqual, "part1")
+
+		// 不检查签名时也需要解码
+		cds2, _, svr2, cli2 := newGateway(func(cds *cdsapi.FakeServer, cdsCfg *cdsapi.Config, cfg *GatewayConfig) {
+			cfg.AK = ""
+		})
+		defer cds2.Close()
+		defer svr2.Close()
+
+		resp, _ = doChunked(svr2, "/bkt/pkg/trailer", streamingUnsignedTrailer, []string{"hello ", "world"}, false)
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(readObject(cli2, "pkg/trailer"), ShouldEqual, "hello world")
+	})
+
+	Convey("分页列出对象", t, func() {
+		cds, _, svr, cli := newGateway(nil)
+		defer cds.Close()
+		defer svr.Close()
+
+		keys := []string{"a/0", "a/1", "a/2", "a/sub/x", "a/sub/y", "b/x", "c/d/e"}
+		for _, key := range keys {
+			_, err := cli.PutObject(ctx, key, bytes.NewReader([]byte{1}), 1)
+			So(err, ShouldBeNil)
+		}
+
+		objs, err := cli.ListAllObjects(ctx, "")
+		So(err, ShouldBeNil)
+		var got []string
+		for _, o := range objs {
+			got = append(got, o.Key)
+		}
+		So(got, ShouldResemble, keys)
+
+		ret, err := cli.ListObjects(ctx, ListObjectsOption{Prefix: "a/", MaxKeys: 2})
+		So(err, ShouldBeNil)
+		So(ret.Objects, ShouldHaveLength, 2)
+		So(ret.IsTruncated, ShouldBeTrue)
+
+		objs, err = cli.ListAllObjects(ctx, "a/s")
+		So(err, ShouldBeNil)
+		So(objs, ShouldHaveLength, 2)
+
+		ret, err = cli.ListObjects(ctx, ListObjectsOption{Prefix: "a/", Delimiter: "/"})
+		So(err, ShouldBeNil)
+		So(ret.Objects, ShouldHaveLength, 3)
+		So(ret.CommonPrefixes, ShouldResemble, []string{"a/sub/"})
+
+		ret, err = cli.ListObjects(ctx, ListObjectsOption{Delimiter: "/"})
+		So(err, ShouldBeNil)
+		So(ret.Objects, ShouldBeEmpty)
+		So(ret.CommonPrefixes, ShouldResemble, []string{"a/", "b/", "c/"})
+
+		// CommonPrefix也计入分页数量
+		var prefixes []string
+		opt := ListObjectsOption{Delimiter: "/", MaxKeys: 1}
+		for {
+			ret, err := cli.ListObjects(ctx, opt)
+			So(err, ShouldBeNil)
+			prefixes = append(prefixes, ret.CommonPrefixes...)
+			if !ret.IsTruncated {
+				break
+			}
+			opt.ContinuationToken = ret.NextContinuationToken
+		}
+		So(prefixes, ShouldResemble, []string{"a/", "b/", "c/"})
+	})
+
+	Convey("获取下一页时从续传标记的位置开始查询", t, func() {
+		var lock sync.Mutex
+		var startAfters []string
+		cds, _, svr, cli := newGateway(proxyCDS(func(w http.ResponseWriter, r *http.Request) bool {
+			if r.URL.Path == cdsapi.ObjectListPath {
+				lock.Lock()
+				startAfters = append(startAfters, r.URL.Query().Get("startAfter"))
+				// 游标只能是上一页返回的NextCursor，不能由对象路径构造
+				if r.URL.Query().Get("cursor") != "" {
+					startAfters = append(startAfters, "cursor:"+r.URL.Query().Get("cursor"))
+				}
+				lock.Unlock()
+			}
+			return false
+		}))
+		defer cds.Close()
+		defer svr.Close()
+
+		keys := []string{"a/0", "a/1", "a/2", "a/3", "b/0", "b/1"}
+		for _, key := range keys {
+			_, err := cli.PutObject(ctx, key, bytes.NewReader([]byte{1}), 1)
+			So(err, ShouldBeNil)
+		}
+
+		// 返回这一页的Key以及查询各个Package时使用的起始位置
+		list := func(opt ListObjectsOption) (ListObjectsResult, []string) {
+			lock.Lock()
+			startAfters = nil
+			lock.Unlock()
+
+			ret, err := cli.ListObjects(ctx, opt)
+			So(err, ShouldBeNil)
+
+			lock.Lock()
+			defer lock.Unlock()
+			return ret, startAfters
+		}
+
+		var got []string
+		var pageStarts [][]string
+		opt := ListObjectsOption{MaxKeys: 2}
+		for {
+			ret, cur := list(opt)
+			for _, o := range ret.Objects {
+				got = append(got, o.Key)
+			}
+			pageStarts = append(pageStarts, cur)
+			if !ret.IsTruncated {
+				break
+			}
+			opt.ContinuationToken = ret.NextContinuationToken
+		}
+		So(got, ShouldResemble, keys)
+		So(pageStarts, ShouldResemble, [][]string{{""}, {"1", ""}, {"3", ""}})
+
+		// 标记在Package b中时不再查询Package a
+		ret, cur := list(ListObjectsOption{ContinuationToken: encodeGatewayToken("b/0", false)})
+		So(ret.Objects, ShouldHaveLength, 1)
+		So(ret.Objects[0].Key, ShouldEqual, "b/1")
+		So(cur, ShouldResemble, []string{"0"})
+	})
+
+	Convey("分段上传", t, func() {
+		cds, gw, svr, cli := newGateway(nil)
+		defer cds.Close()
+		defer svr.Close()
+
+		uploadID, err := cli.CreateMultipartUpload(ctx, "pkg/big")
+		So(err, ShouldBeNil)
+
+		var parts []UploadedPart
+		for i := 1; i <= 3; i++ {
+			part, err := cli.UploadPart(ctx, "pkg/big", uploadID, i, bytes.NewReader([]byte(fmt.Sprintf("part%d", i))), 5)
+			So(err, ShouldBeNil)
+			parts = append(parts, part)
+		}
+
+		listed, err := cli.ListParts(ctx, "pkg/big", uploadID)
+		So(err, ShouldBeNil)
+		So(listed, ShouldHaveLength, 3)
+		So(listed[1].ETag, ShouldEqual, parts[1].ETag)
+
+		_, err = cli.CompleteMultipartUpload(ctx, "pkg/big", uploadID, []UploadedPart{{PartNumber: 1, ETag: "\"x\""}})
+		So(err, ShouldNotBeNil)
+		So(err.(*Error).Code, ShouldEqual, "InvalidPart")
+
+		_, err = cli.CompleteMultipartUpload(ctx, "pkg/big", uploadID, parts)
+		So(err, ShouldBeNil)
+		So(gw.UploadCount(), ShouldEqual, 0)
+
+		str, err := cli.GetObject(ctx, "pkg/big", math2.Range{})
+		So(err, ShouldBeNil)
+		got, _ := io.ReadAll(str)
+		str.Close()
+		So(string(got), ShouldEqual, "part1part2part3")
+	})
+
+	Convey("清除过期的分段上传", t, func() {
+		tempDir := t.TempDir()
+		cds, gw, svr, cli := newGateway(func(cds *cdsapi.FakeServer, cdsCfg *cdsapi.Config, cfg *GatewayConfig) {
+			cfg.TempDir = tempDir
+			cfg.UploadTTL = 50 * time.Millisecond
+		})
+		defer cds.Close()
+		defer svr.Close()
+
+		expired, err := cli.CreateMultipartUpload(ctx, "pkg/big")
+		So(err, ShouldBeNil)
+		_, err = cli.UploadPart(ctx, "pkg/big", expired, 1, bytes.NewReader([]byte("x")), 1)
+		So(err, ShouldBeNil)
+
+		time.Sleep(100 * time.Millisecond)
+
+		_, err = cli.CreateMultipartUpload(ctx, "pkg/big")
+		So(err, ShouldBeNil)
+		So(gw.UploadCount(), ShouldEqual, 1)
+
+		entries, _ := os.ReadDir(tempDir)
+		So(entries, ShouldHaveLength, 1)
+
+		_, err = cli.UploadPart(ctx, "pkg/big", expired, 1, bytes.NewReader([]byte("x")), 1)
+		So(IsNotFound(err), ShouldBeTrue)
+	})
+
+	Convey("取消分段上传", t, func() {
+		cds, gw, svr, cli := newGateway(nil)
+		defer cds.Close()
+		defer svr.Close()
+
+		uploadID, err := cli.CreateMultipartUpload(ctx, "pkg/big")
+		So(err, ShouldBeNil)
+		_, err = cli.UploadPart(ctx, "pkg/big", uploadID, 1, bytes.NewReader([]byte("x")), 1)
+		So(err, ShouldBeNil)
+
+		So(cli.AbortMultipartUpload(ctx, "pkg/big", uploadID), ShouldBeNil)
+		So(gw.UploadCount(), ShouldEqual, 0)
+
+		_, err = cli.UploadPart(ctx, "pkg/big", uploadID, 1, bytes.NewReader([]byte("x")), 1)
+		So(IsNotFound(err), ShouldBeTrue)
+	})
+}
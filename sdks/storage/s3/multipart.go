@@ -0,0 +1,160 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+type UploadedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+	Size       int64  `xml:"Size"`
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name       `xml:"CompleteMultipartUpload"`
+	Parts   []completePart `xml:"Part"`
+}
+
+type completePart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUploadResult struct {
+	ETag string `xml:"ETag"`
+}
+
+type listPartsResult struct {
+	Parts                []UploadedPart `xml:"Part"`
+	IsTruncated          bool           `xml:"IsTruncated"`
+	NextPartNumberMarker int            `xml:"NextPartNumberMarker"`
+}
+
+// 开始一个分段上传任务，返回UploadID
+func (c *Client) CreateMultipartUpload(ctx context.Context, key string) (string, error) {
+	var ret initiateMultipartUploadResult
+	err := c.doXML(ctx, request{
+		method: http.MethodPost,
+		key:    key,
+		query:  url.Values{"uploads": []string{""}},
+	}, &ret)
+	if err != nil {
+		return "", err
+	}
+
+	return ret.UploadID, nil
+}
+
+// 上传一个分段。分段编号从1开始
+func (c *Client) UploadPart(ctx context.Context, key string, uploadID string, partNumber int, body io.Reader, size int64) (UploadedPart, error) {
+	resp, err := c.do(ctx, request{
+		method: http.MethodPut,
+		key:    key,
+		query: url.Values{
+			"partNumber": []string{strconv.Itoa(partNumber)},
+			"uploadId":   []string{uploadID},
+		},
+		body: body,
+		size: size,
+	})
+	if err != nil {
+		return UploadedPart{}, err
+	}
+	resp.Body.Close()
+
+	return UploadedPart{
+		PartNumber: partNumber,
+		ETag:       resp.Header.Get("ETag"),
+		Size:       size,
+	}, nil
+}
+
+// 合并所有分段，完成上传，返回对象的ETag
+func (c *Client) CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []UploadedPart) (string, error) {
+	sorted := append([]UploadedPart{}, parts...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].PartNumber < sorted[j].PartNumber })
+
+	body := completeMultipartUpload{}
+	for _, p := range sorted {
+		body.Parts = append(body.Parts, completePart{PartNumber: p.PartNumber, ETag: p.ETag})
+	}
+
+	data, err := xml.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+
+	var ret completeMultipartUploadResult
+	err = c.doXML(ctx, request{
+		method:      http.MethodPost,
+		key:         key,
+		query:       url.Values{"uploadId": []string{uploadID}},
+		body:        bytes.NewReader(data),
+		size:        int64(len(data)),
+		payloadHash: hexSHA256(data),
+	}, &ret)
+	if err != nil {
+		return "", err
+	}
+
+	return ret.ETag, nil
+}
+
+// 取消分段上传任务，已经上传的分段会被删除
+func (c *Client) AbortMultipartUpload(ctx context.Context, key string, uploadID string) error {
+	resp, err := c.do(ctx, request{
+		method: http.MethodDelete,
+		key:    key,
+		query:  url.Values{"uploadId": []string{uploadID}},
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// 列出分段上传任务已经上传的所有分段
+func (c *Client) ListParts(ctx context.Context, key string, uploadID string) ([]UploadedPart, error) {
+	var parts []UploadedPart
+	marker := 0
+
+	for {
+		query := url.Values{"uploadId": []string{uploadID}}
+		if marker > 0 {
+			query.Set("part-number-marker", strconv.Itoa(marker))
+		}
+
+		var ret listPartsResult
+		err := c.doXML(ctx, request{
+			method: http.MethodGet,
+			key:    key,
+			query:  query,
+		}, &ret)
+		if err != nil {
+			return nil, err
+		}
+
+		parts = append(parts, ret.Parts...)
+		if !ret.IsTruncated {
+			return parts, nil
+		}
+
+		if ret.NextPartNumberMarker <= marker {
+			return nil, fmt.Errorf("invalid next part number marker: %v", ret.NextPartNumberMarker)
+		}
+		marker = ret.NextPartNumberMarker
+	}
+}
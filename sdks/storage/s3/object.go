@@ -0,0 +1,163 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlink.org.cn/cloudream/common/utils/math2"
+)
+
+type ObjectInfo struct {
+	Key          string    `xml:"Key"`
+	Size         int64     `xml:"Size"`
+	ETag         string    `xml:"ETag"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+// 上传一个对象，size为body的长度
+func (c *Client) PutObject(ctx context.Context, key string, body io.Reader, size int64) (ObjectInfo, error) {
+	resp, err := c.do(ctx, request{
+		method: http.MethodPut,
+		key:    key,
+		body:   body,
+		size:   size,
+	})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	resp.Body.Close()
+
+	return ObjectInfo{
+		Key:  key,
+		Size: size,
+		ETag: resp.Header.Get("ETag"),
+	}, nil
+}
+
+// 下载对象。rng的Length为nil时代表读取到对象末尾
+func (c *Client) GetObject(ctx context.Context, key string, rng math2.Range) (io.ReadCloser, error) {
+	header := http.Header{}
+	if rng.Length != nil && *rng.Length == 0 {
+		// Range头无法表示长度为0的范围，但仍然需要检查对象是否存在
+		_, err := c.HeadObject(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	if rng.Offset > 0 || rng.Length != nil {
+		header.Set("Range", formatRange(rng))
+	}
+
+	resp, err := c.do(ctx, request{
+		method: http.MethodGet,
+		key:    key,
+		header: header,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+func (c *Client) HeadObject(ctx context.Context, key string) (ObjectInfo, error) {
+	resp, err := c.do(ctx, request{
+		method: http.MethodHead,
+		key:    key,
+	})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	resp.Body.Close()
+
+	info := ObjectInfo{
+		Key:  key,
+		Size: resp.ContentLength,
+		ETag: resp.Header.Get("ETag"),
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.LastModified = t
+	}
+
+	return info, nil
+}
+
+// 删除对象，对象不存在时不会返回错误
+func (c *Client) DeleteObject(ctx context.Context, key string) error {
+	resp, err := c.do(ctx, request{
+		method: http.MethodDelete,
+		key:    key,
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type ListObjectsOption struct {
+	Prefix            string
+	Delimiter         string
+	ContinuationToken string
+	MaxKeys           int // 为0时使用服务端的默认值
+}
+
+type ListObjectsResult struct {
+	Objects               []ObjectInfo `xml:"Contents"`
+	CommonPrefixes        []string     `xml:"CommonPrefixes>Prefix"`
+	IsTruncated           bool         `xml:"IsTruncated"`
+	NextContinuationToken string       `xml:"NextContinuationToken"`
+}
+
+// 列出一页对象，使用ListObjectsV2接口
+func (c *Client) ListObjects(ctx context.Context, opt ListObjectsOption) (ListObjectsResult, error) {
+	query := url.Values{}
+	query.Set("list-type", "2")
+	if opt.Prefix != "" {
+		query.Set("prefix", opt.Prefix)
+	}
+	if opt.Delimiter != "" {
+		query.Set("delimiter", opt.Delimiter)
+	}
+	if opt.ContinuationToken != "" {
+		query.Set("continuation-token", opt.ContinuationToken)
+	}
+	if opt.MaxKeys > 0 {
+		query.Set("max-keys", strconv.Itoa(opt.MaxKeys))
+	}
+
+	var ret ListObjectsResult
+	err := c.doXML(ctx, request{
+		method: http.MethodGet,
+		query:  query,
+	}, &ret)
+	return ret, err
+}
+
+// 列出所有以prefix开头的对象
+func (c *Client) ListAllObjects(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objs []ObjectInfo
+	opt := ListObjectsOption{
+		Prefix: prefix,
+	}
+
+	for {
+		ret, err := c.ListObjects(ctx, opt)
+		if err != nil {
+			return nil, err
+		}
+
+		objs = append(objs, ret.Objects...)
+		if !ret.IsTruncated || ret.NextContinuationToken == "" {
+			return objs, nil
+		}
+
+		opt.ContinuationToken = ret.NextContinuationToken
+	}
+}
@@ -0,0 +1,255 @@
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	signAlgorithm   = "AWS4-HMAC-SHA256"
+	signService     = "s3"
+	signTimeFormat  = "20060102T150405Z"
+	signDateFormat  = "20060102"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	// 空字符串的SHA256
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	headerAuthorization = "Authorization"
+	headerContentSHA256 = "X-Amz-Content-Sha256"
+	headerDate          = "X-Amz-Date"
+
+	// 请求时间与服务端时间的最大误差
+	maxRequestTimeSkew = 15 * time.Minute
+)
+
+var (
+	errRequestTimeTooSkewed = errors.New("request time too skewed")
+	errPayloadHashMismatch  = errors.New("payload does not match " + headerContentSHA256)
+)
+
+// 使用AWS Signature Version 4对请求签名
+type signer struct {
+	ak     string
+	sk     string
+	region string
+}
+
+// 对请求签名。payloadHash是请求体的SHA256，不计算时可以使用unsignedPayload
+func (s *signer) Sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	req.Header.Set(headerDate, now.Format(signTimeFormat))
+	req.Header.Set(headerContentSHA256, payloadHash)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	signedHeaders := signedHeaderNames(req.Header)
+	scope := s.scope(now)
+	signature := s.signature(req.Method, host, req.URL.Path, req.URL.Query(), req.Header, signedHeaders, payloadHash, now)
+
+	req.Header.Set(headerAuthorization, fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signAlgorithm, s.ak, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+// 检查请求的签名是否正确，供服务端使用。请求时间与当前时间相差超过maxRequestTimeSkew时也会返回错误。
+//
+// 除非请求体的哈希为unsignedPayload，否则请求体会被替换为检查哈希的流，
+// 读取完毕时如果哈希不一致，会返回errPayloadHashMismatch而不是io.EOF。
+// 使用aws-chunked编码的请求体会被解码，并检查每个分块的签名，见decodeChunkedBody。
+func (s *signer) Verify(req *http.Request) error {
+	auth := req.Header.Get(headerAuthorization)
+	if !strings.HasPrefix(auth, signAlgorithm+" ") {
+		return fmt.Errorf("unsupported authorization: %q", auth)
+	}
+
+	var credential, signedHeaders, signature string
+	for _, part := range strings.Split(strings.TrimPrefix(auth, signAlgorithm+" "), ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "Credential":
+			credential = v
+		case "SignedHeaders":
+			signedHeaders = v
+		case "Signature":
+			signature = v
+		}
+	}
+
+	now, err := time.Parse(signTimeFormat, req.Header.Get(headerDate))
+	if err != nil {
+		return fmt.Errorf("invalid %s header: %w", headerDate, err)
+	}
+
+	if skew := time.Since(now); skew > maxRequestTimeSkew || skew < -maxRequestTimeSkew {
+		return fmt.Errorf("%w: %v", errRequestTimeTooSkewed, now)
+	}
+
+	if credential != s.ak+"/"+s.scope(now) {
+		return fmt.Errorf("invalid credential: %q", credential)
+	}
+
+	expected := s.signature(req.Method, req.Host, req.URL.Path, req.URL.Query(), req.Header,
+		strings.Split(signedHeaders, ";"), req.Header.Get(headerContentSHA256), now)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("signature does not match")
+	}
+
+	payloadHash := req.Header.Get(headerContentSHA256)
+	if strings.HasPrefix(payloadHash, streamingPayloadPrefix) {
+		return decodeChunkedBody(req, &chunkSigner{
+			key:       s.signingKey(now),
+			timestamp: now.Format(signTimeFormat),
+			scope:     s.scope(now),
+			prev:      signature,
+		})
+	}
+
+	if payloadHash != unsignedPayload && req.Body != nil {
+		req.Body = &payloadVerifier{
+			inner:    req.Body,
+			hash:     sha256.New(),
+			expected: payloadHash,
+		}
+	}
+
+	return nil
+}
+
+// 读取完毕时检查数据的SHA256是否与expected一致
+type payloadVerifier struct {
+	inner    io.ReadCloser
+	hash     hash.Hash
+	expected string
+}
+
+func (v *payloadVerifier) Read(p []byte) (int, error) {
+	n, err := v.inner.Read(p)
+	v.hash.Write(p[:n])
+
+	if err == io.EOF && hex.EncodeToString(v.hash.Sum(nil)) != v.expected {
+		return n, errPayloadHashMismatch
+	}
+	return n, err
+}
+
+func (v *payloadVerifier) Close() error {
+	return v.inner.Close()
+}
+
+func (s *signer) scope(now time.Time) string {
+	return fmt.Sprintf("%s/%s/%s/aws4_request", now.Format(signDateFormat), s.region, signService)
+}
+
+func (s *signer) signature(method string, host string, path string, query url.Values, header http.Header, signedHeaders []string, payloadHash string, now time.Time) string {
+	canonicalReq := strings.Join([]string{
+		method,
+		uriEncode(path, false),
+		canonicalQuery(query),
+		canonicalHeaders(host, header, signedHeaders),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	strToSign := strings.Join([]string{
+		signAlgorithm,
+		now.Format(signTimeFormat),
+		s.scope(now),
+		hexSHA256([]byte(canonicalReq)),
+	}, "\n")
+
+	return hex.EncodeToString(hmacSHA256(s.signingKey(now), strToSign))
+}
+
+func (s *signer) signingKey(now time.Time) []byte {
+	key := hmacSHA256([]byte("AWS4"+s.sk), now.Format(signDateFormat))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, signService)
+	return hmacSHA256(key, "aws4_request")
+}
+
+// 需要签名的请求头：Host以及所有x-amz-开头的头，再加上Range、Content-MD5、Content-Type
+func signedHeaderNames(header http.Header) []string {
+	names := []string{"host"}
+	for k := range header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") || lk == "range" || lk == "content-md5" || lk == "content-type" {
+			names = append(names, lk)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func canonicalHeaders(host string, header http.Header, signedHeaders []string) string {
+	sb := strings.Builder{}
+	for _, name := range signedHeaders {
+		var val string
+		if name == "host" {
+			val = host
+		} else {
+			val = strings.Join(header.Values(name), ",")
+		}
+
+		sb.WriteString(name)
+		sb.WriteString(":")
+		sb.WriteString(strings.TrimSpace(val))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		vals := append([]string{}, query[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// 按照S3的规则编码，除了非保留字符之外全部编码。encodeSlash为false时不编码'/'
+func uriEncode(s string, encodeSlash bool) string {
+	sb := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+func hexSHA256(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,354 @@
+package crypto2
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"gitlink.org.cn/cloudream/common/utils/math2"
+)
+
+// 分块AES-GCM加密流的格式：
+//
+// [头部: GCMHeaderSize字节][块0: 密文+Tag][块1: 密文+Tag]...
+//
+// 头部：Magic(4) + 版本(1) + 保留(3) + 明文块大小(4，大端) + Nonce前缀(8)
+//
+// 每一块的Nonce = Nonce前缀(8) + 块序号(4，大端)，AAD = 块序号(8，大端) + 是否为最后一块(1)，
+// 以此防止块被重排或者截断。除了最后一块，其他块的明文长度都等于块大小，最后一块的明文长度在[0, 块大小)之间。
+// 由于每一块都可以单独解密，因此可以只读取需要的块来实现范围解密。
+const (
+	GCMHeaderSize       = 20
+	GCMTagSize          = 16
+	GCMDefaultChunkSize = 64 * 1024
+
+	gcmMagic   = "CDSE"
+	gcmVersion = 1
+	// 块序号只占Nonce的4个字节
+	gcmMaxChunkCount = 1 << 32
+)
+
+var ErrGCMAuthFailed = errors.New("gcm chunk authentication failed")
+
+type GCMHeader struct {
+	ChunkSize   int
+	NoncePrefix [8]byte
+}
+
+func (h *GCMHeader) Marshal() []byte {
+	buf := make([]byte, GCMHeaderSize)
+	copy(buf, gcmMagic)
+	buf[4] = gcmVersion
+	binary.BigEndian.PutUint32(buf[8:], uint32(h.ChunkSize))
+	copy(buf[12:], h.NoncePrefix[:])
+	return buf
+}
+
+func UnmarshalGCMHeader(data []byte) (GCMHeader, error) {
+	var h GCMHeader
+	if len(data) < GCMHeaderSize {
+		return h, fmt.Errorf("header length should be %d, but got %d", GCMHeaderSize, len(data))
+	}
+
+	if string(data[:4]) != gcmMagic {
+		return h, fmt.Errorf("invalid magic")
+	}
+
+	if data[4] != gcmVersion {
+		return h, fmt.Errorf("unsupported version %d", data[4])
+	}
+
+	h.ChunkSize = int(binary.BigEndian.Uint32(data[8:]))
+	if h.ChunkSize <= 0 {
+		return h, fmt.Errorf("invalid chunk size %d", h.ChunkSize)
+	}
+
+	copy(h.NoncePrefix[:], data[12:GCMHeaderSize])
+	return h, nil
+}
+
+func ReadGCMHeader(r io.Reader) (GCMHeader, error) {
+	buf := make([]byte, GCMHeaderSize)
+	_, err := io.ReadFull(r, buf)
+	if err != nil {
+		return GCMHeader{}, fmt.Errorf("reading header: %w", err)
+	}
+
+	return UnmarshalGCMHeader(buf)
+}
+
+// 计算明文范围所对应的密文范围（包含头部的偏移），返回的密文范围总是从块的边界开始。
+// 如果明文范围的长度为nil，则密文范围的长度也为nil。
+func GCMCipherRange(plain math2.Range, chunkSize int) math2.Range {
+	cipherChunkSize := int64(chunkSize + GCMTagSize)
+
+	firstChunk := plain.Offset / int64(chunkSize)
+	start := GCMHeaderSize + firstChunk*cipherChunkSize
+	if plain.Length == nil {
+		return math2.Range{Offset: start}
+	}
+
+	if *plain.Length == 0 {
+		return math2.NewRange(start, 0)
+	}
+
+	lastChunk := (plain.Offset + *plain.Length - 1) / int64(chunkSize)
+	return math2.NewRange(start, (lastChunk-firstChunk+1)*cipherChunkSize)
+}
+
+// 计算明文长度加密后的总长度，包括头部
+func GCMCipherSize(plainSize int64, chunkSize int) int64 {
+	fullChunks := plainSize / int64(chunkSize)
+	return GCMHeaderSize + fullChunks*int64(chunkSize+GCMTagSize) + plainSize%int64(chunkSize) + GCMTagSize
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func makeNonce(prefix [8]byte, chunkIdx int64) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix[:])
+	binary.BigEndian.PutUint32(nonce[8:], uint32(chunkIdx))
+	return nonce
+}
+
+func makeAAD(chunkIdx int64, final bool) []byte {
+	aad := make([]byte, 9)
+	binary.BigEndian.PutUint64(aad, uint64(chunkIdx))
+	if final {
+		aad[8] = 1
+	}
+	return aad
+}
+
+type gcmEncryptReader struct {
+	aead     cipher.AEAD
+	header   GCMHeader
+	src      io.Reader
+	plainBuf []byte
+	out      []byte
+	outPos   int
+	chunkIdx int64
+	done     bool
+	err      error
+}
+
+// 将src加密为分块AES-GCM格式的流，输出包含头部。key的长度决定使用AES-128/192/256。
+// chunkSize为0时使用GCMDefaultChunkSize。
+func NewGCMEncryptReader(key []byte, src io.Reader, chunkSize int) (io.Reader, error) {
+	if chunkSize == 0 {
+		chunkSize = GCMDefaultChunkSize
+	}
+	if chunkSize < 0 {
+		return nil, fmt.Errorf("invalid chunk size %d", chunkSize)
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &gcmEncryptReader{
+		aead:     aead,
+		header:   GCMHeader{ChunkSize: chunkSize},
+		src:      src,
+		plainBuf: make([]byte, chunkSize),
+	}
+
+	_, err = io.ReadFull(rand.Reader, r.header.NoncePrefix[:])
+	if err != nil {
+		return nil, fmt.Errorf("generating nonce: %w", err)
+	}
+
+	r.out = r.header.Marshal()
+	return r, nil
+}
+
+func (r *gcmEncryptReader) Read(p []byte) (int, error) {
+	for r.outPos == len(r.out) {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+
+		r.sealNext()
+	}
+
+	n := copy(p, r.out[r.outPos:])
+	r.outPos += n
+	return n, nil
+}
+
+func (r *gcmEncryptReader) sealNext() {
+	if r.chunkIdx >= gcmMaxChunkCount {
+		r.err = fmt.Errorf("too many chunks")
+		return
+	}
+
+	rd, err := io.ReadFull(r.src, r.plainBuf)
+	final := false
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		final = true
+	} else if err != nil {
+		r.err = err
+		return
+	}
+
+	nonce := makeNonce(r.header.NoncePrefix, r.chunkIdx)
+	r.out = r.aead.Seal(r.out[:0], nonce, r.plainBuf[:rd], makeAAD(r.chunkIdx, final))
+	r.outPos = 0
+	r.chunkIdx++
+	r.done = final
+}
+
+type gcmDecryptReader struct {
+	aead      cipher.AEAD
+	header    *GCMHeader
+	src       io.Reader
+	cipherBuf []byte
+	out       []byte
+	outPos    int
+	chunkIdx  int64
+	// 第一块需要跳过的明文长度
+	skip int64
+	// 剩余需要输出的明文长度，为nil代表一直输出到流结束
+	remain *int64
+	// 为true时，要求流以最后一块结束，否则视为被截断。
+	// 范围解密时如果没有指定长度，则一直解密到流结束，同样要求以最后一块结束
+	requireFinal bool
+	done         bool
+	err          error
+}
+
+// 解密一个完整的分块AES-GCM格式的流，src需要包含头部。
+func NewGCMDecryptReader(key []byte, src io.Reader) (io.Reader, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gcmDecryptReader{
+		aead:         aead,
+		src:          src,
+		requireFinal: true,
+	}, nil
+}
+
+// 解密指定明文范围的数据。src应该是GCMCipherRange所计算出的密文范围的数据，不包含头部，头部需要单独读取后传入。
+func NewGCMRangeDecryptReader(key []byte, header GCMHeader, src io.Reader, plain math2.Range) (io.Reader, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var remain *int64
+	if plain.Length != nil {
+		l := *plain.Length
+		remain = &l
+	}
+
+	return &gcmDecryptReader{
+		aead:         aead,
+		header:       &header,
+		src:          src,
+		cipherBuf:    make([]byte, header.ChunkSize+GCMTagSize),
+		chunkIdx:     plain.Offset / int64(header.ChunkSize),
+		skip:         plain.Offset % int64(header.ChunkSize),
+		remain:       remain,
+		requireFinal: plain.Length == nil,
+	}, nil
+}
+
+func (r *gcmDecryptReader) Read(p []byte) (int, error) {
+	if r.remain != nil && *r.remain == 0 {
+		return 0, io.EOF
+	}
+
+	for r.outPos == len(r.out) {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+
+		r.openNext()
+	}
+
+	out := r.out[r.outPos:]
+	if r.remain != nil {
+		out = out[:math2.Min(int64(len(out)), *r.remain)]
+	}
+
+	n := copy(p, out)
+	r.outPos += n
+	if r.remain != nil {
+		*r.remain -= int64(n)
+	}
+	return n, nil
+}
+
+func (r *gcmDecryptReader) openNext() {
+	if r.header == nil {
+		h, err := ReadGCMHeader(r.src)
+		if err != nil {
+			r.err = err
+			return
+		}
+		r.header = &h
+		r.cipherBuf = make([]byte, h.ChunkSize+GCMTagSize)
+	}
+
+	rd, err := io.ReadFull(r.src, r.cipherBuf)
+	if err == io.EOF {
+		// 流必须以最后一块结束，而最后一块至少包含Tag，因此不会遇到EOF。
+		// 范围解密时，在块的边界遇到EOF但还没有输出足够的数据，同样说明流被截断了
+		if r.requireFinal || (r.remain != nil && *r.remain > 0) {
+			r.err = io.ErrUnexpectedEOF
+			return
+		}
+		r.done = true
+		return
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		r.err = err
+		return
+	}
+
+	// 只有最后一块的长度会小于完整块的长度
+	final := rd < len(r.cipherBuf)
+	if rd < GCMTagSize {
+		r.err = io.ErrUnexpectedEOF
+		return
+	}
+
+	nonce := makeNonce(r.header.NoncePrefix, r.chunkIdx)
+	plain, err := r.aead.Open(r.out[:0], nonce, r.cipherBuf[:rd], makeAAD(r.chunkIdx, final))
+	if err != nil {
+		r.err = fmt.Errorf("chunk %d: %w", r.chunkIdx, ErrGCMAuthFailed)
+		return
+	}
+
+	r.out = plain
+	r.outPos = 0
+	r.chunkIdx++
+	r.done = final
+
+	if r.skip > 0 {
+		skip := math2.Min(r.skip, int64(len(r.out)))
+		r.outPos = int(skip)
+		r.skip -= skip
+	}
+}
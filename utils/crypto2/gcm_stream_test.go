@@ -0,0 +1,158 @@
+package crypto2
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlink.org.cn/cloudream/common/utils/math2"
+)
+
+func Test_GCMStream(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+
+	makeData := func(size int) []byte {
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(i * 7)
+		}
+		return data
+	}
+
+	encrypt := func(data []byte, chunkSize int) []byte {
+		rd, err := NewGCMEncryptReader(key, bytes.NewReader(data), chunkSize)
+		So(err, ShouldBeNil)
+
+		enc, err := io.ReadAll(rd)
+		So(err, ShouldBeNil)
+		return enc
+	}
+
+	Convey("加密后解密，长度不是块大小的整数倍", t, func() {
+		data := makeData(100)
+		enc := encrypt(data, 16)
+		So(len(enc), ShouldEqual, GCMCipherSize(100, 16))
+
+		rd, err := NewGCMDecryptReader(key, bytes.NewReader(enc))
+		So(err, ShouldBeNil)
+		dec, err := io.ReadAll(rd)
+		So(err, ShouldBeNil)
+		So(dec, ShouldResemble, data)
+	})
+
+	Convey("加密后解密，长度是块大小的整数倍", t, func() {
+		data := makeData(64)
+		enc := encrypt(data, 16)
+		So(len(enc), ShouldEqual, GCMCipherSize(64, 16))
+
+		rd, err := NewGCMDecryptReader(key, bytes.NewReader(enc))
+		So(err, ShouldBeNil)
+		dec, err := io.ReadAll(rd)
+		So(err, ShouldBeNil)
+		So(dec, ShouldResemble, data)
+	})
+
+	Convey("空流", t, func() {
+		enc := encrypt(nil, 16)
+
+		rd, err := NewGCMDecryptReader(key, bytes.NewReader(enc))
+		So(err, ShouldBeNil)
+		dec, err := io.ReadAll(rd)
+		So(err, ShouldBeNil)
+		So(dec, ShouldHaveLength, 0)
+	})
+
+	Convey("截断的流", t, func() {
+		data := makeData(64)
+		enc := encrypt(data, 16)
+
+		rd, err := NewGCMDecryptReader(key, bytes.NewReader(enc[:GCMHeaderSize+2*(16+GCMTagSize)]))
+		So(err, ShouldBeNil)
+		_, err = io.ReadAll(rd)
+		So(err, ShouldEqual, io.ErrUnexpectedEOF)
+	})
+
+	Convey("被篡改的流", t, func() {
+		data := makeData(64)
+		enc := encrypt(data, 16)
+		enc[GCMHeaderSize+1] ^= 0xff
+
+		rd, err := NewGCMDecryptReader(key, bytes.NewReader(enc))
+		So(err, ShouldBeNil)
+		_, err = io.ReadAll(rd)
+		So(err, ShouldWrap, ErrGCMAuthFailed)
+	})
+
+	Convey("错误的密钥", t, func() {
+		data := makeData(64)
+		enc := encrypt(data, 16)
+
+		rd, err := NewGCMDecryptReader(make([]byte, 32), bytes.NewReader(enc))
+		So(err, ShouldBeNil)
+		_, err = io.ReadAll(rd)
+		So(err, ShouldWrap, ErrGCMAuthFailed)
+	})
+
+	Convey("范围解密", t, func() {
+		data := makeData(100)
+		enc := encrypt(data, 16)
+
+		hdr, err := ReadGCMHeader(bytes.NewReader(enc))
+		So(err, ShouldBeNil)
+
+		check := func(plain math2.Range) {
+			cipherRng := GCMCipherRange(plain, hdr.ChunkSize)
+			cipherData := enc[cipherRng.Offset:]
+			if cipherRng.Length != nil {
+				cipherData = cipherData[:math2.Min(int64(len(cipherData)), *cipherRng.Length)]
+			}
+
+			rd, err := NewGCMRangeDecryptReader(key, hdr, bytes.NewReader(cipherData), plain)
+			So(err, ShouldBeNil)
+			dec, err := io.ReadAll(rd)
+			So(err, ShouldBeNil)
+
+			expected := data[plain.Offset:]
+			if plain.Length != nil {
+				expected = expected[:*plain.Length]
+			}
+			So(dec, ShouldResemble, expected)
+		}
+
+		check(math2.NewRange(0, 100))
+		check(math2.NewRange(5, 10))
+		check(math2.NewRange(15, 2))
+		check(math2.NewRange(16, 16))
+		check(math2.NewRange(33, 60))
+		check(math2.NewRange(90, -1))
+		check(math2.NewRange(40, 0))
+	})
+
+	Convey("范围解密时流被截断", t, func() {
+		data := makeData(300)
+		enc := encrypt(data, 100)
+
+		hdr, err := ReadGCMHeader(bytes.NewReader(enc))
+		So(err, ShouldBeNil)
+
+		// 在第一块之后截断，但需要250字节
+		cipherData := enc[GCMHeaderSize : GCMHeaderSize+100+GCMTagSize]
+		rd, err := NewGCMRangeDecryptReader(key, hdr, bytes.NewReader(cipherData), math2.NewRange(0, 250))
+		So(err, ShouldBeNil)
+		dec, err := io.ReadAll(rd)
+		So(err, ShouldEqual, io.ErrUnexpectedEOF)
+		So(dec, ShouldResemble, data[:100])
+
+		// 不指定长度时，缺少最后一块也是截断
+		cipherData = enc[GCMHeaderSize : GCMHeaderSize+2*(100+GCMTagSize)]
+		rd, err = NewGCMRangeDecryptReader(key, hdr, bytes.NewReader(cipherData), math2.NewRange(0, -1))
+		So(err, ShouldBeNil)
+		dec, err = io.ReadAll(rd)
+		So(err, ShouldEqual, io.ErrUnexpectedEOF)
+		So(dec, ShouldResemble, data[:200])
+	})
+}
@@ -2,6 +2,7 @@ package http2
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"mime"
@@ -30,13 +31,15 @@ const (
 var defaultClient = http.DefaultClient
 
 type RequestParam struct {
-	Header any
-	Query  any
-	Body   any // 如果是[]byte，则直接作为请求体，否则会被序列化等处理
+	Header  any
+	Query   any
+	Body    any             // 如果是[]byte，则直接作为请求体，否则会被序列化等处理
+	Context context.Context // 为nil则使用context.Background()
+	Client  *http.Client    // 为nil则使用http.DefaultClient
 }
 
 func GetJSON(url string, param RequestParam) (*http.Response, error) {
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	req, err := newRequest(param.Context, http.MethodGet, url)
 	if err != nil {
 		return nil, err
 	}
@@ -53,11 +56,11 @@ func GetJSON(url string, param RequestParam) (*http.Response, error) {
 		return nil, err
 	}
 
-	return defaultClient.Do(req)
+	return doRequest(param.Client, req)
 }
 
 func DeleteJSON(url string, param RequestParam) (*http.Response, error) {
-	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	req, err := newRequest(param.Context, http.MethodDelete, url)
 	if err != nil {
 		return nil, err
 	}
@@ -74,11 +77,11 @@ func DeleteJSON(url string, param RequestParam) (*http.Response, error) {
 		return nil, err
 	}
 
-	return defaultClient.Do(req)
+	return doRequest(param.Client, req)
 }
 
 func GetForm(url string, param RequestParam) (*http.Response, error) {
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	req, err := newRequest(param.Context, http.MethodGet, url)
 	if err != nil {
 		return nil, err
 	}
@@ -95,11 +98,11 @@ func GetForm(url string, param RequestParam) (*http.Response, error) {
 		return nil, err
 	}
 
-	return defaultClient.Do(req)
+	return doRequest(param.Client, req)
 }
 
 func PostJSON(url string, param RequestParam) (*http.Response, error) {
-	req, err := http.NewRequest(http.MethodPost, url, nil)
+	req, err := newRequest(param.Context, http.MethodPost, url)
 	if err != nil {
 		return nil, err
 	}
@@ -116,11 +119,11 @@ func PostJSON(url string, param RequestParam) (*http.Response, error) {
 		return nil, err
 	}
 
-	return defaultClient.Do(req)
+	return doRequest(param.Client, req)
 }
 
 func PostForm(url string, param RequestParam) (*http.Response, error) {
-	req, err := http.NewRequest(http.MethodPost, url, nil)
+	req, err := newRequest(param.Context, http.MethodPost, url)
 	if err != nil {
 		return nil, err
 	}
@@ -137,17 +140,19 @@ func PostForm(url string, param RequestParam) (*http.Response, error) {
 		return nil, err
 	}
 
-	return defaultClient.Do(req)
+	return doRequest(param.Client, req)
 }
 
 type Chunked2RequestParam struct {
-	Header any
-	Query  any
-	Body   io.ReadCloser
+	Header  any
+	Query   any
+	Body    io.ReadCloser
+	Context context.Context
+	Client  *http.Client
 }
 
 func PostChunked2(url string, param Chunked2RequestParam) (*http.Response, error) {
-	req, err := http.NewRequest(http.MethodPost, url, nil)
+	req, err := newRequest(param.Context, http.MethodPost, url)
 	if err != nil {
 		return nil, err
 	}
@@ -162,7 +167,7 @@ func PostChunked2(url string, param Chunked2RequestParam) (*http.Response, error
 
 	setHeader(req.Header, "Content-Type", ContentTypeOctetStream)
 	req.Body = param.Body
-	return defaultClient.Do(req)
+	return doRequest(param.Client, req)
 }
 
 func ParseJSONResponse[TBody any](resp *http.Response) (TBody, error) {
@@ -350,6 +355,8 @@ type MultiPartRequestParam struct {
 	Form     any
 	Files    MultiPartFileIterator
 	PartSize int64 // 文件分片大小，如果为0则不分片
+	Context  context.Context
+	Client   *http.Client
 }
 
 type MultiPartFileIterator = iterator.Iterator[*IterMultiPartFile]
@@ -360,7 +367,7 @@ type IterMultiPartFile struct {
 }
 
 func PostMultiPart(url string, param MultiPartRequestParam) (*http.Response, error) {
-	req, err := http.NewRequest(http.MethodPost, url, nil)
+	req, err := newRequest(param.Context, http.MethodPost, url)
 	if err != nil {
 		return nil, err
 	}
@@ -380,10 +387,7 @@ func PostMultiPart(url string, param MultiPartRequestParam) (*http.Response, err
 
 	writeResult := make(chan error, 1)
 	go func() {
-		writeResult <- func() error {
-			defer pw.Close()
-			defer muWriter.Close()
-
+		err := func() error {
 			if param.Form != nil {
 				mp, err := objectToStringMap(param.Form, "json")
 				if err != nil {
@@ -418,14 +422,17 @@ func PostMultiPart(url string, param MultiPartRequestParam) (*http.Response, err
 				}
 			}
 
-			return nil
+			return muWriter.Close()
 		}()
+
+		// 出错时不能写入结束标记，否则服务端会把不完整的数据当作完整的请求体
+		pw.CloseWithError(err)
+		writeResult <- err
 	}()
 
 	req.Body = pr
 
-	cli := http.Client{}
-	resp, err := cli.Do(req)
+	resp, err := doRequest(param.Client, req)
 	if err != nil {
 		return nil, err
 	}
@@ -469,6 +476,20 @@ func sendFileOnePart(muWriter *multipart.Writer, fieldName, fileName string, fil
 	return err
 }
 
+func newRequest(ctx context.Context, method string, url string) (*http.Request, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return http.NewRequestWithContext(ctx, method, url, nil)
+}
+
+func doRequest(cli *http.Client, req *http.Request) (*http.Response, error) {
+	if cli == nil {
+		cli = defaultClient
+	}
+	return cli.Do(req)
+}
+
 func prepareQuery(req *http.Request, query any) error {
 	if query == nil {
 		return nil
@@ -1,8 +1,14 @@
 package io2
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"os"
 	"sync"
+
+	"gitlink.org.cn/cloudream/common/utils/math2"
 )
 
 // 复制一个流。注：返回的多个流的读取不能在同一个线程，且如果不再需要读取返回的某个流，那么必须关闭这个流，否则会阻塞其他流的读取。
@@ -60,8 +66,375 @@ func Clone(str io.Reader, count int) []io.ReadCloser {
 	return prs
 }
 
-/*
+// 复制出的某个流在读取完毕之前被关闭时，其他流读取时会返回这个错误
+var ErrCloneClosedEarly = errors.New("cloned stream closed early")
+
+// 复制一个流，每个复制出的流都有一个大小为bufSize的缓冲区，只有某个流的缓冲区满了才会阻塞其他流的读取。
+//
+// 如果某个流在读取完毕之前被关闭，那么会停止读取源流，其他流在读取时会返回ErrCloneClosedEarly。
+// 返回的流的读取不能在同一个线程。
 func BufferedClone(str io.Reader, count int, bufSize int) []io.ReadCloser {
+	return NewBufferedCloneGroup(str, count, bufSize).Outputs
+}
+
+// 复制一个流，每个复制出的流都有一个大小为memSize的内存缓冲区，缓冲区满了之后，
+// 数据会写入到tempDir中的临时文件里，因此读取速度慢的流不会阻塞其他流。tempDir为空则使用系统的临时目录。
+//
+// 关闭流的行为与BufferedClone相同。临时文件会在流关闭后删除。
+func SpillClone(str io.Reader, count int, memSize int, tempDir string) []io.ReadCloser {
+	return NewSpillCloneGroup(str, count, memSize, tempDir).Outputs
+}
+
+// 以锁步的方式复制一个流：每次从源流读取最多chunkSize字节的数据，所有流都读取完这块数据之后，才会读取下一块。
+//
+// 关闭流的行为与BufferedClone相同。
+func LockStepClone(str io.Reader, count int, chunkSize int) []io.ReadCloser {
+	return NewLockStepCloneGroup(str, count, chunkSize).Outputs
+}
+
+// 复制出的一组流，可以通过Wait得到复制的结果
+type CloneGroup struct {
+	Outputs []io.ReadCloser
+	cloner  *cloner
+}
+
+// 与BufferedClone相同，但返回CloneGroup
+func NewBufferedCloneGroup(str io.Reader, count int, bufSize int) *CloneGroup {
+	return newCloner(str, count, bufSize, cloneBuffered, "").start()
+}
+
+// 与SpillClone相同，但返回CloneGroup
+func NewSpillCloneGroup(str io.Reader, count int, memSize int, tempDir string) *CloneGroup {
+	return newCloner(str, count, memSize, cloneSpill, tempDir).start()
+}
+
+// 与LockStepClone相同，但返回CloneGroup
+func NewLockStepCloneGroup(str io.Reader, count int, chunkSize int) *CloneGroup {
+	return newCloner(str, count, chunkSize, cloneLockStep, "").start()
+}
+
+// 等待所有流都被关闭，并且不再读取源流，然后返回复制的结果：
+//   - 有流在读取完毕之前被关闭时，返回ErrCloneClosedEarly
+//   - 源流读取出错时，返回这个错误
+//   - 否则返回nil
+//
+// 一个流即使没有读到io.EOF就被关闭，只要源流之后没有再产生数据，也不算作提前关闭。
+func (g *CloneGroup) Wait(ctx context.Context) error {
+	c := g.cloner
+
+	for _, ch := range []chan any{c.allClosed, c.done} {
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.abortErr != nil {
+		return c.abortErr
+	}
+
+	if c.srcErr != nil && c.srcErr != io.EOF {
+		return c.srcErr
+	}
+
+	return nil
+}
+
+type cloneMode int
+
+const (
+	cloneBuffered cloneMode = iota
+	cloneSpill
+	cloneLockStep
+)
+
+type cloner struct {
+	lock      sync.Mutex
+	cond      *sync.Cond
+	src       io.Reader
+	bufSize   int
+	mode      cloneMode
+	tempDir   string
+	outputs   []*cloneOutput
+	closedCnt int
+	srcErr    error    // 源流读取时返回的错误，包括io.EOF
+	abortErr  error    // 导致停止复制的错误，比如某个流被提前关闭
+	allClosed chan any // 所有流都关闭后关闭
+	done      chan any // 不再读取源流后关闭
+}
+
+type cloneOutput struct {
+	cloner *cloner
+	mem    []byte
+	memOff int
+	file   *os.File
+	fileR  int64
+	fileW  int64
+	closed bool
+}
+
+func newCloner(src io.Reader, count int, bufSize int, mode cloneMode, tempDir string) *cloner {
+	if bufSize <= 0 {
+		bufSize = 1024 * 16
+	}
+
+	c := &cloner{
+		src:       src,
+		bufSize:   bufSize,
+		mode:      mode,
+		tempDir:   tempDir,
+		allClosed: make(chan any),
+		done:      make(chan any),
+	}
+	c.cond = sync.NewCond(&c.lock)
+
+	for i := 0; i < count; i++ {
+		c.outputs = append(c.outputs, &cloneOutput{
+			cloner: c,
+			mem:    make([]byte, 0, bufSize),
+		})
+	}
+
+	if count == 0 {
+		close(c.allClosed)
+	}
+
+	return c
+}
+
+func (c *cloner) start() *CloneGroup {
+	go c.pump()
+
+	ret := make([]io.ReadCloser, len(c.outputs))
+	for i, o := range c.outputs {
+		ret[i] = o
+	}
+	return &CloneGroup{
+		Outputs: ret,
+		cloner:  c,
+	}
+}
+
+func (c *cloner) pump() {
+	defer close(c.done)
+
+	// 一次读取的数据不能超过缓冲区大小，否则永远无法放入缓冲区
+	readSize := math2.Min(c.bufSize, 1024*32)
+	if c.mode == cloneLockStep {
+		readSize = c.bufSize
+	}
+	buf := make([]byte, readSize)
+
+	for {
+		// 锁步复制时，所有流都读取完上一块数据后才读取下一块
+		if c.mode == cloneLockStep {
+			c.lock.Lock()
+			for c.abortErr == nil && !c.allDrained() {
+				c.cond.Wait()
+			}
+			stop := c.abortErr != nil
+			c.lock.Unlock()
+			if stop {
+				return
+			}
+		}
+
+		n, err := c.src.Read(buf)
+
+		c.lock.Lock()
+		if n > 0 {
+			// 不能溢出到文件时，需要等待所有流的缓冲区都有足够的空间
+			for c.mode != cloneSpill && c.abortErr == nil && !c.allHaveSpace(n) {
+				c.cond.Wait()
+			}
+
+			if c.abortErr != nil {
+				c.lock.Unlock()
+				return
+			}
+
+			for _, o := range c.outputs {
+				// 流关闭时已经读取了所有的数据，但之后源流又产生了新的数据，说明它是被提前关闭的
+				if o.closed {
+					c.abort(ErrCloneClosedEarly)
+					c.lock.Unlock()
+					return
+				}
+
+				if e := o.push(buf[:n]); e != nil {
+					c.abort(e)
+					c.lock.Unlock()
+					return
+				}
+			}
+			c.cond.Broadcast()
+		}
+
+		if err != nil {
+			if c.abortErr == nil {
+				c.srcErr = err
+				c.cond.Broadcast()
+			}
+			c.lock.Unlock()
+			return
+		}
+
+		stop := c.abortErr != nil
+		c.lock.Unlock()
+		if stop {
+			return
+		}
+	}
+}
+
+func (c *cloner) allHaveSpace(n int) bool {
+	for _, o := range c.outputs {
+		if o.closed {
+			continue
+		}
+
+		if len(o.mem)-o.memOff+n > c.bufSize {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *cloner) allDrained() bool {
+	for _, o := range c.outputs {
+		if !o.closed && o.memOff < len(o.mem) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *cloner) abort(err error) {
+	if c.abortErr != nil {
+		return
+	}
+
+	c.abortErr = err
+	c.cond.Broadcast()
+}
+
+// 调用时需要持有锁
+func (o *cloneOutput) push(data []byte) error {
+	c := o.cloner
+
+	// 临时文件中还有数据没有读取时，新的数据也只能放到文件末尾，以保证顺序
+	if o.file == nil || o.fileR == o.fileW {
+		if o.memOff > 0 {
+			n := copy(o.mem, o.mem[o.memOff:])
+			o.mem = o.mem[:n]
+			o.memOff = 0
+		}
+
+		if len(o.mem)+len(data) <= c.bufSize {
+			o.mem = append(o.mem, data...)
+			return nil
+		}
+	}
+
+	if o.file == nil {
+		f, err := os.CreateTemp(c.tempDir, "clone-*")
+		if err != nil {
+			return fmt.Errorf("creating temp file: %w", err)
+		}
+		o.file = f
+	}
+
+	n, err := o.file.WriteAt(data, o.fileW)
+	o.fileW += int64(n)
+	if err != nil {
+		return fmt.Errorf("writing temp file: %w", err)
+	}
+
+	return nil
+}
+
+func (o *cloneOutput) Read(p []byte) (int, error) {
+	c := o.cloner
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for {
+		if o.closed {
+			return 0, io.ErrClosedPipe
+		}
+
+		if c.abortErr != nil {
+			return 0, c.abortErr
+		}
+
+		if o.memOff < len(o.mem) {
+			n := copy(p, o.mem[o.memOff:])
+			o.memOff += n
+			if o.memOff == len(o.mem) {
+				o.mem = o.mem[:0]
+				o.memOff = 0
+			}
+			c.cond.Broadcast()
+			return n, nil
+		}
+
+		if o.file != nil && o.fileR < o.fileW {
+			n, err := o.file.ReadAt(p[:math2.Min(int64(len(p)), o.fileW-o.fileR)], o.fileR)
+			o.fileR += int64(n)
+			if err != nil && err != io.EOF {
+				c.abort(fmt.Errorf("reading temp file: %w", err))
+				return n, c.abortErr
+			}
+
+			// 文件中的数据读取完毕后，重新从头开始使用文件
+			if o.fileR == o.fileW {
+				o.fileR = 0
+				o.fileW = 0
+				o.file.Truncate(0)
+			}
+			return n, nil
+		}
+
+		if c.srcErr != nil {
+			return 0, c.srcErr
+		}
+
+		c.cond.Wait()
+	}
+}
+
+func (o *cloneOutput) Close() error {
+	c := o.cloner
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if o.closed {
+		return nil
+	}
+	o.closed = true
+
+	// 还有没读取的数据时一定是提前关闭。否则要看源流之后是否还会产生数据，由pump判断
+	remains := o.memOff < len(o.mem) || (o.file != nil && o.fileR < o.fileW)
+	if remains && (c.srcErr == nil || c.srcErr == io.EOF) {
+		c.abort(ErrCloneClosedEarly)
+	}
+
+	o.mem = nil
+	if o.file != nil {
+		o.file.Close()
+		os.Remove(o.file.Name())
+		o.file = nil
+	}
+
+	c.closedCnt++
+	if c.closedCnt == len(c.outputs) {
+		close(c.allClosed)
+	}
 
+	c.cond.Broadcast()
+	return nil
 }
-*/
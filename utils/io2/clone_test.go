@@ -0,0 +1,247 @@
+package io2
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_BufferedClone(t *testing.T) {
+	data := make([]byte, 1024*100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	readAll := func(strs []io.ReadCloser) ([][]byte, []error) {
+		rets := make([][]byte, len(strs))
+		errs := make([]error, len(strs))
+		wg := sync.WaitGroup{}
+		for i, str := range strs {
+			wg.Add(1)
+			go func(i int, str io.ReadCloser) {
+				defer wg.Done()
+				rets[i], errs[i] = io.ReadAll(str)
+				str.Close()
+			}(i, str)
+		}
+		wg.Wait()
+		return rets, errs
+	}
+
+	Convey("缓冲区小于数据量", t, func() {
+		strs := BufferedClone(bytes.NewReader(data), 3, 1000)
+		rets, errs := readAll(strs)
+		for i := range strs {
+			So(errs[i], ShouldBeNil)
+			So(rets[i], ShouldResemble, data)
+		}
+	})
+
+	Convey("一个流读取完毕后另一个流才开始读取", t, func() {
+		strs := BufferedClone(bytes.NewReader(data), 2, len(data))
+
+		ret0, err := io.ReadAll(strs[0])
+		So(err, ShouldBeNil)
+		So(ret0, ShouldResemble, data)
+
+		ret1, err := io.ReadAll(strs[1])
+		So(err, ShouldBeNil)
+		So(ret1, ShouldResemble, data)
+
+		So(strs[0].Close(), ShouldBeNil)
+		So(strs[1].Close(), ShouldBeNil)
+	})
+
+	Convey("一个流被提前关闭", t, func() {
+		strs := BufferedClone(bytes.NewReader(data), 2, 1000)
+
+		buf := make([]byte, 10)
+		_, err := io.ReadFull(strs[0], buf)
+		So(err, ShouldBeNil)
+		strs[0].Close()
+
+		_, err = io.ReadAll(strs[1])
+		So(err, ShouldEqual, ErrCloneClosedEarly)
+	})
+
+	Convey("源流读取出错", t, func() {
+		strs := BufferedClone(io.MultiReader(bytes.NewReader(data[:100]), ErrorReader(io.ErrUnexpectedEOF)), 2, 1000)
+		rets, errs := readAll(strs)
+		for i := range strs {
+			So(errs[i], ShouldEqual, io.ErrUnexpectedEOF)
+			So(rets[i], ShouldResemble, data[:100])
+		}
+	})
+
+	Convey("读取了所有数据，但没有读到EOF就关闭，不算提前关闭", t, func() {
+		g := NewBufferedCloneGroup(bytes.NewReader(data), 2, 1000)
+
+		go func() {
+			buf := make([]byte, len(data))
+			io.ReadFull(g.Outputs[0], buf)
+			g.Outputs[0].Close()
+		}()
+
+		ret1, err := io.ReadAll(g.Outputs[1])
+		So(err, ShouldBeNil)
+		So(ret1, ShouldResemble, data)
+		g.Outputs[1].Close()
+
+		So(g.Wait(context.Background()), ShouldBeNil)
+	})
+
+	Convey("读取完缓冲区中的数据后关闭，但源流还有数据", t, func() {
+		g := NewBufferedCloneGroup(bytes.NewReader(data), 2, 1000)
+
+		buf := make([]byte, 1000)
+		_, err := io.ReadFull(g.Outputs[0], buf)
+		So(err, ShouldBeNil)
+		g.Outputs[0].Close()
+
+		_, err = io.ReadAll(g.Outputs[1])
+		So(err, ShouldEqual, ErrCloneClosedEarly)
+		g.Outputs[1].Close()
+
+		So(g.Wait(context.Background()), ShouldEqual, ErrCloneClosedEarly)
+	})
+
+	Convey("Wait返回源流的错误", t, func() {
+		g := NewBufferedCloneGroup(io.MultiReader(bytes.NewReader(data[:100]), ErrorReader(io.ErrUnexpectedEOF)), 1, 1000)
+		_, err := io.ReadAll(g.Outputs[0])
+		So(err, ShouldEqual, io.ErrUnexpectedEOF)
+		g.Outputs[0].Close()
+
+		So(g.Wait(context.Background()), ShouldEqual, io.ErrUnexpectedEOF)
+	})
+}
+
+// 统计从源流读取的字节数
+type countingReader struct {
+	lock sync.Mutex
+	r    io.Reader
+	n    int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.lock.Lock()
+	r.n += n
+	r.lock.Unlock()
+	return n, err
+}
+
+func (r *countingReader) count() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.n
+}
+
+func Test_LockStepClone(t *testing.T) {
+	data := make([]byte, 1024*100)
+	for i := range data {
+		data[i] = byte(i * 3)
+	}
+
+	Convey("所有流读取到的数据相同", t, func() {
+		g := NewLockStepCloneGroup(bytes.NewReader(data), 3, 1000)
+
+		rets := make([][]byte, len(g.Outputs))
+		errs := make([]error, len(g.Outputs))
+		wg := sync.WaitGroup{}
+		for i, str := range g.Outputs {
+			wg.Add(1)
+			go func(i int, str io.ReadCloser) {
+				defer wg.Done()
+				rets[i], errs[i] = io.ReadAll(str)
+				str.Close()
+			}(i, str)
+		}
+		wg.Wait()
+
+		for i := range g.Outputs {
+			So(errs[i], ShouldBeNil)
+			So(rets[i], ShouldResemble, data)
+		}
+		So(g.Wait(context.Background()), ShouldBeNil)
+	})
+
+	Convey("所有流读取完当前的数据块之后才读取下一块", t, func() {
+		src := &countingReader{r: bytes.NewReader(data)}
+		g := NewLockStepCloneGroup(src, 2, 1000)
+
+		buf := make([]byte, 1000)
+		_, err := io.ReadFull(g.Outputs[0], buf)
+		So(err, ShouldBeNil)
+
+		time.Sleep(20 * time.Millisecond)
+		So(src.count(), ShouldEqual, 1000)
+
+		_, err = io.ReadFull(g.Outputs[1], buf)
+		So(err, ShouldBeNil)
+		_, err = io.ReadFull(g.Outputs[0], buf)
+		So(err, ShouldBeNil)
+		So(buf, ShouldResemble, data[1000:2000])
+
+		g.Outputs[0].Close()
+		g.Outputs[1].Close()
+		So(g.Wait(context.Background()), ShouldEqual, ErrCloneClosedEarly)
+	})
+}
+
+func Test_SpillClone(t *testing.T) {
+	data := make([]byte, 1024*100)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	Convey("读取慢的流的数据写入临时文件", t, func() {
+		dir := t.TempDir()
+		strs := SpillClone(bytes.NewReader(data), 2, 1000, dir)
+
+		// 第二个流不读取时，第一个流也能读取完毕
+		ret0, err := io.ReadAll(strs[0])
+		So(err, ShouldBeNil)
+		So(ret0, ShouldResemble, data)
+
+		entries, _ := os.ReadDir(dir)
+		So(entries, ShouldNotBeEmpty)
+
+		ret1, err := io.ReadAll(strs[1])
+		So(err, ShouldBeNil)
+		So(ret1, ShouldResemble, data)
+
+		strs[0].Close()
+		strs[1].Close()
+
+		entries, _ = os.ReadDir(dir)
+		So(entries, ShouldHaveLength, 0)
+	})
+
+	Convey("交替读取", t, func() {
+		strs := SpillClone(bytes.NewReader(data), 2, 1000, t.TempDir())
+
+		var ret0, ret1 []byte
+		buf := make([]byte, 3000)
+		for {
+			n0, err0 := strs[0].Read(buf)
+			ret0 = append(ret0, buf[:n0]...)
+			n1, err1 := io.ReadFull(strs[1], buf[:100])
+			ret1 = append(ret1, buf[:n1]...)
+			if err0 == io.EOF && err1 != nil {
+				break
+			}
+		}
+		rest, err := io.ReadAll(strs[1])
+		So(err, ShouldBeNil)
+		ret1 = append(ret1, rest...)
+
+		So(ret0, ShouldResemble, data)
+		So(ret1, ShouldResemble, data)
+	})
+}
@@ -0,0 +1,45 @@
+package io2
+
+import (
+	"io"
+
+	"gitlink.org.cn/cloudream/common/utils/math2"
+)
+
+// 每次读取的最大字节数，避免一次读取太多数据导致限速不平滑
+const throttleQuantum = 32 * 1024
+
+type throttle struct {
+	inner io.ReadCloser
+	wait  func(n int) error
+	err   error
+}
+
+func (t *throttle) Read(p []byte) (int, error) {
+	if t.err != nil {
+		return 0, t.err
+	}
+
+	n, err := t.inner.Read(p[:math2.Min(len(p), throttleQuantum)])
+	if n > 0 {
+		if werr := t.wait(n); werr != nil {
+			// 已经读取到的数据仍然返回，下次读取时再返回错误
+			t.err = werr
+			return n, nil
+		}
+	}
+
+	return n, err
+}
+
+func (t *throttle) Close() error {
+	return t.inner.Close()
+}
+
+// 限制流的读取速度。每次从inner读取n个字节后，都会调用wait(n)，wait返回错误时，后续的读取都会返回此错误。
+func Throttle(inner io.ReadCloser, wait func(n int) error) io.ReadCloser {
+	return &throttle{
+		inner: inner,
+		wait:  wait,
+	}
+}
@@ -0,0 +1,45 @@
+package io2
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_Throttle(t *testing.T) {
+	Convey("每次读取后等待", t, func() {
+		data := make([]byte, throttleQuantum*2+10)
+		total := 0
+		calls := 0
+		str := Throttle(io.NopCloser(bytes.NewReader(data)), func(n int) error {
+			So(n, ShouldBeLessThanOrEqualTo, throttleQuantum)
+			total += n
+			calls++
+			return nil
+		})
+
+		got, err := io.ReadAll(str)
+		So(err, ShouldBeNil)
+		So(got, ShouldResemble, data)
+		So(total, ShouldEqual, len(data))
+		So(calls, ShouldBeGreaterThanOrEqualTo, 3)
+	})
+
+	Convey("等待出错时先返回已读取的数据", t, func() {
+		waitErr := errors.New("wait failed")
+		str := Throttle(io.NopCloser(bytes.NewReader([]byte{1, 2, 3})), func(n int) error {
+			return waitErr
+		})
+
+		buf := make([]byte, 10)
+		n, err := str.Read(buf)
+		So(err, ShouldBeNil)
+		So(buf[:n], ShouldResemble, []byte{1, 2, 3})
+
+		_, err = str.Read(buf)
+		So(err, ShouldEqual, waitErr)
+	})
+}
@@ -0,0 +1,250 @@
+package sync2
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 令牌桶。等待令牌的请求按照所属者（owner）分组，不同所属者之间轮流分配令牌，
+// 因此一个所属者发起再多的请求，也不会饿死其他所属者。同一个所属者的请求按先后顺序分配。
+type TokenBucket struct {
+	lock        sync.Mutex
+	rate        float64 // 每秒产生的令牌数，为0代表不限制
+	burst       int64   // 令牌桶的容量
+	tokens      float64
+	last        time.Time
+	owners      []*tokenOwner // 按照分配令牌的顺序排列，队头的所属者下一个获得令牌
+	dispatching bool
+	wakeup      chan any
+}
+
+type tokenOwner struct {
+	owner   any
+	waiters []*tokenWaiter
+}
+
+type tokenWaiter struct {
+	n       int64 // 还需要的令牌数
+	got     int64 // 已经分配到的令牌数，取消时需要归还
+	granted chan any
+}
+
+// rate：每秒产生的令牌数，为0代表不限制。burst：最多可以积攒的令牌数，为0则等于rate。
+func NewTokenBucket(rate int64, burst int64) *TokenBucket {
+	if burst <= 0 {
+		burst = rate
+	}
+
+	return &TokenBucket{
+		rate:   float64(rate),
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+		wakeup: make(chan any, 1),
+	}
+}
+
+// 修改速率和容量，对正在等待的请求同样生效
+func (b *TokenBucket) SetLimit(rate int64, burst int64) {
+	if burst <= 0 {
+		burst = rate
+	}
+
+	b.lock.Lock()
+	b.refill(time.Now())
+	b.rate = float64(rate)
+	b.burst = burst
+	if b.tokens > float64(burst) {
+		b.tokens = float64(burst)
+	}
+	b.lock.Unlock()
+
+	select {
+	case b.wakeup <- nil:
+	default:
+	}
+}
+
+func (b *TokenBucket) Limit() (rate int64, burst int64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return int64(b.rate), b.burst
+}
+
+// 获取n个令牌，令牌不足时等待。owner用于在多个请求者之间公平分配令牌，可以为nil。
+// 如果n大于桶的容量，则会分多次获取。
+func (b *TokenBucket) Acquire(ctx context.Context, owner any, n int64) error {
+	for n > 0 {
+		b.lock.Lock()
+		once := n
+		if b.burst > 0 && once > b.burst {
+			once = b.burst
+		}
+		b.lock.Unlock()
+
+		err := b.acquireOnce(ctx, owner, once)
+		if err != nil {
+			return err
+		}
+
+		n -= once
+	}
+
+	return nil
+}
+
+func (b *TokenBucket) acquireOnce(ctx context.Context, owner any, n int64) error {
+	b.lock.Lock()
+	if b.rate <= 0 {
+		b.lock.Unlock()
+		return nil
+	}
+
+	b.refill(time.Now())
+	// 没有其他人在等待时才能直接获取，否则需要排队，保证公平
+	if len(b.owners) == 0 && b.tokens >= float64(n) {
+		b.tokens -= float64(n)
+		b.lock.Unlock()
+		return nil
+	}
+
+	w := &tokenWaiter{
+		n:       n,
+		granted: make(chan any),
+	}
+	b.enqueue(owner, w)
+
+	if !b.dispatching {
+		b.dispatching = true
+		go b.dispatch()
+	}
+	b.lock.Unlock()
+
+	select {
+	case <-w.granted:
+		return nil
+
+	case <-ctx.Done():
+		b.lock.Lock()
+		defer b.lock.Unlock()
+
+		// 可能在取消的同时已经分配到了全部或者部分令牌，此时归还令牌
+		select {
+		case <-w.granted:
+		default:
+			b.remove(w)
+		}
+		b.tokens += float64(w.got)
+		if b.tokens > float64(b.burst) {
+			b.tokens = float64(b.burst)
+		}
+
+		return ctx.Err()
+	}
+}
+
+func (b *TokenBucket) enqueue(owner any, w *tokenWaiter) {
+	for _, o := range b.owners {
+		if o.owner == owner {
+			o.waiters = append(o.waiters, w)
+			return
+		}
+	}
+
+	b.owners = append(b.owners, &tokenOwner{
+		owner:   owner,
+		waiters: []*tokenWaiter{w},
+	})
+}
+
+func (b *TokenBucket) remove(w *tokenWaiter) {
+	for oi, o := range b.owners {
+		for wi, ow := range o.waiters {
+			if ow != w {
+				continue
+			}
+
+			o.waiters = append(o.waiters[:wi], o.waiters[wi+1:]...)
+			if len(o.waiters) == 0 {
+				b.owners = append(b.owners[:oi], b.owners[oi+1:]...)
+			}
+			return
+		}
+	}
+}
+
+func (b *TokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	b.last = now
+	if elapsed <= 0 {
+		return
+	}
+
+	b.tokens += elapsed * b.rate
+	if b.tokens > float64(b.burst) {
+		b.tokens = float64(b.burst)
+	}
+}
+
+func (b *TokenBucket) dispatch() {
+	for {
+		b.lock.Lock()
+		if len(b.owners) == 0 {
+			b.dispatching = false
+			b.lock.Unlock()
+			return
+		}
+
+		now := time.Now()
+		b.refill(now)
+
+		o := b.owners[0]
+		w := o.waiters[0]
+
+		// 速率被修改为不限制，则直接放行所有请求
+		if b.rate <= 0 {
+			b.grant(o, w, w.n)
+			b.lock.Unlock()
+			continue
+		}
+
+		// 容量可能在请求排队后被调小，此时每次最多分配容量大小的令牌，剩余的在之后的轮次中继续分配
+		need := w.n
+		if need > b.burst {
+			need = b.burst
+		}
+		if b.tokens >= float64(need) {
+			b.tokens -= float64(need)
+			b.grant(o, w, need)
+			b.lock.Unlock()
+			continue
+		}
+
+		wait := time.Duration((float64(need) - b.tokens) / b.rate * float64(time.Second))
+		b.lock.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-b.wakeup:
+			timer.Stop()
+		}
+	}
+}
+
+// 给队头的请求分配n个令牌。分配之后所属者移动到队尾，如果没有请求了则移除
+func (b *TokenBucket) grant(o *tokenOwner, w *tokenWaiter, n int64) {
+	w.n -= n
+	w.got += n
+	if w.n == 0 {
+		close(w.granted)
+		o.waiters = o.waiters[1:]
+	}
+
+	b.owners = b.owners[1:]
+	if len(o.waiters) > 0 {
+		b.owners = append(b.owners, o)
+	}
+}
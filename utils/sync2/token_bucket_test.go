@@ -0,0 +1,117 @@
+package sync2
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_TokenBucket(t *testing.T) {
+	ctx := context.Background()
+
+	Convey("令牌足够时直接获取", t, func() {
+		b := NewTokenBucket(1000, 100)
+
+		start := time.Now()
+		So(b.Acquire(ctx, nil, 100), ShouldBeNil)
+		So(time.Since(start), ShouldBeLessThan, 50*time.Millisecond)
+	})
+
+	Convey("超过容量的请求分多次获取", t, func() {
+		b := NewTokenBucket(1000, 100)
+
+		start := time.Now()
+		So(b.Acquire(ctx, nil, 300), ShouldBeNil)
+		So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 150*time.Millisecond)
+	})
+
+	Convey("不同所属者之间轮流分配", t, func() {
+		b := NewTokenBucket(1000, 100)
+		So(b.Acquire(ctx, nil, 100), ShouldBeNil)
+
+		var lock sync.Mutex
+		var order []string
+		var wg sync.WaitGroup
+		acquire := func(owner string, name string) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				b.Acquire(ctx, owner, 100)
+				lock.Lock()
+				order = append(order, name)
+				lock.Unlock()
+			}()
+			// 保证请求按顺序排队
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		acquire("a", "a1")
+		acquire("a", "a2")
+		acquire("a", "a3")
+		acquire("b", "b1")
+		wg.Wait()
+
+		So(order, ShouldResemble, []string{"a1", "b1", "a2", "a3"})
+	})
+
+	Convey("取消等待", t, func() {
+		b := NewTokenBucket(100, 100)
+		So(b.Acquire(ctx, nil, 100), ShouldBeNil)
+
+		cctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		So(errors.Is(b.Acquire(cctx, "a", 100), context.DeadlineExceeded), ShouldBeTrue)
+
+		// 被取消的请求不再占用队列，令牌也不会超过容量
+		time.Sleep(100 * time.Millisecond)
+		start := time.Now()
+		So(b.Acquire(ctx, "b", 10), ShouldBeNil)
+		So(time.Since(start), ShouldBeLessThan, 50*time.Millisecond)
+		So(b.tokens, ShouldBeLessThanOrEqualTo, 100)
+	})
+
+	Convey("排队后调小容量", t, func() {
+		b := NewTokenBucket(1000, 1000)
+		So(b.Acquire(ctx, nil, 1000), ShouldBeNil)
+
+		done := make(chan error, 1)
+		go func() {
+			cctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+			defer cancel()
+			done <- b.Acquire(cctx, nil, 800)
+		}()
+		time.Sleep(10 * time.Millisecond)
+
+		start := time.Now()
+		b.SetLimit(1000, 100)
+		So(<-done, ShouldBeNil)
+		So(time.Since(start), ShouldBeLessThan, 1500*time.Millisecond)
+
+		rate, burst := b.Limit()
+		So(rate, ShouldEqual, 1000)
+		So(burst, ShouldEqual, 100)
+	})
+
+	Convey("修改为不限制时放行所有请求", t, func() {
+		b := NewTokenBucket(10, 10)
+		So(b.Acquire(ctx, nil, 10), ShouldBeNil)
+
+		done := make(chan error, 1)
+		go func() {
+			done <- b.Acquire(ctx, nil, 1000)
+		}()
+		time.Sleep(10 * time.Millisecond)
+
+		b.SetLimit(0, 0)
+		select {
+		case err := <-done:
+			So(err, ShouldBeNil)
+		case <-time.After(time.Second):
+			So("not granted", ShouldBeEmpty)
+		}
+	})
+}